@@ -0,0 +1,54 @@
+#!/bin/bash
+
+if [ -z "$TB_ROOT_PATH" ]; then
+    SCRIPT_DIR=$(dirname "${BASH_SOURCE[0]-$0}")
+    export TB_ROOT_PATH=$(cd "$SCRIPT_DIR" && cd .. && pwd)
+fi
+
+TB_SELF_ENDPOINT=${TB_SELF_ENDPOINT:-localhost:1323}
+TB_API_USERNAME=${TB_API_USERNAME:-default}
+TB_API_PASSWORD=${TB_API_PASSWORD:-default}
+
+# colors
+RED='\033[0;31m'
+GREEN='\033[0;32m'
+BLUE='\033[0;34m'
+NC='\033[0m' # No Color
+
+usage() {
+    echo -e "Usage: $0 [-g]"
+    echo -e "  Re-encrypts secrets (SSH private keys, VM passwords, namespace secrets) in the kvstore with the active master key."
+    echo -e "  -g : generate a new master key in the local KMS keyring first (only when TB_SECRET_MASTER_KEY(_FILE) is not set)"
+    echo -e "\n  To rotate a key given by TB_SECRET_MASTER_KEY, set the new key there, move the old one to"
+    echo -e "  TB_SECRET_MASTER_KEY_PREVIOUS, restart CB-Tumblebug, and run this script without -g."
+}
+
+generate=false
+while getopts "gh" opt; do
+    case $opt in
+        g) generate=true ;;
+        *) usage; exit 1 ;;
+    esac
+done
+
+echo -e "\n${GREEN}Secret Key Rotation Script${NC}"
+echo -e "CB-Tumblebug: ${BLUE}http://$TB_SELF_ENDPOINT/tumblebug${NC} (generate a new key: $generate)\n"
+
+echo -e "[Master keys before rotation]"
+curl -s -u "$TB_API_USERNAME:$TB_API_PASSWORD" "http://$TB_SELF_ENDPOINT/tumblebug/secretKey"
+echo -e "\n"
+
+response=$(curl -s -w "\n%{http_code}" -X POST -u "$TB_API_USERNAME:$TB_API_PASSWORD" \
+    "http://$TB_SELF_ENDPOINT/tumblebug/secretKey/rotate?generate=$generate")
+body=$(echo "$response" | sed '$d')
+status=$(echo "$response" | tail -n1)
+
+if [ "$status" != "200" ]; then
+    echo -e "${RED}Failed to rotate the master key (HTTP $status)${NC}"
+    echo -e "$body\n"
+    exit 1
+fi
+
+echo -e "[Rotation result]"
+echo -e "$body\n"
+echo -e "${GREEN}Done.${NC}\n"
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// RestPostApiKey godoc
+// @ID PostApiKey
+// @Summary Create an API key
+// @Description Create an API key for the local auth mode (TB_AUTH_MODE=local) with a role, namespace grants and an expiry.
+// @Description The key is returned only in this response (only its hash is stored), so keep it safe.
+// @Description Send the key in the X-API-Key header or as a bearer token (Authorization: Bearer tbk_...).
+// @Tags [Admin] API Request Management
+// @Accept  json
+// @Produce  json
+// @Param apiKeyReq body model.ApiKeyReq true "Details of the API key"
+// @Success 200 {object} model.ApiKeyCreateResponse
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /auth/apiKey [post]
+func RestPostApiKey(c echo.Context) error {
+
+	u := &model.ApiKeyReq{}
+	if err := c.Bind(u); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	createdBy, _ := c.Get("name").(string)
+	content, err := common.CreateApiKey(u, createdBy)
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestGetAllApiKey godoc
+// @ID GetAllApiKey
+// @Summary List API keys
+// @Description List API keys including revoked and expired ones (the keys are not included)
+// @Tags [Admin] API Request Management
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} model.ApiKeyListResponse
+// @Failure 500 {object} model.SimpleMsg
+// @Router /auth/apiKey [get]
+func RestGetAllApiKey(c echo.Context) error {
+
+	content, err := common.ListApiKey()
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestGetApiKey godoc
+// @ID GetApiKey
+// @Summary Get an API key
+// @Description Get the details of an API key (the key is not included)
+// @Tags [Admin] API Request Management
+// @Accept  json
+// @Produce  json
+// @Param keyId path string true "API key ID"
+// @Success 200 {object} model.ApiKeyInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Router /auth/apiKey/{keyId} [get]
+func RestGetApiKey(c echo.Context) error {
+
+	content, err := common.GetApiKey(c.Param("keyId"))
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestDelApiKey godoc
+// @ID DelApiKey
+// @Summary Revoke an API key
+// @Description Revoke an API key. Requests with the revoked key are rejected immediately.
+// @Tags [Admin] API Request Management
+// @Accept  json
+// @Produce  json
+// @Param keyId path string true "API key ID"
+// @Success 200 {object} model.ApiKeyInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Router /auth/apiKey/{keyId} [delete]
+func RestDelApiKey(c echo.Context) error {
+
+	content, err := common.RevokeApiKey(c.Param("keyId"))
+	return common.EndRequestWithLog(c, err, content)
+}
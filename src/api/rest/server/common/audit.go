@@ -0,0 +1,76 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to handle REST API for common funcitonalities
+package common
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// RestGetAllAudit godoc
+// @ID GetAllAudit
+// @Summary List audit records
+// @Description List the audit records of mutating API calls (POST, PUT, PATCH, DELETE) with optional filters (latest first).
+// @Description Each record has the caller, namespace, resource path, redacted request body, result status, request ID and duration.
+// @Tags [Admin] API Request Management
+// @Accept  json
+// @Produce  json
+// @Param startTime query string false "Records at or after the time (RFC3339, e.g., 2024-07-01T00:00:00Z)"
+// @Param endTime query string false "Records at or before the time (RFC3339)"
+// @Param user query string false "Filter by the authenticated user"
+// @Param nsId query string false "Filter by namespace ID"
+// @Param resource query string false "Filter by the resource path (records whose path contains it, e.g., mci/mci01)"
+// @Param method query string false "Filter by HTTP method" Enums(POST, PUT, PATCH, DELETE)
+// @Param limit query int false "Max number of records (0 for all)" default(100)
+// @Success 200 {object} model.AuditListResponse
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /audit [get]
+func RestGetAllAudit(c echo.Context) error {
+
+	query := model.AuditQuery{
+		User:     c.QueryParam("user"),
+		NsId:     c.QueryParam("nsId"),
+		Resource: c.QueryParam("resource"),
+		Method:   c.QueryParam("method"),
+		Limit:    100,
+	}
+
+	var err error
+	if v := c.QueryParam("startTime"); v != "" {
+		if query.StartTime, err = time.Parse(time.RFC3339, v); err != nil {
+			return common.EndRequestWithLog(c, fmt.Errorf("startTime is not in RFC3339: %w", err), nil)
+		}
+	}
+	if v := c.QueryParam("endTime"); v != "" {
+		if query.EndTime, err = time.Parse(time.RFC3339, v); err != nil {
+			return common.EndRequestWithLog(c, fmt.Errorf("endTime is not in RFC3339: %w", err), nil)
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit < 0 {
+			return common.EndRequestWithLog(c, fmt.Errorf("limit must be a non-negative integer"), nil)
+		}
+	}
+
+	content, err := common.ListAudit(query)
+	return common.EndRequestWithLog(c, err, content)
+}
@@ -161,7 +161,8 @@ func RestInitAllConfig(c echo.Context) error {
 // RestGetRequest godoc
 // @ID GetRequest
 // @Summary Get request details
-// @Description Get details of a specific request
+// @Description Get details of a specific request. If the request runs as a job, the details are built from the persisted job
+// @Description (available from any Tumblebug instance, also after a restart).
 // @Tags [Admin] API Request Management
 // @Accept  json
 // @Produce  json
@@ -173,6 +174,11 @@ func RestInitAllConfig(c echo.Context) error {
 func RestGetRequest(c echo.Context) error {
 	reqId := c.Param("reqId")
 
+	// the job is the source of truth for the requests running as jobs
+	if job, err := common.GetJobOfRequest(reqId); err == nil {
+		return Send(c, http.StatusOK, requestDetailsFromJob(job))
+	}
+
 	if details, ok := common.RequestMap.Load(reqId); ok {
 		return Send(c, http.StatusOK, details)
 	}
@@ -180,6 +186,31 @@ func RestGetRequest(c echo.Context) error {
 	return SendMessage(c, http.StatusNotFound, "Request ID not found")
 }
 
+// requestDetailsFromJob converts a job to the details of the request that started it
+func requestDetailsFromJob(job model.JobInfo) common.RequestDetails {
+	details := common.RequestDetails{
+		StartTime: job.CreatedTime,
+		EndTime:   job.EndTime,
+		RequestInfo: common.RequestInfo{
+			Method: job.RequestMethod,
+			URL:    job.RequestUrl,
+			Body:   job.RequestBody,
+		},
+		ErrorResponse: job.Error,
+	}
+	switch job.Status {
+	case model.JobStatusSucceeded:
+		details.Status = "Success"
+		details.ResponseData = job.Result
+	case model.JobStatusFailed, model.JobStatusCanceled, model.JobStatusInterrupted:
+		details.Status = "Error"
+	default:
+		details.Status = "Handling"
+		details.ResponseData = job.Progress
+	}
+	return details
+}
+
 // RestGetAllRequests godoc
 // @ID GetAllRequests
 // @Summary Get all requests
@@ -255,10 +286,16 @@ func RestGetAllRequests(c echo.Context) error {
 func RestDeleteRequest(c echo.Context) error {
 	reqId := c.Param("reqId")
 
+	// a finished job of the request is deleted together
+	jobErr := common.DelJob(reqId)
+
 	if _, ok := common.RequestMap.Load(reqId); ok {
 		common.RequestMap.Delete(reqId)
 		return SendMessage(c, http.StatusOK, "Request deleted successfully")
 	}
+	if jobErr == nil {
+		return SendMessage(c, http.StatusOK, "Request deleted successfully")
+	}
 
 	return SendMessage(c, http.StatusNotFound, "Request ID not found")
 }
@@ -0,0 +1,59 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to handle REST API for common funcitonalities
+package common
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+)
+
+// RestGetAllSecretKey godoc
+// @ID GetAllSecretKey
+// @Summary List master keys for encryption at rest
+// @Description List the master keys encrypting the secrets in the kvstore (SSH private keys, VM passwords, namespace secrets).
+// @Description Only the key IDs (fingerprints) and their sources are returned; the keys themselves are never exposed.
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} model.SecretKeyListResponse
+// @Failure 500 {object} model.SimpleMsg
+// @Router /secretKey [get]
+func RestGetAllSecretKey(c echo.Context) error {
+	content, err := common.ListSecretKey()
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestPostRotateSecretKey godoc
+// @ID PostRotateSecretKey
+// @Summary Rotate the master key and re-encrypt secrets
+// @Description Re-encrypt the secrets of all records in the kvstore with the active master key
+// @Description (secrets stored in plain text before the encryption was introduced are encrypted as well).
+// @Description With generate=true, a new key is generated in the local KMS keyring and made active first
+// @Description (not allowed when the master key is given by TB_SECRET_MASTER_KEY or TB_SECRET_MASTER_KEY_FILE;
+// @Description in that case, set the new key there, move the old one to TB_SECRET_MASTER_KEY_PREVIOUS, restart, and rotate).
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param generate query bool false "Generate a new key in the local KMS keyring before re-encryption" default(false)
+// @Success 200 {object} model.SecretKeyRotationResult
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /secretKey/rotate [post]
+func RestPostRotateSecretKey(c echo.Context) error {
+	generate := c.QueryParam("generate") == "true"
+	content, err := common.RotateSecretKey(generate)
+	return common.EndRequestWithLog(c, err, content)
+}
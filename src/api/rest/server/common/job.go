@@ -0,0 +1,105 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to handle REST API for common funcitonalities
+package common
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// RestGetJob godoc
+// @ID GetJob
+// @Summary Get a job
+// @Description Get a long-running operation (job) with its status, progress and result.
+// @Description Jobs are persisted, so any Tumblebug instance can answer, also after a restart.
+// @Tags [Admin] API Request Management
+// @Accept  json
+// @Produce  json
+// @Param jobId path string true "Job ID (the id of the job in the response of the request)"
+// @Success 200 {object} model.JobInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /job/{jobId} [get]
+func RestGetJob(c echo.Context) error {
+
+	content, err := common.GetJob(c.Param("jobId"))
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestGetAllJob godoc
+// @ID GetAllJob
+// @Summary List jobs
+// @Description List long-running operations (jobs) with optional filters (latest first)
+// @Tags [Admin] API Request Management
+// @Accept  json
+// @Produce  json
+// @Param status query string false "Filter by job status" Enums(Queued, Running, Succeeded, Failed, Canceled, Interrupted)
+// @Param kind query string false "Filter by job kind" Enums(createMci, createMciDynamic, deleteMci, loadAssets, registerCspResourcesAll, createVpn, deleteVpn)
+// @Param nsId query string false "Filter by namespace ID"
+// @Param requestId query string false "Filter by the request ID (X-Request-ID header) of the request that started the job"
+// @Success 200 {object} model.JobListResponse
+// @Failure 500 {object} model.SimpleMsg
+// @Router /jobs [get]
+func RestGetAllJob(c echo.Context) error {
+
+	content, err := common.ListJob(c.QueryParam("status"), c.QueryParam("kind"), c.QueryParam("nsId"), c.QueryParam("requestId"))
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestPostCancelJob godoc
+// @ID PostCancelJob
+// @Summary Cancel a job
+// @Description Cancel a running job. The job stops at its next checkpoint and its status becomes Canceled.
+// @Description Only cancelable jobs (see the cancelable field) can be canceled.
+// @Tags [Admin] API Request Management
+// @Accept  json
+// @Produce  json
+// @Param jobId path string true "Job ID"
+// @Success 200 {object} model.JobInfo
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /job/{jobId}/cancel [post]
+func RestPostCancelJob(c echo.Context) error {
+
+	content, err := common.CancelJob(c.Param("jobId"))
+	if err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+	return common.EndRequestWithLog(c, nil, content)
+}
+
+// RestDelJob godoc
+// @ID DelJob
+// @Summary Delete a job
+// @Description Delete a finished job (finished jobs are also removed after TB_JOB_RETENTION_HOURS)
+// @Tags [Admin] API Request Management
+// @Accept  json
+// @Produce  json
+// @Param jobId path string true "Job ID"
+// @Success 200 {object} model.SimpleMsg
+// @Failure 400 {object} model.SimpleMsg
+// @Router /job/{jobId} [delete]
+func RestDelJob(c echo.Context) error {
+
+	jobId := c.Param("jobId")
+	err := common.DelJob(jobId)
+	if err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+	content := model.SimpleMsg{Message: "The job " + jobId + " has been deleted"}
+	return common.EndRequestWithLog(c, nil, content)
+}
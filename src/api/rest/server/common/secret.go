@@ -0,0 +1,97 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to handle REST API for common funcitonalities
+package common
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// RestPutSecret godoc
+// @ID PutSecret
+// @Summary Create or update a namespace secret
+// @Description Create or update a secret of the namespace. The value is never returned by the API
+// @Description and can be used in remote commands via $$Func(GetSecret(name)).
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param secretName path string true "Secret name" default(dbPassword)
+// @Param secretReq body model.SecretReq true "Secret value"
+// @Success 200 {object} model.SecretInfo
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/secret/{secretName} [put]
+func RestPutSecret(c echo.Context) error {
+
+	if err := Validate(c, []string{"nsId", "secretName"}); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	u := &model.SecretReq{}
+	if err := c.Bind(u); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	content, err := common.SetSecret(c.Param("nsId"), c.Param("secretName"), u)
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestGetAllSecret godoc
+// @ID GetAllSecret
+// @Summary List namespace secrets
+// @Description List the secrets of the namespace (names only, values are not included)
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Success 200 {object} model.SecretListResponse
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/secret [get]
+func RestGetAllSecret(c echo.Context) error {
+
+	if err := Validate(c, []string{"nsId"}); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	secretList, err := common.ListSecret(c.Param("nsId"))
+	content := model.SecretListResponse{Secret: secretList}
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestDelSecret godoc
+// @ID DelSecret
+// @Summary Delete a namespace secret
+// @Description Delete a secret of the namespace
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param secretName path string true "Secret name" default(dbPassword)
+// @Success 200 {object} model.SimpleMsg
+// @Failure 404 {object} model.SimpleMsg
+// @Router /ns/{nsId}/secret/{secretName} [delete]
+func RestDelSecret(c echo.Context) error {
+
+	if err := Validate(c, []string{"nsId", "secretName"}); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	err := common.DelSecret(c.Param("nsId"), c.Param("secretName"))
+	content := map[string]string{"message": "The secret " + c.Param("secretName") + " has been deleted"}
+	return common.EndRequestWithLog(c, err, content)
+}
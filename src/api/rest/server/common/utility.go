@@ -15,6 +15,7 @@ limitations under the License.
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,6 +25,7 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/infra"
@@ -77,15 +79,26 @@ func Validate(c echo.Context, params []string) error {
 // RestGetReadyz godoc
 // @Summary Check Tumblebug is ready
 // @Description Check Tumblebug is ready
+// @Description The circuit breakers of outbound endpoints (CB-Spider connections, CB-Dragonfly, ...) which are not closed are also listed.
+// @Description The leader among the Tumblebug instances sharing the kvstore (which runs the background controllers) is also reported.
 // @Tags [Admin] System Management
 // @Accept  json
 // @Produce  json
-// @Success 200 {object} model.SimpleMsg
-// @Failure 503 {object} model.SimpleMsg
+// @Success 200 {object} model.ReadyzResponse
+// @Failure 503 {object} model.ReadyzResponse
 // @Router /readyz [get]
 func RestGetReadyz(c echo.Context) error {
-	message := model.SimpleMsg{}
+	message := model.ReadyzResponse{}
 	message.Message = "CB-Tumblebug is ready"
+	message.CircuitBreakers = common.ListCircuitBreakerStatus(false)
+	message.IsLeader = common.IsLeader()
+	if leader, err := common.GetLeaderInfo(); err == nil {
+		message.Leader = leader
+	}
+	if common.IsShuttingDown() {
+		message.Message = "CB-Tumblebug is shutting down"
+		return c.JSON(http.StatusServiceUnavailable, &message)
+	}
 	if !model.SystemReady {
 		message.Message = "CB-Tumblebug is NOT ready"
 		return c.JSON(http.StatusServiceUnavailable, &message)
@@ -93,6 +106,24 @@ func RestGetReadyz(c echo.Context) error {
 	return c.JSON(http.StatusOK, &message)
 }
 
+// RestGetMetrics godoc
+// @ID GetMetrics
+// @Summary Get metrics of Tumblebug
+// @Description Get metrics of Tumblebug in the Prometheus text format.
+// @Description (HTTP requests per route, CB-Spider calls per connection, circuit breakers, client cache, kvstore operations,
+// @Description MCIs and VMs per status, VM provisioning durations per provider, MCI policy evaluations, Go runtime)
+// @Tags [Admin] System Management
+// @Produce  plain
+// @Success 200 {string} string "Metrics in the Prometheus text format"
+// @Router /metrics [get]
+func RestGetMetrics(c echo.Context) error {
+	metricsHandler.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// metricsHandler serves the metrics registered to the default Prometheus registry
+var metricsHandler = promhttp.Handler()
+
 // RestCheckHTTPVersion godoc
 // @ID CheckHTTPVersion
 // @Summary Check HTTP version of incoming request
@@ -548,7 +579,9 @@ type RestRegisterCspNativeResourcesRequestAll struct {
 // @Param Request body RestRegisterCspNativeResourcesRequestAll true "Specify NS Id and MCI Name"
 // @Param option query string false "Option to specify resourceType" Enums(onlyVm, exceptVm)
 // @Param mciFlag query string false "Flag to show VMs in a collective MCI form (y,n)" Enums(y, n) default(y)
+// @Param async query bool false "Run as a job and respond 202 with the job (check it with GET /job/{jobId})" default(false)
 // @Success 200 {object} model.RegisterResourceAllResult
+// @Success 202 {object} model.JobInfo
 // @Failure 404 {object} model.SimpleMsg
 // @Failure 500 {object} model.SimpleMsg
 // @Router /registerCspResourcesAll [post]
@@ -561,8 +594,10 @@ func RestRegisterCspNativeResourcesAll(c echo.Context) error {
 	option := c.QueryParam("option")
 	mciFlag := c.QueryParam("mciFlag")
 
-	content, err := infra.RegisterCspNativeResourcesAll(u.NsId, u.MciName, option, mciFlag)
-	return common.EndRequestWithLog(c, err, content)
+	spec := common.JobSpec{Kind: model.JobKindRegisterCspResource, NsId: u.NsId, TargetId: u.MciName}
+	return common.RunJob(c, spec, func(ctx context.Context) (interface{}, error) {
+		return infra.RegisterCspNativeResourcesAll(u.NsId, u.MciName, option, mciFlag)
+	})
 }
 
 // RestForwardAnyReqToAny godoc
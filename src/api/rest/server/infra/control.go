@@ -53,7 +53,7 @@ func RestGetControlMci(c echo.Context) error {
 
 	if action == "suspend" || action == "resume" || action == "reboot" || action == "terminate" || action == "refine" || action == "continue" || action == "withdraw" {
 
-		resultString, err := infra.HandleMciAction(nsId, mciId, action, forceOption)
+		resultString, err := infra.HandleMciAction(c.Request().Context(), nsId, mciId, action, forceOption)
 		if err != nil {
 			return common.EndRequestWithLog(c, err, returnObj)
 		}
@@ -99,7 +99,7 @@ func RestGetControlMciVm(c echo.Context) error {
 
 	if action == "suspend" || action == "resume" || action == "reboot" || action == "terminate" {
 
-		resultString, err := infra.HandleMciVmAction(nsId, mciId, vmId, action, forceOption)
+		resultString, err := infra.HandleMciVmAction(c.Request().Context(), nsId, mciId, vmId, action, forceOption)
 		if err != nil {
 			return common.EndRequestWithLog(c, err, returnObj)
 		}
@@ -112,6 +112,59 @@ func RestGetControlMciVm(c echo.Context) error {
 	}
 }
 
+// RestGetMciDrift godoc
+// @ID GetMciDrift
+// @Summary Get drift events of MCI
+// @Description Get drift events of VMs from the desired status of MCI, and the reconciliation taken for them
+// @Tags [MC-Infra] MCI Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param vmId query string false "VM ID (all VMs if empty)"
+// @Success 200 {object} model.MciDriftHistory
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/control/mci/{mciId}/drift [get]
+func RestGetMciDrift(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	vmId := c.QueryParam("vmId")
+
+	result, err := infra.GetMciDriftHistory(nsId, mciId, vmId)
+	return common.EndRequestWithLog(c, err, result)
+}
+
+// RestPostReconcileMci godoc
+// @ID PostReconcileMci
+// @Summary Reconcile MCI to its desired status
+// @Description Reconcile VMs of MCI to the desired status of MCI without waiting for the next reconciliation cycle
+// @Tags [MC-Infra] MCI Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Success 200 {object} model.MciDriftHistory
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/control/mci/{mciId}/reconcile [post]
+func RestPostReconcileMci(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+
+	events, err := infra.ReconcileMci(nsId, mciId)
+	if err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+	result := model.MciDriftHistory{NsId: nsId, MciId: mciId, Events: events}
+	if result.Events == nil {
+		result.Events = []model.MciDriftEvent{}
+	}
+	return common.EndRequestWithLog(c, err, result)
+}
+
 // RestPostMciVmSnapshot godoc
 // @ID PostMciVmSnapshot
 // @Summary Snapshot VM and create a Custom Image Object using the Snapshot
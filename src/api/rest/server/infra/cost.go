@@ -0,0 +1,116 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mci is to handle REST API for mci
+package infra
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/infra"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/labstack/echo/v4"
+)
+
+// RestGetNsCostReport godoc
+// @ID GetNsCostReport
+// @Summary Get the cost report of the namespace
+// @Description Get the estimated cost of VMs in the namespace over the time range, grouped by the grouping keys.
+// @Description The cost is estimated from the running intervals of VMs (accumulated from their status transitions) and costPerHour of their specs.
+// @Description VMs whose costPerHour is unknown are counted in unknownCostVms and excluded from estimatedCost.
+// @Tags [MC-Infra] MCI Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Produce  text/csv
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId query string false "Filter by MCI ID"
+// @Param startTime query string false "Start of the time range (RFC3339, default: the beginning of this month)"
+// @Param endTime query string false "End of the time range (RFC3339, default: now)"
+// @Param groupBy query string false "Comma-separated grouping keys (ns, mci, subGroup, vm, provider or label:<key>, e.g., mci,label:team)" default(mci)
+// @Param format query string false "Output format" Enums(json, csv) default(json)
+// @Success 200 {object} model.CostReport
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/costReport [get]
+func RestGetNsCostReport(c echo.Context) error {
+	return getCostReport(c, c.Param("nsId"))
+}
+
+// RestGetCostReport godoc
+// @ID GetCostReport
+// @Summary Get the cost report of all namespaces
+// @Description Get the estimated cost of VMs in all namespaces (or the given namespace) over the time range, grouped by the grouping keys.
+// @Description The cost is estimated from the running intervals of VMs (accumulated from their status transitions) and costPerHour of their specs.
+// @Tags [MC-Infra] MCI Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Produce  text/csv
+// @Param nsId query string false "Filter by namespace ID"
+// @Param mciId query string false "Filter by MCI ID"
+// @Param startTime query string false "Start of the time range (RFC3339, default: the beginning of this month)"
+// @Param endTime query string false "End of the time range (RFC3339, default: now)"
+// @Param groupBy query string false "Comma-separated grouping keys (ns, mci, subGroup, vm, provider or label:<key>, e.g., ns,label:project)" default(ns)
+// @Param format query string false "Output format" Enums(json, csv) default(json)
+// @Success 200 {object} model.CostReport
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /costReport [get]
+func RestGetCostReport(c echo.Context) error {
+	if c.QueryParam("groupBy") == "" {
+		c.QueryParams().Set("groupBy", model.CostGroupByNs)
+	}
+	return getCostReport(c, c.QueryParam("nsId"))
+}
+
+// getCostReport returns the cost report of the query parameters in JSON or CSV
+func getCostReport(c echo.Context, nsId string) error {
+	query := model.CostReportQuery{
+		NsId:  nsId,
+		MciId: c.QueryParam("mciId"),
+	}
+
+	var err error
+	if v := c.QueryParam("startTime"); v != "" {
+		if query.StartTime, err = time.Parse(time.RFC3339, v); err != nil {
+			return common.EndRequestWithLog(c, fmt.Errorf("startTime is not in RFC3339: %w", err), nil)
+		}
+	}
+	if v := c.QueryParam("endTime"); v != "" {
+		if query.EndTime, err = time.Parse(time.RFC3339, v); err != nil {
+			return common.EndRequestWithLog(c, fmt.Errorf("endTime is not in RFC3339: %w", err), nil)
+		}
+	}
+	for _, g := range strings.Split(c.QueryParam("groupBy"), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			query.GroupBy = append(query.GroupBy, g)
+		}
+	}
+	format := strings.ToLower(c.QueryParam("format"))
+	if format != "" && format != "json" && format != "csv" {
+		return common.EndRequestWithLog(c, fmt.Errorf("format %q is not supported (json or csv)", format), nil)
+	}
+
+	content, err := infra.GetCostReport(query)
+	if err != nil || format != "csv" {
+		return common.EndRequestWithLog(c, err, content)
+	}
+	csvData, err := infra.CostReportToCsv(content)
+	if err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+	return c.Blob(http.StatusOK, "text/csv; charset=utf-8", csvData)
+}
@@ -15,6 +15,7 @@ limitations under the License.
 package infra
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
@@ -68,7 +69,7 @@ func RestGetMci(c echo.Context) error {
 		return common.EndRequestWithLog(c, err, content)
 	} else if option == "status" {
 
-		result, err := infra.GetMciStatus(nsId, mciId)
+		result, err := infra.GetMciStatusWithContext(c.Request().Context(), nsId, mciId)
 		if err != nil {
 			return common.EndRequestWithLog(c, err, nil)
 		}
@@ -112,6 +113,7 @@ type RestGetAllMciStatusResponse struct {
 // @Produce  json
 // @Param nsId path string true "Namespace ID" default(default)
 // @Param option query string false "Option" Enums(id, simple, status)
+// @Param showSecret query bool false "Include secrets (vmUserPassword) of VMs in the list (redacted by default)" default(false)
 // @Success 200 {object} JSONResult{[DEFAULT]=RestGetAllMciResponse,[SIMPLE]=RestGetAllMciResponse,[ID]=model.IdList,[STATUS]=RestGetAllMciStatusResponse} "Different return structures by the given option param"
 // @Failure 404 {object} model.SimpleMsg
 // @Failure 500 {object} model.SimpleMsg
@@ -120,6 +122,7 @@ func RestGetAllMci(c echo.Context) error {
 
 	nsId := c.Param("nsId")
 	option := c.QueryParam("option")
+	showSecret := c.QueryParam("showSecret") == "true"
 
 	if option == "id" {
 		// return MCI IDs
@@ -142,6 +145,9 @@ func RestGetAllMci(c echo.Context) error {
 		if err != nil {
 			return common.EndRequestWithLog(c, err, nil)
 		}
+		if !showSecret {
+			redactMciSecrets(result)
+		}
 		content := RestGetAllMciResponse{}
 		content.Mci = result
 		return common.EndRequestWithLog(c, err, content)
@@ -151,12 +157,24 @@ func RestGetAllMci(c echo.Context) error {
 		if err != nil {
 			return common.EndRequestWithLog(c, err, nil)
 		}
+		if !showSecret {
+			redactMciSecrets(result)
+		}
 		content := RestGetAllMciResponse{}
 		content.Mci = result
 		return common.EndRequestWithLog(c, err, content)
 	}
 }
 
+// redactMciSecrets clears the secrets of VMs in the list of MCIs
+func redactMciSecrets(mciList []model.TbMciInfo) {
+	for i := range mciList {
+		for j := range mciList[i].Vm {
+			mciList[i].Vm[j].VmUserPassword = ""
+		}
+	}
+}
+
 /*
 	function RestPutMci not yet implemented
 
@@ -187,7 +205,9 @@ func RestPutMci(c echo.Context) error {
 // @Param nsId path string true "Namespace ID" default(default)
 // @Param mciId path string true "MCI ID" default(mci01)
 // @Param option query string false "Option for delete MCI (support force delete)" Enums(terminate,force)
+// @Param async query bool false "Run as a job and respond 202 with the job (check it with GET /job/{jobId})" default(false)
 // @Success 200 {object} model.IdList
+// @Success 202 {object} model.JobInfo
 // @Failure 404 {object} model.SimpleMsg
 // @Router /ns/{nsId}/mci/{mciId} [delete]
 func RestDelMci(c echo.Context) error {
@@ -196,8 +216,11 @@ func RestDelMci(c echo.Context) error {
 	mciId := c.Param("mciId")
 	option := c.QueryParam("option")
 
-	content, err := infra.DelMci(nsId, mciId, option)
-	return common.EndRequestWithLog(c, err, content)
+	spec := common.JobSpec{Kind: model.JobKindDeleteMci, NsId: nsId, TargetId: mciId}
+	return common.RunJob(c, spec, func(ctx context.Context) (interface{}, error) {
+		content, err := infra.DelMci(nsId, mciId, option)
+		return &content, err
+	})
 }
 
 // RestDelAllMci godoc
@@ -15,11 +15,13 @@ limitations under the License.
 package infra
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	networkSiteModel "github.com/cloud-barista/cb-tumblebug/src/api/rest/server/model"
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
@@ -28,7 +30,6 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
 	terrariumModel "github.com/cloud-barista/mc-terrarium/pkg/api/rest/model"
-	"github.com/go-resty/resty/v2"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
 )
@@ -219,7 +220,9 @@ func ExtractSitesInfoFromMciInfo(nsId, mciId string) (*networkSiteModel.SitesInf
 // @Param mciId path string true "MCI ID" default(mci01)
 // @Param vpnId path string true "VPN ID" default(vpn01)
 // @Param vpnReq body model.RestPostVpnRequest true "Sites info for VPN configuration"
+// @Param async query bool false "Run as a job and respond 202 with the job (check it with GET /job/{jobId})" default(false)
 // @Success 200 {object} model.SimpleMsg "OK"
+// @Success 202 {object} model.JobInfo "Accepted"
 // @Failure 400 {object} model.SimpleMsg "Bad Request"
 // @Failure 500 {object} model.SimpleMsg "Internal Server Error"
 // @Failure 503 {object} model.SimpleMsg "Service Unavailable"
@@ -278,13 +281,19 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, res)
 	}
 
-	// Prepare for streaming response
-	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	c.Response().WriteHeader(http.StatusOK)
-	enc := json.NewEncoder(c.Response())
+	spec := common.JobSpec{Kind: model.JobKindCreateVpn, NsId: nsId, TargetId: vpnId, Cancelable: true}
+	return runVpnJob(c, spec, func(ctx context.Context, emit func(res model.SimpleMsg) error) error {
+		return createSiteToSiteVpn(ctx, nsId, mciId, vpnId, vpnReq, emit)
+	})
+}
+
+// createSiteToSiteVpn creates a site-to-site VPN through CB-Terrarium and emits the messages of each step
+func createSiteToSiteVpn(ctx context.Context, nsId string, mciId string, vpnId string, vpnReq *networkSiteModel.RestPostVpnRequest, emit func(res model.SimpleMsg) error) error {
 
 	// Initialize resty client with basic auth
-	client := resty.New()
+	// (applying and destroying the VPN infrastructure can take long)
+	client := common.NewHttpClient()
+	client.SetTimeout(60 * time.Minute)
 	apiUser := os.Getenv("TB_API_USERNAME")
 	apiPass := os.Getenv("TB_API_PASSWORD")
 	client.SetBasicAuth(apiUser, apiPass)
@@ -300,7 +309,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 	requestBody := common.NoBody
 	resReadyz := new(networkSiteModel.Response)
 
-	err := common.ExecuteHttpRequest(
+	err := common.ExecuteHttpRequestWithContext(
+		ctx,
 		client,
 		method,
 		url,
@@ -313,10 +323,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 	if err != nil {
 		log.Err(err).Msg("")
-		res := model.SimpleMsg{
-			Message: err.Error(),
-		}
-		return c.JSON(http.StatusServiceUnavailable, res)
+		return err
 	}
 	log.Debug().Msgf("resReadyz: %+v", resReadyz.Message)
 
@@ -324,10 +331,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 	res := model.SimpleMsg{
 		Message: resReadyz.Message,
 	}
-	if err := enc.Encode(res); err != nil {
+	if err := emit(res); err != nil {
 		return err
 	}
-	c.Response().Flush()
 
 	cspSet := whichCspSet(vpnReq.Site1.CSP, vpnReq.Site2.CSP)
 
@@ -344,7 +350,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		resTrInfo := new(terrariumModel.TerrariumInfo)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -357,8 +364,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resTrInfo.Id: %s", resTrInfo.Id)
@@ -368,10 +374,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: "successully created a terrarium (trId: " + resTrInfo.Id + ")",
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 
 		// init env
 		method = "POST"
@@ -379,7 +384,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		requestBody = common.NoBody
 		resTerrariumEnv := new(networkSiteModel.Response)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -392,8 +398,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resInit: %+v", resTerrariumEnv.Message)
@@ -403,10 +408,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: resTerrariumEnv.Message,
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 
 		// generate infracode
 		method = "POST"
@@ -429,7 +433,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		resInfracode := new(networkSiteModel.Response)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -442,8 +447,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resInfracode: %+v", resInfracode.Message)
@@ -453,10 +457,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: resInfracode.Message,
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 
 		// check the infracode by plan
 		method = "POST"
@@ -464,7 +467,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		requestBody = common.NoBody
 		resPlan := new(networkSiteModel.Response)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -477,8 +481,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resPlan: %+v", resPlan.Message)
@@ -488,10 +491,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: resPlan.Message,
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 
 		// apply
 		// wait until the task is completed
@@ -502,7 +504,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		requestBody = common.NoBody
 		resApply := new(networkSiteModel.Response)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -515,8 +518,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resApply: %+v", resApply.Message)
@@ -526,10 +528,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: resApply.Message,
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 	case "gcp,azure", "azure,gcp":
 		// issue a terrarium
 		method = "POST"
@@ -540,7 +541,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		resTrInfo := new(terrariumModel.TerrariumInfo)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -553,8 +555,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resTrInfo.Id: %s", resTrInfo.Id)
@@ -564,10 +565,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: "successully created a terrarium (trId: " + resTrInfo.Id + ")",
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 
 		// init env
 		method = "POST"
@@ -575,7 +575,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		requestBody = common.NoBody
 		resTerrariumEnv := new(networkSiteModel.Response)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -588,8 +589,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resInit: %+v", resTerrariumEnv.Message)
@@ -599,10 +599,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: resTerrariumEnv.Message,
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 
 		// generate infracode
 		method = "POST"
@@ -631,7 +630,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		resInfracode := new(networkSiteModel.Response)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -644,8 +644,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resInfracode: %+v", resInfracode.Message)
@@ -655,10 +654,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: resInfracode.Message,
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 
 		// check the infracode by plan
 		method = "POST"
@@ -666,7 +664,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		requestBody = common.NoBody
 		resPlan := new(networkSiteModel.Response)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -679,8 +678,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resPlan: %+v", resPlan.Message)
@@ -690,10 +688,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: resPlan.Message,
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 
 		// apply
 		// wait until the task is completed
@@ -704,7 +701,8 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		requestBody = common.NoBody
 		resApply := new(networkSiteModel.Response)
 
-		err = common.ExecuteHttpRequest(
+		err = common.ExecuteHttpRequestWithContext(
+			ctx,
 			client,
 			method,
 			url,
@@ -717,8 +715,7 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 
 		if err != nil {
 			log.Err(err).Msg("")
-			res := model.SimpleMsg{Message: err.Error()}
-			return c.JSON(http.StatusInternalServerError, res)
+			return err
 		}
 
 		log.Debug().Msgf("resApply: %+v", resApply.Message)
@@ -728,10 +725,9 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 		res = model.SimpleMsg{
 			Message: resApply.Message,
 		}
-		if err := enc.Encode(res); err != nil {
+		if err := emit(res); err != nil {
 			return err
 		}
-		c.Response().Flush()
 
 	default:
 		log.Warn().Msgf("not valid CSP set: %s", cspSet)
@@ -740,6 +736,61 @@ func RestPostSiteToSiteVpn(c echo.Context) error {
 	return nil
 }
 
+// runVpnJob runs a VPN operation as a job. The messages of each step are streamed in the response,
+// or recorded as the progress of the job with ?async=true (responds 202 with the job).
+func runVpnJob(c echo.Context, spec common.JobSpec, op func(ctx context.Context, emit func(res model.SimpleMsg) error) error) error {
+	reqID := c.Request().Header.Get(echo.HeaderXRequestID)
+	async := c.QueryParam("async") == "true"
+
+	var enc *json.Encoder
+	if !async {
+		// Prepare for streaming response
+		c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c.Response().WriteHeader(http.StatusOK)
+		enc = json.NewEncoder(c.Response())
+	}
+
+	var opErr error
+	job, done, err := common.StartJobForRequest(c, spec, func(ctx context.Context) (interface{}, error) {
+		messages := []model.SimpleMsg{}
+		opErr = op(ctx, func(res model.SimpleMsg) error {
+			// each step is a checkpoint to cancel the job
+			if err := ctx.Err(); err != nil {
+				return common.ErrJobCanceled
+			}
+			messages = append(messages, res)
+			common.UpdateRequestProgress(reqID, common.ProgressInfo{Title: res.Message, Time: time.Now()})
+			if enc == nil {
+				return nil
+			}
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+			c.Response().Flush()
+			return nil
+		})
+		return messages, opErr
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		if async {
+			return common.EndRequestWithLog(c, err, nil)
+		}
+		return enc.Encode(model.SimpleMsg{Message: err.Error()})
+	}
+
+	if async {
+		c.Response().Header().Set(echo.HeaderLocation, "/tumblebug/job/"+job.Id)
+		return c.JSON(http.StatusAccepted, job)
+	}
+
+	<-done
+	if opErr != nil {
+		return enc.Encode(model.SimpleMsg{Message: opErr.Error()})
+	}
+	return nil
+}
+
 var validCspSet = map[string]bool{
 	"aws,gcp":   true,
 	"gcp,aws":   true,
@@ -771,7 +822,9 @@ func whichCspSet(csp1, csp2 string) string {
 // @Param nsId path string true "Namespace ID" default(default)
 // @Param mciId path string true "MCI ID" default(mci01)
 // @Param vpnId path string true "VPN ID" default(vpn01)
+// @Param async query bool false "Run as a job and respond 202 with the job (check it with GET /job/{jobId})" default(false)
 // @Success 200 {object} model.SimpleMsg "OK"
+// @Success 202 {object} model.JobInfo "Accepted"
 // @Failure 400 {object} model.SimpleMsg "Bad Request"
 // @Failure 500 {object} model.SimpleMsg "Internal Server Error"
 // @Failure 503 {object} model.SimpleMsg "Service Unavailable"
@@ -808,13 +861,19 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, res)
 	}
 
-	// Prepare for streaming response
-	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	c.Response().WriteHeader(http.StatusOK)
-	enc := json.NewEncoder(c.Response())
+	spec := common.JobSpec{Kind: model.JobKindDeleteVpn, NsId: nsId, TargetId: vpnId, Cancelable: true}
+	return runVpnJob(c, spec, func(ctx context.Context, emit func(res model.SimpleMsg) error) error {
+		return deleteSiteToSiteVpn(ctx, nsId, mciId, vpnId, emit)
+	})
+}
+
+// deleteSiteToSiteVpn deletes a site-to-site VPN through CB-Terrarium and emits the messages of each step
+func deleteSiteToSiteVpn(ctx context.Context, nsId string, mciId string, vpnId string, emit func(res model.SimpleMsg) error) error {
 
 	// Initialize resty client with basic auth
-	client := resty.New()
+	// (applying and destroying the VPN infrastructure can take long)
+	client := common.NewHttpClient()
+	client.SetTimeout(60 * time.Minute)
 	apiUser := os.Getenv("TB_API_USERNAME")
 	apiPass := os.Getenv("TB_API_PASSWORD")
 	client.SetBasicAuth(apiUser, apiPass)
@@ -830,7 +889,8 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	requestBody := common.NoBody
 	resReadyz := new(networkSiteModel.Response)
 
-	err := common.ExecuteHttpRequest(
+	err := common.ExecuteHttpRequestWithContext(
+		ctx,
 		client,
 		method,
 		url,
@@ -843,10 +903,7 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 
 	if err != nil {
 		log.Err(err).Msg("")
-		res := model.SimpleMsg{
-			Message: err.Error(),
-		}
-		return c.JSON(http.StatusServiceUnavailable, res)
+		return err
 	}
 	log.Debug().Msgf("resReadyz: %+v", resReadyz.Message)
 	log.Trace().Msgf("resReadyz: %+v", resReadyz.Detail)
@@ -855,10 +912,9 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	res := model.SimpleMsg{
 		Message: resReadyz.Message,
 	}
-	if err := enc.Encode(res); err != nil {
+	if err := emit(res); err != nil {
 		return err
 	}
-	c.Response().Flush()
 
 	// Get the terrarium info
 	method = "GET"
@@ -866,7 +922,8 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	requestBody = common.NoBody
 	resTrInfo := new(terrariumModel.TerrariumInfo)
 
-	err = common.ExecuteHttpRequest(
+	err = common.ExecuteHttpRequestWithContext(
+		ctx,
 		client,
 		method,
 		url,
@@ -879,8 +936,7 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 
 	if err != nil {
 		log.Err(err).Msg("")
-		res := model.SimpleMsg{Message: err.Error()}
-		return c.JSON(http.StatusInternalServerError, res)
+		return err
 	}
 
 	log.Debug().Msgf("resTrInfo.Id: %s", resTrInfo.Id)
@@ -892,10 +948,9 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	res = model.SimpleMsg{
 		Message: msg,
 	}
-	if err := enc.Encode(res); err != nil {
+	if err := emit(res); err != nil {
 		return err
 	}
-	c.Response().Flush()
 
 	// delete enrichments
 	method = "DELETE"
@@ -903,7 +958,8 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	requestBody = common.NoBody
 	resDeleteEnrichments := new(networkSiteModel.Response)
 
-	err = common.ExecuteHttpRequest(
+	err = common.ExecuteHttpRequestWithContext(
+		ctx,
 		client,
 		method,
 		url,
@@ -916,8 +972,7 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 
 	if err != nil {
 		log.Err(err).Msg("")
-		res := model.SimpleMsg{Message: err.Error()}
-		return c.JSON(http.StatusInternalServerError, res)
+		return err
 	}
 
 	log.Debug().Msgf("resDeleteEnrichments: %+v", resDeleteEnrichments.Message)
@@ -927,10 +982,9 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	res = model.SimpleMsg{
 		Message: resDeleteEnrichments.Message,
 	}
-	if err := enc.Encode(res); err != nil {
+	if err := emit(res); err != nil {
 		return err
 	}
-	c.Response().Flush()
 
 	// delete env
 	method = "DELETE"
@@ -938,7 +992,8 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	requestBody = common.NoBody
 	resDeleteEnv := new(networkSiteModel.Response)
 
-	err = common.ExecuteHttpRequest(
+	err = common.ExecuteHttpRequestWithContext(
+		ctx,
 		client,
 		method,
 		url,
@@ -951,8 +1006,7 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 
 	if err != nil {
 		log.Err(err).Msg("")
-		res := model.SimpleMsg{Message: err.Error()}
-		return c.JSON(http.StatusInternalServerError, res)
+		return err
 	}
 
 	log.Debug().Msgf("resDeleteEnv: %+v", resDeleteEnv.Message)
@@ -962,10 +1016,9 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	res = model.SimpleMsg{
 		Message: resDeleteEnv.Message,
 	}
-	if err := enc.Encode(res); err != nil {
+	if err := emit(res); err != nil {
 		return err
 	}
-	c.Response().Flush()
 
 	// delete terrarium
 	method = "DELETE"
@@ -973,7 +1026,8 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	requestBody = common.NoBody
 	resDeleteTr := new(networkSiteModel.Response)
 
-	err = common.ExecuteHttpRequest(
+	err = common.ExecuteHttpRequestWithContext(
+		ctx,
 		client,
 		method,
 		url,
@@ -986,8 +1040,7 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 
 	if err != nil {
 		log.Err(err).Msg("")
-		res := model.SimpleMsg{Message: err.Error()}
-		return c.JSON(http.StatusInternalServerError, res)
+		return err
 	}
 
 	log.Debug().Msgf("resDeleteTr: %+v", resDeleteTr.Message)
@@ -997,10 +1050,9 @@ func RestDeleteSiteToSiteVpn(c echo.Context) error {
 	res = model.SimpleMsg{
 		Message: resDeleteTr.Message,
 	}
-	if err := enc.Encode(res); err != nil {
+	if err := emit(res); err != nil {
 		return err
 	}
-	c.Response().Flush()
 
 	return nil
 }
@@ -1192,7 +1244,7 @@ func RestGetSiteToSiteVpn(c echo.Context) error {
 	}
 
 	// Initialize resty client with basic auth
-	client := resty.New()
+	client := common.NewHttpClient()
 	apiUser := os.Getenv("TB_API_USERNAME")
 	apiPass := os.Getenv("TB_API_PASSWORD")
 	client.SetBasicAuth(apiUser, apiPass)
@@ -1208,7 +1260,8 @@ func RestGetSiteToSiteVpn(c echo.Context) error {
 	requestBody := common.NoBody
 	resReadyz := new(networkSiteModel.Response)
 
-	err := common.ExecuteHttpRequest(
+	err := common.ExecuteHttpRequestWithContext(
+		c.Request().Context(),
 		client,
 		method,
 		url,
@@ -1235,7 +1288,8 @@ func RestGetSiteToSiteVpn(c echo.Context) error {
 	requestBody = common.NoBody
 	resTrInfo := new(terrariumModel.TerrariumInfo)
 
-	err = common.ExecuteHttpRequest(
+	err = common.ExecuteHttpRequestWithContext(
+		c.Request().Context(),
 		client,
 		method,
 		url,
@@ -1262,7 +1316,8 @@ func RestGetSiteToSiteVpn(c echo.Context) error {
 	requestBody = common.NoBody
 	resResourceInfo := new(networkSiteModel.Response)
 
-	err = common.ExecuteHttpRequest(
+	err = common.ExecuteHttpRequestWithContext(
+		c.Request().Context(),
 		client,
 		method,
 		url,
@@ -1370,7 +1425,7 @@ func RestGetRequestStatusOfSiteToSiteVpn(c echo.Context) error {
 	}
 
 	// Initialize resty client with basic auth
-	client := resty.New()
+	client := common.NewHttpClient()
 	apiUser := os.Getenv("TB_API_USERNAME")
 	apiPass := os.Getenv("TB_API_PASSWORD")
 	client.SetBasicAuth(apiUser, apiPass)
@@ -1386,7 +1441,8 @@ func RestGetRequestStatusOfSiteToSiteVpn(c echo.Context) error {
 	requestBody := common.NoBody
 	resTrInfo := new(terrariumModel.TerrariumInfo)
 
-	err := common.ExecuteHttpRequest(
+	err := common.ExecuteHttpRequestWithContext(
+		c.Request().Context(),
 		client,
 		method,
 		url,
@@ -1413,7 +1469,8 @@ func RestGetRequestStatusOfSiteToSiteVpn(c echo.Context) error {
 	reqReqStatus := common.NoBody
 	resReqStatus := new(networkSiteModel.Response)
 
-	err = common.ExecuteHttpRequest(
+	err = common.ExecuteHttpRequestWithContext(
+		c.Request().Context(),
 		client,
 		method,
 		url,
@@ -115,6 +115,30 @@ func RestGetAllMciPolicy(c echo.Context) error {
 	return common.EndRequestWithLog(c, err, content)
 }
 
+// RestGetMciPolicyHistory godoc
+// @ID GetMciPolicyHistory
+// @Summary Get history of MCI Policy
+// @Description Get history of evaluations and actions of MCI Policy
+// @Tags [MC-Infra] MCI Orchestration Management (WIP)
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param policyId query string false "Policy ID (all policies if empty)" default(policy01)
+// @Success 200 {object} model.PolicyHistory
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/policy/mci/{mciId}/history [get]
+func RestGetMciPolicyHistory(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	policyId := c.QueryParam("policyId")
+
+	result, err := infra.GetMciPolicyHistory(nsId, mciId, policyId)
+	return common.EndRequestWithLog(c, err, result)
+}
+
 /*
 	function RestPutMciPolicy not yet implemented
 
@@ -15,7 +15,7 @@ limitations under the License.
 package infra
 
 import (
-	"net/http"
+	"context"
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/infra"
@@ -33,7 +33,9 @@ import (
 // @Produce  json
 // @Param nsId path string true "Namespace ID" default(default)
 // @Param mciReq body model.TbMciReq true "Details for an MCI object"
+// @Param async query bool false "Run as a job and respond 202 with the job (check it with GET /job/{jobId})" default(false)
 // @Success 200 {object} model.TbMciInfo
+// @Success 202 {object} model.JobInfo
 // @Failure 404 {object} model.SimpleMsg
 // @Failure 500 {object} model.SimpleMsg
 // @Router /ns/{nsId}/mci [post]
@@ -47,8 +49,10 @@ func RestPostMci(c echo.Context) error {
 	}
 
 	option := "create"
-	result, err := infra.CreateMci(nsId, req, option)
-	return common.EndRequestWithLog(c, err, result)
+	spec := common.JobSpec{Kind: model.JobKindCreateMci, NsId: nsId, TargetId: req.Name}
+	return common.RunJob(c, spec, func(ctx context.Context) (interface{}, error) {
+		return infra.CreateMci(ctx, nsId, req, option)
+	})
 }
 
 // RestPostRegisterCSPNativeVM godoc
@@ -74,7 +78,7 @@ func RestPostRegisterCSPNativeVM(c echo.Context) error {
 	}
 
 	option := "register"
-	result, err := infra.CreateMci(nsId, req, option)
+	result, err := infra.CreateMci(c.Request().Context(), nsId, req, option)
 	return common.EndRequestWithLog(c, err, result)
 }
 
@@ -113,8 +117,10 @@ func RestPostSystemMci(c echo.Context) error {
 // @Param nsId path string true "Namespace ID" default(default)
 // @Param mciReq body model.TbMciDynamicReq true "Request body to provision MCI dynamically. Must include commonSpec and commonImage info of each VM request.(ex: {name: mci01,vm: [{commonImage: aws+ap-northeast-2+ubuntu22.04,commonSpec: aws+ap-northeast-2+t2.small}]} ) You can use /mciRecommendVm and /mciDynamicCheckRequest to get it) Check the guide: https://github.com/cloud-barista/cb-tumblebug/discussions/1570"
 // @Param option query string false "Option for MCI creation" Enums(hold)
+// @Param async query bool false "Run as a job and respond 202 with the job (check it with GET /job/{jobId})" default(false)
 // @Param x-request-id header string false "Custom request ID"
 // @Success 200 {object} model.TbMciInfo
+// @Success 202 {object} model.JobInfo
 // @Failure 404 {object} model.SimpleMsg
 // @Failure 500 {object} model.SimpleMsg
 // @Router /ns/{nsId}/mciDynamic [post]
@@ -130,12 +136,44 @@ func RestPostMciDynamic(c echo.Context) error {
 		return common.EndRequestWithLog(c, err, nil)
 	}
 
-	result, err := infra.CreateMciDynamic(reqID, nsId, req, option)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to create MCI dynamically")
+	// the job is cancelable until the VMs are provisioned
+	spec := common.JobSpec{Kind: model.JobKindCreateMciDynamic, NsId: nsId, TargetId: req.Name, Cancelable: true}
+	return common.RunJob(c, spec, func(ctx context.Context) (interface{}, error) {
+		result, err := infra.CreateMciDynamic(ctx, reqID, nsId, req, option)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to create MCI dynamically")
+			return nil, err
+		}
+		return result, nil
+	})
+}
+
+// RestPostMciDynamicReview godoc
+// @ID PostMciDynamicReview
+// @Summary Review request to create MCI dynamically (dry-run)
+// @Description Review the request to create MCI dynamically without calling CSPs.
+// @Description It resolves spec and image of each VM, validates the image against the spec and the root disk against the provider rules,
+// @Description reports shared resources (vNet, sshKey, securityGroup) to be created or reused, and estimates the hourly and monthly cost.
+// @Tags [MC-Infra] MCI Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciReq body model.TbMciDynamicReq true "Request body to provision MCI dynamically"
+// @Success 200 {object} model.ReviewMciDynamicReqInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/mciDynamicReview [post]
+func RestPostMciDynamicReview(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+
+	req := &model.TbMciDynamicReq{}
+	if err := c.Bind(req); err != nil {
 		return common.EndRequestWithLog(c, err, nil)
 	}
-	return c.JSON(http.StatusOK, result)
+
+	result, err := infra.ReviewMciDynamicReq(nsId, req)
+	return common.EndRequestWithLog(c, err, result)
 }
 
 // RestPostMciVmDynamic godoc
@@ -245,3 +283,34 @@ func RestPostMciSubGroupScaleOut(c echo.Context) error {
 	result, err := infra.ScaleOutMciSubGroup(nsId, mciId, subgroupId, scaleOutReq.NumVMsToAdd)
 	return common.EndRequestWithLog(c, err, result)
 }
+
+// RestPostMciSubGroupScaleIn godoc
+// @ID PostMciSubGroupScaleIn
+// @Summary ScaleIn subGroup in specified MCI
+// @Description ScaleIn subGroup in specified MCI to the target size.
+// @Description VMs to remove are selected by the strategy (newest, oldest, leastLoaded, zone), drained from NLBs, and terminated.
+// @Tags [MC-Infra] MCI Provisioning and Management
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param subgroupId path string true "subGroup ID" default(g1)
+// @Param scaleInReq body model.TbScaleInSubGroupReq true "subGroup scaleIn request"
+// @Success 200 {object} model.TbMciInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/mci/{mciId}/subgroup/{subgroupId}/scaleIn [post]
+func RestPostMciSubGroupScaleIn(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	subgroupId := c.Param("subgroupId")
+
+	scaleInReq := &model.TbScaleInSubGroupReq{}
+	if err := c.Bind(scaleInReq); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	result, err := infra.ScaleInMciSubGroup(nsId, mciId, subgroupId, scaleInReq)
+	return common.EndRequestWithLog(c, err, result)
+}
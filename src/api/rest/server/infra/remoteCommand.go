@@ -15,28 +15,38 @@ limitations under the License.
 package infra
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/infra"
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
 )
 
 // RestPostCmdMci godoc
 // @ID PostCmdMci
 // @Summary Send a command to specified MCI
 // @Description Send a command to specified MCI
+// @Description With stream=true, the output is streamed as JSON lines (model.SshCmdStreamEvent) as it arrives:
+// @Description stdout/stderr lines per VM, a vmDone event per VM, and an end event.
+// @Description A running command can be cancelled with its request ID (x-request-id) via DELETE /ns/{nsId}/cmd/{reqId}.
 // @Tags [MC-Infra] MCI Remote Command
 // @Accept  json
 // @Produce  json
+// @Produce  json-stream
 // @Param nsId path string true "Namespace ID" default(default)
 // @Param mciId path string true "MCI ID" default(mci01)
 // @Param mciCmdReq body model.MciCmdReq true "MCI Command Request"
 // @Param subGroupId query string false "subGroupId to apply the command only for VMs in subGroup of MCI" default(g1)
 // @Param vmId query string false "vmId to apply the command only for a VM in MCI" default(g1-1)
+// @Param stream query bool false "Stream the output line by line as JSON lines" default(false)
 // @Param x-request-id header string false "Custom request ID"
 // @Success 200 {object} model.MciSshCmdResult
 // @Failure 404 {object} model.SimpleMsg
@@ -48,13 +58,18 @@ func RestPostCmdMci(c echo.Context) error {
 	mciId := c.Param("mciId")
 	subGroupId := c.QueryParam("subGroupId")
 	vmId := c.QueryParam("vmId")
+	reqId := c.Request().Header.Get(echo.HeaderXRequestID)
 
 	req := &model.MciCmdReq{}
 	if err := c.Bind(req); err != nil {
 		return common.EndRequestWithLog(c, err, nil)
 	}
 
-	output, err := infra.RemoteCommandToMci(nsId, mciId, subGroupId, vmId, req)
+	if c.QueryParam("stream") == "true" {
+		return streamCmdMci(c, nsId, mciId, subGroupId, vmId, reqId, req)
+	}
+
+	output, err := infra.RemoteCommandToMciWithContext(context.Background(), nsId, mciId, subGroupId, vmId, req, infra.RemoteCommandOptions{ReqId: reqId})
 	if err != nil {
 		return common.EndRequestWithLog(c, err, nil)
 	}
@@ -73,6 +88,112 @@ func RestPostCmdMci(c echo.Context) error {
 
 }
 
+// streamCmdMci sends the output of the remote command as JSON lines as it arrives
+// (the commands are cancelled if the client disconnects)
+func streamCmdMci(c echo.Context, nsId string, mciId string, subGroupId string, vmId string, reqId string, req *model.MciCmdReq) error {
+
+	// Prepare for streaming response
+	c.Response().Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c.Response().WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(c.Response())
+
+	send := func(event model.SshCmdStreamEvent) {
+		if err := enc.Encode(event); err != nil {
+			log.Debug().Err(err).Msg("failed to stream remote command output")
+			return
+		}
+		c.Response().Flush()
+	}
+
+	opts := infra.RemoteCommandOptions{ReqId: reqId, OnOutput: send}
+	_, err := infra.RemoteCommandToMciWithContext(c.Request().Context(), nsId, mciId, subGroupId, vmId, req, opts)
+
+	endEvent := model.SshCmdStreamEvent{Type: model.SshCmdStreamEnd, MciId: mciId, Time: time.Now().UTC().Format(time.RFC3339Nano)}
+	if err != nil {
+		endEvent.Err = err.Error()
+	}
+	send(endEvent)
+
+	return nil
+}
+
+// RestDelCmd godoc
+// @ID DelCmd
+// @Summary Cancel a running remote command
+// @Description Cancel a running remote command by its request ID (x-request-id of the command request).
+// @Description The SSH sessions of the command are closed and the unfinished VMs report a cancellation error.
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param reqId path string true "Request ID of the remote command"
+// @Success 200 {object} model.SimpleMsg
+// @Failure 400 {object} model.SimpleMsg
+// @Router /ns/{nsId}/cmd/{reqId} [delete]
+func RestDelCmd(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	reqId := c.Param("reqId")
+
+	mciId, err := infra.CancelRemoteCommand(nsId, reqId)
+	content := map[string]string{"message": "The remote command " + reqId + " to MCI " + mciId + " has been cancelled"}
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestPostCmdMciDryRun godoc
+// @ID PostCmdMciDryRun
+// @Summary Render a command for specified MCI without executing it
+// @Description Render the command for each target VM of specified MCI (built-in functions such as $$Func(GetPublicIP()) are replaced).
+// @Description Nothing is executed on the VMs. Rendering errors are reported per VM and secret values are masked.
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param mciCmdReq body model.MciCmdReq true "MCI Command Request"
+// @Param subGroupId query string false "subGroupId to render the command only for VMs in subGroup of MCI" default(g1)
+// @Param vmId query string false "vmId to render the command only for a VM in MCI" default(g1-1)
+// @Param x-request-id header string false "Custom request ID"
+// @Success 200 {object} model.MciCmdRenderResult
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/cmd/mci/{mciId}/dryRun [post]
+func RestPostCmdMciDryRun(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	subGroupId := c.QueryParam("subGroupId")
+	vmId := c.QueryParam("vmId")
+
+	req := &model.MciCmdReq{}
+	if err := c.Bind(req); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	output, err := infra.RenderRemoteCommandToMci(nsId, mciId, subGroupId, vmId, req)
+	if err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	result := model.MciCmdRenderResult{Results: output}
+	return common.EndRequestWithLog(c, nil, result)
+}
+
+// RestGetCmdFunction godoc
+// @ID GetCmdFunction
+// @Summary List built-in functions for remote commands
+// @Description List built-in functions usable in remote commands as $$Func(Name(param=value, ...)) with their parameters.
+// @Description Parameters can also be given by position in the listed order.
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Success 200 {object} model.RemoteCommandFuncList
+// @Router /cmdFunction [get]
+func RestGetCmdFunction(c echo.Context) error {
+	result := infra.ListCommandFunc()
+	return common.EndRequestWithLog(c, nil, result)
+}
+
 // RestPostFileToMci godoc
 // @ID PostFileToMci
 // @Summary Transfer a file to specified MCI
@@ -219,3 +340,260 @@ func RestRemoveBastionNodes(c echo.Context) error {
 	content, err := infra.RemoveBastionNodes(nsId, mciId, bastionVmId)
 	return common.EndRequestWithLog(c, err, content)
 }
+
+// RestGetVmSshHostKey godoc
+// @ID GetVmSshHostKey
+// @Summary Get the pinned SSH host key of a VM
+// @Description Get the SSH host key pinned on the first successful connection to the VM (trust-on-first-use),
+// @Description and the last host key rejected because it did not match the pinned key.
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param vmId path string true "VM ID" default(g1-1)
+// @Success 200 {object} model.SshHostKeyInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/mci/{mciId}/vm/{vmId}/sshHostKey [get]
+func RestGetVmSshHostKey(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	vmId := c.Param("vmId")
+
+	content, err := infra.GetVmSshHostKey(nsId, mciId, vmId)
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestPutVmSshHostKey godoc
+// @ID PutVmSshHostKey
+// @Summary Rotate the pinned SSH host key of a VM
+// @Description Pin the given SSH host key for the VM, or the last rejected host key with acceptRejected.
+// @Description Use this to explicitly accept an expected host key change (e.g., VM re-imaged).
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param vmId path string true "VM ID" default(g1-1)
+// @Param sshHostKeyReq body model.SshHostKeyReq true "Host key to pin"
+// @Success 200 {object} model.SshHostKeyInfo
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/mci/{mciId}/vm/{vmId}/sshHostKey [put]
+func RestPutVmSshHostKey(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	vmId := c.Param("vmId")
+
+	req := &model.SshHostKeyReq{}
+	if err := c.Bind(req); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	content, err := infra.RotateVmSshHostKey(nsId, mciId, vmId, req)
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestDelVmSshHostKey godoc
+// @ID DelVmSshHostKey
+// @Summary Reset the pinned SSH host key of a VM
+// @Description Remove the pinned SSH host key of the VM. The host key presented on the next connection is pinned again.
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param vmId path string true "VM ID" default(g1-1)
+// @Success 200 {object} model.SimpleMsg
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/mci/{mciId}/vm/{vmId}/sshHostKey [delete]
+func RestDelVmSshHostKey(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	vmId := c.Param("vmId")
+
+	err := infra.ResetVmSshHostKey(nsId, mciId, vmId)
+	content := map[string]string{"message": "The pinned SSH host key of VM " + vmId + " has been reset"}
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestPostRotateMciSshKey godoc
+// @ID PostRotateMciSshKey
+// @Summary Rotate the SSH key of VMs in an MCI
+// @Description Roll the SSH key of the running VMs in the MCI (or in a subGroup) to a new key pair (generated if not given).
+// @Description In each VM, the new public key is installed with the current key and login with the new key is verified.
+// @Description Then the VM is switched to a new sshKey object for the key pair, and the old public key is removed from the VM.
+// @Description A VM where the verification failed is rolled back (the new public key is removed and the current key is kept).
+// @Description The result of each VM is reported. VMs created later with a rotated sshKey are given the CSP key pair of the original sshKey.
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param subGroupId query string false "subGroupId to rotate the key only for VMs in subGroup of MCI" default(g1)
+// @Param sshKeyRotationReq body model.TbSshKeyRotationReq false "New key pair (generated if privateKey is empty)"
+// @Success 200 {object} model.TbSshKeyRotationResult
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/mci/{mciId}/sshKey/rotate [post]
+func RestPostRotateMciSshKey(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	subGroupId := c.QueryParam("subGroupId")
+
+	req := &model.TbSshKeyRotationReq{}
+	if err := c.Bind(req); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	content, err := infra.RotateMciSshKey(nsId, mciId, subGroupId, req)
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// cmdHistoryFilterFromQuery builds the remote command history filter from the query params
+func cmdHistoryFilterFromQuery(c echo.Context) (model.CmdHistoryFilter, error) {
+	filter := model.CmdHistoryFilter{
+		VmId:     c.QueryParam("vmId"),
+		ReqId:    c.QueryParam("reqId"),
+		Type:     c.QueryParam("type"),
+		Status:   c.QueryParam("status"),
+		Since:    c.QueryParam("since"),
+		Until:    c.QueryParam("until"),
+		Contains: c.QueryParam("contains"),
+	}
+	if limit := c.QueryParam("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return filter, fmt.Errorf("invalid limit %s: %w", limit, err)
+		}
+		filter.Limit = n
+	}
+	return filter, nil
+}
+
+// RestGetAllCmdHistory godoc
+// @ID GetAllCmdHistory
+// @Summary List the remote command history of an MCI
+// @Description List the remote commands and file transfers executed on the VMs of an MCI (oldest first).
+// @Description The history is kept after the MCI is deleted, and removed with the namespace.
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param vmId query string false "Filter by VM ID" default()
+// @Param reqId query string false "Filter by request ID" default()
+// @Param type query string false "Filter by type" Enums(command, fileTransfer)
+// @Param status query string false "Filter by status" Enums(success, failed)
+// @Param since query string false "Filter by start time (RFC3339)" default()
+// @Param until query string false "Filter by start time (RFC3339)" default()
+// @Param contains query string false "Filter by a substring of the commands" default()
+// @Param limit query int false "Maximum number of the latest entries to return" default(0)
+// @Success 200 {object} model.CmdHistoryList
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/cmdHistory/mci/{mciId} [get]
+func RestGetAllCmdHistory(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+
+	filter, err := cmdHistoryFilterFromQuery(c)
+	if err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	content, err := infra.ListCmdHistory(nsId, mciId, filter)
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestGetCmdHistory godoc
+// @ID GetCmdHistory
+// @Summary Get a remote command history entry of an MCI
+// @Description Get a remote command history entry of an MCI
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param historyId path string true "History ID"
+// @Success 200 {object} model.CmdHistoryInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/cmdHistory/mci/{mciId}/{historyId} [get]
+func RestGetCmdHistory(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	historyId := c.Param("historyId")
+
+	content, err := infra.GetCmdHistory(nsId, mciId, historyId)
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestDelCmdHistory godoc
+// @ID DelCmdHistory
+// @Summary Delete a remote command history entry of an MCI
+// @Description Delete a remote command history entry of an MCI
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param historyId path string true "History ID"
+// @Success 200 {object} model.SimpleMsg
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/cmdHistory/mci/{mciId}/{historyId} [delete]
+func RestDelCmdHistory(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+	historyId := c.Param("historyId")
+
+	err := infra.DelCmdHistory(nsId, mciId, historyId)
+	content := map[string]string{"message": "The command history " + historyId + " has been deleted"}
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestDelAllCmdHistory godoc
+// @ID DelAllCmdHistory
+// @Summary Delete the remote command history of an MCI
+// @Description Delete the remote command history entries of an MCI matching the filters (all entries without filters)
+// @Tags [MC-Infra] MCI Remote Command
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param mciId path string true "MCI ID" default(mci01)
+// @Param vmId query string false "Filter by VM ID" default()
+// @Param reqId query string false "Filter by request ID" default()
+// @Param type query string false "Filter by type" Enums(command, fileTransfer)
+// @Param status query string false "Filter by status" Enums(success, failed)
+// @Param since query string false "Filter by start time (RFC3339)" default()
+// @Param until query string false "Filter by start time (RFC3339)" default()
+// @Param contains query string false "Filter by a substring of the commands" default()
+// @Success 200 {object} model.IdList
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/cmdHistory/mci/{mciId} [delete]
+func RestDelAllCmdHistory(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+	mciId := c.Param("mciId")
+
+	filter, err := cmdHistoryFilterFromQuery(c)
+	if err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+	filter.Limit = 0
+
+	ids, err := infra.DelAllCmdHistory(nsId, mciId, filter)
+	content := &model.IdList{IdList: ids}
+	return common.EndRequestWithLog(c, err, content)
+}
@@ -0,0 +1,71 @@
+package middlewares
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/labstack/echo/v4"
+)
+
+// AuditMiddleware records mutating API calls (POST, PUT, PATCH, DELETE) in the audit log.
+// It must be used before the auth middlewares, so that rejected calls are also recorded
+// and the caller set by the auth middlewares is available after the handler returns.
+func AuditMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		switch req.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return next(c)
+		}
+		if !common.IsAuditEnabled() {
+			return next(c)
+		}
+
+		// Read the head of the request body (larger bodies are not stored) and restore it for the handler.
+		// Multipart bodies (e.g., uploaded files) are not read.
+		var reqBody []byte
+		if req.Body != nil && !strings.HasPrefix(req.Header.Get(echo.HeaderContentType), "multipart/") {
+			reqBody, _ = io.ReadAll(io.LimitReader(req.Body, int64(model.AuditBodyMaxBytes)+1))
+			req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(reqBody), req.Body), Closer: req.Body}
+		}
+
+		start := time.Now()
+		err := next(c)
+
+		user, _ := c.Get("name").(string)
+		role, _ := c.Get("role").(string)
+		record := model.AuditRecord{
+			Time:        start,
+			RequestId:   c.Response().Header().Get(echo.HeaderXRequestID),
+			User:        user,
+			Role:        role,
+			ClientIp:    c.RealIP(),
+			NsId:        c.Param("nsId"),
+			Method:      req.Method,
+			Path:        req.URL.Path,
+			Route:       route(c),
+			Query:       req.URL.RawQuery,
+			RequestBody: common.RedactAuditBody(req.URL.Path, reqBody),
+			Status:      responseStatus(c, err),
+			DurationMs:  time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			record.Error = err.Error()
+		}
+		common.RecordAudit(record)
+
+		return err
+	}
+}
+
+// readCloser reads from the Reader and closes the Closer (the original request body)
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
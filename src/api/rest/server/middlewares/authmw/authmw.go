@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
-	"github.com/go-resty/resty/v2"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/golang-jwt/jwt/v4"
 	echojwt "github.com/labstack/echo-jwt"
 	"github.com/labstack/echo/v4"
@@ -19,7 +19,7 @@ func InitJwtAuthMw(iamEndpoint string, pubkeyUrl string) error {
 	log.Debug().Msg("Start - InitJwtAuthMw")
 
 	// Check readiness of MC-IAM-Manager
-	client := resty.New()
+	client := common.NewHttpClient()
 
 	method := "GET"
 	url := fmt.Sprintf("%s/alive", iamEndpoint)
@@ -63,21 +63,7 @@ func JwtAuthMw(skipPatterns [][]string) echo.MiddlewareFunc {
 
 	config := echojwt.Config{
 		Skipper: func(c echo.Context) bool {
-			path := c.Request().URL.Path
-			query := c.Request().URL.RawQuery
-			for _, patterns := range skipPatterns {
-				isAllMatched := true
-				for _, pattern := range patterns {
-					if !strings.Contains(path+query, pattern) {
-						isAllMatched = false
-						break
-					}
-				}
-				if isAllMatched {
-					return true
-				}
-			}
-			return false
+			return isSkipped(c, skipPatterns)
 		},
 		// SigningMethod:  signingMethod,
 		KeyFunc:        iamtokenvalidator.Keyfunction,
@@ -94,10 +80,13 @@ func JwtAuthMw(skipPatterns [][]string) echo.MiddlewareFunc {
 func retrospectToken(c echo.Context) {
 	log.Debug().Msg("start - retrospectToken, which is the SuccessHandler")
 
-	accesstoken := c.Get("user").(*jwt.Token).Raw
+	token := c.Get("user").(*jwt.Token)
+	accesstoken := token.Raw
 	claims, err := iamtokenvalidator.GetTokenClaimsByIamManagerClaims(accesstoken)
 	if err != nil {
+		// the request is denied by the authorization middleware (no role)
 		c.String(http.StatusUnauthorized, "failed to type cast claims as jwt.MapClaims")
+		return
 	}
 
 	// Get the realm roles from the claims
@@ -105,16 +94,7 @@ func retrospectToken(c echo.Context) {
 	log.Debug().Msgf("claims.RealmAccess.Roles: %+v", roles)
 
 	// Check this user's role
-	var role = ""
-	if HasRole(roles, "maintainer") {
-		role = "maintainer"
-	} else if HasRole(roles, "admin") {
-		role = "admin"
-	} else if HasRole(roles, "user") {
-		role = "user"
-	} else {
-		role = "guest"
-	}
+	role := roleOf(roles)
 
 	// Get expiry time from claims
 	exp := claims.ExpiresAt
@@ -135,12 +115,49 @@ func retrospectToken(c echo.Context) {
 	c.Set("name", claims.UserName)
 	c.Set("role", role)
 	c.Set("expired-time", expiredTime)
+	// Set the roles granted per namespace
+	if mapClaims, ok := token.Claims.(jwt.MapClaims); ok {
+		if claimName := getAuthzPolicy().NamespaceClaim; claimName != "" {
+			c.Set("namespaces", namespaceGrants(mapClaims[claimName]))
+		}
+	}
 	// Set more values here
 	// ...
 
 	log.Debug().Msg("End - retrospectToken, which is the SuccessHandler")
 }
 
+// isSkipped checks if the path and query of the request contain all patterns of one of the skip patterns
+func isSkipped(c echo.Context, skipPatterns [][]string) bool {
+	path := c.Request().URL.Path
+	query := c.Request().URL.RawQuery
+	for _, patterns := range skipPatterns {
+		isAllMatched := true
+		for _, pattern := range patterns {
+			if !strings.Contains(path+query, pattern) {
+				isAllMatched = false
+				break
+			}
+		}
+		if isAllMatched {
+			return true
+		}
+	}
+	return false
+}
+
+// roleOf returns the highest role among the realm roles (guest if none)
+func roleOf(roles []string) string {
+	if HasRole(roles, model.RoleMaintainer) {
+		return model.RoleMaintainer
+	} else if HasRole(roles, model.RoleAdmin) {
+		return model.RoleAdmin
+	} else if HasRole(roles, model.RoleUser) {
+		return model.RoleUser
+	}
+	return model.RoleGuest
+}
+
 // HasRole checks if a slice contains a specific element
 func HasRole(roleList []string, role string) bool {
 	for _, s := range roleList {
@@ -0,0 +1,213 @@
+package authmw
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/fsnotify/fsnotify"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+var (
+	authzPolicyMutex sync.RWMutex
+	authzPolicy      model.AuthzPolicy
+)
+
+// InitAuthzPolicy loads the authorization policy from conf/authz.yaml and reloads it when the file is changed
+func InitAuthzPolicy() error {
+	v := viper.New()
+	v.AddConfigPath(".")
+	v.AddConfigPath("./conf/")
+	v.AddConfigPath("../conf/")
+	v.SetConfigName("authz")
+	v.SetConfigType("yaml")
+
+	if err := loadAuthzPolicy(v); err != nil {
+		return err
+	}
+	log.Info().Msgf("Authorization policy is loaded from %s", v.ConfigFileUsed())
+
+	v.OnConfigChange(func(e fsnotify.Event) {
+		if err := loadAuthzPolicy(v); err != nil {
+			// keep the current policy
+			log.Error().Err(err).Msgf("failed to reload the authorization policy from %s", e.Name)
+			return
+		}
+		log.Info().Msgf("Authorization policy is reloaded from %s", e.Name)
+	})
+	v.WatchConfig()
+	return nil
+}
+
+// loadAuthzPolicy reads the policy file and replaces the current policy
+func loadAuthzPolicy(v *viper.Viper) error {
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read the authorization policy: %w", err)
+	}
+	config := model.AuthzConfig{}
+	if err := v.Unmarshal(&config); err != nil {
+		return fmt.Errorf("failed to parse the authorization policy: %w", err)
+	}
+	if len(config.Authz.Roles) == 0 {
+		return fmt.Errorf("the authorization policy has no roles")
+	}
+
+	authzPolicyMutex.Lock()
+	authzPolicy = config.Authz
+	authzPolicyMutex.Unlock()
+	return nil
+}
+
+// getAuthzPolicy returns the current authorization policy
+func getAuthzPolicy() model.AuthzPolicy {
+	authzPolicyMutex.RLock()
+	defer authzPolicyMutex.RUnlock()
+	return authzPolicy
+}
+
+// AuthzMw returns the middleware to authorize requests by the roles of the caller (set by the auth middlewares).
+// It must be used after the auth middlewares.
+func AuthzMw() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role, _ := c.Get("role").(string)
+			if role == "" {
+				role = model.RoleAnonymous
+			}
+			roles := []string{role}
+
+			// the role granted for the namespace of the request
+			nsId := c.Param("nsId")
+			if nsId != "" {
+				if grants, ok := c.Get("namespaces").(map[string]string); ok {
+					if nsRole, ok := grants[nsId]; ok {
+						roles = append(roles, nsRole)
+					}
+				}
+			}
+
+			method := c.Request().Method
+			path := c.Request().URL.Path
+			if IsAllowed(getAuthzPolicy(), roles, method, path, c.QueryParams()) {
+				return next(c)
+			}
+
+			name, _ := c.Get("name").(string)
+			log.Warn().Str("name", name).Strs("roles", roles).Str("method", method).Str("path", path).
+				Msg("[authz] request is denied")
+			return c.JSON(http.StatusForbidden, model.SimpleMsg{
+				Message: fmt.Sprintf("%s %s is not allowed for the role(s) %v", method, path, roles),
+			})
+		}
+	}
+}
+
+// IsAllowed checks if one of the roles allows the request of the method, the path and the query parameters
+func IsAllowed(policy model.AuthzPolicy, roles []string, method string, path string, query url.Values) bool {
+	for _, role := range roles {
+		rules, ok := policy.Roles[strings.ToLower(role)]
+		if !ok {
+			continue
+		}
+		if matchRules(rules.Allow, method, path, query) && !matchRules(rules.Deny, method, path, query) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchRules checks if one of the rules matches the method, the path and the query parameters
+func matchRules(rules []model.AuthzRule, method string, path string, query url.Values) bool {
+	for _, rule := range rules {
+		if !matchQueries(rule.Queries, query) {
+			continue
+		}
+		methodMatched := false
+		for _, m := range rule.Methods {
+			if m == "*" || strings.EqualFold(m, method) {
+				methodMatched = true
+				break
+			}
+		}
+		if !methodMatched {
+			continue
+		}
+		for _, p := range rule.Paths {
+			if matchPath(p, path) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchQueries checks if the query parameters have all of the "key=value" pairs (values are case-insensitive)
+func matchQueries(pairs []string, query url.Values) bool {
+	for _, pair := range pairs {
+		key, value, _ := strings.Cut(pair, "=")
+		matched := false
+		for _, v := range query[key] {
+			if strings.EqualFold(v, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPath checks if the path matches the pattern ('*' matches any characters including '/')
+func matchPath(pattern string, path string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == path
+	}
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+	for i := 1; i < len(parts)-1; i++ {
+		idx := strings.Index(path, parts[i])
+		if idx < 0 {
+			return false
+		}
+		path = path[idx+len(parts[i]):]
+	}
+	return strings.HasSuffix(path, parts[len(parts)-1])
+}
+
+// namespaceGrants returns the roles granted per namespace by the claim
+// (a map of namespace and role, or a list of "namespace:role"; "namespace" alone is granted the owner role)
+func namespaceGrants(claim interface{}) map[string]string {
+	grants := map[string]string{}
+	switch v := claim.(type) {
+	case map[string]interface{}:
+		for nsId, role := range v {
+			if r, ok := role.(string); ok {
+				grants[nsId] = strings.ToLower(r)
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				continue
+			}
+			nsId, role, found := strings.Cut(s, ":")
+			if !found {
+				role = model.RoleNamespaceOwner
+			}
+			grants[nsId] = strings.ToLower(role)
+		}
+	}
+	return grants
+}
@@ -0,0 +1,220 @@
+package authmw
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/labstack/echo/v4"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/rs/zerolog/log"
+)
+
+// HeaderApiKey is the header of API keys (an API key can also be sent as a bearer token)
+const HeaderApiKey = "X-API-Key"
+
+// localJwtKeys is the keys to verify JWTs without an external identity service
+type localJwtKeys struct {
+	signingMethod string
+	// keysById is the keys of the JWKS file by key ID (kid)
+	keysById map[string]interface{}
+	// defaultKey is the key for JWTs without kid (the PEM key, or the only key of the JWKS file)
+	defaultKey interface{}
+}
+
+var localKeys *localJwtKeys
+
+// InitLocalAuthMw loads the keys to verify JWTs in the local auth mode
+// (publicKey is a PEM public key or the path of a PEM file, and jwksPath is the path of a JWKS file; both are optional)
+func InitLocalAuthMw(signingMethod string, publicKey string, jwksPath string) error {
+	log.Debug().Msg("Start - InitLocalAuthMw")
+
+	keys := &localJwtKeys{signingMethod: common.NVL(signingMethod, "RS256"), keysById: map[string]interface{}{}}
+	if jwt.GetSigningMethod(keys.signingMethod) == nil {
+		return fmt.Errorf("the JWT signing method %s is not supported", keys.signingMethod)
+	}
+
+	if publicKey != "" {
+		pemBytes := []byte(publicKey)
+		if !strings.HasPrefix(strings.TrimSpace(publicKey), "-----BEGIN") {
+			var err error
+			pemBytes, err = os.ReadFile(publicKey)
+			if err != nil {
+				return fmt.Errorf("failed to read the JWT public key: %w", err)
+			}
+		}
+		key, err := parsePublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return err
+		}
+		keys.defaultKey = key
+	}
+
+	if jwksPath != "" {
+		set, err := jwk.ReadFile(jwksPath)
+		if err != nil {
+			return fmt.Errorf("failed to read the JWKS file %s: %w", jwksPath, err)
+		}
+		for i := 0; i < set.Len(); i++ {
+			k, _ := set.Get(i)
+			var raw interface{}
+			if err := k.Raw(&raw); err != nil {
+				return fmt.Errorf("failed to load the key %s of the JWKS file: %w", k.KeyID(), err)
+			}
+			keys.keysById[k.KeyID()] = raw
+			if set.Len() == 1 && keys.defaultKey == nil {
+				keys.defaultKey = raw
+			}
+		}
+	}
+
+	if keys.defaultKey == nil && len(keys.keysById) == 0 {
+		log.Info().Msg("No JWT key is configured; only API keys and basic auth are accepted")
+	}
+	localKeys = keys
+
+	log.Debug().Msg("End - InitLocalAuthMw")
+	return nil
+}
+
+// parsePublicKeyFromPEM parses an RSA, ECDSA or Ed25519 public key in PEM
+func parsePublicKeyFromPEM(pemBytes []byte) (interface{}, error) {
+	if key, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseECPublicKeyFromPEM(pemBytes); err == nil {
+		return key, nil
+	}
+	if key, err := jwt.ParseEdPublicKeyFromPEM(pemBytes); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("failed to parse the JWT public key (RSA, ECDSA or Ed25519 public key in PEM is required)")
+}
+
+// keyFunc returns the key to verify the JWT by its kid (or the default key if the kid is not in the JWKS file)
+func (k *localJwtKeys) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := k.keysById[kid]; ok && kid != "" {
+		return key, nil
+	}
+	if k.defaultKey == nil {
+		return nil, fmt.Errorf("no key to verify the token (key ID: %q)", kid)
+	}
+	return k.defaultKey, nil
+}
+
+// LocalAuthMw returns the middleware of the local auth mode, which accepts the following without an external identity service
+//   - API keys issued by CB-Tumblebug (X-API-Key header, or Authorization: Bearer tbk_...)
+//   - JWTs verified by the locally configured keys (Authorization: Bearer <JWT>)
+//   - basic auth of TB_API_USERNAME and TB_API_PASSWORD as an admin (e.g., to issue the first API key)
+func LocalAuthMw(skipPatterns [][]string, apiUser string, apiPass string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if isSkipped(c, skipPatterns) {
+				return next(c)
+			}
+
+			req := c.Request()
+			var err error
+			switch {
+			case req.Header.Get(HeaderApiKey) != "":
+				err = authenticateApiKey(c, req.Header.Get(HeaderApiKey))
+			case strings.HasPrefix(req.Header.Get(echo.HeaderAuthorization), "Bearer "):
+				token := strings.TrimPrefix(req.Header.Get(echo.HeaderAuthorization), "Bearer ")
+				if strings.HasPrefix(token, model.ApiKeyPrefix) {
+					err = authenticateApiKey(c, token)
+				} else {
+					err = authenticateLocalJwt(c, token)
+				}
+			default:
+				username, password, ok := req.BasicAuth()
+				if !ok || apiUser == "" ||
+					subtle.ConstantTimeCompare([]byte(username), []byte(apiUser)) != 1 ||
+					subtle.ConstantTimeCompare([]byte(password), []byte(apiPass)) != 1 {
+					err = fmt.Errorf("an API key, a bearer token or basic auth credentials are required")
+					break
+				}
+				c.Set("authenticated", true)
+				c.Set("name", username)
+				c.Set("role", model.RoleAdmin)
+			}
+
+			if err != nil {
+				log.Debug().Err(err).Str("path", req.URL.Path).Msg("[auth] request is not authenticated")
+				return c.JSON(http.StatusUnauthorized, model.SimpleMsg{Message: err.Error()})
+			}
+			return next(c)
+		}
+	}
+}
+
+// authenticateApiKey verifies the API key and sets the caller of the key in the context
+func authenticateApiKey(c echo.Context, key string) error {
+	info, err := common.VerifyApiKey(key)
+	if err != nil {
+		return err
+	}
+	c.Set("authenticated", true)
+	c.Set("name", "apiKey:"+info.Name)
+	c.Set("role", info.Role)
+	c.Set("namespaces", info.Namespaces)
+	c.Set("apiKeyId", info.Id)
+	if info.ExpireTime != nil {
+		c.Set("expired-time", info.ExpireTime.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// authenticateLocalJwt verifies the JWT by the locally configured keys and sets the caller of the token in the context
+func authenticateLocalJwt(c echo.Context, tokenString string) error {
+	if localKeys == nil {
+		return fmt.Errorf("the local auth mode is not initialized")
+	}
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, localKeys.keyFunc, jwt.WithValidMethods([]string{localKeys.signingMethod}))
+	if err != nil || !token.Valid {
+		return fmt.Errorf("token is invalid: %v", err)
+	}
+
+	// the role from the "role" claim or the realm roles (as issued by MC-IAM-Manager)
+	role, _ := claims["role"].(string)
+	if role == "" {
+		roles := []string{}
+		if realmAccess, ok := claims["realm_access"].(map[string]interface{}); ok {
+			if list, ok := realmAccess["roles"].([]interface{}); ok {
+				for _, r := range list {
+					if s, ok := r.(string); ok {
+						roles = append(roles, s)
+					}
+				}
+			}
+		}
+		role = roleOf(roles)
+	}
+
+	name := ""
+	for _, claim := range []string{"name", "preferred_username", "sub"} {
+		if v, ok := claims[claim].(string); ok && v != "" {
+			name = v
+			break
+		}
+	}
+
+	c.Set("authenticated", true)
+	c.Set("token", tokenString)
+	c.Set("name", name)
+	c.Set("role", strings.ToLower(role))
+	if claimName := getAuthzPolicy().NamespaceClaim; claimName != "" {
+		c.Set("namespaces", namespaceGrants(claims[claimName]))
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		c.Set("expired-time", time.Unix(int64(exp), 0).Format(time.RFC3339))
+	}
+	return nil
+}
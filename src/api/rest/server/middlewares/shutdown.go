@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/labstack/echo/v4"
+)
+
+// ShutdownGuard rejects mutating API calls (POST, PUT, PATCH, DELETE) while the instance is shutting down,
+// and tracks the accepted ones so that the shutdown waits for them (or checkpoints them at the deadline).
+func ShutdownGuard(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		switch req.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			return next(c)
+		}
+
+		if common.IsShuttingDown() {
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(common.ShutdownTimeout().Seconds())))
+			return c.JSON(http.StatusServiceUnavailable, model.SimpleMsg{Message: "CB-Tumblebug is shutting down, please retry with another instance or later"})
+		}
+
+		reqID := req.Header.Get(echo.HeaderXRequestID)
+		requestInfo := common.RequestInfo{Method: req.Method, URL: req.URL.String()}
+		if v, ok := common.RequestMap.Load(reqID); ok {
+			requestInfo = v.(common.RequestDetails).RequestInfo
+		}
+		done := common.TrackRequest(reqID, requestInfo)
+		defer done()
+
+		return next(c)
+	}
+}
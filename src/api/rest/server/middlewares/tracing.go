@@ -2,37 +2,45 @@ package middlewares
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"time"
 
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/common/logger"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog/log"
-	// "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Define Tracing middleware
 func TracingMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 
-		// TODO: Be able to use this code when OpenTelemetry is integrated
-		// Start a new tracing context
-		// tracer := otel.Tracer("example-tracer")
-		// ctx, span := tracer.Start(c.Request().Context(), c.Path())
-		// defer span.End()
+		// Start a server span as a child of the caller's span (W3C trace context) if any
+		ctx := common.ExtractTraceContext(c.Request().Context(), c.Request().Header)
+		ctx, span := common.Tracer().Start(ctx, c.Request().Method+" "+route(c),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request().Method),
+				attribute.String("http.route", route(c)),
+				attribute.String("url.path", c.Request().URL.Path),
+				attribute.String("request.id", c.Response().Header().Get(echo.HeaderXRequestID)),
+			),
+		)
+		defer span.End()
 
 		// Store trace and span IDs in the context
-		// traceId := span.SpanContext().TraceID().String()
-		// spanId := span.SpanContext().SpanID().String()
-
-		// Get the context
-		ctx := c.Request().Context()
-
-		// [NOTE]
-		// For now, we will use the request ID as the trace ID
-		// and generate a new span ID for each request
-		traceId := c.Response().Header().Get(echo.HeaderXRequestID)
-		spanId := fmt.Sprintf("%d", time.Now().UnixNano())
+		traceId := span.SpanContext().TraceID().String()
+		spanId := span.SpanContext().SpanID().String()
+		if !span.SpanContext().IsValid() {
+			// [NOTE] the tracer provider is not initialized; use the request ID as the trace ID
+			traceId = c.Response().Header().Get(echo.HeaderXRequestID)
+			spanId = fmt.Sprintf("%d", time.Now().UnixNano())
+		}
 
 		ctx = context.WithValue(ctx, logger.TraceIdKey, traceId)
 		ctx = context.WithValue(ctx, logger.SpanIdKey, spanId)
@@ -65,6 +73,34 @@ func TracingMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		})
 
 		// Call the next handler
-		return next(c)
+		err := next(c)
+
+		code := responseStatus(c, err)
+		span.SetAttributes(attribute.Int("http.response.status_code", code))
+		if code >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(code))
+		}
+		return err
+	}
+}
+
+// route returns the path template of the request (not the actual path, to keep span names low-cardinality)
+func route(c echo.Context) string {
+	if c.Path() == "" {
+		return "unmatched"
+	}
+	return c.Path()
+}
+
+// responseStatus returns the status code of the response (or of the error if the response is not sent yet)
+func responseStatus(c echo.Context, err error) int {
+	code := c.Response().Status
+	if err != nil && !c.Response().Committed {
+		code = http.StatusInternalServerError
+		var httpErr *echo.HTTPError
+		if errors.As(err, &httpErr) {
+			code = httpErr.Code
+		}
 	}
+	return code
 }
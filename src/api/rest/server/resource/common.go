@@ -15,6 +15,7 @@ limitations under the License.
 package resource
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
@@ -156,6 +157,12 @@ func RestGetAllResources(c echo.Context) error {
 			}
 
 			content.SshKey = resourceList.([]model.TbSshKeyInfo) // type assertion (interface{} -> array)
+			// private keys are redacted from the list unless explicitly requested
+			if c.QueryParam("showSecret") != "true" {
+				for i := range content.SshKey {
+					content.SshKey[i].PrivateKey = ""
+				}
+			}
 			return common.EndRequestWithLog(c, err, content)
 		case model.StrVNet:
 			var content struct {
@@ -291,13 +298,18 @@ func RestTestGetAssociatedObjectCount(c echo.Context) error {
 // @Tags [Admin] System Configuration
 // @Accept  json
 // @Produce  json
+// @Param async query bool false "Run as a job and respond 202 with the job (check it with GET /job/{jobId})" default(false)
 // @Success 200 {object} model.IdList
+// @Success 202 {object} model.JobInfo
 // @Failure 404 {object} model.SimpleMsg
 // @Router /loadAssets [get]
 func RestLoadAssets(c echo.Context) error {
 
-	content, err := resource.LoadAssets()
-	return common.EndRequestWithLog(c, err, content)
+	spec := common.JobSpec{Kind: model.JobKindLoadAssets, NsId: model.SystemCommonNs}
+	return common.RunJob(c, spec, func(ctx context.Context) (interface{}, error) {
+		content, err := resource.LoadAssets()
+		return &content, err
+	})
 }
 
 // RestCreateSharedResource godoc
@@ -0,0 +1,88 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resource is to handle REST API for resource
+package resource
+
+import (
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/labstack/echo/v4"
+)
+
+// RestPutNsQuota godoc
+// @ID PutNsQuota
+// @Summary Set the quota of a namespace
+// @Description Set the limits of resources in the namespace (0 or empty means no limit).
+// @Description Requests to create MCIs, VMs, K8s clusters, data disks and vNets exceeding the quota are rejected.
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Param nsQuota body model.NsQuota true "Quota of the namespace"
+// @Success 200 {object} model.NsQuotaInfo
+// @Failure 400 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/quota [put]
+func RestPutNsQuota(c echo.Context) error {
+
+	nsId := c.Param("nsId")
+
+	u := &model.NsQuota{}
+	if err := c.Bind(u); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+
+	if _, err := common.SetNsQuota(nsId, u); err != nil {
+		return common.EndRequestWithLog(c, err, nil)
+	}
+	content, err := resource.GetNsQuotaInfo(nsId)
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestGetNsQuota godoc
+// @ID GetNsQuota
+// @Summary Get the quota and the usage of a namespace
+// @Description Get the quota of the namespace and the current consumption
+// @Description (VMs of MCIs which are not terminated and nodes of K8s clusters, with vCPUs, memory and hourly cost from their specs)
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Success 200 {object} model.NsQuotaInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Failure 500 {object} model.SimpleMsg
+// @Router /ns/{nsId}/quota [get]
+func RestGetNsQuota(c echo.Context) error {
+
+	content, err := resource.GetNsQuotaInfo(c.Param("nsId"))
+	return common.EndRequestWithLog(c, err, content)
+}
+
+// RestDelNsQuota godoc
+// @ID DelNsQuota
+// @Summary Remove the quota of a namespace
+// @Description Remove the quota of the namespace (no limit)
+// @Tags [Admin] System Configuration
+// @Accept  json
+// @Produce  json
+// @Param nsId path string true "Namespace ID" default(default)
+// @Success 200 {object} model.NsInfo
+// @Failure 404 {object} model.SimpleMsg
+// @Router /ns/{nsId}/quota [delete]
+func RestDelNsQuota(c echo.Context) error {
+
+	content, err := common.SetNsQuota(c.Param("nsId"), nil)
+	return common.EndRequestWithLog(c, err, content)
+}
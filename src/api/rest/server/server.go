@@ -114,9 +114,18 @@ func RunServer() {
 	// Custom middleware for tracing
 	e.Use(middlewares.TracingMiddleware)
 
+	// Custom middleware for metrics of HTTP requests
+	e.Use(middlewares.MetricsMiddleware)
+
 	// Custom middleware for ResponseBodyDump
 	e.Use(middlewares.ResponseBodyDump())
 
+	// Custom middleware for the audit log of mutating API calls (before the auth middlewares to record rejected calls)
+	e.Use(middlewares.AuditMiddleware)
+
+	// Custom middleware to reject mutating API calls while shutting down and to track the accepted ones
+	e.Use(middlewares.ShutdownGuard)
+
 	e.HideBanner = true
 	//e.colorer.Printf(banner, e.colorer.Red("v"+Version), e.colorer.Blue(website))
 
@@ -132,6 +141,7 @@ func RunServer() {
 	// e.GET("/tumblebug/swagger/*", echoSwagger.WrapHandler)
 	// e.GET("/tumblebug/swaggerActive", rest_common.RestGetSwagger)
 	e.GET("/tumblebug/readyz", rest_common.RestGetReadyz)
+	e.GET("/tumblebug/metrics", rest_common.RestGetMetrics)
 	e.GET("/tumblebug/httpVersion", rest_common.RestCheckHTTPVersion)
 	e.POST("tumblebug/testStreamResponse", rest_common.RestTestStreamResponse)
 
@@ -156,6 +166,7 @@ func RunServer() {
 	// Setup Middlewares for auth
 	var basicAuthMw echo.MiddlewareFunc
 	var jwtAuthMw echo.MiddlewareFunc
+	var localAuthMw echo.MiddlewareFunc
 
 	if authEnabled {
 		switch authMode {
@@ -164,6 +175,7 @@ func RunServer() {
 			basicAuthMw = middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
 				Skipper: func(c echo.Context) bool {
 					if c.Path() == "/tumblebug/readyz" ||
+						c.Path() == "/tumblebug/metrics" ||
 						c.Path() == "/tumblebug/httpVersion" {
 						return true
 					}
@@ -173,6 +185,9 @@ func RunServer() {
 					// Be careful to use constant time comparison to prevent timing attacks
 					if subtle.ConstantTimeCompare([]byte(username), []byte(apiUser)) == 1 &&
 						subtle.ConstantTimeCompare([]byte(password), []byte(apiPass)) == 1 {
+						// the API user of basic auth is an admin
+						c.Set("name", username)
+						c.Set("role", model.RoleAdmin)
 						return true, nil
 					}
 					return false, nil
@@ -187,13 +202,29 @@ func RunServer() {
 			} else {
 				authSkipPatterns := [][]string{
 					{"/tumblebug/readyz"},
+					{"/tumblebug/metrics"},
 					{"/tumblebug/httpVersion"},
+					{"/tumblebug/api"},
 				}
 				jwtAuthMw = authmw.JwtAuthMw(authSkipPatterns)
 				log.Info().Msg("JWT Auth Middleware is initialized successfully")
 			}
+		case "local":
+			// Setup Local Auth Middleware (API keys and JWTs verified by local keys, without MC-IAM-Manager)
+			err := authmw.InitLocalAuthMw(os.Getenv("TB_AUTH_JWT_SIGNING_METHOD"), os.Getenv("TB_AUTH_JWT_PUBLICKEY"), os.Getenv("TB_AUTH_JWKS_PATH"))
+			if err != nil {
+				log.Fatal().Err(err).Msg("Failed to initialize Local Auth Middleware")
+			}
+			authSkipPatterns := [][]string{
+				{"/tumblebug/readyz"},
+				{"/tumblebug/metrics"},
+				{"/tumblebug/httpVersion"},
+				{"/tumblebug/api"},
+			}
+			localAuthMw = authmw.LocalAuthMw(authSkipPatterns, apiUser, apiPass)
+			log.Info().Msg("Local Auth Middleware is initialized successfully")
 		default:
-			log.Fatal().Msg("TB_AUTH_MODE is not set properly. Please set it to 'basic' or 'jwt'. EXITING...")
+			log.Fatal().Msg("TB_AUTH_MODE is not set properly. Please set it to 'basic', 'jwt' or 'local'. EXITING...")
 		}
 	}
 
@@ -203,15 +234,39 @@ func RunServer() {
 		e.Use(basicAuthMw)
 	}
 
-	// [Temp - start] For JWT auth test, a route group and an API
-	authGroup := e.Group("/tumblebug/auth")
+	// Set JWT auth middleware for root group
 	if authEnabled && authMode == "jwt" && jwtAuthMw != nil {
-		log.Debug().Msg("Setting up JWT Auth Middleware for /tumblebug/auth group")
-		authGroup.Use(jwtAuthMw)
+		log.Debug().Msg("Setting up JWT Auth Middleware for root group")
+		e.Use(jwtAuthMw)
+	}
+
+	// Set local auth middleware for root group
+	if authEnabled && authMode == "local" && localAuthMw != nil {
+		log.Debug().Msg("Setting up Local Auth Middleware for root group")
+		e.Use(localAuthMw)
 	}
+
+	// Set authorization middleware (roles of the caller set by the auth middlewares) for root group
+	if authEnabled {
+		err := authmw.InitAuthzPolicy()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Failed to initialize the authorization policy (conf/authz.yaml)")
+		}
+		e.Use(authmw.AuthzMw())
+		log.Info().Msg("Authorization Middleware is initialized successfully")
+	}
+
+	// [Temp - start] For JWT auth test, a route group and an API
+	authGroup := e.Group("/tumblebug/auth")
 	authGroup.GET("/test", auth.TestJWTAuth)
 	// [Temp - end] For JWT auth test, a route group and an API
 
+	// API keys for the local auth mode
+	authGroup.POST("/apiKey", auth.RestPostApiKey)
+	authGroup.GET("/apiKey", auth.RestGetAllApiKey)
+	authGroup.GET("/apiKey/:keyId", auth.RestGetApiKey)
+	authGroup.DELETE("/apiKey/:keyId", auth.RestDelApiKey)
+
 	fmt.Print(banner)
 	fmt.Println("\n ")
 	fmt.Printf(infoColor, website)
@@ -229,6 +284,7 @@ func RunServer() {
 	e.GET("/tumblebug/provider/:providerName/region/:regionName", rest_common.RestGetRegion)
 	e.GET("/tumblebug/regionFromCsp", rest_common.RestGetRegionListFromCsp)
 	e.GET("/tumblebug/k8sClusterInfo", rest_common.RestGetK8sClusterInfo)
+	e.GET("/tumblebug/cmdFunction", rest_infra.RestGetCmdFunction)
 
 	e.GET("/tumblebug/credential/publicKey", rest_common.RestGetPublicKeyForCredentialEncryption)
 	e.POST("/tumblebug/credential", rest_common.RestRegisterCredential)
@@ -252,11 +308,22 @@ func RunServer() {
 	e.DELETE("/tumblebug/config/:configId", rest_common.RestInitConfig)
 	e.DELETE("/tumblebug/config", rest_common.RestInitAllConfig)
 
+	e.GET("/tumblebug/secretKey", rest_common.RestGetAllSecretKey)
+	e.POST("/tumblebug/secretKey/rotate", rest_common.RestPostRotateSecretKey)
+
 	e.GET("/tumblebug/request/:reqId", rest_common.RestGetRequest)
 	e.GET("/tumblebug/requests", rest_common.RestGetAllRequests)
 	e.DELETE("/tumblebug/request/:reqId", rest_common.RestDeleteRequest)
 	e.DELETE("/tumblebug/requests", rest_common.RestDeleteAllRequests)
 
+	e.GET("/tumblebug/job/:jobId", rest_common.RestGetJob)
+	e.GET("/tumblebug/jobs", rest_common.RestGetAllJob)
+	e.POST("/tumblebug/job/:jobId/cancel", rest_common.RestPostCancelJob)
+	e.DELETE("/tumblebug/job/:jobId", rest_common.RestDelJob)
+
+	e.GET("/tumblebug/audit", rest_common.RestGetAllAudit)
+	e.GET("/tumblebug/costReport", rest_infra.RestGetCostReport)
+
 	e.GET("/tumblebug/object", rest_common.RestGetObject)
 	e.GET("/tumblebug/objects", rest_common.RestGetObjects)
 	e.DELETE("/tumblebug/object", rest_common.RestDeleteObject)
@@ -287,6 +354,16 @@ func RunServer() {
 	g.DELETE("/:nsId", rest_common.RestDelNs)
 	g.DELETE("", rest_common.RestDelAllNs)
 
+	// Namespace Secret
+	g.PUT("/:nsId/secret/:secretName", rest_common.RestPutSecret)
+	g.GET("/:nsId/secret", rest_common.RestGetAllSecret)
+	g.DELETE("/:nsId/secret/:secretName", rest_common.RestDelSecret)
+
+	// Namespace Quota
+	g.PUT("/:nsId/quota", rest_resource.RestPutNsQuota)
+	g.GET("/:nsId/quota", rest_resource.RestGetNsQuota)
+	g.DELETE("/:nsId/quota", rest_resource.RestDelNsQuota)
+
 	// Resource Label
 	e.PUT("/tumblebug/label/:labelType/:uid", rest_label.RestCreateOrUpdateLabel)
 	e.DELETE("/tumblebug/label/:labelType/:uid/:key", rest_label.RestRemoveLabel)
@@ -303,6 +380,7 @@ func RunServer() {
 	e.POST("/tumblebug/systemMci", rest_infra.RestPostSystemMci)
 
 	g.POST("/:nsId/mciDynamic", rest_infra.RestPostMciDynamic)
+	g.POST("/:nsId/mciDynamicReview", rest_infra.RestPostMciDynamicReview)
 	g.POST("/:nsId/mci/:mciId/vmDynamic", rest_infra.RestPostMciVmDynamic)
 
 	//g.GET("/:nsId/mci/:mciId", rest_infra.RestGetMci, middleware.TimeoutWithConfig(middleware.TimeoutConfig{Timeout: 20 * time.Second}), middleware.RateLimiter(middleware.NewRateLimiterMemoryStore(1)))
@@ -329,6 +407,7 @@ func RunServer() {
 	g.GET("/:nsId/mci/:mciId/subgroup", rest_infra.RestGetMciGroupIds)
 	g.GET("/:nsId/mci/:mciId/subgroup/:subgroupId", rest_infra.RestGetMciGroupVms)
 	g.POST("/:nsId/mci/:mciId/subgroup/:subgroupId", rest_infra.RestPostMciSubGroupScaleOut)
+	g.POST("/:nsId/mci/:mciId/subgroup/:subgroupId/scaleIn", rest_infra.RestPostMciSubGroupScaleIn)
 
 	//g.GET("/:nsId/mci/:mciId/vm", rest_infra.RestGetAllMciVm)
 	// g.PUT("/:nsId/mci/:mciId/vm/:vmId", rest_infra.RestPutMciVm)
@@ -339,12 +418,26 @@ func RunServer() {
 
 	g.GET("/:nsId/control/mci/:mciId", rest_infra.RestGetControlMci)
 	g.GET("/:nsId/control/mci/:mciId/vm/:vmId", rest_infra.RestGetControlMciVm)
+	g.GET("/:nsId/control/mci/:mciId/drift", rest_infra.RestGetMciDrift)
+	g.POST("/:nsId/control/mci/:mciId/reconcile", rest_infra.RestPostReconcileMci)
+
+	g.GET("/:nsId/costReport", rest_infra.RestGetNsCostReport)
 
 	g.POST("/:nsId/cmd/mci/:mciId", rest_infra.RestPostCmdMci)
+	g.POST("/:nsId/cmd/mci/:mciId/dryRun", rest_infra.RestPostCmdMciDryRun)
+	g.DELETE("/:nsId/cmd/:reqId", rest_infra.RestDelCmd)
+	g.GET("/:nsId/cmdHistory/mci/:mciId", rest_infra.RestGetAllCmdHistory)
+	g.GET("/:nsId/cmdHistory/mci/:mciId/:historyId", rest_infra.RestGetCmdHistory)
+	g.DELETE("/:nsId/cmdHistory/mci/:mciId", rest_infra.RestDelAllCmdHistory)
+	g.DELETE("/:nsId/cmdHistory/mci/:mciId/:historyId", rest_infra.RestDelCmdHistory)
 	g.POST("/:nsId/transferFile/mci/:mciId", rest_infra.RestPostFileToMci)
 	g.PUT("/:nsId/mci/:mciId/vm/:targetVmId/bastion/:bastionVmId", rest_infra.RestSetBastionNodes)
 	g.DELETE("/:nsId/mci/:mciId/bastion/:bastionVmId", rest_infra.RestRemoveBastionNodes)
 	g.GET("/:nsId/mci/:mciId/vm/:targetVmId/bastion", rest_infra.RestGetBastionNodes)
+	g.GET("/:nsId/mci/:mciId/vm/:vmId/sshHostKey", rest_infra.RestGetVmSshHostKey)
+	g.PUT("/:nsId/mci/:mciId/vm/:vmId/sshHostKey", rest_infra.RestPutVmSshHostKey)
+	g.DELETE("/:nsId/mci/:mciId/vm/:vmId/sshHostKey", rest_infra.RestDelVmSshHostKey)
+	g.POST("/:nsId/mci/:mciId/sshKey/rotate", rest_infra.RestPostRotateMciSshKey)
 
 	g.POST("/:nsId/installBenchmarkAgent/mci/:mciId", rest_infra.RestPostInstallBenchmarkAgentToMci)
 	g.POST("/:nsId/benchmark/mci/:mciId", rest_infra.RestGetBenchmark)
@@ -368,6 +461,7 @@ func RunServer() {
 	//MCI AUTO Policy
 	g.POST("/:nsId/policy/mci/:mciId", rest_infra.RestPostMciPolicy)
 	g.GET("/:nsId/policy/mci/:mciId", rest_infra.RestGetMciPolicy)
+	g.GET("/:nsId/policy/mci/:mciId/history", rest_infra.RestGetMciPolicyHistory)
 	g.GET("/:nsId/policy/mci", rest_infra.RestGetAllMciPolicy)
 	g.PUT("/:nsId/policy/mci/:mciId", rest_infra.RestPutMciPolicy)
 	g.DELETE("/:nsId/policy/mci/:mciId", rest_infra.RestDelMciPolicy)
@@ -561,14 +655,27 @@ func RunServer() {
 
 		// Block until a signal is triggered
 		<-gracefulShutdownContext.Done()
+		// a second signal stops the server immediately
+		stop()
+
+		// Stop accepting mutating requests, and wait for the jobs and requests in flight
+		timeout := common.ShutdownTimeout()
+		log.Info().Msgf("Stopping CB-Tumblebug API Server gracefully... (waiting for in-flight operations within %s)", timeout)
+		common.BeginShutdown()
+		drainCtx, cancelDrain := context.WithTimeout(context.TODO(), timeout)
+		defer cancelDrain()
+
+		if !common.DrainOperations(drainCtx) {
+			// record where the remaining operations stopped, so that a restarted instance can report them
+			common.CheckpointOperations("the Tumblebug instance was shut down before the operation finished")
+		}
 
-		log.Info().Msg("Stopping CB-Tumblebug API Server gracefully... (within 10s)")
 		ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Second)
 		defer cancel()
 
 		if err := e.Shutdown(ctx); err != nil {
 			log.Error().Err(err).Msg("Error in Gracefully Stopping CB-Tumblebug API Server")
-			e.Logger.Panic(err)
+			_ = e.Close()
 		}
 	}(&wg)
 
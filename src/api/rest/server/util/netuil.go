@@ -23,6 +23,7 @@ type RestPostUtilToDesignVNetReponse struct {
 // @ID PostUtilToDesignVNet
 // @Summary Design VNet and subnets based on user-friendly properties
 // @Description Design VNet and subnets based on user-friendly properties
+// @Description For dual-stack vNets, set targetPrivateNetworkIpv6 (e.g., fd00:10::/48) to add IPv6 CIDR blocks (/64 subnets) as well.
 // @Tags [Infra Resource] Network Management
 // @Accept  json
 // @Produce  json
@@ -61,6 +62,7 @@ type RestPostUtilToDesignNetworkReponse struct {
 // @ID PostUtilToDesignNetwork
 // @Summary Design a multi-cloud network configuration
 // @Description Design a hierarchical network configuration of a VPC network or multi-cloud network consisting of multiple VPC networks
+// @Description Both IPv4 and IPv6 CIDR blocks are supported.
 // @Tags [Infra Resource] Network Management
 // @Accept  json
 // @Produce  json
@@ -96,6 +98,7 @@ type RestPostUtilToValidateNetworkRequest struct {
 // @ID PostUtilToValidateNetwork
 // @Summary Validate a multi-cloud network configuration
 // @Description Validate a hierarchical configuration of a VPC network or multi-cloud network consisting of multiple VPC networks
+// @Description Both IPv4 and IPv6 CIDR blocks are supported (a subnet should be in the same address family as its network).
 // @Tags [Infra Resource] Network Management
 // @Accept  json
 // @Produce  json
@@ -0,0 +1,209 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// [API keys for the local auth mode (TB_AUTH_MODE=local)]
+
+// GenApiKeyKey is func to generate the kvstore key of an API key
+func GenApiKeyKey(keyId string) string {
+	return "/auth/apiKey/" + keyId
+}
+
+// hashApiKey returns the SHA-256 hash (hex) of the API key
+func hashApiKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateApiKey is func to create an API key. The key is returned only once; only its hash is stored.
+func CreateApiKey(req *model.ApiKeyReq, createdBy string) (model.ApiKeyCreateResponse, error) {
+	result := model.ApiKeyCreateResponse{}
+
+	if req.Name == "" {
+		return result, fmt.Errorf("the name of the API key is required")
+	}
+	switch req.Role {
+	case model.RoleMaintainer, model.RoleAdmin, model.RoleUser, model.RoleGuest:
+	default:
+		return result, fmt.Errorf("the role %q is not valid (maintainer, admin, user or guest)", req.Role)
+	}
+	if req.ExpiresInHours < 0 {
+		return result, fmt.Errorf("expiresInHours must not be negative")
+	}
+
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return result, err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return result, err
+	}
+	keyId := hex.EncodeToString(idBytes)
+	key := model.ApiKeyPrefix + keyId + "_" + base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	now := time.Now()
+	info := model.ApiKeyInfo{
+		Id:          keyId,
+		Name:        req.Name,
+		Description: req.Description,
+		Role:        req.Role,
+		Namespaces:  req.Namespaces,
+		CreatedBy:   createdBy,
+		CreatedTime: now,
+	}
+	if req.ExpiresInHours > 0 {
+		expireTime := now.Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		info.ExpireTime = &expireTime
+	}
+
+	val, err := json.Marshal(model.ApiKeyRecord{ApiKeyInfo: info, KeyHash: hashApiKey(key)})
+	if err != nil {
+		return result, err
+	}
+	resp, err := kvstore.Txn([]kvstore.Compare{kvstore.CompareNotExist(GenApiKeyKey(keyId))}, []kvstore.Op{kvstore.OpPut(GenApiKeyKey(keyId), string(val))})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	if !resp.Succeeded {
+		return result, fmt.Errorf("the API key %s already exists", keyId)
+	}
+
+	log.Info().Msgf("API key %s (%s, role: %s) is created by %s", keyId, info.Name, info.Role, createdBy)
+	result.ApiKeyInfo = info
+	result.Key = key
+	return result, nil
+}
+
+// getApiKeyRecord returns the stored API key
+func getApiKeyRecord(keyId string) (model.ApiKeyRecord, error) {
+	record := model.ApiKeyRecord{}
+	keyValue, err := kvstore.GetKv(GenApiKeyKey(keyId))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return record, err
+	}
+	if keyValue == (kvstore.KeyValue{}) {
+		return record, fmt.Errorf("the API key %s does not exist", keyId)
+	}
+	err = json.Unmarshal([]byte(keyValue.Value), &record)
+	return record, err
+}
+
+// GetApiKey is func to get an API key (without the key)
+func GetApiKey(keyId string) (model.ApiKeyInfo, error) {
+	record, err := getApiKeyRecord(keyId)
+	return record.ApiKeyInfo, err
+}
+
+// ListApiKey is func to list API keys (without the keys, latest first)
+func ListApiKey() (model.ApiKeyListResponse, error) {
+	result := model.ApiKeyListResponse{ApiKey: []model.ApiKeyInfo{}}
+	keyValue, err := kvstore.GetKvList(GenApiKeyKey(""))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	for _, v := range keyValue {
+		record := model.ApiKeyRecord{}
+		if err := json.Unmarshal([]byte(v.Value), &record); err != nil {
+			log.Error().Err(err).Msgf("failed to unmarshal the API key %s", v.Key)
+			continue
+		}
+		result.ApiKey = append(result.ApiKey, record.ApiKeyInfo)
+	}
+	sort.Slice(result.ApiKey, func(i, j int) bool {
+		return result.ApiKey[i].CreatedTime.After(result.ApiKey[j].CreatedTime)
+	})
+	return result, nil
+}
+
+// RevokeApiKey is func to revoke an API key (the revoked key is kept to be listed)
+func RevokeApiKey(keyId string) (model.ApiKeyInfo, error) {
+	var result model.ApiKeyInfo
+	key := GenApiKeyKey(keyId)
+	err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[key].Exists() {
+			return nil, fmt.Errorf("the API key %s does not exist", keyId)
+		}
+		record := model.ApiKeyRecord{}
+		if err := json.Unmarshal([]byte(current[key].Value), &record); err != nil {
+			return nil, err
+		}
+		if !record.Revoked {
+			now := time.Now()
+			record.Revoked = true
+			record.RevokedTime = &now
+		}
+		result = record.ApiKeyInfo
+		val, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+	if err != nil {
+		return result, err
+	}
+	log.Info().Msgf("API key %s (%s) is revoked", keyId, result.Name)
+	return result, nil
+}
+
+// VerifyApiKey is func to verify an API key and returns its info if it is valid (not revoked nor expired)
+func VerifyApiKey(key string) (model.ApiKeyInfo, error) {
+	invalid := fmt.Errorf("the API key is not valid")
+
+	keyId, _, found := strings.Cut(strings.TrimPrefix(key, model.ApiKeyPrefix), "_")
+	if !strings.HasPrefix(key, model.ApiKeyPrefix) || !found {
+		return model.ApiKeyInfo{}, invalid
+	}
+	// the key ID is the hex of 8 random bytes
+	if _, err := hex.DecodeString(keyId); err != nil || len(keyId) != 16 {
+		return model.ApiKeyInfo{}, invalid
+	}
+	record, err := getApiKeyRecord(keyId)
+	if err != nil {
+		return model.ApiKeyInfo{}, invalid
+	}
+	if subtle.ConstantTimeCompare([]byte(record.KeyHash), []byte(hashApiKey(key))) != 1 {
+		return model.ApiKeyInfo{}, invalid
+	}
+	if record.Revoked {
+		return model.ApiKeyInfo{}, fmt.Errorf("the API key %s is revoked", keyId)
+	}
+	if record.ExpireTime != nil && time.Now().After(*record.ExpireTime) {
+		return model.ApiKeyInfo{}, fmt.Errorf("the API key %s is expired", keyId)
+	}
+	return record.ApiKeyInfo, nil
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// [Audit log of mutating API calls]
+
+// GenAuditKey is func to generate the kvstore key of an audit record
+func GenAuditKey(auditId string) string {
+	return "/audit/" + auditId
+}
+
+// newAuditId returns an ID that sorts by time (zero-padded Unix nanoseconds and a random suffix)
+func newAuditId(t time.Time) string {
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%020d-%s", t.UnixNano(), hex.EncodeToString(suffix))
+}
+
+// IsAuditEnabled returns whether mutating API calls are recorded in the audit log
+func IsAuditEnabled() bool {
+	return !strings.EqualFold(model.AuditEnabled, "false")
+}
+
+// RecordAudit is func to append an audit record (records are never modified once stored)
+func RecordAudit(record model.AuditRecord) {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+	record.Id = newAuditId(record.Time)
+
+	val, err := json.Marshal(record)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to marshal the audit record of %s %s", record.Method, record.Path)
+		return
+	}
+	key := GenAuditKey(record.Id)
+	resp, err := kvstore.Txn([]kvstore.Compare{kvstore.CompareNotExist(key)}, []kvstore.Op{kvstore.OpPut(key, string(val))})
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to store the audit record of %s %s (request: %s)", record.Method, record.Path, record.RequestId)
+		return
+	}
+	if !resp.Succeeded {
+		log.Error().Msgf("the audit record %s already exists", record.Id)
+	}
+}
+
+// RedactAuditBody returns the request body to be stored in an audit record.
+// Bodies of credentials and secrets are not stored, and the values of sensitive fields
+// (e.g., vmUserPassword) are replaced with model.RedactedValue.
+func RedactAuditBody(path string, body []byte) json.RawMessage {
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+	describe := func(msg string) json.RawMessage {
+		b, _ := json.Marshal(msg)
+		return b
+	}
+
+	if isRedactedPath(path) {
+		return describe(model.RedactedValue)
+	}
+	// the body is read up to model.AuditBodyMaxBytes+1 bytes
+	if len(body) > model.AuditBodyMaxBytes {
+		return describe(fmt.Sprintf("[body larger than %d bytes is not stored]", model.AuditBodyMaxBytes))
+	}
+
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return describe(fmt.Sprintf("[non-JSON body of %d bytes is not stored]", len(body)))
+	}
+	redacted, err := json.Marshal(redactValue(data))
+	if err != nil {
+		return describe(model.RedactedValue)
+	}
+	return redacted
+}
+
+// auditPageSize is the number of audit records read from the kvstore at once
+const auditPageSize int64 = 500
+
+// auditTimeKey returns the kvstore key that sorts before the audit records at or after the time
+func auditTimeKey(t time.Time) string {
+	if t.IsZero() {
+		return GenAuditKey("")
+	}
+	return GenAuditKey(fmt.Sprintf("%020d", t.UnixNano()))
+}
+
+// auditEndKey is the kvstore key that sorts after all audit records (audit IDs start with digits)
+var auditEndKey = GenAuditKey("~")
+
+// ListAudit is func to list audit records matching the query (latest first).
+// Records are read page by page in the key range of the time filter, until the limit is reached.
+func ListAudit(query model.AuditQuery) (model.AuditListResponse, error) {
+	result := model.AuditListResponse{Audit: []model.AuditRecord{}}
+
+	startKey := auditTimeKey(query.StartTime)
+	endKey := auditEndKey
+	if !query.EndTime.IsZero() {
+		endKey = auditTimeKey(query.EndTime.Add(time.Nanosecond))
+	}
+	for {
+		keyValue, err := kvstore.GetKvRange(startKey, endKey, kvstore.SortDescend, auditPageSize)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return result, err
+		}
+		for _, kv := range keyValue {
+			if query.Limit > 0 && len(result.Audit) >= query.Limit {
+				return result, nil
+			}
+			record := model.AuditRecord{}
+			if err := json.Unmarshal([]byte(kv.Value), &record); err != nil {
+				log.Error().Err(err).Msgf("failed to unmarshal the audit record %s", kv.Key)
+				continue
+			}
+			if (query.User == "" || record.User == query.User) &&
+				(query.NsId == "" || record.NsId == query.NsId) &&
+				(query.Method == "" || strings.EqualFold(record.Method, query.Method)) &&
+				(query.Resource == "" || strings.Contains(record.Path, query.Resource)) {
+				result.Audit = append(result.Audit, record)
+			}
+		}
+		if int64(len(keyValue)) < auditPageSize {
+			return result, nil
+		}
+		// the next page is the older records (the end of a range is exclusive)
+		endKey = keyValue[len(keyValue)-1].Key
+	}
+}
+
+// auditRetention returns the retention of audit records (TB_AUDIT_RETENTION_DAYS; 0 to keep them forever)
+func auditRetention() time.Duration {
+	days, err := strconv.Atoi(model.AuditRetentionDays)
+	if err != nil || days < 0 {
+		days = 90
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// CleanupAudit is func to delete the audit records older than the retention
+func CleanupAudit() {
+	retention := auditRetention()
+	if retention == 0 {
+		return
+	}
+	endKey := auditTimeKey(time.Now().Add(-retention))
+	deleted := 0
+	for {
+		keyValue, err := kvstore.GetKvRange(GenAuditKey(""), endKey, kvstore.SortAscend, int64(kvstore.MaxTxnOps))
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			break
+		}
+		ops := []kvstore.Op{}
+		for _, kv := range keyValue {
+			ops = append(ops, kvstore.OpDelete(kv.Key))
+		}
+		if len(ops) > 0 {
+			if _, err := kvstore.Txn(nil, ops); err != nil {
+				log.Error().Err(err).Msg("failed to delete expired audit records")
+				break
+			}
+			deleted += len(ops)
+		}
+		if len(keyValue) < kvstore.MaxTxnOps {
+			break
+		}
+	}
+	if deleted > 0 {
+		log.Info().Msgf("%d audit records older than %s are deleted", deleted, retention)
+	}
+}
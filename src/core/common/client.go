@@ -16,7 +16,9 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -38,9 +40,6 @@ type CacheItem[T any] struct {
 // clientCache is a map for cache items of intenal calls
 var clientCache = sync.Map{}
 
-// clientRequestCounter is a map for request counters of intenal calls
-var clientRequestCounter = sync.Map{}
-
 const (
 	// VeryShortDuration is a duration for very short-term cache
 	VeryShortDuration = 1 * time.Second
@@ -63,34 +62,19 @@ func SetUseBody(requestBody interface{}) bool {
 	return true
 }
 
-// limitConcurrentRequests limits the number of Concurrent requests to the given limit
-func limitConcurrentRequests(requestKey string, limit int) bool {
-	count, _ := clientRequestCounter.LoadOrStore(requestKey, 0)
-	currentCount := count.(int)
-
-	if currentCount >= limit {
-		fmt.Printf("[%s] requests for %s \n", currentCount, requestKey)
-		return false
-	}
-
-	clientRequestCounter.Store(requestKey, currentCount+1)
-	return true
+// inflightCall is an HTTP request in flight, shared by the identical requests made concurrently
+type inflightCall struct {
+	done   chan struct{}
+	result interface{}
+	err    error
 }
 
-// requestDone decreases the request counter
-func requestDone(requestKey string) {
-	count, _ := clientRequestCounter.Load(requestKey)
-	if count == nil {
-		return
-	}
-	currentCount := count.(int)
-
-	if currentCount > 0 {
-		clientRequestCounter.Store(requestKey, currentCount-1)
-	}
-}
+// inflightRequests is a map of HTTP requests in flight (request key -> *inflightCall)
+var inflightRequests = sync.Map{}
 
 // ExecuteHttpRequest performs the HTTP request and fills the result (var requestBody interface{} = nil for empty body)
+// Identical requests made concurrently are coalesced into one call, and the result of GET is cached for cacheDuration.
+// Calls are rate-limited, retried and guarded by circuit breakers if the client is created by NewHttpClient.
 func ExecuteHttpRequest[B any, T any](
 	client *resty.Client,
 	method string,
@@ -101,24 +85,39 @@ func ExecuteHttpRequest[B any, T any](
 	result *T, // Generic type
 	cacheDuration time.Duration,
 ) error {
+	return ExecuteHttpRequestWithContext(context.Background(), client, method, url, headers, useBody, body, result, cacheDuration)
+}
 
-	// Generate cache key for GET method only
-	requestKey := ""
-	if method == "GET" {
+// ExecuteHttpRequestWithContext is ExecuteHttpRequest canceled with ctx (e.g. the context of the incoming request or job)
+func ExecuteHttpRequestWithContext[B any, T any](
+	ctx context.Context,
+	client *resty.Client,
+	method string,
+	url string,
+	headers map[string]string,
+	useBody bool,
+	body *B,
+	result *T,
+	cacheDuration time.Duration,
+) error {
 
-		if useBody {
-			// Serialize the body to JSON
-			bodyString, err := json.Marshal(body)
-			if err != nil {
-				return fmt.Errorf("JSON marshaling failed: %w", err)
-			}
-			// Create cache key using both URL and body
-			requestKey = fmt.Sprintf("%s_%s_%s", method, url, string(bodyString))
-		} else {
-			// Create cache key using only URL
-			requestKey = fmt.Sprintf("%s_%s", method, url)
+	// Generate the key of the request to coalesce identical requests (and to cache GET results)
+	requestKey := fmt.Sprintf("%s_%s", method, url)
+	if useBody {
+		// Serialize the body to JSON
+		bodyString, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("JSON marshaling failed: %w", err)
 		}
+		// Create the key using both URL and body
+		requestKey = fmt.Sprintf("%s_%s_%s", method, url, string(bodyString))
+	}
+	if len(headers) > 0 {
+		headerString, _ := json.Marshal(headers)
+		requestKey += "_" + string(headerString)
+	}
 
+	if method == "GET" {
 		if item, found := clientCache.Load(requestKey); found {
 			// Ensure safe type assertion
 			cachedItem, ok := item.(CacheItem[T])
@@ -130,58 +129,70 @@ func ExecuteHttpRequest[B any, T any](
 
 			if time.Now().Before(cachedItem.ExpiresAt) {
 				log.Trace().Msgf("Cache hit! Expires: %v", time.Now().Sub(cachedItem.ExpiresAt))
+				clientCacheRequests.WithLabelValues("hit").Inc()
 				*result = cachedItem.Response
-				//val := reflect.ValueOf(result).Elem()
-				//cachedVal := reflect.ValueOf(cachedItem.Response)
-				//val.Set(cachedVal)
-
 				return nil
 			} else {
-				//log.Trace().Msg("Cache item expired!")
 				clientCache.Delete(requestKey)
 			}
 		}
+		clientCacheRequests.WithLabelValues("miss").Inc()
+	}
 
-		// Limit the number of concurrent requests
-		concurrencyLimit := 10
-		retryWait := 5 * time.Second
-		retryLimit := 3
-		retryCount := 0
-		// try to wait for the upcoming cached result when sending queue is full
-		for {
-			if !limitConcurrentRequests(requestKey, concurrencyLimit) {
-				if retryCount >= retryLimit {
-					log.Debug().Msgf("Too many same requests: %s\n", requestKey)
-					return fmt.Errorf("Too many same requests: %s", requestKey)
-				}
-				time.Sleep(retryWait)
-
-				if item, found := clientCache.Load(requestKey); found {
-					cachedItem, ok := item.(CacheItem[T])
-					if !ok {
-						log.Error().Msgf("Type assertion failed for cache item while waiting: expected CacheItem[%T], got %T", *result, item)
-						clientCache.Delete(requestKey) // Delete invalid cache item
-						return fmt.Errorf("type assertion failed for cache item while waiting")
-					}
-					*result = cachedItem.Response
-					// release the request count for parallel requests limit
-					requestDone(requestKey)
-					log.Debug().Msg("Got the cached result while waiting")
-					return nil
-				}
-				retryCount++
-			} else {
-				break
-			}
+	// Wait for the identical request in flight instead of sending a new one
+	call := &inflightCall{done: make(chan struct{})}
+	if v, loaded := inflightRequests.LoadOrStore(requestKey, call); loaded {
+		shared := v.(*inflightCall)
+		select {
+		case <-shared.done:
+		case <-ctx.Done():
+			return fmt.Errorf("[Error from: %s] Message: %w", url, ctx.Err())
+		}
+		if sharedResult, ok := shared.result.(T); ok {
+			log.Trace().Msgf("Coalesced with the request in flight: %s", requestKey)
+			*result = sharedResult
+			return shared.err
+		}
+		if shared.err != nil && !errors.Is(shared.err, context.Canceled) {
+			return shared.err
 		}
+		// the result type of the other caller is different (or the other caller canceled); send the request
+		return doHttpRequest(ctx, client, method, url, headers, useBody, body, result)
 	}
 
+	defer func() {
+		inflightRequests.Delete(requestKey)
+		close(call.done)
+	}()
+
+	call.err = doHttpRequest(ctx, client, method, url, headers, useBody, body, result)
+	if call.err == nil && result != nil {
+		call.result = *result
+		// Update the cache for GET method only
+		if method == "GET" {
+			clientCache.Store(requestKey, CacheItem[T]{Response: *result, ExpiresAt: time.Now().Add(cacheDuration)})
+		}
+	}
+	return call.err
+}
+
+// doHttpRequest sends the HTTP request and fills the result
+func doHttpRequest[B any, T any](
+	ctx context.Context,
+	client *resty.Client,
+	method string,
+	url string,
+	headers map[string]string,
+	useBody bool,
+	body *B,
+	result *T,
+) error {
 	// Perform the HTTP request using Resty
 	//client.SetDebug(true)
 	// SetAllowGetMethodPayload should be set to true for GET method to allow payload
 	// NOTE: Need to removed when cb-spider api is stopped to use GET method with payload
 	client.SetAllowGetMethodPayload(true)
-	req := client.R().SetHeader("Content-Type", "application/json").SetResult(result)
+	req := client.R().SetContext(ctx).SetHeader("Content-Type", "application/json").SetResult(result)
 
 	if headers != nil {
 		req = req.SetHeaders(headers)
@@ -194,6 +205,11 @@ func ExecuteHttpRequest[B any, T any](
 	var resp *resty.Response
 	var err error
 
+	start := time.Now()
+	defer func() {
+		observeOutboundRequest(req, resp, err, time.Since(start))
+	}()
+
 	// Execute HTTP method based on the given type
 	switch method {
 	case "GET":
@@ -209,37 +225,13 @@ func ExecuteHttpRequest[B any, T any](
 	}
 
 	if err != nil {
-		if method == "GET" {
-			requestDone(requestKey)
-		}
-		return fmt.Errorf("[Error from: %s] Message: %s", url, err.Error())
+		return fmt.Errorf("[Error from: %s] Message: %w", url, err)
 	}
 
 	if resp.IsError() {
-		if method == "GET" {
-			requestDone(requestKey)
-		}
 		return fmt.Errorf("[Error from: %s] Status code: %s, Message: %s", url, resp.Status(), resp.Body())
 	}
 
-	// Update the cache for GET method only
-	if method == "GET" {
-
-		//val := reflect.ValueOf(result).Elem()
-		//newCacheItem := val.Interface()
-
-		// release the request count for parallel requests limit
-		requestDone(requestKey)
-
-		// Check if result is nil
-		if result == nil {
-			log.Trace().Msg("Fesult is nil, not caching")
-		} else {
-			clientCache.Store(requestKey, CacheItem[T]{Response: *result, ExpiresAt: time.Now().Add(cacheDuration)})
-			//log.Trace().Msg("Cached successfully!")
-		}
-	}
-
 	return nil
 }
 
@@ -350,7 +342,15 @@ func EndRequestWithLog(c echo.Context, err error, responseData interface{}) erro
 }
 
 // UpdateRequestProgress updates the handling status of the request.
+// If the request runs as a job, the progress is also persisted in the job.
 func UpdateRequestProgress(reqID string, progressData interface{}) {
+	switch p := progressData.(type) {
+	case ProgressInfo:
+		AddJobProgress(reqID, model.JobProgress{Title: p.Title, Info: p.Info, Time: p.Time})
+	default:
+		AddJobProgress(reqID, model.JobProgress{Info: p, Time: time.Now()})
+	}
+
 	if v, ok := RequestMap.Load(reqID); ok {
 		details := v.(RequestDetails)
 
@@ -369,7 +369,7 @@ func UpdateRequestProgress(reqID string, progressData interface{}) {
 
 // ForwardRequestToAny forwards the given request to the specified path
 func ForwardRequestToAny(reqPath string, method string, requestBody interface{}) (interface{}, error) {
-	client := resty.New()
+	client := NewHttpClient()
 	var callResult interface{}
 
 	url := model.SpiderRestUrl + "/" + reqPath
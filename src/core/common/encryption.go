@@ -0,0 +1,567 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// [Envelope encryption of sensitive fields in the kvstore]
+// Each value is encrypted with its own data key (AES-256-GCM), and the data key is encrypted (wrapped)
+// with the master key. Rotating the master key re-wraps the data keys only.
+
+// secretKey is a master key
+type secretKey struct {
+	id      string
+	key     []byte
+	source  string
+	created time.Time
+}
+
+// secretKeyring is the master keys available to this instance
+type secretKeyring struct {
+	active string
+	keys   map[string]secretKey
+}
+
+// kmsKeyringFile is the stored form of the local KMS keyring (TB_SECRET_KMS_PATH)
+type kmsKeyringFile struct {
+	ActiveKeyId string `json:"activeKeyId"`
+	Keys        []struct {
+		KeyId       string    `json:"keyId"`
+		Key         string    `json:"key"`
+		CreatedTime time.Time `json:"createdTime"`
+	} `json:"keys"`
+}
+
+var (
+	keyringMu sync.Mutex
+	keyring   *secretKeyring
+)
+
+// secretKeyId returns the ID of a master key (its fingerprint)
+func secretKeyId(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// decodeMasterKey decodes a master key given in base64 (or as 32 raw bytes)
+func decodeMasterKey(s string) ([]byte, error) {
+	trimmed := strings.TrimSpace(s)
+	if key, err := base64.StdEncoding.DecodeString(trimmed); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if len(s) == 32 {
+		return []byte(s), nil
+	}
+	return nil, fmt.Errorf("the master key should be 32 bytes in base64 (e.g., openssl rand -base64 32)")
+}
+
+// add adds the master key to the keyring
+func (kr *secretKeyring) add(key []byte, source string, created time.Time) string {
+	id := secretKeyId(key)
+	if _, ok := kr.keys[id]; !ok {
+		kr.keys[id] = secretKey{id: id, key: key, source: source, created: created}
+	}
+	return id
+}
+
+// isKmsActive checks if the active master key is managed by the local KMS
+func isKmsActive() bool {
+	return model.SecretMasterKey == "" && model.SecretMasterKeyFile == ""
+}
+
+// IsSharedKvStore checks if the kvstore is shared by other instances (a key generated in the local KMS
+// of one instance cannot be used by the others to decrypt the values)
+func IsSharedKvStore() bool {
+	return model.KvStoreType == "etcd"
+}
+
+// errKmsKeyringPerInstance is the error for a key to be generated in the local KMS of an instance sharing the kvstore
+func errKmsKeyringPerInstance() error {
+	return fmt.Errorf("the local KMS keyring (%s) is per instance, and the kvstore (%s) is shared; set the same master key in %s or %s on all instances",
+		model.SecretKmsPath, model.KvStoreType, model.StrSecretMasterKey, model.StrSecretMasterKeyFile)
+}
+
+// loadKeyring loads the master keys from the local KMS keyring, the environment variables and the key file
+func loadKeyring() (*secretKeyring, error) {
+	kr := &secretKeyring{keys: map[string]secretKey{}}
+
+	// keys in the local KMS (the active one is used if no master key is given)
+	kms, err := readKmsKeyring(isKmsActive())
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range kms.Keys {
+		key, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("malformed key %s in the local KMS keyring: %w", k.KeyId, err)
+		}
+		kr.add(key, model.SecretKeySourceKms, k.CreatedTime)
+	}
+	kr.active = kms.ActiveKeyId
+
+	// previous master keys (to decrypt the values until they are rotated)
+	for _, s := range strings.Split(model.SecretMasterKeyPrevious, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		key, err := decodeMasterKey(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", model.StrSecretMasterKeyPrevious, err)
+		}
+		kr.add(key, model.SecretKeySourceEnv, time.Time{})
+	}
+
+	if model.SecretMasterKeyFile != "" {
+		data, err := os.ReadFile(model.SecretMasterKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the master key file: %w", err)
+		}
+		key, err := decodeMasterKey(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", model.StrSecretMasterKeyFile, err)
+		}
+		kr.active = kr.add(key, model.SecretKeySourceFile, time.Time{})
+	}
+	if model.SecretMasterKey != "" {
+		key, err := decodeMasterKey(model.SecretMasterKey)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", model.StrSecretMasterKey, err)
+		}
+		kr.active = kr.add(key, model.SecretKeySourceEnv, time.Time{})
+	}
+
+	if _, ok := kr.keys[kr.active]; !ok {
+		return nil, fmt.Errorf("the active master key %s is not available", kr.active)
+	}
+	return kr, nil
+}
+
+// readKmsKeyring reads the local KMS keyring (a keyring with a new key is created if create is set and it does not exist)
+func readKmsKeyring(create bool) (kmsKeyringFile, error) {
+	kms := kmsKeyringFile{}
+	data, err := os.ReadFile(model.SecretKmsPath)
+	if err == nil {
+		if err := json.Unmarshal(data, &kms); err != nil {
+			return kms, fmt.Errorf("malformed local KMS keyring %s: %w", model.SecretKmsPath, err)
+		}
+		return kms, nil
+	}
+	if !os.IsNotExist(err) {
+		return kms, fmt.Errorf("failed to read the local KMS keyring: %w", err)
+	}
+	if !create {
+		return kms, nil
+	}
+	if IsSharedKvStore() {
+		return kms, errKmsKeyringPerInstance()
+	}
+	if err := addKmsKey(&kms); err != nil {
+		return kms, err
+	}
+	log.Info().Msgf("a master key (%s) is generated in the local KMS keyring %s", kms.ActiveKeyId, model.SecretKmsPath)
+	return kms, nil
+}
+
+// addKmsKey generates a new key in the local KMS keyring, makes it active, and stores the keyring
+func addKmsKey(kms *kmsKeyringFile) error {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	id := secretKeyId(key)
+	kms.Keys = append(kms.Keys, struct {
+		KeyId       string    `json:"keyId"`
+		Key         string    `json:"key"`
+		CreatedTime time.Time `json:"createdTime"`
+	}{KeyId: id, Key: base64.StdEncoding.EncodeToString(key), CreatedTime: time.Now()})
+	kms.ActiveKeyId = id
+
+	data, err := json.MarshalIndent(kms, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(model.SecretKmsPath), 0700); err != nil {
+		return fmt.Errorf("failed to create the directory of the local KMS keyring: %w", err)
+	}
+	// write to a temporary file and rename it, so that the keyring is never left half-written
+	tmp := model.SecretKmsPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write the local KMS keyring: %w", err)
+	}
+	return os.Rename(tmp, model.SecretKmsPath)
+}
+
+// CheckSecretKeyring is func to check that the master keys are available (called on startup).
+// If the kvstore is shared, the master key must be given by TB_SECRET_MASTER_KEY or TB_SECRET_MASTER_KEY_FILE
+// (the same key on all instances).
+func CheckSecretKeyring() error {
+	if IsSharedKvStore() && isKmsActive() {
+		return errKmsKeyringPerInstance()
+	}
+	_, err := getKeyring(false)
+	return err
+}
+
+// getKeyring returns the master keys (loaded on the first use, or reloaded if reload is set)
+func getKeyring(reload bool) (*secretKeyring, error) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	if keyring == nil || reload {
+		kr, err := loadKeyring()
+		if err != nil {
+			return nil, err
+		}
+		keyring = kr
+	}
+	return keyring, nil
+}
+
+// sealGcm encrypts the data with AES-256-GCM (the nonce is prepended)
+func sealGcm(key []byte, data []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// openGcm decrypts the data sealed by sealGcm
+func openGcm(key []byte, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("the encrypted value is too short")
+	}
+	return gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+}
+
+// IsEncryptedSecret checks if the value is encrypted by EncryptSecret
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, model.EncryptedSecretPrefix)
+}
+
+// EncryptSecret is func to encrypt a sensitive value to be stored in the kvstore
+// (empty and already encrypted values are returned as they are)
+func EncryptSecret(plaintext string) (string, error) {
+	if plaintext == "" || IsEncryptedSecret(plaintext) {
+		return plaintext, nil
+	}
+	kr, err := getKeyring(false)
+	if err != nil {
+		return "", err
+	}
+	master := kr.keys[kr.active]
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	ciphertext, err := sealGcm(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := sealGcm(master.key, dataKey)
+	if err != nil {
+		return "", err
+	}
+	return model.EncryptedSecretPrefix + master.id + ":" +
+		base64.RawURLEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawURLEncoding.EncodeToString(ciphertext), nil
+}
+
+// EncryptSecretFields is func to encrypt the sensitive fields of a record in place
+func EncryptSecretFields(fields ...*string) error {
+	for _, f := range fields {
+		encrypted, err := EncryptSecret(*f)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt a sensitive field: %w", err)
+		}
+		*f = encrypted
+	}
+	return nil
+}
+
+// parseEncryptedSecret returns the master key ID, the wrapped data key and the ciphertext of the encrypted value
+func parseEncryptedSecret(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, model.EncryptedSecretPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value")
+	}
+	wrappedKey, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	ciphertext, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	return parts[0], wrappedKey, ciphertext, nil
+}
+
+// unwrapDataKey decrypts the data key with the master key
+// (the keyring is reloaded once if the master key is unknown, e.g., added to the local KMS by another instance)
+func unwrapDataKey(keyId string, wrappedKey []byte) ([]byte, error) {
+	kr, err := getKeyring(false)
+	if err != nil {
+		return nil, err
+	}
+	master, ok := kr.keys[keyId]
+	if !ok {
+		if kr, err = getKeyring(true); err != nil {
+			return nil, err
+		}
+		if master, ok = kr.keys[keyId]; !ok {
+			return nil, fmt.Errorf("the master key %s is not available (set it in %s)", keyId, model.StrSecretMasterKeyPrevious)
+		}
+	}
+	dataKey, err := openGcm(master.key, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the data key with the master key %s: %w", keyId, err)
+	}
+	return dataKey, nil
+}
+
+// DecryptSecret is func to decrypt a value encrypted by EncryptSecret
+// (values stored in plain text before the encryption was introduced are returned as they are)
+func DecryptSecret(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	keyId, wrappedKey, ciphertext, err := parseEncryptedSecret(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := unwrapDataKey(keyId, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := openGcm(dataKey, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt the value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// RevealSecret is func to decrypt a sensitive value read from the kvstore.
+// It returns an empty string (not the ciphertext) if the value cannot be decrypted.
+func RevealSecret(value string) string {
+	plaintext, err := DecryptSecret(value)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to decrypt a sensitive field")
+		return ""
+	}
+	return plaintext
+}
+
+// rewrapSecret re-encrypts the value with the active master key
+// (only the data key is re-wrapped; values in plain text are encrypted)
+func rewrapSecret(value string) (string, bool, error) {
+	if value == "" {
+		return value, false, nil
+	}
+	if !IsEncryptedSecret(value) {
+		encrypted, err := EncryptSecret(value)
+		return encrypted, err == nil, err
+	}
+	keyId, wrappedKey, ciphertext, err := parseEncryptedSecret(value)
+	if err != nil {
+		return "", false, err
+	}
+	kr, err := getKeyring(false)
+	if err != nil {
+		return "", false, err
+	}
+	if keyId == kr.active {
+		return value, false, nil
+	}
+	dataKey, err := unwrapDataKey(keyId, wrappedKey)
+	if err != nil {
+		return "", false, err
+	}
+	master := kr.keys[kr.active]
+	rewrapped, err := sealGcm(master.key, dataKey)
+	if err != nil {
+		return "", false, err
+	}
+	return model.EncryptedSecretPrefix + master.id + ":" +
+		base64.RawURLEncoding.EncodeToString(rewrapped) + ":" +
+		base64.RawURLEncoding.EncodeToString(ciphertext), true, nil
+}
+
+// secretFieldsOfKey returns the sensitive fields of the record stored at the key
+func secretFieldsOfKey(key string) []string {
+	segments := strings.Split(strings.TrimPrefix(key, "/"), "/")
+	if len(segments) < 4 || segments[0] != "ns" {
+		return nil
+	}
+	switch {
+	case len(segments) == 5 && segments[2] == "resources" && segments[3] == model.StrSSHKey:
+		// /ns/{nsId}/resources/sshKey/{sshKeyId}
+		return []string{"privateKey"}
+	case len(segments) == 6 && segments[2] == "mci" && segments[4] == "vm":
+		// /ns/{nsId}/mci/{mciId}/vm/{vmId}
+		return []string{"vmUserPassword"}
+	case len(segments) == 4 && segments[2] == "secret":
+		// /ns/{nsId}/secret/{name}
+		return []string{"value"}
+	}
+	return nil
+}
+
+// ListSecretKey is func to list the master keys available to this instance
+func ListSecretKey() (model.SecretKeyListResponse, error) {
+	result := model.SecretKeyListResponse{SecretKey: []model.SecretKeyInfo{}}
+	kr, err := getKeyring(true)
+	if err != nil {
+		return result, err
+	}
+	for _, k := range kr.keys {
+		result.SecretKey = append(result.SecretKey, model.SecretKeyInfo{
+			KeyId: k.id, Source: k.source, Active: k.id == kr.active, CreatedTime: k.created,
+		})
+	}
+	sort.Slice(result.SecretKey, func(i, j int) bool {
+		return result.SecretKey[i].CreatedTime.Before(result.SecretKey[j].CreatedTime)
+	})
+	return result, nil
+}
+
+// RotateSecretKey is func to re-encrypt the sensitive fields of all records with the active master key.
+// If generate is set, a new master key is generated in the local KMS and becomes active first
+// (if the master key is given by TB_SECRET_MASTER_KEY or TB_SECRET_MASTER_KEY_FILE, set the new key there,
+// keep the old key in TB_SECRET_MASTER_KEY_PREVIOUS, and rotate without generate).
+func RotateSecretKey(generate bool) (model.SecretKeyRotationResult, error) {
+	result := model.SecretKeyRotationResult{}
+
+	if generate {
+		if !isKmsActive() {
+			return result, fmt.Errorf("the master key is given by %s or %s; set the new key there (with the old key in %s) and rotate without generating a key",
+				model.StrSecretMasterKey, model.StrSecretMasterKeyFile, model.StrSecretMasterKeyPrevious)
+		}
+		if IsSharedKvStore() {
+			return result, errKmsKeyringPerInstance()
+		}
+		keyringMu.Lock()
+		kms, err := readKmsKeyring(true)
+		if err == nil {
+			err = addKmsKey(&kms)
+		}
+		keyringMu.Unlock()
+		if err != nil {
+			return result, err
+		}
+	}
+	kr, err := getKeyring(true)
+	if err != nil {
+		return result, err
+	}
+	result.ActiveKeyId = kr.active
+
+	keyValue, err := kvstore.GetKvList("/ns/")
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	for _, kv := range keyValue {
+		fields := secretFieldsOfKey(kv.Key)
+		if len(fields) == 0 {
+			continue
+		}
+		changed := 0
+		key := kv.Key
+		err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+			changed = 0
+			if !current[key].Exists() {
+				return nil, nil
+			}
+			record := map[string]json.RawMessage{}
+			if err := json.Unmarshal([]byte(current[key].Value), &record); err != nil {
+				return nil, err
+			}
+			for _, field := range fields {
+				raw, ok := record[field]
+				if !ok {
+					continue
+				}
+				var value string
+				if err := json.Unmarshal(raw, &value); err != nil {
+					continue
+				}
+				rewrapped, updated, err := rewrapSecret(value)
+				if err != nil {
+					return nil, err
+				}
+				if updated {
+					record[field], _ = json.Marshal(rewrapped)
+					changed++
+				}
+			}
+			if changed == 0 {
+				return nil, nil
+			}
+			val, err := json.Marshal(record)
+			if err != nil {
+				return nil, err
+			}
+			return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to re-encrypt the record %s", key)
+			result.Failed = append(result.Failed, key)
+			continue
+		}
+		if changed > 0 {
+			result.Records++
+			result.Fields += changed
+		}
+	}
+	log.Info().Msgf("re-encrypted %d fields of %d records with the master key %s (failed: %d)",
+		result.Fields, result.Records, result.ActiveKeyId, len(result.Failed))
+	return result, nil
+}
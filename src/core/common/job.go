@@ -0,0 +1,534 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// [Durable jobs for long-running operations]
+
+// ErrJobCanceled is returned by CheckJobCanceled when the job of the request is canceled
+var ErrJobCanceled = errors.New("the job is canceled")
+
+// jobHeartbeatInterval is the interval to refresh the heartbeat of running jobs
+// (and to check the cancel requests made through other instances)
+const jobHeartbeatInterval = 10 * time.Second
+
+// jobStaleAfter is the time without heartbeat after which a running job is considered interrupted
+const jobStaleAfter = 6 * jobHeartbeatInterval
+
+// jobInstanceId identifies this Tumblebug process as the owner of the jobs it runs (hostname/pid/start time).
+// A restarted process has a new ID even on the same host.
+var jobInstanceId string
+
+// jobInstanceHost is the hostname part of jobInstanceId
+var jobInstanceHost string
+
+func init() {
+	jobInstanceHost, _ = os.Hostname()
+	jobInstanceId = fmt.Sprintf("%s/%d/%d", jobInstanceHost, os.Getpid(), time.Now().UnixNano())
+}
+
+// JobFunc is the function of a job. It should return when ctx is canceled if the job is cancelable.
+type JobFunc func(ctx context.Context) (interface{}, error)
+
+// JobSpec is struct for the description of a job to start
+type JobSpec struct {
+	// Id is the job ID (generated if empty)
+	Id string
+	// RequestId is the request ID (X-Request-Id) of the request that starts the job
+	RequestId string
+	Kind      string
+	NsId      string
+	TargetId  string
+	// Cancelable is set if the job function stops when its context is canceled
+	Cancelable bool
+	Request    RequestInfo
+	// SpanContext is the span of the request that starts the job (the job is traced as its child)
+	SpanContext trace.SpanContext
+}
+
+// runningJob is a job running in this instance
+type runningJob struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// mu serializes the updates of the job by this instance
+	mu sync.Mutex
+}
+
+// runningJobs is the map of jobs running in this instance (jobId -> *runningJob)
+var runningJobs sync.Map
+
+// requestJobs is the map of the requests whose jobs are running in this instance (reqId -> jobId)
+var requestJobs sync.Map
+
+// runningJobOfRequest returns the job of the request running in this instance
+func runningJobOfRequest(reqId string) (string, *runningJob, bool) {
+	v, ok := requestJobs.Load(reqId)
+	if !ok {
+		return "", nil, false
+	}
+	jobId := v.(string)
+	rj, ok := runningJobs.Load(jobId)
+	if !ok {
+		return "", nil, false
+	}
+	return jobId, rj.(*runningJob), true
+}
+
+// GenJobKey is func to generate the kvstore key of a job (an empty ID returns the prefix of all jobs)
+func GenJobKey(jobId string) string {
+	return "/job/" + jobId
+}
+
+// isJobFinished checks if the job status is final
+func isJobFinished(status string) bool {
+	switch status {
+	case model.JobStatusSucceeded, model.JobStatusFailed, model.JobStatusCanceled, model.JobStatusInterrupted:
+		return true
+	}
+	return false
+}
+
+// jobRetention returns the retention of finished jobs (TB_JOB_RETENTION_HOURS)
+func jobRetention() time.Duration {
+	hours, err := strconv.Atoi(model.JobRetentionHours)
+	if err != nil || hours <= 0 {
+		hours = 72
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// updateJob updates the job in the kvstore with the update function
+// (the update is skipped if the function returns false)
+func updateJob(jobId string, update func(job *model.JobInfo) bool) (model.JobInfo, error) {
+	if v, ok := runningJobs.Load(jobId); ok {
+		rj := v.(*runningJob)
+		rj.mu.Lock()
+		defer rj.mu.Unlock()
+	}
+
+	key := GenJobKey(jobId)
+	result := model.JobInfo{}
+	err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if current[key].Value == "" {
+			return nil, fmt.Errorf("the job %s does not exist", jobId)
+		}
+		job := model.JobInfo{}
+		if err := json.Unmarshal([]byte(current[key].Value), &job); err != nil {
+			return nil, err
+		}
+		if !update(&job) {
+			result = job
+			return nil, nil
+		}
+		result = job
+		val, err := json.Marshal(job)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+	return result, err
+}
+
+// StartJob is func to persist a job and run its function in the background.
+// The returned channel is closed when the job is finished.
+func StartJob(spec JobSpec, fn JobFunc) (model.JobInfo, <-chan struct{}, error) {
+	// the job ID is generated by the server, since a request ID given by the client may be reused (e.g., on retries)
+	if spec.Id == "" {
+		spec.Id = GenUid()
+	}
+	now := time.Now()
+	job := model.JobInfo{
+		Id:            spec.Id,
+		RequestId:     spec.RequestId,
+		Kind:          spec.Kind,
+		NsId:          spec.NsId,
+		TargetId:      spec.TargetId,
+		Status:        model.JobStatusQueued,
+		Owner:         jobInstanceId,
+		Cancelable:    spec.Cancelable,
+		RequestMethod: spec.Request.Method,
+		RequestUrl:    spec.Request.URL,
+		RequestBody:   RedactRequestBody(spec.Request.URL, spec.Request.Body),
+		CreatedTime:   now,
+		HeartbeatTime: now,
+	}
+	val, err := json.Marshal(job)
+	if err != nil {
+		return job, nil, err
+	}
+
+	key := GenJobKey(job.Id)
+	resp, err := kvstore.Txn([]kvstore.Compare{kvstore.CompareNotExist(key)}, []kvstore.Op{kvstore.OpPut(key, string(val))})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return job, nil, err
+	}
+	if !resp.Succeeded {
+		return job, nil, fmt.Errorf("the job %s already exists", job.Id)
+	}
+
+	// the job outlives the request, but it belongs to the trace of the request
+	ctx, cancel := context.WithCancel(trace.ContextWithSpanContext(context.Background(), spec.SpanContext))
+	rj := &runningJob{ctx: ctx, cancel: cancel}
+	runningJobs.Store(job.Id, rj)
+	if job.RequestId != "" {
+		requestJobs.Store(job.RequestId, job.Id)
+	}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		defer runningJobs.Delete(job.Id)
+		if job.RequestId != "" {
+			defer requestJobs.CompareAndDelete(job.RequestId, job.Id)
+		}
+		defer cancel()
+
+		_, err := updateJob(job.Id, func(j *model.JobInfo) bool {
+			j.Status = model.JobStatusRunning
+			j.StartTime = time.Now()
+			return true
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to update the job %s", job.Id)
+		}
+
+		stopHeartbeat := make(chan struct{})
+		go jobHeartbeat(job.Id, rj, stopHeartbeat)
+
+		spanCtx, span := StartSpan(ctx, "job "+job.Kind,
+			attribute.String("job.id", job.Id), attribute.String("ns.id", job.NsId), attribute.String("target.id", job.TargetId))
+		result, fnErr := runJobFunc(spanCtx, fn)
+		EndSpan(span, fnErr)
+		close(stopHeartbeat)
+
+		_, err = updateJob(job.Id, func(j *model.JobInfo) bool {
+			j.EndTime = time.Now()
+			j.ExpireTime = j.EndTime.Add(jobRetention())
+			// the job is finished after it was checkpointed at shutdown
+			j.Checkpoint = nil
+			switch {
+			case fnErr == nil:
+				j.Status = model.JobStatusSucceeded
+				// the stored result is readable by any role with GET /job, so secrets (e.g., VM passwords) are redacted
+				j.Result = RedactSecretValue(result)
+			case ctx.Err() != nil:
+				j.Status = model.JobStatusCanceled
+				j.Error = fnErr.Error()
+			default:
+				j.Status = model.JobStatusFailed
+				j.Error = fnErr.Error()
+			}
+			return true
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to update the job %s", job.Id)
+		}
+		log.Info().Msgf("[Job] %s (%s) is finished (error: %v)", job.Id, job.Kind, fnErr)
+	}()
+
+	return job, done, nil
+}
+
+// runJobFunc runs the job function and converts a panic into an error
+func runJobFunc(ctx context.Context, fn JobFunc) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error().Msgf("[Job] panic: %v", r)
+			err = fmt.Errorf("the job panicked: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+// jobHeartbeat refreshes the heartbeat of the running job and applies the cancel requests made through other instances
+func jobHeartbeat(jobId string, rj *runningJob, stop <-chan struct{}) {
+	ticker := time.NewTicker(jobHeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			job, err := updateJob(jobId, func(j *model.JobInfo) bool {
+				j.HeartbeatTime = time.Now()
+				return true
+			})
+			if err != nil {
+				log.Error().Err(err).Msgf("failed to refresh the heartbeat of the job %s", jobId)
+				continue
+			}
+			if job.CancelRequested && job.Cancelable {
+				rj.cancel()
+			}
+		}
+	}
+}
+
+// CheckJobCanceled is func to check if the job of the request is canceled
+// (a checkpoint for long operations running as jobs; returns nil for requests that are not jobs)
+func CheckJobCanceled(reqID string) error {
+	if _, rj, ok := runningJobOfRequest(reqID); ok {
+		if rj.ctx.Err() != nil {
+			return ErrJobCanceled
+		}
+	}
+	return nil
+}
+
+// AddJobProgress is func to append a progress event to the job of the request running in this instance
+func AddJobProgress(reqID string, progress model.JobProgress) {
+	jobId, _, ok := runningJobOfRequest(reqID)
+	if !ok {
+		return
+	}
+	_, err := updateJob(jobId, func(j *model.JobInfo) bool {
+		j.Progress = append(j.Progress, progress)
+		if len(j.Progress) > model.JobProgressMaxEntries {
+			j.Progress = j.Progress[len(j.Progress)-model.JobProgressMaxEntries:]
+		}
+		return true
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to add progress to the job %s", jobId)
+	}
+}
+
+// GetJob is func to get a job
+func GetJob(jobId string) (model.JobInfo, error) {
+	job := model.JobInfo{}
+	keyValue, err := kvstore.GetKv(GenJobKey(jobId))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return job, err
+	}
+	if keyValue == (kvstore.KeyValue{}) {
+		return job, fmt.Errorf("the job %s does not exist", jobId)
+	}
+	err = json.Unmarshal([]byte(keyValue.Value), &job)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return job, err
+	}
+	return job, nil
+}
+
+// GetJobOfRequest is func to get the (latest) job started by the request
+func GetJobOfRequest(reqId string) (model.JobInfo, error) {
+	if jobId, _, ok := runningJobOfRequest(reqId); ok {
+		return GetJob(jobId)
+	}
+	jobs, err := ListJob("", "", "", reqId)
+	if err != nil {
+		return model.JobInfo{}, err
+	}
+	if len(jobs.Job) == 0 {
+		return model.JobInfo{}, fmt.Errorf("the request %s has no job", reqId)
+	}
+	return jobs.Job[0], nil
+}
+
+// ListJob is func to list jobs filtered by status, kind, namespace and request ID (latest first)
+func ListJob(status string, kind string, nsId string, reqId string) (model.JobListResponse, error) {
+	result := model.JobListResponse{Job: []model.JobInfo{}}
+	keyValue, err := kvstore.GetKvList(GenJobKey(""))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	for _, kv := range keyValue {
+		job := model.JobInfo{}
+		if err := json.Unmarshal([]byte(kv.Value), &job); err != nil {
+			log.Error().Err(err).Msg("")
+			continue
+		}
+		if (status == "" || strings.EqualFold(job.Status, status)) &&
+			(kind == "" || strings.EqualFold(job.Kind, kind)) &&
+			(nsId == "" || job.NsId == nsId) &&
+			(reqId == "" || job.RequestId == reqId) {
+			result.Job = append(result.Job, job)
+		}
+	}
+	sort.SliceStable(result.Job, func(i, j int) bool {
+		return result.Job[i].CreatedTime.After(result.Job[j].CreatedTime)
+	})
+	return result, nil
+}
+
+// CancelJob is func to cancel a job. A job running in another instance is canceled at its next heartbeat.
+func CancelJob(jobId string) (model.JobInfo, error) {
+	job, err := updateJob(jobId, func(j *model.JobInfo) bool {
+		if isJobFinished(j.Status) || !j.Cancelable || j.CancelRequested {
+			return false
+		}
+		j.CancelRequested = true
+		return true
+	})
+	if err != nil {
+		return job, err
+	}
+	if isJobFinished(job.Status) {
+		return job, fmt.Errorf("the job %s is already finished (%s)", jobId, job.Status)
+	}
+	if !job.Cancelable {
+		return job, fmt.Errorf("the job %s (%s) cannot be canceled", jobId, job.Kind)
+	}
+	if v, ok := runningJobs.Load(jobId); ok {
+		v.(*runningJob).cancel()
+	}
+	log.Info().Msgf("[Job] cancel is requested for %s (%s)", jobId, job.Kind)
+	return job, nil
+}
+
+// DelJob is func to delete a finished job
+func DelJob(jobId string) error {
+	job, err := GetJob(jobId)
+	if err != nil {
+		return err
+	}
+	if !isJobFinished(job.Status) {
+		return fmt.Errorf("the job %s is not finished (%s)", jobId, job.Status)
+	}
+	return kvstore.Delete(GenJobKey(jobId))
+}
+
+// interruptJobs marks the unfinished jobs matching the condition as interrupted
+func interruptJobs(reason string, interrupted func(job model.JobInfo) bool) {
+	keyValue, err := kvstore.GetKvList(GenJobKey(""))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return
+	}
+	for _, kv := range keyValue {
+		job := model.JobInfo{}
+		if err := json.Unmarshal([]byte(kv.Value), &job); err != nil {
+			continue
+		}
+		if isJobFinished(job.Status) || !interrupted(job) {
+			continue
+		}
+		_, err := updateJob(job.Id, func(j *model.JobInfo) bool {
+			if isJobFinished(j.Status) || !interrupted(*j) {
+				return false
+			}
+			j.Status = model.JobStatusInterrupted
+			j.Error = reason
+			j.EndTime = time.Now()
+			j.ExpireTime = j.EndTime.Add(jobRetention())
+			return true
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to mark the job %s as interrupted", job.Id)
+			continue
+		}
+		log.Warn().Msgf("[Job] %s (%s) is interrupted: %s", job.Id, job.Kind, reason)
+	}
+}
+
+// InterruptOrphanJobs is func to mark the unfinished jobs of other processes without heartbeat as interrupted
+// (called at startup, before any job is started). The jobs of live instances keep their heartbeat,
+// so they are not interrupted even if the instances share the hostname.
+func InterruptOrphanJobs() {
+	interruptJobs("the Tumblebug instance running the job was restarted", func(job model.JobInfo) bool {
+		return job.Owner != jobInstanceId && time.Since(job.HeartbeatTime) > jobStaleAfter
+	})
+}
+
+// CleanupJobs is func to mark the jobs without heartbeat as interrupted and to delete the expired jobs
+func CleanupJobs() {
+	interruptJobs("the Tumblebug instance running the job stopped responding", func(job model.JobInfo) bool {
+		if _, ok := runningJobs.Load(job.Id); ok {
+			return false
+		}
+		return time.Since(job.HeartbeatTime) > jobStaleAfter
+	})
+
+	keyValue, err := kvstore.GetKvList(GenJobKey(""))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return
+	}
+	ops := []kvstore.Op{}
+	for _, kv := range keyValue {
+		job := model.JobInfo{}
+		if err := json.Unmarshal([]byte(kv.Value), &job); err != nil {
+			continue
+		}
+		if isJobFinished(job.Status) && !job.ExpireTime.IsZero() && time.Now().After(job.ExpireTime) {
+			ops = append(ops, kvstore.OpDelete(kv.Key))
+		}
+	}
+	for len(ops) > 0 {
+		n := min(len(ops), kvstore.MaxTxnOps)
+		if _, err := kvstore.Txn(nil, ops[:n]); err != nil {
+			log.Error().Err(err).Msg("failed to delete expired jobs")
+			return
+		}
+		ops = ops[n:]
+	}
+}
+
+// StartJobForRequest is func to start a job for the REST request (the job records the request ID)
+func StartJobForRequest(c echo.Context, spec JobSpec, fn JobFunc) (model.JobInfo, <-chan struct{}, error) {
+	spec.RequestId = c.Request().Header.Get(echo.HeaderXRequestID)
+	if v, ok := RequestMap.Load(spec.RequestId); ok {
+		spec.Request = v.(RequestDetails).RequestInfo
+	}
+	spec.SpanContext = trace.SpanContextFromContext(c.Request().Context())
+	return StartJob(spec, fn)
+}
+
+// RunJob is func to run the operation of a REST request as a job.
+// With ?async=true, it responds 202 with the job; otherwise it waits for the job and responds with its result.
+func RunJob(c echo.Context, spec JobSpec, fn JobFunc) error {
+	var result interface{}
+	var resultErr error
+	job, done, err := StartJobForRequest(c, spec, func(ctx context.Context) (interface{}, error) {
+		result, resultErr = fn(ctx)
+		return result, resultErr
+	})
+	if err != nil {
+		return EndRequestWithLog(c, err, nil)
+	}
+
+	if c.QueryParam("async") == "true" {
+		c.Response().Header().Set(echo.HeaderLocation, "/tumblebug/job/"+job.Id)
+		return c.JSON(http.StatusAccepted, job)
+	}
+
+	<-done
+	return EndRequestWithLog(c, resultErr, result)
+}
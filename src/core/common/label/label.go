@@ -15,6 +15,7 @@ limitations under the License.
 package label
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"strings"
@@ -25,30 +26,25 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-// CreateOrUpdateLabel adds a new label or updates an existing label for the given resource,
-// and then persists the updated label information in the Key-Value store.
-func CreateOrUpdateLabel(labelType, uid string, resourceKey string, labels map[string]string) error {
-	// Construct the labelKey
-	labelKey := fmt.Sprintf("/label/%s/%s", labelType, uid)
-
-	// Fetch the existing model.LabelInfo if it exists
-	labelData, err := kvstore.Get(labelKey)
-	if err != nil {
-		log.Error().Err(err).Msg("failed to get label data from kvstore")
-	}
-
-	log.Debug().Str("labelData", string(labelData)).Msg("Fetched label data")
+// GenLabelKey returns the key of the label object for the given resource.
+func GenLabelKey(labelType, uid string) string {
+	return fmt.Sprintf("/label/%s/%s", labelType, uid)
+}
 
-	if len(labelData) == 0 {
-		log.Debug().Msg("labelData is empty")
-	}
+// MergeLabels returns the label data (JSON) with the given labels added to or updated in the existing labelData.
+// If labelData is empty, a new label object for the resourceKey is created.
+// It does not access the Key-Value store, so it can be used to build a transaction.
+func MergeLabels(labelData string, resourceKey string, labels map[string]string) (string, error) {
 	var labelInfo model.LabelInfo
 
-	if err == nil && len(labelData) > 0 {
+	if len(labelData) > 0 {
 		// If label info exists, unmarshal and update it
-		err = json.Unmarshal([]byte(labelData), &labelInfo)
+		err := json.Unmarshal([]byte(labelData), &labelInfo)
 		if err != nil {
-			return fmt.Errorf("failed to unmarshal existing label data: %w", err)
+			return "", fmt.Errorf("failed to unmarshal existing label data: %w", err)
+		}
+		if labelInfo.Labels == nil {
+			labelInfo.Labels = make(map[string]string)
 		}
 		for key, value := range labels {
 			labelInfo.Labels[key] = value
@@ -61,13 +57,29 @@ func CreateOrUpdateLabel(labelType, uid string, resourceKey string, labels map[s
 		}
 	}
 
-	// Save the updated model.LabelInfo back to the Key-Value store
 	updatedLabelData, err := json.Marshal(labelInfo)
 	if err != nil {
-		return fmt.Errorf("failed to marshal updated label info: %w", err)
+		return "", fmt.Errorf("failed to marshal updated label info: %w", err)
 	}
+	return string(updatedLabelData), nil
+}
 
-	err = kvstore.Put(labelKey, string(updatedLabelData))
+// CreateOrUpdateLabel adds a new label or updates an existing label for the given resource,
+// and then persists the updated label information in the Key-Value store.
+// The update is applied with compare-and-swap, so concurrent updates on the same label object are not lost.
+func CreateOrUpdateLabel(labelType, uid string, resourceKey string, labels map[string]string) error {
+	labelKey := GenLabelKey(labelType, uid)
+
+	err := kvstore.ReadModifyWrite(context.Background(), []string{labelKey}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		labelData := current[labelKey].Value
+		log.Debug().Str("labelData", labelData).Msg("Fetched label data")
+
+		updatedLabelData, err := MergeLabels(labelData, resourceKey, labels)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(labelKey, updatedLabelData)}, nil
+	})
 	if err != nil {
 		return fmt.Errorf("failed to put label info into kvstore: %w", err)
 	}
@@ -77,8 +89,7 @@ func CreateOrUpdateLabel(labelType, uid string, resourceKey string, labels map[s
 
 // DeleteLabelObject deletes the entire label object for a given resource identified by its labelType and uid.
 func DeleteLabelObject(labelType, uid string) error {
-	// Construct the labelKey
-	labelKey := fmt.Sprintf("/label/%s/%s", labelType, uid)
+	labelKey := GenLabelKey(labelType, uid)
 
 	// Delete the entire label object from the Key-Value store
 	err := kvstore.Delete(labelKey)
@@ -92,37 +103,31 @@ func DeleteLabelObject(labelType, uid string) error {
 }
 
 // RemoveLabel removes a label from a resource identified by its uid.
+// The update is applied with compare-and-swap, so concurrent updates on the same label object are not lost.
 func RemoveLabel(labelType, uid, key string) error {
-	// Construct the labelKey
-	labelKey := fmt.Sprintf("/label/%s/%s", labelType, uid)
+	labelKey := GenLabelKey(labelType, uid)
 
-	// Fetch the existing model.LabelInfo
-	labelData, err := kvstore.Get(labelKey)
-	if err != nil {
-		log.Error().Err(err).Msgf("labelData: %v", labelData)
-		return err
-	}
-
-	var labelInfo model.LabelInfo
-	err = json.Unmarshal([]byte(labelData), &labelInfo)
-	if err != nil {
-		log.Error().Err(err).Msgf("labelInfo: %v", labelInfo)
-		return err
-	}
+	err := kvstore.ReadModifyWrite(context.Background(), []string{labelKey}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		labelData := current[labelKey].Value
 
-	// Remove the label
-	delete(labelInfo.Labels, key)
+		var labelInfo model.LabelInfo
+		err := json.Unmarshal([]byte(labelData), &labelInfo)
+		if err != nil {
+			log.Error().Err(err).Msgf("labelData: %v", labelData)
+			return nil, err
+		}
 
-	// Save the updated model.LabelInfo back to the Key-Value store
-	updatedLabelData, err := json.Marshal(labelInfo)
-	if err != nil {
-		log.Error().Err(err).Msgf("updatedLabelData: %v", updatedLabelData)
-		return err
-	}
+		// Remove the label
+		delete(labelInfo.Labels, key)
 
-	err = kvstore.Put(labelKey, string(updatedLabelData))
+		updatedLabelData, err := json.Marshal(labelInfo)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(labelKey, string(updatedLabelData))}, nil
+	})
 	if err != nil {
-		log.Error().Err(err).Msgf("")
+		log.Error().Err(err).Msg("")
 		return err
 	}
 
@@ -133,8 +138,7 @@ func RemoveLabel(labelType, uid, key string) error {
 func GetLabels(labelType, uid string) (label model.LabelInfo, err error) {
 	labelInfo := model.LabelInfo{}
 
-	// Construct the labelKey
-	labelKey := fmt.Sprintf("/label/%s/%s", labelType, uid)
+	labelKey := GenLabelKey(labelType, uid)
 
 	// Fetch the existing model.LabelInfo
 	labelData, err := kvstore.Get(labelKey)
@@ -0,0 +1,135 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// [Leader election among Tumblebug instances sharing the kvstore]
+
+const (
+	// leaderLockKey is the lock held by the leader (released when the session of the leader expires)
+	leaderLockKey = "/leader/lock"
+	// leaderInfoKey is the key to record the current leader
+	leaderInfoKey = "/leader/info"
+	// leaderRetryInterval is the interval to retry the election after an error
+	leaderRetryInterval = 5 * time.Second
+)
+
+// isLeader is whether this instance holds the leader lock
+var isLeader atomic.Bool
+
+// IsLeader returns whether this instance is the leader, which runs the singleton background controllers
+// (e.g., MCI orchestration, reconciliation, and job cleanup)
+func IsLeader() bool {
+	return isLeader.Load()
+}
+
+// GetLeaderInfo is func to get the current leader (nil if no leader is recorded)
+func GetLeaderInfo() (*model.LeaderInfo, error) {
+	kv, err := kvstore.GetKv(leaderInfoKey)
+	if err != nil {
+		return nil, err
+	}
+	if kv.Value == "" {
+		return nil, nil
+	}
+	leader := &model.LeaderInfo{}
+	if err := json.Unmarshal([]byte(kv.Value), leader); err != nil {
+		return nil, err
+	}
+	return leader, nil
+}
+
+// RunLeaderElection is func to campaign for the leader until ctx is done.
+// The leader keeps the leadership while its kvstore session is alive; if the leader stops or loses the session,
+// another instance waiting for the lock becomes the leader.
+func RunLeaderElection(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := campaign(ctx); err != nil && ctx.Err() == nil {
+			log.Error().Err(err).Msg("[Leader] failed to campaign for the leader (retrying)")
+			select {
+			case <-ctx.Done():
+			case <-time.After(leaderRetryInterval):
+			}
+		}
+	}
+}
+
+// campaign waits for the leader lock and holds it until the session is lost or ctx is done
+func campaign(ctx context.Context) error {
+	session, err := kvstore.NewSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// stop waiting for the lock if the session expires
+	lockCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-session.Done():
+			cancel()
+		case <-lockCtx.Done():
+		}
+	}()
+
+	lock, err := kvstore.NewLock(lockCtx, session, leaderLockKey)
+	if err != nil {
+		return err
+	}
+
+	leader := model.LeaderInfo{InstanceId: jobInstanceId, Hostname: jobInstanceHost, Since: time.Now()}
+	val, _ := json.Marshal(leader)
+	if err := kvstore.Put(leaderInfoKey, string(val)); err != nil {
+		_ = lock.Unlock(context.Background())
+		return err
+	}
+	isLeader.Store(true)
+	log.Info().Msgf("[Leader] this instance (%s) is elected as the leader", jobInstanceId)
+
+	select {
+	case <-ctx.Done():
+		isLeader.Store(false)
+		resignLeader(lock, string(val))
+		log.Info().Msgf("[Leader] this instance (%s) resigned the leadership", jobInstanceId)
+		return nil
+	case <-session.Done():
+		isLeader.Store(false)
+		log.Warn().Msgf("[Leader] this instance (%s) lost the leadership (session expired)", jobInstanceId)
+		return nil
+	}
+}
+
+// resignLeader deletes the leader record (if it is still of this instance) and releases the lock
+func resignLeader(lock kvstore.Lock, recorded string) {
+	kv, err := kvstore.GetRevisionedKv(leaderInfoKey)
+	if err == nil && kv.Exists() && kv.Value == recorded {
+		_, _ = kvstore.Txn([]kvstore.Compare{kvstore.CompareModRevision(leaderInfoKey, kv.ModRevision)},
+			[]kvstore.Op{kvstore.OpDelete(leaderInfoKey)})
+	}
+	if err := lock.Unlock(context.Background()); err != nil {
+		log.Debug().Err(err).Msg("[Leader] failed to release the leader lock")
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// [Prometheus metrics of outbound calls, client cache and kvstore]
+
+// MetricsNamespace is the namespace (prefix) of the metrics of CB-Tumblebug
+const MetricsNamespace = "tumblebug"
+
+var (
+	outboundRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "outbound",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of outbound calls (including retries) by target, CB-Spider connection, method and status code",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1200},
+	}, []string{"target", "connection", "method", "code"})
+
+	outboundRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "outbound",
+		Name:      "request_errors_total",
+		Help:      "Number of failed outbound calls by target, CB-Spider connection and method",
+	}, []string{"target", "connection", "method"})
+
+	clientCacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "client_cache",
+		Name:      "requests_total",
+		Help:      "Number of lookups of the cache of GET calls by result (hit or miss)",
+	}, []string{"result"})
+
+	kvStoreOpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "kvstore",
+		Name:      "operation_duration_seconds",
+		Help:      "Latency of kvstore operations by operation",
+		Buckets:   []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	}, []string{"op"})
+
+	kvStoreOpErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: MetricsNamespace,
+		Subsystem: "kvstore",
+		Name:      "operation_errors_total",
+		Help:      "Number of failed kvstore operations by operation",
+	}, []string{"op"})
+)
+
+func init() {
+	prometheus.MustRegister(circuitBreakerCollector{})
+}
+
+// circuitBreakerCollector exports the state of the circuit breakers of outbound endpoints
+type circuitBreakerCollector struct{}
+
+var circuitBreakerStateDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(MetricsNamespace, "outbound", "circuit_breaker_state"),
+	"State of the circuit breaker of an outbound endpoint (0: Closed, 1: HalfOpen, 2: Open)",
+	[]string{"endpoint"}, nil,
+)
+
+// Describe implements prometheus.Collector
+func (circuitBreakerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- circuitBreakerStateDesc
+}
+
+// Collect implements prometheus.Collector
+func (circuitBreakerCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, status := range ListCircuitBreakerStatus(true) {
+		value := 0.0
+		switch status.State {
+		case model.CircuitBreakerHalfOpen:
+			value = 1
+		case model.CircuitBreakerOpen:
+			value = 2
+		}
+		ch <- prometheus.MustNewConstMetric(circuitBreakerStateDesc, prometheus.GaugeValue, value, status.Endpoint)
+	}
+}
+
+// outboundTarget returns the target of an outbound call for metrics (not the host, to keep the cardinality low)
+func outboundTarget(url string) string {
+	switch {
+	case model.SpiderRestUrl != "" && strings.HasPrefix(url, model.SpiderRestUrl):
+		return "spider"
+	case model.DragonflyRestUrl != "" && strings.HasPrefix(url, model.DragonflyRestUrl):
+		return "dragonfly"
+	case model.TerrariumRestUrl != "" && strings.HasPrefix(url, model.TerrariumRestUrl):
+		return "terrarium"
+	}
+	return "other"
+}
+
+// observeOutboundRequest records the latency and the result of an outbound call
+func observeOutboundRequest(req *resty.Request, resp *resty.Response, err error, elapsed time.Duration) {
+	if req.Method == "" {
+		// not sent (unsupported method)
+		return
+	}
+	target := outboundTarget(req.URL)
+	connection := ""
+	if target == "spider" {
+		connection = spiderConnectionName(req)
+	}
+
+	code := "error"
+	if resp != nil && resp.RawResponse != nil {
+		code = strconv.Itoa(resp.StatusCode())
+	}
+	outboundRequestDuration.WithLabelValues(target, connection, req.Method, code).Observe(elapsed.Seconds())
+	if err != nil || (resp != nil && resp.IsError()) {
+		outboundRequestErrors.WithLabelValues(target, connection, req.Method).Inc()
+	}
+}
+
+// ObserveKvStoreOp records the latency and the result of a kvstore operation (and its span if ctx belongs to a trace)
+func ObserveKvStoreOp(ctx context.Context, op string, start time.Time, err error) {
+	kvStoreOpDuration.WithLabelValues(op).Observe(time.Since(start).Seconds())
+	recordKvStoreSpan(ctx, op, start, err)
+	if err != nil {
+		kvStoreOpErrors.WithLabelValues(op).Inc()
+	}
+}
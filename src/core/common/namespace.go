@@ -15,6 +15,7 @@ limitations under the License.
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -173,6 +174,50 @@ func UpdateNs(id string, u *model.NsReq) (model.NsInfo, error) {
 	return res, nil
 }
 
+// SetNsQuota is func to set the quota of the namespace (nil to remove the quota)
+func SetNsQuota(id string, quota *model.NsQuota) (model.NsInfo, error) {
+	res := model.NsInfo{}
+
+	err := CheckString(id)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return res, err
+	}
+	if quota != nil {
+		if quota.MaxVms < 0 || quota.MaxVCpu < 0 || quota.MaxMemoryGiB < 0 || quota.MaxCostPerHour < 0 {
+			return res, fmt.Errorf("the limits of the quota must not be negative")
+		}
+		if quota.MaxVms == 0 && quota.MaxVCpu == 0 && quota.MaxMemoryGiB == 0 && quota.MaxCostPerHour == 0 &&
+			len(quota.AllowedProviders) == 0 && len(quota.AllowedRegions) == 0 {
+			// no limit
+			quota = nil
+		}
+	}
+
+	key := "/ns/" + id
+	err = kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[key].Exists() {
+			return nil, fmt.Errorf("The namespace %s does not exist.", id)
+		}
+		res = model.NsInfo{}
+		if err := json.Unmarshal([]byte(current[key].Value), &res); err != nil {
+			return nil, err
+		}
+		res.Quota = quota
+		val, err := json.Marshal(res)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.NsInfo{}, err
+	}
+	log.Info().Msgf("The quota of the namespace %s is set: %+v", id, quota)
+	return res, nil
+}
+
 func GetNs(id string) (model.NsInfo, error) {
 
 	res := model.NsInfo{}
@@ -361,6 +406,16 @@ func DelNs(id string) error {
 		return err
 	}
 
+	// secrets and remote command history belong to the namespace and are removed with it
+	_, err = kvstore.Txn(nil, []kvstore.Op{
+		kvstore.OpDeletePrefix(GenSecretKey(id, "")),
+		kvstore.OpDeletePrefix(GenCmdHistoryKey(id, "", "")),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return err
+	}
+
 	err = label.DeleteLabelObject(model.StrNamespace, ns.Uid)
 	if err != nil {
 		log.Error().Err(err).Msg("")
@@ -4,8 +4,9 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"math/big"
 	"net"
-	"strings"
+	"strconv"
 )
 
 var (
@@ -215,6 +216,15 @@ func CalculateHostCapacity(ipNet *net.IPNet) (int, error) {
 }
 
 func calculateHostCapacity(maskSize, bits int) (int, error) {
+	if bits == net.IPv6len*8 {
+		// IPv6 has no network and broadcast addresses to reserve (capped at the max int for large subnets)
+		hostBits := bits - maskSize
+		if hostBits >= strconv.IntSize-1 {
+			return math.MaxInt, nil
+		}
+		return 1 << uint(hostBits), nil
+	}
+
 	switch maskSize {
 	case 31:
 		// Special case for /31 subnets, typically used in point-to-point links (RFC 3021)
@@ -316,30 +326,37 @@ func SubnettingByMinimumSubnetCount(cidrBlock string, minSubnets int) ([]string,
 	}
 
 	// Calculate the new subnet mask size
-	maskSize, _ := network.Mask.Size()
+	maskSize, bits := network.Mask.Size()
 	subnetBits := int(math.Ceil(math.Log2(float64(minSubnets))))
 	newMaskSize := maskSize + subnetBits
 
-	if newMaskSize > 32 {
+	if newMaskSize > bits {
 		return nil, fmt.Errorf("cannot split '%s' to accommodate at least %d subnets", cidrBlock, minSubnets)
 	}
 
-	// Calculate the actual number of subnets that can be created with the new mask size
-	numSubnets := int(math.Pow(2, float64(subnetBits)))
+	return listSubnets(network, newMaskSize)
+}
 
-	var subnets []string
-	for i := 0; i < numSubnets; i++ {
-		ip := make(net.IP, len(network.IP))
-		copy(ip, network.IP)
-
-		// Calculate the offset to apply to the base IP address
-		offset := int64(i) << (32 - newMaskSize)
-		for j := 3; j >= 0; j-- {
-			shift := uint((3 - j) * 8)
-			ip[j] += byte((offset >> shift) & 0xff)
-		}
+// MaxSubnetListBits limits the number of subnets listed at once (2^MaxSubnetListBits)
+// since an IPv6 network can be split into an astronomical number of subnets.
+const MaxSubnetListBits = 24
+
+// listSubnets lists all subnets of the network with the new mask size.
+func listSubnets(network *net.IPNet, newMaskSize int) ([]string, error) {
+	maskSize, bits := network.Mask.Size()
+	if newMaskSize-maskSize > MaxSubnetListBits {
+		return nil, fmt.Errorf("too many subnets: splitting '%s' into /%d subnets results in 2^%d subnets (up to 2^%d)", network.String(), newMaskSize, newMaskSize-maskSize, MaxSubnetListBits)
+	}
 
-		subnets = append(subnets, fmt.Sprintf("%s/%d", ip.String(), newMaskSize))
+	numSubnets := 1 << uint(newMaskSize-maskSize)
+	subnetSize := new(big.Int).Lsh(big.NewInt(1), uint(bits-newMaskSize))
+	current := IpToBigInt(network.IP)
+
+	subnets := make([]string, 0, numSubnets)
+	for i := 0; i < numSubnets; i++ {
+		subnetIP := BigIntToIP(current, bits)
+		subnets = append(subnets, fmt.Sprintf("%s/%d", subnetIP.String(), newMaskSize))
+		current.Add(current, subnetSize)
 	}
 
 	return subnets, nil
@@ -356,6 +373,46 @@ func Uint32ToIP(n uint32) net.IP {
 	return net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
 }
 
+// IpToBigInt converts an IPv4 or IPv6 address to a big.Int.
+func IpToBigInt(ip net.IP) *big.Int {
+	if ip4 := ip.To4(); ip4 != nil {
+		return new(big.Int).SetBytes(ip4)
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+// BigIntToIP converts a big.Int to an IP address of the address family with the given bits (32: IPv4, 128: IPv6).
+// It returns nil if the value is out of the address range.
+func BigIntToIP(n *big.Int, bits int) net.IP {
+	if n.Sign() < 0 || n.BitLen() > bits {
+		return nil
+	}
+	size := bits / 8
+	ip := make(net.IP, size)
+	n.FillBytes(ip)
+	if size == net.IPv4len {
+		return net.IPv4(ip[0], ip[1], ip[2], ip[3])
+	}
+	return ip
+}
+
+// AddressBits returns the number of bits of the address family of the IP (32: IPv4, 128: IPv6).
+func AddressBits(ip net.IP) int {
+	if ip.To4() != nil {
+		return net.IPv4len * 8
+	}
+	return net.IPv6len * 8
+}
+
+// IsIPv6CIDR checks if the CIDR block is an IPv6 one.
+func IsIPv6CIDR(cidrBlock string) bool {
+	ip, _, err := net.ParseCIDR(cidrBlock)
+	if err != nil {
+		return false
+	}
+	return AddressBits(ip) == net.IPv6len*8
+}
+
 // SubnettingByMinimumHosts divides a CIDR block into subnets based on the number of hosts required for one subnet.
 func SubnettingByMinimumHosts(cidrBlock string, hostsPerSubnet int) ([]string, error) {
 	if hostsPerSubnet < 2 {
@@ -368,8 +425,12 @@ func SubnettingByMinimumHosts(cidrBlock string, hostsPerSubnet int) ([]string, e
 	}
 
 	maskSize, bits := network.Mask.Size()
-	// Adjusting for network and broadcast addresses
-	hostBits := int(math.Ceil(math.Log2(float64(hostsPerSubnet + 2))))
+	// Adjusting for network and broadcast addresses (IPv4 only)
+	reserved := 2
+	if bits == net.IPv6len*8 {
+		reserved = 0
+	}
+	hostBits := int(math.Ceil(math.Log2(float64(hostsPerSubnet + reserved))))
 	newMaskSize := bits - hostBits
 
 	if newMaskSize <= maskSize {
@@ -377,16 +438,7 @@ func SubnettingByMinimumHosts(cidrBlock string, hostsPerSubnet int) ([]string, e
 		return nil, fmt.Errorf("cannot split '%s' (host capacity: %d) into multiple subnets, each containing at least %d hosts", cidrBlock, capa, hostsPerSubnet)
 	}
 
-	baseIP := IpToUint32(network.IP)
-	subnetMask := uint32(math.Pow(2, float64(hostBits)) - 1)
-	var subnets []string
-
-	for currentIP := baseIP; currentIP < baseIP+uint32(math.Pow(2, float64(bits-maskSize))); currentIP += subnetMask + 1 {
-		subnetIP := Uint32ToIP(currentIP)
-		subnets = append(subnets, fmt.Sprintf("%s/%d", subnetIP.String(), newMaskSize))
-	}
-
-	return subnets, nil
+	return listSubnets(network, newMaskSize)
 }
 
 // ///////////////////////////////////////////////////////////////////
@@ -404,6 +456,9 @@ func ValidateNetwork(network Network) error {
 
 	// Recursively validate each subnet
 	for _, subnet := range network.Subnets {
+		if IsIPv6CIDR(subnet.CidrBlock) != IsIPv6CIDR(network.CidrBlock) {
+			return fmt.Errorf("subnet '%s' is not in the same address family (IPv4/IPv6) as '%s'", subnet.CidrBlock, network.CidrBlock)
+		}
 		if !isSubnetOf(network.CidrBlock, subnet.CidrBlock) {
 			return fmt.Errorf("subnet '%s' is not a valid subnet of '%s'", subnet.CidrBlock, network.CidrBlock)
 		}
@@ -455,21 +510,21 @@ func NextSubnet(currentSubnetCIDR string, baseNetworkCIDR string) (string, error
 		return "", err
 	}
 
-	// Convert the current subnet's IP to uint32
-	currentIPInt := IpToUint32(currentNet.IP)
+	// Convert the current subnet's IP to big.Int
+	currentIPInt := IpToBigInt(currentNet.IP)
 
 	// Calculate the size of the current subnet
-	maskSize, _ := currentNet.Mask.Size()
-	subnetSize := uint32(1 << (32 - maskSize))
+	maskSize, bits := currentNet.Mask.Size()
+	subnetSize := new(big.Int).Lsh(big.NewInt(1), uint(bits-maskSize))
 
 	// Calculate the next subnet's starting IP
-	nextIPInt := currentIPInt + subnetSize
+	nextIPInt := new(big.Int).Add(currentIPInt, subnetSize)
 
-	// Convert the next IP to net.IP
-	nextIP := Uint32ToIP(nextIPInt)
+	// Convert the next IP to net.IP (nil if out of the address range)
+	nextIP := BigIntToIP(nextIPInt, bits)
 
 	// Check if the next subnet is within the base network range
-	if !baseNet.Contains(nextIP) {
+	if nextIP == nil || !baseNet.Contains(nextIP) {
 		return "", fmt.Errorf("the next subnet is outside the base network range")
 	}
 
@@ -490,21 +545,21 @@ func PreviousSubnet(currentSubnet string, baseNetworkCIDR string) (string, error
 		return "", err
 	}
 
-	// Convert the current subnet's IP to uint32
-	currentIPInt := IpToUint32(currentNet.IP)
+	// Convert the current subnet's IP to big.Int
+	currentIPInt := IpToBigInt(currentNet.IP)
 
 	// Calculate the size of the current subnet
-	maskSize, _ := currentNet.Mask.Size()
-	subnetSize := uint32(1 << (32 - maskSize))
+	maskSize, bits := currentNet.Mask.Size()
+	subnetSize := new(big.Int).Lsh(big.NewInt(1), uint(bits-maskSize))
 
 	// Calculate the previous subnet's starting IP
-	previousIPInt := currentIPInt - subnetSize
+	previousIPInt := new(big.Int).Sub(currentIPInt, subnetSize)
 
-	// Convert the previous IP to net.IP
-	previousIP := Uint32ToIP(previousIPInt)
+	// Convert the previous IP to net.IP (nil if out of the address range)
+	previousIP := BigIntToIP(previousIPInt, bits)
 
 	// Check if the previous subnet is within the base network range
-	if !baseNet.Contains(previousIP) {
+	if previousIP == nil || !baseNet.Contains(previousIP) {
 		return "", fmt.Errorf("the previous subnet is outside the base network range")
 	}
 
@@ -516,8 +571,13 @@ The following functions are used for Designing VNets
 */
 
 // DeriveVNetAndSubnets calculates the CIDR blocks for a VNet and its subnets based on the given parameters.
+// For an IPv6 base IP, the subnets are /64 regardless of the subnet size (see DeriveIPv6VNetAndSubnets).
 func DeriveVNetAndSubnets(baseIP net.IP, subnetSize, subnetCount int) (string, []string, net.IP, error) {
 
+	if AddressBits(baseIP) == net.IPv6len*8 {
+		return DeriveIPv6VNetAndSubnets(baseIP, subnetCount)
+	}
+
 	// Adjust the subnet size to account for the network and broadcast addresses
 	adjustedSubnetSize := subnetSize + 2
 	totalIPs := adjustedSubnetSize * subnetCount
@@ -560,6 +620,54 @@ func DeriveVNetAndSubnets(baseIP net.IP, subnetSize, subnetCount int) (string, [
 	return cidr, subnets, nextAvailableIP, nil
 }
 
+// IPv6SubnetPrefix is the prefix length of IPv6 subnets in a VNet design
+// (most CSPs and SLAAC require /64 subnets).
+const IPv6SubnetPrefix = 64
+
+// DeriveIPv6VNetAndSubnets calculates the IPv6 CIDR blocks for a VNet and its /64 subnets.
+// The VNet block starts at the first address aligned to its size from the base IP.
+func DeriveIPv6VNetAndSubnets(baseIP net.IP, subnetCount int) (string, []string, net.IP, error) {
+	bits := net.IPv6len * 8
+	if baseIP == nil || AddressBits(baseIP) != bits {
+		return "", nil, nil, fmt.Errorf("not an IPv6 address: %s", baseIP)
+	}
+	if subnetCount < 1 {
+		subnetCount = 1
+	}
+
+	// Adjust the subnet count to be a power of 2 (e.g., 1, 2, 4, 8, 16, ...)
+	subnetBits := int(math.Ceil(math.Log2(float64(subnetCount))))
+	if subnetBits > MaxSubnetListBits {
+		return "", nil, nil, fmt.Errorf("too many subnets: %d (up to 2^%d)", subnetCount, MaxSubnetListBits)
+	}
+	adjustSubnetCount := 1 << uint(subnetBits)
+	cidrSize := IPv6SubnetPrefix - subnetBits
+
+	// Align the base IP to the VNet block
+	blockSize := new(big.Int).Lsh(big.NewInt(1), uint(bits-cidrSize))
+	start := IpToBigInt(baseIP)
+	if rem := new(big.Int).Mod(start, blockSize); rem.Sign() != 0 {
+		start.Sub(start, rem).Add(start, blockSize)
+	}
+	vNetIP := BigIntToIP(start, bits)
+	if vNetIP == nil {
+		return "", nil, nil, fmt.Errorf("cannot allocate: no IPv6 address space left after %s", baseIP)
+	}
+
+	subnetSize := new(big.Int).Lsh(big.NewInt(1), uint(bits-IPv6SubnetPrefix))
+	subnets := make([]string, adjustSubnetCount)
+	current := new(big.Int).Set(start)
+	for i := 0; i < adjustSubnetCount; i++ {
+		subnets[i] = fmt.Sprintf("%s/%d", BigIntToIP(current, bits).String(), IPv6SubnetPrefix)
+		current.Add(current, subnetSize)
+	}
+
+	// nil if the VNet block is the last one in the address space
+	nextAvailableIP := BigIntToIP(current, bits)
+
+	return fmt.Sprintf("%s/%d", vNetIP.String(), cidrSize), subnets, nextAvailableIP, nil
+}
+
 // CalculateSupernet calculates the supernet of the given CIDRs.
 func CalculateSupernet(cidrs []string) (string, error) {
 	if len(cidrs) == 0 {
@@ -567,6 +675,7 @@ func CalculateSupernet(cidrs []string) (string, error) {
 	}
 
 	var minIP, maxIP net.IP
+	var bits int
 	for i, cidrStr := range cidrs {
 		_, ipNet, err := net.ParseCIDR(cidrStr)
 		if err != nil {
@@ -576,19 +685,23 @@ func CalculateSupernet(cidrs []string) (string, error) {
 		if i == 0 {
 			minIP = ipNet.IP
 			maxIP = lastIPInNetwork(ipNet)
+			bits = AddressBits(ipNet.IP)
 		} else {
-			if IpToUint32(ipNet.IP) < IpToUint32(minIP) {
+			if AddressBits(ipNet.IP) != bits {
+				return "", fmt.Errorf("cannot calculate the supernet of IPv4 and IPv6 CIDRs together: %s", cidrStr)
+			}
+			if IpToBigInt(ipNet.IP).Cmp(IpToBigInt(minIP)) < 0 {
 				minIP = ipNet.IP
 			}
 			lastIP := lastIPInNetwork(ipNet)
-			if IpToUint32(lastIP) > IpToUint32(maxIP) {
+			if IpToBigInt(lastIP).Cmp(IpToBigInt(maxIP)) > 0 {
 				maxIP = lastIP
 			}
 		}
 	}
 
-	prefixLen := commonPrefixLength(minIP, maxIP)
-	return fmt.Sprintf("%s/%d", minIP.Mask(net.CIDRMask(prefixLen, 32)), prefixLen), nil
+	prefixLen := commonPrefixLength(minIP, maxIP, bits)
+	return fmt.Sprintf("%s/%d", minIP.Mask(net.CIDRMask(prefixLen, bits)), prefixLen), nil
 }
 
 func lastIPInNetwork(ipNet *net.IPNet) net.IP {
@@ -600,7 +713,7 @@ func lastIPInNetwork(ipNet *net.IPNet) net.IP {
 	return lastIP
 }
 
-func commonPrefixLength(ip1, ip2 net.IP) int {
-	xor := IpToUint32(ip1) ^ IpToUint32(ip2)
-	return 32 - len(strings.TrimLeft(fmt.Sprintf("%032b", xor), "0"))
+func commonPrefixLength(ip1, ip2 net.IP, bits int) int {
+	xor := new(big.Int).Xor(IpToBigInt(ip1), IpToBigInt(ip2))
+	return bits - xor.BitLen()
 }
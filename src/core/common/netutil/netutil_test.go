@@ -0,0 +1,340 @@
+package netutil
+
+import (
+	"math"
+	"math/big"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListSubnets(t *testing.T) {
+	cases := []struct {
+		name        string
+		cidrBlock   string
+		newMaskSize int
+		wantCount   int
+		wantFirst   []string
+		wantLast    string
+		wantErr     bool
+	}{
+		{
+			name: "IPv4", cidrBlock: "10.0.0.0/24", newMaskSize: 26, wantCount: 4,
+			wantFirst: []string{"10.0.0.0/26", "10.0.0.64/26", "10.0.0.128/26", "10.0.0.192/26"},
+			wantLast:  "10.0.0.192/26",
+		},
+		{
+			name: "IPv6", cidrBlock: "fd00:10::/56", newMaskSize: 58, wantCount: 4,
+			wantFirst: []string{"fd00:10::/58", "fd00:10:0:40::/58", "fd00:10:0:80::/58", "fd00:10:0:c0::/58"},
+			wantLast:  "fd00:10:0:c0::/58",
+		},
+		{
+			name: "IPv6 /64 subnets of /48", cidrBlock: "fd00::/48", newMaskSize: 64, wantCount: 1 << 16,
+			wantFirst: []string{"fd00::/64", "fd00:0:0:1::/64"},
+			wantLast:  "fd00:0:0:ffff::/64",
+		},
+		{
+			name: "IPv6 at the end of the address space", cidrBlock: "ffff::/16", newMaskSize: 17, wantCount: 2,
+			wantFirst: []string{"ffff::/17", "ffff:8000::/17"},
+			wantLast:  "ffff:8000::/17",
+		},
+		{
+			name: "same mask size", cidrBlock: "fd00::/64", newMaskSize: 64, wantCount: 1,
+			wantFirst: []string{"fd00::/64"},
+			wantLast:  "fd00::/64",
+		},
+		{name: "too many subnets", cidrBlock: "fd00::/32", newMaskSize: 64, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, network, err := net.ParseCIDR(tc.cidrBlock)
+			require.NoError(t, err)
+			subnets, err := listSubnets(network, tc.newMaskSize)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, subnets, tc.wantCount)
+			assert.Equal(t, tc.wantFirst, subnets[:len(tc.wantFirst)])
+			assert.Equal(t, tc.wantLast, subnets[len(subnets)-1])
+		})
+	}
+}
+
+func TestSubnettingByMinimumSubnetCount(t *testing.T) {
+	cases := []struct {
+		cidrBlock  string
+		minSubnets int
+		want       []string
+		wantErr    bool
+	}{
+		{cidrBlock: "10.0.0.0/16", minSubnets: 3, want: []string{"10.0.0.0/18", "10.0.64.0/18", "10.0.128.0/18", "10.0.192.0/18"}},
+		{cidrBlock: "fd00:10::/56", minSubnets: 3, want: []string{"fd00:10::/58", "fd00:10:0:40::/58", "fd00:10:0:80::/58", "fd00:10:0:c0::/58"}},
+		{cidrBlock: "fd00:10::/56", minSubnets: 2, want: []string{"fd00:10::/57", "fd00:10:0:80::/57"}},
+		{cidrBlock: "fd00::/127", minSubnets: 4, wantErr: true},
+		{cidrBlock: "10.0.0.0/31", minSubnets: 4, wantErr: true},
+		{cidrBlock: "not-a-cidr", minSubnets: 2, wantErr: true},
+	}
+	for _, tc := range cases {
+		subnets, err := SubnettingByMinimumSubnetCount(tc.cidrBlock, tc.minSubnets)
+		if tc.wantErr {
+			assert.Error(t, err, "%s by %d", tc.cidrBlock, tc.minSubnets)
+			continue
+		}
+		require.NoError(t, err, "%s by %d", tc.cidrBlock, tc.minSubnets)
+		assert.Equal(t, tc.want, subnets, "%s by %d", tc.cidrBlock, tc.minSubnets)
+	}
+}
+
+func TestNextSubnet(t *testing.T) {
+	cases := []struct {
+		current string
+		base    string
+		want    string
+		wantErr bool
+	}{
+		{current: "10.0.1.0/24", base: "10.0.0.0/16", want: "10.0.2.0/24"},
+		{current: "10.0.255.0/24", base: "10.0.0.0/16", wantErr: true},
+		{current: "fd00:10:0:1::/64", base: "fd00:10::/56", want: "fd00:10:0:2::/64"},
+		{current: "fd00:10:0:fe::/64", base: "fd00:10::/56", want: "fd00:10:0:ff::/64"},
+		{current: "fd00:10:0:ff::/64", base: "fd00:10::/56", wantErr: true},
+		{current: "fd00:10::/58", base: "fd00:10::/56", want: "fd00:10:0:40::/58"},
+		// the next subnet is beyond the IPv6 address space
+		{current: "ffff:ffff:ffff:ffff::/64", base: "ffff::/16", wantErr: true},
+	}
+	for _, tc := range cases {
+		next, err := NextSubnet(tc.current, tc.base)
+		if tc.wantErr {
+			assert.Error(t, err, "next of %s in %s", tc.current, tc.base)
+			continue
+		}
+		require.NoError(t, err, "next of %s in %s", tc.current, tc.base)
+		assert.Equal(t, tc.want, next, "next of %s in %s", tc.current, tc.base)
+	}
+}
+
+func TestPreviousSubnet(t *testing.T) {
+	cases := []struct {
+		current string
+		base    string
+		want    string
+		wantErr bool
+	}{
+		{current: "10.0.1.0/24", base: "10.0.0.0/16", want: "10.0.0.0/24"},
+		{current: "10.0.0.0/24", base: "10.0.0.0/16", wantErr: true},
+		{current: "fd00:10:0:2::/64", base: "fd00:10::/56", want: "fd00:10:0:1::/64"},
+		{current: "fd00:10::/64", base: "fd00:10::/56", wantErr: true},
+		{current: "fd00:10:0:80::/58", base: "fd00:10::/56", want: "fd00:10:0:40::/58"},
+		// the previous subnet is before the IPv6 address space
+		{current: "::/64", base: "::/0", wantErr: true},
+	}
+	for _, tc := range cases {
+		previous, err := PreviousSubnet(tc.current, tc.base)
+		if tc.wantErr {
+			assert.Error(t, err, "previous of %s in %s", tc.current, tc.base)
+			continue
+		}
+		require.NoError(t, err, "previous of %s in %s", tc.current, tc.base)
+		assert.Equal(t, tc.want, previous, "previous of %s in %s", tc.current, tc.base)
+	}
+}
+
+func TestCalculateSupernet(t *testing.T) {
+	cases := []struct {
+		name    string
+		cidrs   []string
+		want    string
+		wantErr bool
+	}{
+		{name: "IPv4", cidrs: []string{"10.0.0.0/24", "10.0.4.0/22", "10.1.0.0/16"}, want: "10.0.0.0/15"},
+		{name: "IPv4 single", cidrs: []string{"192.168.1.0/24"}, want: "192.168.1.0/24"},
+		{name: "IPv6", cidrs: []string{"fd00::/62", "fd00:0:0:8::/61"}, want: "fd00::/60"},
+		{name: "IPv6 single", cidrs: []string{"fd00:10:0:1::/64"}, want: "fd00:10:0:1::/64"},
+		{name: "IPv6 adjacent", cidrs: []string{"fd00:0:0:2::/64", "fd00:0:0:3::/64"}, want: "fd00:0:0:2::/63"},
+		{name: "IPv6 far apart", cidrs: []string{"fd00::/64", "fdff::/64"}, want: "fd00::/8"},
+		{name: "IPv4 and IPv6", cidrs: []string{"10.0.0.0/24", "fd00::/64"}, wantErr: true},
+		{name: "empty", cidrs: []string{}, wantErr: true},
+		{name: "invalid", cidrs: []string{"fd00::/64", "fd00::/129"}, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			supernet, err := CalculateSupernet(tc.cidrs)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, supernet)
+		})
+	}
+}
+
+func TestDeriveIPv6VNetAndSubnets(t *testing.T) {
+	cases := []struct {
+		name        string
+		baseIP      string
+		subnetCount int
+		wantVNet    string
+		wantSubnets []string
+		// wantNext is the next available IP ("" if none)
+		wantNext string
+		wantErr  bool
+	}{
+		{
+			name: "power of 2 subnets", baseIP: "fd00::", subnetCount: 4,
+			wantVNet:    "fd00::/62",
+			wantSubnets: []string{"fd00::/64", "fd00:0:0:1::/64", "fd00:0:0:2::/64", "fd00:0:0:3::/64"},
+			wantNext:    "fd00:0:0:4::",
+		},
+		{
+			name: "subnets rounded up to a power of 2", baseIP: "fd00::", subnetCount: 3,
+			wantVNet:    "fd00::/62",
+			wantSubnets: []string{"fd00::/64", "fd00:0:0:1::/64", "fd00:0:0:2::/64", "fd00:0:0:3::/64"},
+			wantNext:    "fd00:0:0:4::",
+		},
+		{
+			name: "base IP aligned to the VNet block", baseIP: "fd00:0:0:4::", subnetCount: 5,
+			wantVNet: "fd00:0:0:8::/61",
+			wantSubnets: []string{
+				"fd00:0:0:8::/64", "fd00:0:0:9::/64", "fd00:0:0:a::/64", "fd00:0:0:b::/64",
+				"fd00:0:0:c::/64", "fd00:0:0:d::/64", "fd00:0:0:e::/64", "fd00:0:0:f::/64",
+			},
+			wantNext: "fd00:0:0:10::",
+		},
+		{
+			name: "base IP within a /64", baseIP: "fd00::1", subnetCount: 1,
+			wantVNet:    "fd00:0:0:1::/64",
+			wantSubnets: []string{"fd00:0:0:1::/64"},
+			wantNext:    "fd00:0:0:2::",
+		},
+		{
+			name: "no subnet count", baseIP: "fd00::", subnetCount: 0,
+			wantVNet:    "fd00::/64",
+			wantSubnets: []string{"fd00::/64"},
+			wantNext:    "fd00:0:0:1::",
+		},
+		{
+			name: "last block of the address space", baseIP: "ffff:ffff:ffff:ffff::", subnetCount: 1,
+			wantVNet:    "ffff:ffff:ffff:ffff::/64",
+			wantSubnets: []string{"ffff:ffff:ffff:ffff::/64"},
+			wantNext:    "",
+		},
+		{name: "no address space left", baseIP: "ffff:ffff:ffff:ffff::1", subnetCount: 1, wantErr: true},
+		{name: "too many subnets", baseIP: "fd00::", subnetCount: 1<<MaxSubnetListBits + 1, wantErr: true},
+		{name: "IPv4 base IP", baseIP: "10.0.0.0", subnetCount: 1, wantErr: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vNet, subnets, next, err := DeriveIPv6VNetAndSubnets(net.ParseIP(tc.baseIP), tc.subnetCount)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantVNet, vNet)
+			assert.Equal(t, tc.wantSubnets, subnets)
+			if tc.wantNext == "" {
+				assert.Nil(t, next)
+			} else {
+				assert.Equal(t, tc.wantNext, next.String())
+			}
+		})
+	}
+
+	// VNets derived one after another do not overlap
+	vNet1, _, next, err := DeriveIPv6VNetAndSubnets(net.ParseIP("fd00::"), 3)
+	require.NoError(t, err)
+	vNet2, _, _, err := DeriveIPv6VNetAndSubnets(next, 5)
+	require.NoError(t, err)
+	assert.False(t, cidrOverlap(vNet1, vNet2), "%s and %s overlap", vNet1, vNet2)
+}
+
+func TestDeriveVNetAndSubnets(t *testing.T) {
+	cases := []struct {
+		name        string
+		baseIP      string
+		subnetSize  int
+		subnetCount int
+		wantVNet    string
+		wantSubnets []string
+		wantNext    string
+	}{
+		{
+			name: "IPv4", baseIP: "10.0.0.0", subnetSize: 254, subnetCount: 2,
+			wantVNet:    "10.0.0.0/23",
+			wantSubnets: []string{"10.0.0.0/24", "10.0.1.0/24"},
+			wantNext:    "10.0.2.0",
+		},
+		{
+			// the subnet size is ignored for IPv6 (subnets are /64)
+			name: "IPv6", baseIP: "fd00::", subnetSize: 254, subnetCount: 2,
+			wantVNet:    "fd00::/63",
+			wantSubnets: []string{"fd00::/64", "fd00:0:0:1::/64"},
+			wantNext:    "fd00:0:0:2::",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			vNet, subnets, next, err := DeriveVNetAndSubnets(net.ParseIP(tc.baseIP), tc.subnetSize, tc.subnetCount)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantVNet, vNet)
+			assert.Equal(t, tc.wantSubnets, subnets)
+			assert.Equal(t, tc.wantNext, next.String())
+		})
+	}
+}
+
+func TestBigIntToIP(t *testing.T) {
+	maxIPv6 := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 128), big.NewInt(1))
+	cases := []struct {
+		name string
+		n    *big.Int
+		bits int
+		want string
+	}{
+		{name: "IPv4", n: big.NewInt(0x0a000001), bits: 32, want: "10.0.0.1"},
+		{name: "IPv4 overflow", n: big.NewInt(1 << 32), bits: 32, want: ""},
+		{name: "IPv6", n: IpToBigInt(net.ParseIP("fd00::1")), bits: 128, want: "fd00::1"},
+		{name: "IPv6 max", n: maxIPv6, bits: 128, want: "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"},
+		{name: "IPv6 overflow", n: new(big.Int).Add(maxIPv6, big.NewInt(1)), bits: 128, want: ""},
+		{name: "negative", n: big.NewInt(-1), bits: 128, want: ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ip := BigIntToIP(tc.n, tc.bits)
+			if tc.want == "" {
+				assert.Nil(t, ip)
+				return
+			}
+			assert.Equal(t, tc.want, ip.String())
+		})
+	}
+}
+
+func TestNetworkDetails(t *testing.T) {
+	cases := []struct {
+		cidrBlock        string
+		wantIPv6         bool
+		wantPrefix       int
+		wantHostCapacity int
+	}{
+		{cidrBlock: "10.0.0.0/24", wantIPv6: false, wantPrefix: 24, wantHostCapacity: 254},
+		{cidrBlock: "10.0.0.0/16", wantIPv6: false, wantPrefix: 16, wantHostCapacity: 65534},
+		// IPv6 has no network and broadcast addresses to reserve
+		{cidrBlock: "fd00::/120", wantIPv6: true, wantPrefix: 120, wantHostCapacity: 256},
+		// the capacity of a large IPv6 network is capped
+		{cidrBlock: "fd00::/64", wantIPv6: true, wantPrefix: 64, wantHostCapacity: math.MaxInt},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.wantIPv6, IsIPv6CIDR(tc.cidrBlock), tc.cidrBlock)
+		prefix, err := GetPrefix(tc.cidrBlock)
+		require.NoError(t, err, tc.cidrBlock)
+		assert.Equal(t, tc.wantPrefix, prefix, tc.cidrBlock)
+		details, err := NewNetworkDetails(tc.cidrBlock)
+		require.NoError(t, err, tc.cidrBlock)
+		assert.Equal(t, tc.wantHostCapacity, details.GetHostCapacity(), tc.cidrBlock)
+	}
+}
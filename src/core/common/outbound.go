@@ -0,0 +1,308 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// [Outbound calls (CB-Spider, CB-Dragonfly, Terrarium, MC-IAM, ...)]
+
+// ErrCircuitOpen is the error of a call to an endpoint whose circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// outboundEndpointKey is the context key of the endpoint of an outbound call
+type outboundEndpointKey struct{}
+
+// NewHttpClient returns a resty client for outbound calls. Every call of the client
+//   - is rate-limited per connection and per provider if it is a CB-Spider call (cloud.<csp>.ratelimit in cloud_conf.yaml)
+//   - is rejected with ErrCircuitOpen while the circuit breaker of its endpoint is open
+//   - times out after TB_OUTBOUND_TIMEOUT_SEC per attempt (can be changed by SetTimeout) and follows the context of the request
+//   - is retried with exponential backoff and jitter (idempotent methods only, except for connection failures and 429)
+//   - is traced as a child span of the span in the context of the request, which is propagated by W3C trace context headers
+func NewHttpClient() *resty.Client {
+	client := resty.New()
+	client.SetTransport(&outboundTransport{base: client.GetClient().Transport})
+
+	client.SetTimeout(time.Duration(envInt(model.OutboundTimeoutSec, 600)) * time.Second)
+	client.SetRetryCount(envInt(model.OutboundRetryMax, 3))
+	client.SetRetryWaitTime(time.Duration(envInt(model.OutboundRetryWaitMs, 500)) * time.Millisecond)
+	client.SetRetryMaxWaitTime(time.Duration(envInt(model.OutboundRetryMaxWaitMs, 10000)) * time.Millisecond)
+	client.AddRetryCondition(shouldRetryOutbound)
+
+	client.OnBeforeRequest(func(_ *resty.Client, req *resty.Request) error {
+		connectionName := ""
+		if model.SpiderRestUrl != "" && strings.HasPrefix(req.URL, model.SpiderRestUrl) {
+			connectionName = spiderConnectionName(req)
+			if err := WaitSpiderRateLimit(req.Context(), connectionName); err != nil {
+				return err
+			}
+		}
+
+		endpoint, ok := req.Context().Value(outboundEndpointKey{}).(string)
+		if !ok {
+			endpoint = outboundEndpoint(req.URL, connectionName)
+			req.SetContext(context.WithValue(req.Context(), outboundEndpointKey{}, endpoint))
+		}
+		return getCircuitBreaker(endpoint).allow()
+	})
+	return client
+}
+
+// shouldRetryOutbound decides if a failed attempt of an outbound call is retried
+func shouldRetryOutbound(resp *resty.Response, err error) bool {
+	// the call failed before being sent (e.g. open circuit breaker, canceled while waiting for the rate limit)
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+	if resp.Request.Context().Err() != nil {
+		return false
+	}
+
+	idempotent := resp.Request.Header.Get("Idempotency-Key") != ""
+	switch resp.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		idempotent = true
+	}
+
+	if err != nil {
+		if idempotent {
+			return true
+		}
+		// a non-idempotent call is retried only if it could not be sent to the endpoint
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+
+	switch resp.StatusCode() {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// outboundEndpoint returns the endpoint of an outbound call for the circuit breaker
+// (the host, with the connection name for CB-Spider calls to isolate failing CSP regions)
+func outboundEndpoint(rawUrl string, connectionName string) string {
+	endpoint := rawUrl
+	if u, err := url.Parse(rawUrl); err == nil && u.Host != "" {
+		endpoint = u.Host
+	}
+	if connectionName != "" {
+		endpoint += "/" + connectionName
+	}
+	return endpoint
+}
+
+// outboundTransport records the result of every attempt of outbound calls to the circuit breaker of the endpoint,
+// and traces every attempt as a client span whose W3C trace context is sent to the endpoint
+type outboundTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip sends the request by the base transport and records the result
+func (t *outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint, ok := req.Context().Value(outboundEndpointKey{}).(string)
+	if !ok {
+		endpoint = req.URL.Host
+	}
+	cb := getCircuitBreaker(endpoint)
+
+	ctx, span := Tracer().Start(req.Context(), req.Method+" "+outboundTarget(req.URL.String()),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.full", req.URL.String()),
+			attribute.String("server.address", req.URL.Host),
+		),
+	)
+	defer span.End()
+	// a RoundTripper must not modify the given request
+	req = req.Clone(ctx)
+	InjectTraceContext(ctx, req.Header)
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+
+	switch {
+	case err != nil && errors.Is(req.Context().Err(), context.Canceled):
+		// canceled by the caller; not a failure of the endpoint
+		cb.release()
+	case err != nil:
+		cb.recordFailure(err.Error())
+	case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout:
+		cb.recordFailure(resp.Status)
+	default:
+		cb.recordSuccess()
+	}
+	return resp, err
+}
+
+// [Circuit breakers of outbound endpoints]
+
+// circuitBreakers is the map of circuit breakers (endpoint -> *circuitBreaker)
+var circuitBreakers sync.Map
+
+// circuitBreaker opens after TB_CIRCUIT_BREAKER_THRESHOLD consecutive failures of an endpoint,
+// rejects calls for TB_CIRCUIT_BREAKER_OPEN_SEC, and then lets one probe call decide to close or open it again
+type circuitBreaker struct {
+	mu         sync.Mutex
+	endpoint   string
+	state      string
+	failures   int
+	lastError  string
+	openedTime time.Time
+	probeTime  time.Time
+}
+
+// getCircuitBreaker returns the circuit breaker of the endpoint
+func getCircuitBreaker(endpoint string) *circuitBreaker {
+	v, _ := circuitBreakers.LoadOrStore(endpoint, &circuitBreaker{endpoint: endpoint, state: model.CircuitBreakerClosed})
+	return v.(*circuitBreaker)
+}
+
+// circuitBreakerOpenDuration returns how long a circuit breaker stays open
+func circuitBreakerOpenDuration() time.Duration {
+	return time.Duration(envInt(model.CircuitBreakerOpenSec, 30)) * time.Second
+}
+
+// allow returns ErrCircuitOpen if a call to the endpoint is not allowed
+func (cb *circuitBreaker) allow() error {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	openDuration := circuitBreakerOpenDuration()
+	switch cb.state {
+	case model.CircuitBreakerOpen:
+		if time.Since(cb.openedTime) < openDuration {
+			return fmt.Errorf("%w for %s (last error: %s)", ErrCircuitOpen, cb.endpoint, cb.lastError)
+		}
+		cb.state = model.CircuitBreakerHalfOpen
+		cb.probeTime = time.Now()
+		log.Info().Msgf("circuit breaker for %s is half-open; probing", cb.endpoint)
+		return nil
+	case model.CircuitBreakerHalfOpen:
+		// only one probe at a time (a lost probe is replaced after the open duration)
+		if !cb.probeTime.IsZero() && time.Since(cb.probeTime) < openDuration {
+			return fmt.Errorf("%w for %s (probing)", ErrCircuitOpen, cb.endpoint)
+		}
+		cb.probeTime = time.Now()
+		return nil
+	}
+	return nil
+}
+
+// release frees the probe of a half-open circuit breaker without a result
+func (cb *circuitBreaker) release() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.probeTime = time.Time{}
+}
+
+// recordSuccess closes the circuit breaker
+func (cb *circuitBreaker) recordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.state != model.CircuitBreakerClosed {
+		log.Info().Msgf("circuit breaker for %s is closed", cb.endpoint)
+	}
+	cb.state = model.CircuitBreakerClosed
+	cb.failures = 0
+	cb.probeTime = time.Time{}
+}
+
+// recordFailure counts the failure and opens the circuit breaker if the threshold is reached (or the probe failed)
+func (cb *circuitBreaker) recordFailure(errMsg string) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.failures++
+	cb.lastError = errMsg
+	cb.probeTime = time.Time{}
+
+	threshold := envInt(model.CircuitBreakerThreshold, 5)
+	if threshold < 1 {
+		// circuit breaker is disabled
+		return
+	}
+	if cb.state == model.CircuitBreakerHalfOpen || (cb.state == model.CircuitBreakerClosed && cb.failures >= threshold) {
+		cb.state = model.CircuitBreakerOpen
+		cb.openedTime = time.Now()
+		log.Warn().Msgf("circuit breaker for %s is open after %d consecutive failures (last error: %s)", cb.endpoint, cb.failures, errMsg)
+	}
+}
+
+// status returns the status of the circuit breaker
+func (cb *circuitBreaker) status() model.CircuitBreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return model.CircuitBreakerStatus{
+		Endpoint:            cb.endpoint,
+		State:               cb.state,
+		ConsecutiveFailures: cb.failures,
+		LastError:           cb.lastError,
+		OpenedTime:          cb.openedTime,
+	}
+}
+
+// ListCircuitBreakerStatus returns the status of the circuit breakers of outbound endpoints
+// (only the breakers not closed if includeClosed is false)
+func ListCircuitBreakerStatus(includeClosed bool) []model.CircuitBreakerStatus {
+	list := []model.CircuitBreakerStatus{}
+	circuitBreakers.Range(func(_, v interface{}) bool {
+		status := v.(*circuitBreaker).status()
+		if includeClosed || status.State != model.CircuitBreakerClosed {
+			list = append(list, status)
+		}
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Endpoint < list[j].Endpoint })
+	return list
+}
+
+// envInt returns the integer value of a setting (defaultValue if empty or invalid)
+func envInt(value string, defaultValue int) int {
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		return defaultValue
+	}
+	return i
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+// [Rate limiting of CB-Spider calls]
+
+// spiderLimiters is the map of token buckets for CB-Spider calls ("connection/<name>" or "provider/<name>" -> *rate.Limiter)
+var spiderLimiters sync.Map
+
+// connectionProviders caches the provider of connection configs (connection name -> provider name)
+var connectionProviders sync.Map
+
+// WaitSpiderRateLimit waits until a CB-Spider call for the connection is allowed by the rate limits
+// of the connection and of its provider (calls without connection are not limited)
+func WaitSpiderRateLimit(ctx context.Context, connectionName string) error {
+	if connectionName == "" {
+		return nil
+	}
+	provider := providerOfConnection(connectionName)
+	setting := getRateLimitSetting(provider)
+
+	limiter := getSpiderLimiter("connection/"+connectionName, setting.ConnectionRps, setting.ConnectionBurst)
+	if err := limiter.Wait(ctx); err != nil {
+		return err
+	}
+	if provider == "" {
+		return nil
+	}
+	limiter = getSpiderLimiter("provider/"+provider, setting.ProviderRps, setting.ProviderBurst)
+	return limiter.Wait(ctx)
+}
+
+// getSpiderLimiter returns the token bucket of the key, updated to the given rate and burst
+// (the settings can be changed while running by reloading cloud_conf.yaml)
+func getSpiderLimiter(key string, rpsStr string, burstStr string) *rate.Limiter {
+	limit := rate.Inf
+	if rps, err := strconv.ParseFloat(rpsStr, 64); err == nil && rps > 0 {
+		limit = rate.Limit(rps)
+	}
+	burst, err := strconv.Atoi(burstStr)
+	if err != nil || burst < 1 {
+		burst = 1
+	}
+
+	v, _ := spiderLimiters.LoadOrStore(key, rate.NewLimiter(limit, burst))
+	limiter := v.(*rate.Limiter)
+	if limiter.Limit() != limit {
+		limiter.SetLimit(limit)
+	}
+	if limiter.Burst() != burst {
+		limiter.SetBurst(burst)
+	}
+	return limiter
+}
+
+// getRateLimitSetting returns the rate limit setting of the provider (the common setting for empty fields)
+func getRateLimitSetting(provider string) model.RateLimitSetting {
+	setting := RuntimeConf.Cloud.Common.RateLimit
+	lowercase := strings.ToLower(provider)
+	if lowercase == "" {
+		return setting
+	}
+	fieldName := strings.ToUpper(string(lowercase[0])) + lowercase[1:]
+	field := reflect.ValueOf(&RuntimeConf.Cloud).Elem().FieldByName(fieldName)
+	if !field.IsValid() {
+		return setting
+	}
+	cloudSetting, ok := field.Interface().(model.CloudSetting)
+	if !ok {
+		return setting
+	}
+	providerSetting := cloudSetting.RateLimit
+	if providerSetting.ConnectionRps != "" {
+		setting.ConnectionRps = providerSetting.ConnectionRps
+	}
+	if providerSetting.ConnectionBurst != "" {
+		setting.ConnectionBurst = providerSetting.ConnectionBurst
+	}
+	if providerSetting.ProviderRps != "" {
+		setting.ProviderRps = providerSetting.ProviderRps
+	}
+	if providerSetting.ProviderBurst != "" {
+		setting.ProviderBurst = providerSetting.ProviderBurst
+	}
+	return setting
+}
+
+// providerOfConnection returns the provider of the connection config (empty if unknown)
+func providerOfConnection(connectionName string) string {
+	if v, ok := connectionProviders.Load(connectionName); ok {
+		return v.(string)
+	}
+	connConfig, err := GetConnConfig(connectionName)
+	if err != nil {
+		log.Debug().Msgf("cannot find the provider of connection %s for rate limiting", connectionName)
+		return ""
+	}
+	provider := strings.ToLower(connConfig.ProviderName)
+	connectionProviders.Store(connectionName, provider)
+	return provider
+}
+
+// spiderConnectionName extracts the connection name of a CB-Spider request from its query or body
+func spiderConnectionName(req *resty.Request) string {
+	if name := req.QueryParam.Get("ConnectionName"); name != "" {
+		return name
+	}
+	if u, err := url.Parse(req.URL); err == nil {
+		if name := u.Query().Get("ConnectionName"); name != "" {
+			return name
+		}
+	}
+
+	var bodyBytes []byte
+	switch body := req.Body.(type) {
+	case nil:
+		return ""
+	case []byte:
+		bodyBytes = body
+	case string:
+		bodyBytes = []byte(body)
+	default:
+		var err error
+		bodyBytes, err = json.Marshal(body)
+		if err != nil {
+			return ""
+		}
+	}
+	connection := struct {
+		ConnectionName string `json:"ConnectionName"`
+	}{}
+	if err := json.Unmarshal(bodyBytes, &connection); err != nil {
+		return ""
+	}
+	return connection.ConnectionName
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// [Redaction of secrets in the data stored in the kvstore]
+
+// sensitiveFields is the (lower-case) substrings of the field names whose values are redacted
+var sensitiveFields = []string{"password", "secret", "privatekey", "token", "passphrase", "apikey"}
+
+// redactedPaths is the (lower-case) substrings of the paths whose request bodies are not stored at all
+// (credential registration, including the requests forwarded to CB-Spider, and namespace secrets)
+var redactedPaths = []string{"credential", "/secret/"}
+
+// isRedactedPath checks if the request bodies of the path are not stored at all
+func isRedactedPath(path string) bool {
+	lowerPath := strings.ToLower(path)
+	for _, p := range redactedPaths {
+		if strings.Contains(lowerPath, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactRequestBody returns the parsed request body to be stored in the kvstore (e.g., in a job).
+// Bodies of credentials and secrets are not stored, and the values of sensitive fields
+// (e.g., vmUserPassword) are replaced with model.RedactedValue.
+func RedactRequestBody(url string, body interface{}) interface{} {
+	if body == nil {
+		return nil
+	}
+	if isRedactedPath(url) {
+		return model.RedactedValue
+	}
+	return RedactSecretValue(body)
+}
+
+// RedactSecretValue returns a JSON copy of the value (e.g., the result of a job) in which
+// the values of sensitive fields (e.g., vmUserPassword, privateKey) are redacted.
+func RedactSecretValue(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return model.RedactedValue
+	}
+	var data interface{}
+	if err := json.Unmarshal(b, &data); err != nil {
+		return model.RedactedValue
+	}
+	return redactValue(data)
+}
+
+// redactValue replaces the values of sensitive fields in the JSON value recursively
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, field := range t {
+			if isSensitiveField(k) {
+				t[k] = model.RedactedValue
+				continue
+			}
+			t[k] = redactValue(field)
+		}
+	case []interface{}:
+		for i := range t {
+			t[i] = redactValue(t[i])
+		}
+	}
+	return v
+}
+
+// isSensitiveField checks if the field name is of a sensitive value
+func isSensitiveField(name string) bool {
+	lower := strings.ToLower(name)
+	for _, s := range sensitiveFields {
+		if strings.Contains(lower, s) {
+			return true
+		}
+	}
+	return false
+}
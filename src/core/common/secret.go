@@ -0,0 +1,154 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// secretObject is the stored form of a namespace secret
+type secretObject struct {
+	model.SecretInfo
+	Value string `json:"value"`
+}
+
+// GenSecretKey is func to generate the kvstore key of a namespace secret
+// (an empty name returns the prefix of all secrets in the namespace)
+func GenSecretKey(nsId string, name string) string {
+	return "/ns/" + nsId + "/secret/" + name
+}
+
+// SetSecret is func to create or update a namespace secret
+func SetSecret(nsId string, name string, req *model.SecretReq) (model.SecretInfo, error) {
+	err := CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.SecretInfo{}, err
+	}
+	err = CheckString(name)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.SecretInfo{}, err
+	}
+	if check, _ := CheckNs(nsId); !check {
+		err := fmt.Errorf("the namespace %s does not exist", nsId)
+		log.Error().Err(err).Msg("")
+		return model.SecretInfo{}, err
+	}
+	if req.Value == "" {
+		return model.SecretInfo{}, fmt.Errorf("the secret value is empty")
+	}
+
+	// the value is stored encrypted with the master key
+	encrypted, err := EncryptSecret(req.Value)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.SecretInfo{}, err
+	}
+	obj := secretObject{
+		SecretInfo: model.SecretInfo{Name: name, UpdatedTime: time.Now().UTC().Format(time.RFC3339)},
+		Value:      encrypted,
+	}
+	val, err := json.Marshal(obj)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.SecretInfo{}, err
+	}
+	err = kvstore.Put(GenSecretKey(nsId, name), string(val))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.SecretInfo{}, err
+	}
+	return obj.SecretInfo, nil
+}
+
+// GetSecretValue is func to get the value of a namespace secret (internal use only)
+func GetSecretValue(nsId string, name string) (string, error) {
+	err := CheckString(name)
+	if err != nil {
+		return "", err
+	}
+	keyValue, err := kvstore.GetKv(GenSecretKey(nsId, name))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return "", err
+	}
+	if keyValue == (kvstore.KeyValue{}) {
+		return "", fmt.Errorf("the secret %s does not exist in namespace %s", name, nsId)
+	}
+	obj := secretObject{}
+	err = json.Unmarshal([]byte(keyValue.Value), &obj)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return "", err
+	}
+	value, err := DecryptSecret(obj.Value)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to decrypt the secret %s in namespace %s", name, nsId)
+		return "", err
+	}
+	return value, nil
+}
+
+// ListSecret is func to list the secrets of a namespace without their values
+func ListSecret(nsId string) ([]model.SecretInfo, error) {
+	err := CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	keyValue, err := kvstore.GetKvList(GenSecretKey(nsId, ""))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	result := []model.SecretInfo{}
+	for _, kv := range keyValue {
+		obj := secretObject{}
+		if err := json.Unmarshal([]byte(kv.Value), &obj); err != nil {
+			log.Warn().Err(err).Msgf("skip malformed secret %s", kv.Key)
+			continue
+		}
+		result = append(result, obj.SecretInfo)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// DelSecret is func to delete a namespace secret
+func DelSecret(nsId string, name string) error {
+	err := CheckString(name)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	key := GenSecretKey(nsId, name)
+	keyValue, err := kvstore.GetKv(key)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	if keyValue == (kvstore.KeyValue{}) {
+		return fmt.Errorf("the secret %s does not exist in namespace %s", name, nsId)
+	}
+	return kvstore.Delete(key)
+}
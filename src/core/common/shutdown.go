@@ -0,0 +1,263 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// [Graceful shutdown with draining of in-flight operations]
+
+// shutdownDrainPollInterval is the interval to check whether in-flight operations are finished
+const shutdownDrainPollInterval = 500 * time.Millisecond
+
+// shuttingDown is set when the instance starts to shut down (new mutating requests are rejected)
+var shuttingDown atomic.Bool
+
+// inflightMutation is a mutating request being handled by this instance
+type inflightMutation struct {
+	Request   RequestInfo
+	StartTime time.Time
+}
+
+// inflightMutations is the map of mutating requests being handled by this instance (reqId -> inflightMutation)
+var inflightMutations sync.Map
+
+// inflightBackground is the number of background operations (e.g., the MCI policy and reconciliation controllers)
+// being run by this instance
+var inflightBackground atomic.Int64
+
+// IsShuttingDown returns whether the instance is shutting down
+func IsShuttingDown() bool {
+	return shuttingDown.Load()
+}
+
+// BeginShutdown is func to mark the instance as shutting down (new mutating requests are rejected from now)
+func BeginShutdown() {
+	shuttingDown.Store(true)
+	model.SystemReady = false
+}
+
+// ShutdownTimeout returns the time to wait for in-flight operations at shutdown (TB_SHUTDOWN_TIMEOUT_SEC)
+func ShutdownTimeout() time.Duration {
+	sec, err := strconv.Atoi(model.ShutdownTimeoutSec)
+	if err != nil || sec < 0 {
+		sec = 8
+	}
+	return time.Duration(sec) * time.Second
+}
+
+// TrackRequest is func to register a mutating request in flight. The returned func unregisters it.
+func TrackRequest(reqId string, request RequestInfo) func() {
+	inflightMutations.Store(reqId, inflightMutation{Request: request, StartTime: time.Now()})
+	return func() { inflightMutations.Delete(reqId) }
+}
+
+// TrackBackgroundOperation is func to register a background operation in flight (not started by a request),
+// so that the shutdown waits for it. It returns false if the instance is shutting down (the operation is not started),
+// and the returned func unregisters it.
+func TrackBackgroundOperation() (func(), bool) {
+	inflightBackground.Add(1)
+	if IsShuttingDown() {
+		inflightBackground.Add(-1)
+		return func() {}, false
+	}
+	return func() { inflightBackground.Add(-1) }, true
+}
+
+// countInflight returns the number of the jobs and the mutating requests in flight in this instance
+func countInflight() (jobs int, requests int) {
+	runningJobs.Range(func(_, _ interface{}) bool {
+		jobs++
+		return true
+	})
+	inflightMutations.Range(func(key, _ interface{}) bool {
+		// a request running as a job is counted as the job
+		if _, _, ok := runningJobOfRequest(key.(string)); !ok {
+			requests++
+		}
+		return true
+	})
+	return jobs, requests
+}
+
+// DrainOperations is func to wait until the jobs, the mutating requests and the background operations in flight
+// are finished or ctx is done.
+// It returns true if all of them are finished.
+func DrainOperations(ctx context.Context) bool {
+	ticker := time.NewTicker(shutdownDrainPollInterval)
+	defer ticker.Stop()
+	for {
+		jobs, requests := countInflight()
+		background := inflightBackground.Load()
+		if jobs == 0 && requests == 0 && background == 0 {
+			return true
+		}
+		log.Info().Msgf("[Shutdown] waiting for %d jobs, %d requests and %d background operations in flight", jobs, requests, background)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckpointOperations is func to record the operations still in flight as interrupted jobs with their checkpoints,
+// so that a restarted instance can report them (GET /job?status=Interrupted).
+func CheckpointOperations(reason string) {
+	now := time.Now()
+
+	runningJobs.Range(func(key, _ interface{}) bool {
+		jobId := key.(string)
+		job, err := updateJob(jobId, func(j *model.JobInfo) bool {
+			if isJobFinished(j.Status) {
+				return false
+			}
+			j.Status = model.JobStatusInterrupted
+			j.Error = reason
+			j.EndTime = now
+			j.ExpireTime = now.Add(jobRetention())
+			j.Checkpoint = newJobCheckpoint(reason, now, j.NsId, mciIdOfJob(*j))
+			return true
+		})
+		if err != nil {
+			log.Error().Err(err).Msgf("[Shutdown] failed to checkpoint the job %s", jobId)
+			return true
+		}
+		log.Warn().Msgf("[Shutdown] the job %s (%s) is checkpointed as interrupted", jobId, job.Kind)
+		return true
+	})
+
+	inflightMutations.Range(func(key, value interface{}) bool {
+		reqId := key.(string)
+		if _, _, ok := runningJobOfRequest(reqId); ok {
+			return true
+		}
+		req := value.(inflightMutation)
+		nsId, mciId := requestTarget(req.Request.URL)
+		job := model.JobInfo{
+			Id:            GenUid(),
+			Kind:          model.JobKindRequest,
+			NsId:          nsId,
+			TargetId:      mciId,
+			Status:        model.JobStatusInterrupted,
+			Owner:         jobInstanceId,
+			RequestId:     reqId,
+			RequestMethod: req.Request.Method,
+			RequestUrl:    req.Request.URL,
+			RequestBody:   RedactRequestBody(req.Request.URL, req.Request.Body),
+			Error:         reason,
+			Checkpoint:    newJobCheckpoint(reason, now, nsId, mciId),
+			CreatedTime:   req.StartTime,
+			StartTime:     req.StartTime,
+			EndTime:       now,
+			HeartbeatTime: now,
+			ExpireTime:    now.Add(jobRetention()),
+		}
+		val, err := json.Marshal(job)
+		if err != nil {
+			return true
+		}
+		jobKey := GenJobKey(job.Id)
+		_, err = kvstore.Txn([]kvstore.Compare{kvstore.CompareNotExist(jobKey)}, []kvstore.Op{kvstore.OpPut(jobKey, string(val))})
+		if err != nil {
+			log.Error().Err(err).Msgf("[Shutdown] failed to checkpoint the request %s", reqId)
+			return true
+		}
+		log.Warn().Msgf("[Shutdown] the request %s (%s %s) is checkpointed as interrupted", reqId, req.Request.Method, req.Request.URL)
+		return true
+	})
+}
+
+// mciIdOfJob returns the MCI of the job (empty if the job is not on an MCI)
+func mciIdOfJob(job model.JobInfo) string {
+	switch job.Kind {
+	case model.JobKindCreateMci, model.JobKindCreateMciDynamic, model.JobKindDeleteMci:
+		return job.TargetId
+	}
+	return ""
+}
+
+// requestTarget returns the namespace and the MCI in the path of the request
+// (e.g., /tumblebug/ns/default/control/mci/mci01?action=suspend -> default, mci01)
+func requestTarget(requestUrl string) (nsId string, mciId string) {
+	u, err := url.Parse(requestUrl)
+	if err != nil {
+		return "", ""
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+1 < len(segments); i++ {
+		switch segments[i] {
+		case "ns":
+			if nsId == "" {
+				nsId = segments[i+1]
+			}
+		case "mci":
+			if mciId == "" {
+				mciId = segments[i+1]
+			}
+		}
+	}
+	return nsId, mciId
+}
+
+// newJobCheckpoint returns the checkpoint of an operation with the status of the target MCI and its VMs
+func newJobCheckpoint(reason string, t time.Time, nsId string, mciId string) *model.JobCheckpoint {
+	checkpoint := &model.JobCheckpoint{Time: t, Reason: reason}
+	if nsId == "" || mciId == "" {
+		return checkpoint
+	}
+
+	mciKey := GenMciKey(nsId, mciId, "")
+	mciKv, err := kvstore.GetKv(mciKey)
+	if err != nil || mciKv.Value == "" {
+		return checkpoint
+	}
+	mci := model.TbMciInfo{}
+	if err := json.Unmarshal([]byte(mciKv.Value), &mci); err != nil {
+		return checkpoint
+	}
+	checkpoint.MciStatus = mci.Status
+	checkpoint.MciTargetAction = mci.TargetAction
+
+	vmPrefix := mciKey + "/vm/"
+	vmKvs, err := kvstore.GetKvList(vmPrefix)
+	if err != nil {
+		return checkpoint
+	}
+	checkpoint.VmStatus = map[string]string{}
+	for _, kv := range vmKvs {
+		if strings.Contains(strings.TrimPrefix(kv.Key, vmPrefix), "/") {
+			continue
+		}
+		vm := model.TbVmInfo{}
+		if err := json.Unmarshal([]byte(kv.Value), &vm); err != nil {
+			continue
+		}
+		checkpoint.VmStatus[vm.Id] = vm.Status
+	}
+	return checkpoint
+}
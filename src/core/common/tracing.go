@@ -0,0 +1,131 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package common is to include common methods for managing multi-cloud infra
+package common
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// [OpenTelemetry tracing]
+
+// tracerName is the instrumentation name of the spans of CB-Tumblebug
+const tracerName = "github.com/cloud-barista/cb-tumblebug"
+
+// tracerProvider is the tracer provider initialized by InitTracing
+var tracerProvider *sdktrace.TracerProvider
+
+// InitTracing sets the global tracer provider and the W3C trace context propagator.
+// Spans are always created (so that trace IDs are logged and propagated to CB-Spider, CB-Dragonfly and Terrarium),
+// and exported to the OTLP/HTTP collector of TB_OTLP_ENDPOINT if it is set.
+func InitTracing() {
+	ratio := 1.0
+	if r, err := strconv.ParseFloat(model.OtlpSamplingRatio, 64); err == nil && r >= 0 && r <= 1 {
+		ratio = r
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(model.TracingServiceName))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	}
+
+	if model.OtlpEndpoint != "" {
+		endpoint := model.OtlpEndpoint
+		if u, err := url.Parse(endpoint); err == nil && (u.Path == "" || u.Path == "/") {
+			endpoint = u.Scheme + "://" + u.Host + "/v1/traces"
+		}
+		exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(endpoint))
+		if err != nil {
+			log.Error().Err(err).Msgf("failed to create the OTLP exporter for %s; spans are not exported", endpoint)
+		} else {
+			opts = append(opts, sdktrace.WithBatcher(exporter))
+			log.Info().Msgf("spans are exported to %s (sampling ratio: %v)", endpoint, ratio)
+		}
+	}
+
+	tracerProvider = sdktrace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// ShutdownTracing flushes the remaining spans to the exporter and stops the tracer provider
+func ShutdownTracing(ctx context.Context) error {
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.Shutdown(ctx)
+}
+
+// Tracer returns the tracer of CB-Tumblebug
+func Tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartSpan starts a span as a child of the span in ctx (or a new trace if ctx has no span)
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// EndSpan records the error (if any) of the operation of the span and ends the span
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// ExtractTraceContext returns the context with the remote span of the W3C trace context headers (traceparent, tracestate)
+func ExtractTraceContext(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// InjectTraceContext sets the W3C trace context headers of the span in ctx to the header
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// recordKvStoreSpan records a span of a kvstore operation if ctx belongs to a trace
+// (kvstore operations without a traced context are not worth a trace of their own)
+func recordKvStoreSpan(ctx context.Context, op string, start time.Time, err error) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return
+	}
+	_, span := Tracer().Start(ctx, "kvstore "+op,
+		trace.WithTimestamp(start),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", model.KvStoreType), attribute.String("db.operation.name", op)),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -42,8 +42,6 @@ import (
 
 	"encoding/json"
 	"fmt"
-
-	"github.com/go-resty/resty/v2"
 )
 
 // MCI utilities
@@ -176,6 +174,15 @@ func GenMciPolicyKey(nsId string, mciId string, vmId string) string {
 	}
 }
 
+// GenCmdHistoryKey is func to generate a key of the remote command history
+// (an empty historyId returns the prefix of the history of the MCI, an empty mciId the prefix of the namespace)
+func GenCmdHistoryKey(nsId string, mciId string, historyId string) string {
+	if mciId == "" {
+		return "/ns/" + nsId + "/cmdHistory/"
+	}
+	return "/ns/" + nsId + "/cmdHistory/mci/" + mciId + "/" + historyId
+}
+
 // GenConnectionKey is func to generate a key for connection info
 func GenConnectionKey(connectionId string) string {
 	return "/connection/" + connectionId
@@ -263,7 +270,7 @@ func GetConnConfig(ConnConfigName string) (model.ConnConfig, error) {
 func CheckConnConfigAvailable(connConfigName string) (bool, error) {
 
 	var callResult interface{}
-	client := resty.New()
+	client := NewHttpClient()
 	url := model.SpiderRestUrl + "/allkeypair"
 	method := "GET"
 	requestBody := model.SpiderConnectionName{}
@@ -292,7 +299,7 @@ func CheckConnConfigAvailable(connConfigName string) (bool, error) {
 func CheckSpiderReady() error {
 
 	var callResult interface{}
-	client := resty.New()
+	client := NewHttpClient()
 	url := model.SpiderRestUrl + "/readyz"
 	method := "GET"
 	requestBody := NoBody
@@ -404,7 +411,7 @@ func RegisterCloudInfo(providerName string) error {
 
 	driverName := RuntimeCloudInfo.CSPs[providerName].Driver
 
-	client := resty.New()
+	client := NewHttpClient()
 	url := model.SpiderRestUrl + "/driver"
 	method := "POST"
 	var callResult model.CloudDriverInfo
@@ -439,7 +446,7 @@ func RegisterCloudInfo(providerName string) error {
 
 // RegisterRegionZone is func to register all regions to CB-Spider
 func RegisterRegionZone(providerName string, regionName string) error {
-	client := resty.New()
+	client := NewHttpClient()
 	url := model.SpiderRestUrl + "/region"
 	method := "POST"
 	var callResult model.SpiderRegionZoneInfo
@@ -641,7 +648,7 @@ func RegisterCredential(req model.CredentialReq) (model.CredentialInfo, error) {
 		KeyValueInfoList: decryptedKeyValueList,
 	}
 
-	client := resty.New()
+	client := NewHttpClient()
 	url := model.SpiderRestUrl + "/credential"
 	method := "POST"
 	var callResult model.CredentialInfo
@@ -862,7 +869,7 @@ func RegisterCredential(req model.CredentialReq) (model.CredentialInfo, error) {
 
 // RegisterConnectionConfig is func to register connection config to CB-Spider
 func RegisterConnectionConfig(connConfig model.ConnConfig) (model.ConnConfig, error) {
-	client := resty.New()
+	client := NewHttpClient()
 	url := model.SpiderRestUrl + "/connectionconfig"
 	method := "POST"
 	var callResult model.SpiderConnConfig
@@ -1027,7 +1034,7 @@ func RetrieveRegionListFromCsp() (model.RetrievedRegionList, error) {
 
 	url := model.SpiderRestUrl + "/region"
 
-	client := resty.New().SetCloseConnection(true)
+	client := NewHttpClient().SetCloseConnection(true)
 
 	resp, err := client.R().
 		SetResult(&model.RetrievedRegionList{}).
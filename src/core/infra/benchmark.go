@@ -17,7 +17,6 @@ package infra
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 
 	"strings"
 
@@ -30,6 +29,7 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 )
 
@@ -66,11 +66,11 @@ func CallMilkyway(wg *sync.WaitGroup, vmList []string, nsId string, mciId string
 	url := "http://" + vmIp + model.MilkywayPort + action
 	method := "GET"
 
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-	}
+	client := common.NewHttpClient()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	client.SetAllowGetMethodPayload(true)
 
 	// Create Req body
 	type JsonTemplate struct {
@@ -99,30 +99,20 @@ func CallMilkyway(wg *sync.WaitGroup, vmList []string, nsId string, mciId string
 		payload, _ = json.MarshalIndent(reqTmp, "", "  ")
 	}
 
-	req, err := http.NewRequest(method, url, strings.NewReader(string(payload)))
-	req.Header.Add("Content-Type", "application/json")
-	if err != nil {
-		log.Err(err).Msg("")
-	}
 	errStr := ""
 	resultTmp := model.BenchmarkInfo{}
 
-	res, err := client.Do(req)
+	res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(payload).Execute(method, url)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		errStr = err.Error()
 	} else {
-		body, err := io.ReadAll(res.Body)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			errStr = err.Error()
-		}
-		defer res.Body.Close()
+		body := res.Body()
 		fmt.Println(string(body))
 
-		// fmt.Println("HTTP Status code: " + strconv.Itoa(res.StatusCode))
+		// fmt.Println("HTTP Status code: " + strconv.Itoa(res.StatusCode()))
 		switch {
-		case res.StatusCode >= 400 || res.StatusCode < 200:
+		case res.StatusCode() >= 400 || res.StatusCode() < 200:
 			err := fmt.Errorf(string(body))
 			log.Error().Err(err).Msg("")
 			errStr = err.Error()
@@ -0,0 +1,268 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mci is to manage multi-cloud infra
+package infra
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// [Remote command history]
+
+// truncateCmdOutput keeps the last CmdHistoryOutputMaxBytes bytes of the output
+func truncateCmdOutput(output string) (string, bool) {
+	if len(output) <= model.CmdHistoryOutputMaxBytes {
+		return output, false
+	}
+	return "...(truncated)\n" + output[len(output)-model.CmdHistoryOutputMaxBytes:], true
+}
+
+// recordCmdHistory stores the history of a remote command (or file transfer) executed on a VM
+// and removes the oldest entries of the MCI over the limit (secret values in the output are masked)
+func recordCmdHistory(nsId string, reqId string, historyType string, userName string, startTime time.Time, result model.SshCmdResult, secrets []string) {
+	endTime := time.Now()
+	entry := model.CmdHistoryInfo{
+		Id:        fmt.Sprintf("%020d-%s", startTime.UnixNano(), result.VmId),
+		ReqId:     reqId,
+		Type:      historyType,
+		NsId:      nsId,
+		MciId:     result.MciId,
+		VmId:      result.VmId,
+		VmIp:      result.VmIp,
+		UserName:  userName,
+		Command:   map[int]string{},
+		StartTime: startTime.UTC().Format(time.RFC3339Nano),
+		EndTime:   endTime.UTC().Format(time.RFC3339Nano),
+		ExitCode:  result.ExitCode,
+		Stdout:    map[int]string{},
+		Stderr:    map[int]string{},
+	}
+	for i, cmd := range result.Command {
+		entry.Command[i] = maskSecrets(cmd, secrets)
+	}
+	for i, out := range result.Stdout {
+		var truncated bool
+		entry.Stdout[i], truncated = truncateCmdOutput(maskSecrets(out, secrets))
+		entry.Truncated = entry.Truncated || truncated
+	}
+	for i, out := range result.Stderr {
+		var truncated bool
+		entry.Stderr[i], truncated = truncateCmdOutput(maskSecrets(out, secrets))
+		entry.Truncated = entry.Truncated || truncated
+	}
+	if result.Err != nil {
+		entry.Err = result.Err.Error()
+	}
+
+	prefix := common.GenCmdHistoryKey(nsId, result.MciId, "")
+	val, _ := json.Marshal(entry)
+	err := kvstore.Put(prefix+entry.Id, string(val))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to record remote command history")
+		return
+	}
+
+	keyValue, err := kvstore.GetKvList(prefix)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return
+	}
+	if len(keyValue) <= model.CmdHistoryMaxEntries {
+		return
+	}
+	ops := []kvstore.Op{}
+	for _, kv := range keyValue[:len(keyValue)-model.CmdHistoryMaxEntries] {
+		ops = append(ops, kvstore.OpDelete(kv.Key))
+	}
+	err = commitOpsInBatches(ops)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+	}
+}
+
+// cmdHistoryMatches checks if the history entry matches the filter
+func cmdHistoryMatches(entry model.CmdHistoryInfo, filter model.CmdHistoryFilter) bool {
+	if filter.VmId != "" && entry.VmId != filter.VmId {
+		return false
+	}
+	if filter.ReqId != "" && entry.ReqId != filter.ReqId {
+		return false
+	}
+	if filter.Type != "" && !strings.EqualFold(entry.Type, filter.Type) {
+		return false
+	}
+	if filter.Status != "" {
+		failed := entry.Err != ""
+		for _, code := range entry.ExitCode {
+			if code != 0 {
+				failed = true
+			}
+		}
+		if strings.EqualFold(filter.Status, "success") == failed {
+			return false
+		}
+	}
+	// RFC3339 timestamps in UTC are compared as strings
+	if filter.Since != "" && entry.StartTime < filter.Since {
+		return false
+	}
+	if filter.Until != "" && entry.StartTime > filter.Until {
+		return false
+	}
+	if filter.Contains != "" {
+		found := false
+		for _, cmd := range entry.Command {
+			if strings.Contains(cmd, filter.Contains) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeCmdHistoryFilter validates the filter and converts its times to UTC
+func normalizeCmdHistoryFilter(filter model.CmdHistoryFilter) (model.CmdHistoryFilter, error) {
+	if filter.Status != "" && !strings.EqualFold(filter.Status, "success") && !strings.EqualFold(filter.Status, "failed") {
+		return filter, fmt.Errorf("invalid status %s (success or failed)", filter.Status)
+	}
+	if filter.Limit < 0 {
+		return filter, fmt.Errorf("limit should not be negative")
+	}
+	for _, t := range []*string{&filter.Since, &filter.Until} {
+		if *t == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, *t)
+		if err != nil {
+			return filter, fmt.Errorf("invalid time %s (RFC3339 is required): %w", *t, err)
+		}
+		*t = parsed.UTC().Format(time.RFC3339Nano)
+	}
+	return filter, nil
+}
+
+// listCmdHistory returns the keys and the entries of the history of an MCI matching the filter (oldest first)
+func listCmdHistory(nsId string, mciId string, filter model.CmdHistoryFilter) ([]string, []model.CmdHistoryInfo, error) {
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, nil, err
+	}
+	err = common.CheckString(mciId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, nil, err
+	}
+	filter, err = normalizeCmdHistoryFilter(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyValue, err := kvstore.GetKvList(common.GenCmdHistoryKey(nsId, mciId, ""))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, nil, err
+	}
+	keys := []string{}
+	entries := []model.CmdHistoryInfo{}
+	for _, kv := range keyValue {
+		entry := model.CmdHistoryInfo{}
+		err = json.Unmarshal([]byte(kv.Value), &entry)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			continue
+		}
+		if !cmdHistoryMatches(entry, filter) {
+			continue
+		}
+		keys = append(keys, kv.Key)
+		entries = append(entries, entry)
+	}
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		keys = keys[len(keys)-filter.Limit:]
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return keys, entries, nil
+}
+
+// ListCmdHistory is func to list the remote command history of an MCI with filters (oldest first)
+// (the history is kept after the MCI is deleted, as an audit trail)
+func ListCmdHistory(nsId string, mciId string, filter model.CmdHistoryFilter) (model.CmdHistoryList, error) {
+	_, entries, err := listCmdHistory(nsId, mciId, filter)
+	if err != nil {
+		return model.CmdHistoryList{History: []model.CmdHistoryInfo{}}, err
+	}
+	return model.CmdHistoryList{History: entries}, nil
+}
+
+// GetCmdHistory is func to get a remote command history entry of an MCI
+func GetCmdHistory(nsId string, mciId string, historyId string) (model.CmdHistoryInfo, error) {
+	entry := model.CmdHistoryInfo{}
+	keyValue, err := kvstore.GetKv(common.GenCmdHistoryKey(nsId, mciId, historyId))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return entry, err
+	}
+	if keyValue == (kvstore.KeyValue{}) {
+		return entry, fmt.Errorf("the command history %s does not exist in MCI %s", historyId, mciId)
+	}
+	err = json.Unmarshal([]byte(keyValue.Value), &entry)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return entry, err
+	}
+	return entry, nil
+}
+
+// DelCmdHistory is func to delete a remote command history entry of an MCI
+func DelCmdHistory(nsId string, mciId string, historyId string) error {
+	_, err := GetCmdHistory(nsId, mciId, historyId)
+	if err != nil {
+		return err
+	}
+	return kvstore.Delete(common.GenCmdHistoryKey(nsId, mciId, historyId))
+}
+
+// DelAllCmdHistory is func to delete the remote command history entries of an MCI matching the filter
+// and returns the IDs of the deleted entries
+func DelAllCmdHistory(nsId string, mciId string, filter model.CmdHistoryFilter) ([]string, error) {
+	keys, entries, err := listCmdHistory(nsId, mciId, filter)
+	if err != nil {
+		return nil, err
+	}
+	deleted := []string{}
+	ops := []kvstore.Op{}
+	for i, key := range keys {
+		ops = append(ops, kvstore.OpDelete(key))
+		deleted = append(deleted, entries[i].Id)
+	}
+	err = commitOpsInBatches(ops)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	return deleted, nil
+}
@@ -15,6 +15,7 @@ limitations under the License.
 package infra
 
 import (
+	"context"
 	"errors"
 
 	"encoding/json"
@@ -28,14 +29,14 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // MCI Control
 
 // HandleMciAction is func to handle actions to MCI
-func HandleMciAction(nsId string, mciId string, action string, force bool) (string, error) {
+func HandleMciAction(ctx context.Context, nsId string, mciId string, action string, force bool) (string, error) {
 	action = common.ToLower(action)
 
 	err := common.CheckString(nsId)
@@ -60,7 +61,7 @@ func HandleMciAction(nsId string, mciId string, action string, force bool) (stri
 	if action == "suspend" {
 		log.Debug().Msg("[suspend MCI]")
 
-		err := ControlMciAsync(nsId, mciId, model.ActionSuspend, force)
+		err := ControlMciAsync(ctx, nsId, mciId, model.ActionSuspend, force)
 		if err != nil {
 			return "", err
 		}
@@ -70,7 +71,7 @@ func HandleMciAction(nsId string, mciId string, action string, force bool) (stri
 	} else if action == "resume" {
 		log.Debug().Msg("[resume MCI]")
 
-		err := ControlMciAsync(nsId, mciId, model.ActionResume, force)
+		err := ControlMciAsync(ctx, nsId, mciId, model.ActionResume, force)
 		if err != nil {
 			return "", err
 		}
@@ -80,7 +81,7 @@ func HandleMciAction(nsId string, mciId string, action string, force bool) (stri
 	} else if action == "reboot" {
 		log.Debug().Msg("[reboot MCI]")
 
-		err := ControlMciAsync(nsId, mciId, model.ActionReboot, force)
+		err := ControlMciAsync(ctx, nsId, mciId, model.ActionReboot, force)
 		if err != nil {
 			return "", err
 		}
@@ -100,7 +101,7 @@ func HandleMciAction(nsId string, mciId string, action string, force bool) (stri
 			return "No VM to terminate in the MCI", nil
 		}
 
-		err = ControlMciAsync(nsId, mciId, model.ActionTerminate, force)
+		err = ControlMciAsync(ctx, nsId, mciId, model.ActionTerminate, force)
 		if err != nil {
 			return "", err
 		}
@@ -134,7 +135,7 @@ func HandleMciAction(nsId string, mciId string, action string, force bool) (stri
 			return "No VM in the MCI", nil
 		}
 
-		mciStatus, err := GetMciStatus(nsId, mciId)
+		mciStatus, err := GetMciStatusWithContext(ctx, nsId, mciId)
 		if err != nil {
 			log.Error().Err(err).Msg("")
 			return "", err
@@ -162,7 +163,7 @@ func HandleMciAction(nsId string, mciId string, action string, force bool) (stri
 }
 
 // HandleMciVmAction is func to Get MciVm Action
-func HandleMciVmAction(nsId string, mciId string, vmId string, action string, force bool) (string, error) {
+func HandleMciVmAction(ctx context.Context, nsId string, mciId string, vmId string, action string, force bool) (string, error) {
 
 	err := common.CheckString(nsId)
 	if err != nil {
@@ -190,7 +191,7 @@ func HandleMciVmAction(nsId string, mciId string, vmId string, action string, fo
 
 	log.Debug().Msg("[VM action: " + action)
 
-	mci, err := GetMciStatus(nsId, mciId)
+	mci, err := GetMciStatusWithContext(ctx, nsId, mciId)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return "", err
@@ -213,17 +214,26 @@ func HandleMciVmAction(nsId string, mciId string, vmId string, action string, fo
 		}
 	}
 
+	// the reconciler keeps the VM in the status requested for the VM (instead of the desired status of the MCI)
+	if desiredStatus := getVmDesiredStatus(action); desiredStatus != "" {
+		err = setVmDesiredStatus(nsId, mciId, vmId, desiredStatus)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return "", err
+		}
+	}
+
 	var wg sync.WaitGroup
 	results := make(chan model.ControlVmResult, 1)
 	wg.Add(1)
 	if strings.EqualFold(action, model.ActionSuspend) {
-		go ControlVmAsync(&wg, nsId, mciId, vmId, model.ActionSuspend, results)
+		go ControlVmAsync(ctx, &wg, nsId, mciId, vmId, model.ActionSuspend, results)
 	} else if strings.EqualFold(action, model.ActionResume) {
-		go ControlVmAsync(&wg, nsId, mciId, vmId, model.ActionResume, results)
+		go ControlVmAsync(ctx, &wg, nsId, mciId, vmId, model.ActionResume, results)
 	} else if strings.EqualFold(action, model.ActionReboot) {
-		go ControlVmAsync(&wg, nsId, mciId, vmId, model.ActionReboot, results)
+		go ControlVmAsync(ctx, &wg, nsId, mciId, vmId, model.ActionReboot, results)
 	} else if strings.EqualFold(action, model.ActionTerminate) {
-		go ControlVmAsync(&wg, nsId, mciId, vmId, model.ActionTerminate, results)
+		go ControlVmAsync(ctx, &wg, nsId, mciId, vmId, model.ActionTerminate, results)
 	} else {
 		close(results)
 		wg.Done()
@@ -238,7 +248,7 @@ func HandleMciVmAction(nsId string, mciId string, vmId string, action string, fo
 }
 
 // ControlMciAsync is func to control MCI async
-func ControlMciAsync(nsId string, mciId string, action string, force bool) error {
+func ControlMciAsync(ctx context.Context, nsId string, mciId string, action string, force bool) error {
 
 	mci, err := GetMciObject(nsId, mciId)
 	if err != nil {
@@ -299,6 +309,8 @@ func ControlMciAsync(nsId string, mciId string, action string, force bool) error
 	default:
 		return errors.New(action + " is invalid actionType")
 	}
+	// the reconciler re-drives VMs which have not reached the status
+	mci.DesiredStatus = mci.TargetStatus
 	UpdateMciInfo(nsId, mci)
 
 	//goroutin sync wg
@@ -306,15 +318,17 @@ func ControlMciAsync(nsId string, mciId string, action string, force bool) error
 	results := make(chan model.ControlVmResult, len(vmList))
 
 	for _, vmId := range vmList {
+		// VMs follow the desired status of the MCI again after an action on the MCI
+		err = setVmDesiredStatus(nsId, mciId, vmId, "")
+		if err != nil {
+			log.Error().Err(err).Msg("")
+		}
 		// skip if control is not needed
 		err = CheckAllowedTransition(nsId, mciId, model.OptionalParameter{Set: true, Value: vmId}, action)
 		if err == nil || force {
 			wg.Add(1)
-
-			// Avoid concurrent requests to CSP.
-			time.Sleep(time.Duration(3) * time.Second)
-
-			go ControlVmAsync(&wg, nsId, mciId, vmId, action, results)
+			// requests to CSP are rate-limited per connection and provider (cloud_conf.yaml)
+			go ControlVmAsync(ctx, &wg, nsId, mciId, vmId, action, results)
 		}
 	}
 	go func() {
@@ -342,8 +356,8 @@ func ControlMciAsync(nsId string, mciId string, action string, force bool) error
 
 }
 
-// ControlVmAsync is func to control VM async
-func ControlVmAsync(wg *sync.WaitGroup, nsId string, mciId string, vmId string, action string, results chan<- model.ControlVmResult) {
+// ControlVmAsync is func to control VM async (traced as a child span of the span in ctx)
+func ControlVmAsync(ctx context.Context, wg *sync.WaitGroup, nsId string, mciId string, vmId string, action string, results chan<- model.ControlVmResult) {
 	defer wg.Done() //goroutine sync done
 
 	var err error
@@ -353,6 +367,11 @@ func ControlVmAsync(wg *sync.WaitGroup, nsId string, mciId string, vmId string,
 	callResult.Status = ""
 	temp := model.TbVmInfo{}
 
+	// the VM is controlled even if ctx is canceled (only the trace of ctx is kept)
+	ctx, span := common.StartSpan(context.WithoutCancel(ctx), "ControlVm",
+		attribute.String("ns.id", nsId), attribute.String("mci.id", mciId), attribute.String("vm.id", vmId), attribute.String("action", action))
+	defer func() { common.EndSpan(span, callResult.Error) }()
+
 	key := common.GenMciKey(nsId, mciId, vmId)
 	log.Debug().Msg("[ControlVmAsync] " + key)
 
@@ -433,13 +452,14 @@ func ControlVmAsync(wg *sync.WaitGroup, nsId string, mciId string, vmId string,
 
 			UpdateVmInfo(nsId, mciId, temp)
 
-			client := resty.New()
+			client := common.NewHttpClient()
 			client.SetTimeout(10 * time.Minute)
 
 			requestBody := model.SpiderConnectionName{}
 			requestBody.ConnectionName = temp.ConnectionName
 
-			err = common.ExecuteHttpRequest(
+			err = common.ExecuteHttpRequestWithContext(
+				ctx,
 				client,
 				method,
 				url,
@@ -0,0 +1,362 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mci is to manage multi-cloud infra
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/label"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// [Cost tracking of VMs from their status transitions]
+
+// genVmCostKey returns the key of the cost record of a VM (by its uid, since VM IDs can be reused)
+func genVmCostKey(nsId string, vmUid string) string {
+	return "/cost/" + nsId + "/vm/" + vmUid
+}
+
+// isBillableStatus checks if a VM in the status is billed by its spec (i.e., the VM is powered on)
+func isBillableStatus(status string) bool {
+	switch status {
+	case model.StatusRunning, model.StatusRebooting, model.StatusSuspending, model.StatusResuming, model.StatusTerminating:
+		return true
+	}
+	return false
+}
+
+// vmCostLabels returns the labels of the MCI and the VM for grouping the cost (without system labels)
+func vmCostLabels(nsId string, mciId string, vm model.TbVmInfo) map[string]string {
+	labels := map[string]string{}
+	add := func(m map[string]string) {
+		for k, v := range m {
+			if !strings.HasPrefix(k, "sys.") {
+				labels[k] = v
+			}
+		}
+	}
+
+	mciKv, err := kvstore.GetKv(common.GenMciKey(nsId, mciId, ""))
+	if err == nil && mciKv.Value != "" {
+		mci := struct {
+			Uid string `json:"uid"`
+		}{}
+		if json.Unmarshal([]byte(mciKv.Value), &mci) == nil && mci.Uid != "" {
+			if mciLabel, err := label.GetLabels(model.StrMCI, mci.Uid); err == nil {
+				add(mciLabel.Labels)
+			}
+		}
+	}
+	add(vm.Label)
+	if vmLabel, err := label.GetLabels(model.StrVM, vm.Uid); err == nil {
+		add(vmLabel.Labels)
+	}
+	return labels
+}
+
+// vmSpecCost returns the hourly cost of the spec of the VM (-1 if unknown)
+func vmSpecCost(nsId string, specId string) float32 {
+	for _, ns := range []string{nsId, model.SystemCommonNs} {
+		if spec, err := resource.GetSpec(ns, specId); err == nil {
+			if spec.CostPerHour < 0 {
+				return -1
+			}
+			return spec.CostPerHour
+		}
+	}
+	return -1
+}
+
+// trackVmCost opens or closes the running interval of the VM by its current status
+func trackVmCost(nsId string, mciId string, vm model.TbVmInfo) {
+	if vm.Uid == "" {
+		return
+	}
+	key := genVmCostKey(nsId, vm.Uid)
+	labels := vmCostLabels(nsId, mciId, vm)
+
+	err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		record := model.VmCostRecord{}
+		if current[key].Exists() {
+			if err := json.Unmarshal([]byte(current[key].Value), &record); err != nil {
+				return nil, err
+			}
+			if record.Status == vm.Status && reflect.DeepEqual(record.Label, labels) {
+				return nil, nil
+			}
+		} else {
+			record = model.VmCostRecord{
+				NsId:           nsId,
+				MciId:          mciId,
+				VmId:           vm.Id,
+				VmUid:          vm.Uid,
+				SpecId:         vm.SpecId,
+				ConnectionName: vm.ConnectionName,
+				ProviderName:   vm.ConnectionConfig.ProviderName,
+				RegionName:     vm.Region.Region,
+				CostPerHour:    vmSpecCost(nsId, vm.SpecId),
+				CreatedTime:    time.Now(),
+			}
+		}
+		record.SubGroupId = vm.SubGroupId
+		record.Label = labels
+		record.Status = vm.Status
+
+		now := time.Now()
+		last := len(record.Intervals) - 1
+		running := last >= 0 && record.Intervals[last].End == nil
+		if isBillableStatus(vm.Status) && !running {
+			record.Intervals = append(record.Intervals, model.VmRunningInterval{Start: now})
+		} else if !isBillableStatus(vm.Status) && running {
+			record.Intervals[last].End = &now
+		}
+
+		val, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to track the cost of the VM %s/%s/%s", nsId, mciId, vm.Id)
+	}
+}
+
+// closeVmCost closes the running interval of the deleted VM (the record is kept for reports)
+func closeVmCost(nsId string, vm model.TbVmInfo) {
+	if vm.Uid == "" {
+		return
+	}
+	key := genVmCostKey(nsId, vm.Uid)
+	err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[key].Exists() {
+			return nil, nil
+		}
+		record := model.VmCostRecord{}
+		if err := json.Unmarshal([]byte(current[key].Value), &record); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		if last := len(record.Intervals) - 1; last >= 0 && record.Intervals[last].End == nil {
+			record.Intervals[last].End = &now
+		}
+		record.Status = model.StatusTerminated
+		record.DeletedTime = &now
+
+		val, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to close the cost record of the VM %s (%s)", vm.Id, vm.Uid)
+	}
+}
+
+// InitVmCostTracking starts tracking the cost of existing VMs which have no cost record
+// (e.g., VMs created before cost tracking is introduced are tracked from now)
+func InitVmCostTracking() {
+	nsIdList, err := common.ListNsId()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to list namespaces to track the cost of VMs")
+		return
+	}
+	for _, nsId := range nsIdList {
+		mciIdList, err := ListMciId(nsId)
+		if err != nil {
+			continue
+		}
+		for _, mciId := range mciIdList {
+			vmIdList, err := ListVmId(nsId, mciId)
+			if err != nil {
+				continue
+			}
+			for _, vmId := range vmIdList {
+				vm, err := GetVmObject(nsId, mciId, vmId)
+				if err != nil {
+					continue
+				}
+				trackVmCost(nsId, mciId, vm)
+			}
+		}
+	}
+}
+
+// runningHoursIn returns the running hours of the intervals within the time range
+func runningHoursIn(intervals []model.VmRunningInterval, start time.Time, end time.Time) float64 {
+	hours := 0.0
+	for _, interval := range intervals {
+		s := interval.Start
+		e := end
+		if interval.End != nil && interval.End.Before(end) {
+			e = *interval.End
+		}
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(s) {
+			hours += e.Sub(s).Hours()
+		}
+	}
+	return hours
+}
+
+// costGroupValue returns the value of the grouping key of the cost record
+func costGroupValue(record model.VmCostRecord, groupBy string) string {
+	switch {
+	case groupBy == model.CostGroupByNs:
+		return record.NsId
+	case groupBy == model.CostGroupByMci:
+		return record.MciId
+	case groupBy == model.CostGroupBySubGroup:
+		return record.MciId + "/" + record.SubGroupId
+	case groupBy == model.CostGroupByVm:
+		return record.MciId + "/" + record.VmId
+	case groupBy == model.CostGroupByProvider:
+		return record.ProviderName
+	case strings.HasPrefix(groupBy, model.CostGroupByLabel):
+		return record.Label[strings.TrimPrefix(groupBy, model.CostGroupByLabel)]
+	}
+	return ""
+}
+
+// GetCostReport is func to estimate the cost of VMs in the time range, grouped by the grouping keys
+func GetCostReport(query model.CostReportQuery) (model.CostReport, error) {
+	if query.EndTime.IsZero() {
+		query.EndTime = time.Now()
+	}
+	if query.StartTime.IsZero() {
+		// this month
+		y, m, _ := query.EndTime.Date()
+		query.StartTime = time.Date(y, m, 1, 0, 0, 0, 0, query.EndTime.Location())
+	}
+	if !query.EndTime.After(query.StartTime) {
+		return model.CostReport{}, fmt.Errorf("endTime (%s) should be after startTime (%s)", query.EndTime, query.StartTime)
+	}
+	if len(query.GroupBy) == 0 {
+		query.GroupBy = []string{model.CostGroupByMci}
+	}
+	for _, g := range query.GroupBy {
+		switch {
+		case g == model.CostGroupByNs, g == model.CostGroupByMci, g == model.CostGroupBySubGroup,
+			g == model.CostGroupByVm, g == model.CostGroupByProvider:
+		case strings.HasPrefix(g, model.CostGroupByLabel) && len(g) > len(model.CostGroupByLabel):
+		default:
+			return model.CostReport{}, fmt.Errorf("groupBy %q is not supported (ns, mci, subGroup, vm, provider or label:<key>)", g)
+		}
+	}
+
+	report := model.CostReport{StartTime: query.StartTime, EndTime: query.EndTime, GroupBy: query.GroupBy, Item: []model.CostReportItem{}}
+
+	prefix := "/cost/"
+	if query.NsId != "" {
+		prefix = "/cost/" + query.NsId + "/vm/"
+	}
+	keyValue, err := kvstore.GetKvList(prefix)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return report, err
+	}
+
+	items := map[string]*model.CostReportItem{}
+	for _, kv := range keyValue {
+		record := model.VmCostRecord{}
+		if err := json.Unmarshal([]byte(kv.Value), &record); err != nil {
+			log.Error().Err(err).Msgf("failed to unmarshal the cost record %s", kv.Key)
+			continue
+		}
+		if query.MciId != "" && record.MciId != query.MciId {
+			continue
+		}
+		hours := runningHoursIn(record.Intervals, query.StartTime, query.EndTime)
+		if hours == 0 {
+			continue
+		}
+
+		group := map[string]string{}
+		groupKey := ""
+		for _, g := range query.GroupBy {
+			group[g] = costGroupValue(record, g)
+			groupKey += g + "=" + group[g] + "\n"
+		}
+		item, ok := items[groupKey]
+		if !ok {
+			item = &model.CostReportItem{Group: group}
+			items[groupKey] = item
+		}
+		item.VmCount++
+		item.RunningHours += hours
+		if record.CostPerHour < 0 {
+			item.UnknownCostVms++
+		} else {
+			item.EstimatedCost += hours * float64(record.CostPerHour)
+		}
+	}
+
+	for _, item := range items {
+		report.Item = append(report.Item, *item)
+		report.TotalRunningHours += item.RunningHours
+		report.TotalEstimatedCost += item.EstimatedCost
+	}
+	sort.Slice(report.Item, func(i, j int) bool {
+		return report.Item[i].EstimatedCost > report.Item[j].EstimatedCost
+	})
+	return report, nil
+}
+
+// CostReportToCsv is func to convert the cost report to CSV (a column per grouping key, and the estimated cost)
+func CostReportToCsv(report model.CostReport) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+
+	header := append([]string{}, report.GroupBy...)
+	header = append(header, "vmCount", "runningHours", "estimatedCost", "unknownCostVms", "startTime", "endTime")
+	if err := w.Write(header); err != nil {
+		return nil, err
+	}
+	for _, item := range report.Item {
+		row := []string{}
+		for _, g := range report.GroupBy {
+			row = append(row, item.Group[g])
+		}
+		row = append(row,
+			strconv.Itoa(item.VmCount),
+			strconv.FormatFloat(item.RunningHours, 'f', 4, 64),
+			strconv.FormatFloat(item.EstimatedCost, 'f', 4, 64),
+			strconv.Itoa(item.UnknownCostVms),
+			report.StartTime.Format(time.RFC3339),
+			report.EndTime.Format(time.RFC3339),
+		)
+		if err := w.Write(row); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -15,6 +15,7 @@ limitations under the License.
 package infra
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -108,7 +109,7 @@ func CreateMcSwNlb(nsId string, mciId string, req *model.TbNLBReq, option string
 	vmDynamicReq := model.TbVmDynamicReq{Name: vmGroupName, CommonSpec: commonSpec, CommonImage: commonImage, SubGroupSize: subGroupSize}
 	mciDynamicReq.Vm = append(mciDynamicReq.Vm, vmDynamicReq)
 
-	mciInfo, err := CreateMciDynamic("", nsId, &mciDynamicReq, "")
+	mciInfo, err := CreateMciDynamic(context.Background(), "", nsId, &mciDynamicReq, "")
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return emptyObj, err
@@ -310,7 +311,7 @@ func CreateNLB(nsId string, mciId string, u *model.TbNLBReq, option string) (mod
 
 	var tempSpiderNLBInfo *model.SpiderNLBInfo
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	req := client.R().
@@ -738,7 +739,7 @@ func DelNLB(nsId string, mciId string, resourceId string, forceFlag string) erro
 
 	fmt.Println("url: " + url)
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
@@ -883,7 +884,7 @@ func GetNLBHealth(nsId string, mciId string, nlbId string) (model.TbNLBHealthInf
 
 	var tempSpiderNLBHealthInfo *model.SpiderNLBHealthInfoWrapper
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	req := client.R().
@@ -1053,7 +1054,7 @@ func AddNLBVMs(nsId string, mciId string, resourceId string, u *model.TbNLBAddRe
 
 	var tempSpiderNLBInfo *model.SpiderNLBInfo
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	req := client.R().
@@ -1258,7 +1259,7 @@ func RemoveNLBVMs(nsId string, mciId string, resourceId string, u *model.TbNLBAd
 
 	// var tempSpiderNLBInfo *model.SpiderNLBInfo
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	req := client.R().
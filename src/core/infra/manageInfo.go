@@ -15,9 +15,13 @@ limitations under the License.
 package infra
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"path"
 	"reflect"
+	"slices"
 
 	"strconv"
 	"strings"
@@ -32,8 +36,8 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // [MCI and VM object information managemenet]
@@ -539,6 +543,7 @@ func ListMciInfo(nsId string, option string) ([]model.TbMciInfo, error) {
 			vmTmp := model.TbVmInfo{}
 			json.Unmarshal([]byte(vmKeyValue.Value), &vmTmp)
 			vmTmp.Id = v1
+			vmTmp.VmUserPassword = common.RevealSecret(vmTmp.VmUserPassword)
 
 			if option == "status" {
 				//get current vm status
@@ -616,6 +621,7 @@ func ListVmInfo(nsId string, mciId string, vmId string) (*model.TbVmInfo, error)
 	vmTmp := model.TbVmInfo{}
 	json.Unmarshal([]byte(vmKeyValue.Value), &vmTmp)
 	vmTmp.Id = vmId
+	vmTmp.VmUserPassword = common.RevealSecret(vmTmp.VmUserPassword)
 
 	//get current vm status
 	vmStatusInfoTmp, err := FetchVmStatus(nsId, mciId, vmId)
@@ -676,9 +682,23 @@ func GetVmObject(nsId string, mciId string, vmId string) (model.TbVmInfo, error)
 		log.Error().Err(err).Msg("")
 		return model.TbVmInfo{}, err
 	}
+	vmTmp.VmUserPassword = common.RevealSecret(vmTmp.VmUserPassword)
 	return vmTmp, nil
 }
 
+// marshalVmInfo returns the VM object to be stored in the kvstore (with its sensitive fields encrypted)
+func marshalVmInfo(vmInfoData model.TbVmInfo) (string, error) {
+	if err := common.EncryptSecretFields(&vmInfoData.VmUserPassword); err != nil {
+		log.Error().Err(err).Msgf("failed to encrypt the VM object (ID: %s)", vmInfoData.Id)
+		return "", err
+	}
+	val, err := json.Marshal(vmInfoData)
+	if err != nil {
+		return "", err
+	}
+	return string(val), nil
+}
+
 // GetVmIdNameInDetail is func to get ID and Name details
 func GetVmIdNameInDetail(nsId string, mciId string, vmId string) (*model.TbIdNameInDetailInfo, error) {
 	key := common.GenMciKey(nsId, mciId, vmId)
@@ -711,7 +731,7 @@ func GetVmIdNameInDetail(nsId string, mciId string, vmId string) (*model.TbIdNam
 
 	callResult := spiderResTmp{}
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	url := fmt.Sprintf("%s/cspresourcename/%s", model.SpiderRestUrl, idDetails.IdInSp)
 	method := "GET"
 	client.SetTimeout(5 * time.Minute)
@@ -741,6 +761,11 @@ func GetVmIdNameInDetail(nsId string, mciId string, vmId string) (*model.TbIdNam
 
 // GetMciStatus is func to Get Mci Status
 func GetMciStatus(nsId string, mciId string) (*model.MciStatusInfo, error) {
+	return GetMciStatusWithContext(context.Background(), nsId, mciId)
+}
+
+// GetMciStatusWithContext is func to Get Mci Status (the status check of each VM is traced as a child span of the span in ctx)
+func GetMciStatusWithContext(ctx context.Context, nsId string, mciId string) (*model.MciStatusInfo, error) {
 
 	err := common.CheckString(nsId)
 	if err != nil {
@@ -786,7 +811,7 @@ func GetMciStatus(nsId string, mciId string) (*model.MciStatusInfo, error) {
 	var wg sync.WaitGroup
 	for _, v := range vmList {
 		wg.Add(1)
-		go FetchVmStatusAsync(&wg, nsId, mciId, v, &mciStatus)
+		go FetchVmStatusAsync(ctx, &wg, nsId, mciId, v, &mciStatus)
 	}
 	wg.Wait() //goroutine sync wg
 
@@ -901,6 +926,7 @@ func GetMciStatus(nsId string, mciId string) (*model.MciStatusInfo, error) {
 		mciTmp.StatusCount = mciStatus.StatusCount
 		UpdateMciInfo(nsId, mciTmp)
 	}
+	recordMciStatusMetrics(nsId, mciId, &mciStatus)
 
 	return &mciStatus, nil
 
@@ -987,7 +1013,7 @@ func GetVmCurrentPublicIp(nsId string, mciId string, vmId string) (model.TbVmSta
 		SSHAccessPoint string
 	}
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	client.SetTimeout(2 * time.Minute)
 	url := model.SpiderRestUrl + "/vm/" + cspResourceName
 	method := "GET"
@@ -1056,12 +1082,16 @@ func GetVmSpecId(nsId string, mciId string, vmId string) string {
 	return content.SpecId
 }
 
-// FetchVmStatusAsync is func to get VM status async
-func FetchVmStatusAsync(wg *sync.WaitGroup, nsId string, mciId string, vmId string, results *model.MciStatusInfo) error {
+// FetchVmStatusAsync is func to get VM status async (traced as a child span of the span in ctx)
+func FetchVmStatusAsync(ctx context.Context, wg *sync.WaitGroup, nsId string, mciId string, vmId string, results *model.MciStatusInfo) error {
 	defer wg.Done() //goroutine sync done
 
 	if nsId != "" && mciId != "" && vmId != "" {
-		vmStatusTmp, err := FetchVmStatus(nsId, mciId, vmId)
+		// the status is fetched even if ctx is canceled (only the trace of ctx is kept)
+		ctx, span := common.StartSpan(context.WithoutCancel(ctx), "FetchVmStatus",
+			attribute.String("ns.id", nsId), attribute.String("mci.id", mciId), attribute.String("vm.id", vmId))
+		vmStatusTmp, err := fetchVmStatus(ctx, nsId, mciId, vmId)
+		common.EndSpan(span, err)
 		if err != nil {
 			log.Error().Err(err).Msg("")
 			vmStatusTmp.Status = model.StatusFailed
@@ -1076,6 +1106,11 @@ func FetchVmStatusAsync(wg *sync.WaitGroup, nsId string, mciId string, vmId stri
 
 // FetchVmStatus is func to fetch VM status (call to CSPs)
 func FetchVmStatus(nsId string, mciId string, vmId string) (model.TbVmStatusInfo, error) {
+	return fetchVmStatus(context.Background(), nsId, mciId, vmId)
+}
+
+// fetchVmStatus is func to fetch VM status with the context of the call to CB-Spider
+func fetchVmStatus(ctx context.Context, nsId string, mciId string, vmId string) (model.TbVmStatusInfo, error) {
 
 	errorInfo := model.TbVmStatusInfo{}
 
@@ -1114,7 +1149,7 @@ func FetchVmStatus(nsId string, mciId string, vmId string) (model.TbVmStatusInfo
 	callResult.Status = ""
 
 	if temp.Status != model.StatusTerminated && cspResourceName != "" {
-		client := resty.New()
+		client := common.NewHttpClient()
 		url := model.SpiderRestUrl + "/vmstatus/" + cspResourceName
 		method := "GET"
 		client.SetTimeout(60 * time.Second)
@@ -1129,7 +1164,8 @@ func FetchVmStatus(nsId string, mciId string, vmId string) (model.TbVmStatusInfo
 		retrycheck := 2
 		for i := 0; i < retrycheck; i++ {
 			errorInfo.Status = model.StatusFailed
-			err := common.ExecuteHttpRequest(
+			err := common.ExecuteHttpRequestWithContext(
+				ctx,
 				client,
 				method,
 				url,
@@ -1326,50 +1362,302 @@ func GetMciVmStatus(nsId string, mciId string, vmId string) (*model.TbVmStatusIn
 // [Update MCI and VM object]
 
 // UpdateMciInfo is func to update MCI Info (without VM info in MCI)
+// The update is applied with compare-and-swap, so a deleted MCI object is not recreated.
 func UpdateMciInfo(nsId string, mciInfoData model.TbMciInfo) {
 
 	mciInfoData.Vm = nil
 
 	key := common.GenMciKey(nsId, mciInfoData.Id, "")
 
-	// Check existence of the key. If no key, no update.
-	keyValue, err := kvstore.GetKv(key)
-	if keyValue == (kvstore.KeyValue{}) || err != nil {
-		return
-	}
+	err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		// Check existence of the key. If no key, no update.
+		if !current[key].Exists() {
+			return nil, nil
+		}
 
-	mciTmp := model.TbMciInfo{}
-	json.Unmarshal([]byte(keyValue.Value), &mciTmp)
+		mciTmp := model.TbMciInfo{}
+		json.Unmarshal([]byte(current[key].Value), &mciTmp)
+		if reflect.DeepEqual(mciTmp, mciInfoData) {
+			return nil, nil
+		}
 
-	if !reflect.DeepEqual(mciTmp, mciInfoData) {
 		val, _ := json.Marshal(mciInfoData)
-		err = kvstore.Put(key, string(val))
-		if err != nil {
-			log.Error().Err(err).Msg("")
-		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
 	}
 }
 
 // UpdateVmInfo is func to update VM Info
+// The update is applied with compare-and-swap, so a deleted VM object is not recreated.
 func UpdateVmInfo(nsId string, mciId string, vmInfoData model.TbVmInfo) {
 	key := common.GenMciKey(nsId, mciId, vmInfoData.Id)
 
-	// Check existence of the key. If no key, no update.
-	keyValue, err := kvstore.GetKv(key)
-	if keyValue == (kvstore.KeyValue{}) || err != nil {
+	statusChanged := false
+	err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		statusChanged = false
+		// Check existence of the key. If no key, no update.
+		if !current[key].Exists() {
+			return nil, nil
+		}
+
+		vmTmp := model.TbVmInfo{}
+		json.Unmarshal([]byte(current[key].Value), &vmTmp)
+		vmTmp.VmUserPassword = common.RevealSecret(vmTmp.VmUserPassword)
+		// the desired status is only changed by setVmDesiredStatus (vmInfoData may be a stale copy)
+		vmInfoData.DesiredStatus = vmTmp.DesiredStatus
+		if reflect.DeepEqual(vmTmp, vmInfoData) {
+			return nil, nil
+		}
+		statusChanged = vmTmp.Status != vmInfoData.Status
+
+		val, err := marshalVmInfo(vmInfoData)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, val)}, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
 		return
 	}
+	if statusChanged {
+		// accumulate the running intervals of the VM for cost reports
+		trackVmCost(nsId, mciId, vmInfoData)
+	}
+}
 
-	vmTmp := model.TbVmInfo{}
-	json.Unmarshal([]byte(keyValue.Value), &vmTmp)
+// [Transactional updates of MCI objects]
+
+// errStaleReadSet is returned by a transaction builder when the keys to read depend on a value that has changed.
+// The caller recomputes the keys and tries again.
+var errStaleReadSet = errors.New("keys to read have changed")
+
+// maxReadSetRetries is the maximum number of recomputing the keys to read of a transaction
+const maxReadSetRetries = 5
+
+// vmAssociatedResourceKeys returns the keys of resources that have the VM in their associatedObjectList.
+// If imageType is empty, both image and customImage keys are returned for the ImageId.
+func vmAssociatedResourceKeys(nsId string, vmInfo model.TbVmInfo, imageType string) []string {
+	keys := []string{}
+	added := map[string]bool{}
+	add := func(resourceType string, resourceId string) {
+		if resourceId == "" {
+			return
+		}
+		key := common.GenResourceKey(nsId, resourceType, resourceId)
+		if !added[key] {
+			added[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	if imageType == "" {
+		add(model.StrImage, vmInfo.ImageId)
+		add(model.StrCustomImage, vmInfo.ImageId)
+	} else {
+		add(imageType, vmInfo.ImageId)
+	}
+	add(model.StrSSHKey, vmInfo.SshKeyId)
+	add(model.StrVNet, vmInfo.VNetId)
+	for _, v := range vmInfo.SecurityGroupIds {
+		add(model.StrSecurityGroup, v)
+	}
+	for _, v := range vmInfo.DataDiskIds {
+		add(model.StrDataDisk, v)
+	}
+	return keys
+}
 
-	if !reflect.DeepEqual(vmTmp, vmInfoData) {
-		val, _ := json.Marshal(vmInfoData)
-		err = kvstore.Put(key, string(val))
+// vmAssociationOps returns operations to add or delete the vmKey to/from associatedObjectList of the resources.
+// Resources that do not exist, or are already (or not) associated with the VM, are skipped.
+func vmAssociationOps(current map[string]kvstore.RevisionedKeyValue, resourceKeys []string, cmd string, vmKey string) []kvstore.Op {
+	ops := []kvstore.Op{}
+	for _, key := range resourceKeys {
+		if !current[key].Exists() {
+			continue
+		}
+		updatedValue, err := resource.ModifyAssociatedObjectList(current[key].Value, cmd, vmKey)
+		if err != nil {
+			log.Debug().Err(err).Str("key", key).Msg("skip updating associatedObjectList")
+			continue
+		}
+		ops = append(ops, kvstore.OpPut(key, updatedValue))
+	}
+	return ops
+}
+
+// updateVmAssociations adds or deletes the VM to/from associatedObjectList of its resources in a transaction
+func updateVmAssociations(nsId string, mciId string, vmInfo model.TbVmInfo, imageType string, cmd string) error {
+	vmKey := common.GenMciKey(nsId, mciId, vmInfo.Id)
+	resourceKeys := vmAssociatedResourceKeys(nsId, vmInfo, imageType)
+
+	return kvstore.ReadModifyWrite(context.Background(), resourceKeys, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		return vmAssociationOps(current, resourceKeys, cmd, vmKey), nil
+	})
+}
+
+// delVmObject deletes the VM object, its label and its associations with resources in a transaction.
+// If updateSubGroup is true, the VM is also removed from its SubGroup, and the SubGroup (with its label)
+// is deleted when no VM remains in it.
+func delVmObject(nsId string, mciId string, vmId string, updateSubGroup bool) error {
+	vmKey := common.GenMciKey(nsId, mciId, vmId)
+
+	for attempt := 1; attempt <= maxReadSetRetries; attempt++ {
+		// the VM object decides which keys are read in the transaction
+		vmKv, err := kvstore.GetRevisionedKv(vmKey)
 		if err != nil {
 			log.Error().Err(err).Msg("")
+			return err
+		}
+		if !vmKv.Exists() {
+			return nil
+		}
+		vmInfo := model.TbVmInfo{}
+		err = json.Unmarshal([]byte(vmKv.Value), &vmInfo)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return err
+		}
+
+		resourceKeys := vmAssociatedResourceKeys(nsId, vmInfo, "")
+		keys := append([]string{vmKey}, resourceKeys...)
+
+		// The other VMs of the SubGroup are read in the transaction as well, and the SubGroup is deleted only if
+		// none of them exists (its VM list may be stale). Their keys are compared unless they exceed kvstore.MaxTxnOps
+		// (a SubGroup with that many VMs does not become empty by deleting a VM).
+		subGroupKey := ""
+		memberKeys := []string{}
+		if updateSubGroup && vmInfo.SubGroupId != "" {
+			subGroupKey = common.GenMciSubGroupKey(nsId, mciId, vmInfo.SubGroupId)
+			keys = append(keys, subGroupKey)
+			memberKeys, err = listSubGroupVmKeys(nsId, mciId, vmInfo.SubGroupId, vmId)
+			if err != nil {
+				log.Error().Err(err).Msg("")
+				return err
+			}
+			if len(keys)+len(memberKeys) <= kvstore.MaxTxnOps {
+				keys = append(keys, memberKeys...)
+			}
+		}
+
+		err = kvstore.ReadModifyWrite(context.Background(), keys, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+			if current[vmKey].ModRevision != vmKv.ModRevision {
+				return nil, errStaleReadSet
+			}
+
+			ops := []kvstore.Op{
+				kvstore.OpDelete(vmKey),
+				kvstore.OpDelete(label.GenLabelKey(model.StrVM, vmInfo.Uid)),
+			}
+			ops = append(ops, vmAssociationOps(current, resourceKeys, model.StrDelete, vmKey)...)
+
+			if subGroupKey == "" || !current[subGroupKey].Exists() {
+				return ops, nil
+			}
+
+			// VMs added to or removed from the SubGroup in the meantime change the keys to read
+			currentMemberKeys, err := listSubGroupVmKeys(nsId, mciId, vmInfo.SubGroupId, vmId)
+			if err != nil {
+				return nil, err
+			}
+			if !slices.Equal(currentMemberKeys, memberKeys) {
+				return nil, errStaleReadSet
+			}
+
+			currentSubGroup := model.TbSubGroupInfo{}
+			err = json.Unmarshal([]byte(current[subGroupKey].Value), &currentSubGroup)
+			if err != nil {
+				return nil, err
+			}
+			remainingVmIds := subGroupVmIds(currentSubGroup.VmId, memberKeys)
+
+			if len(remainingVmIds) == 0 {
+				ops = append(ops,
+					kvstore.OpDelete(subGroupKey),
+					kvstore.OpDelete(label.GenLabelKey(model.StrSubGroup, currentSubGroup.Uid)),
+				)
+				return ops, nil
+			}
+			currentSubGroup.VmId = remainingVmIds
+			currentSubGroup.SubGroupSize = strconv.Itoa(len(remainingVmIds))
+			val, _ := json.Marshal(currentSubGroup)
+			return append(ops, kvstore.OpPut(subGroupKey, string(val))), nil
+		})
+		if errors.Is(err, errStaleReadSet) {
+			continue
+		}
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return err
+		}
+		closeVmCost(nsId, vmInfo)
+		return nil
+	}
+	return fmt.Errorf("failed to delete VM %s: %w", vmId, kvstore.ErrTxnConflict)
+}
+
+// listSubGroupVmKeys returns the keys of the VM objects in the SubGroup except the VM of excludeVmId (sorted)
+func listSubGroupVmKeys(nsId string, mciId string, subGroupId string, excludeVmId string) ([]string, error) {
+	vmPrefix := common.GenMciKey(nsId, mciId, "") + "/vm/"
+	keyValue, err := kvstore.GetKvList(vmPrefix)
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	for _, kv := range keyValue {
+		if strings.Contains(strings.TrimPrefix(kv.Key, vmPrefix), "/") {
+			continue
+		}
+		vm := model.TbVmInfo{}
+		if err := json.Unmarshal([]byte(kv.Value), &vm); err != nil {
+			continue
+		}
+		if vm.SubGroupId == subGroupId && vm.Id != excludeVmId {
+			keys = append(keys, kv.Key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// subGroupVmIds returns the IDs of the VM objects in the order of the VM list of the SubGroup
+// (VMs not in the list follow, and VMs in the list without an object are dropped)
+func subGroupVmIds(vmIdList []string, vmKeys []string) []string {
+	existing := map[string]bool{}
+	for _, key := range vmKeys {
+		existing[path.Base(key)] = true
+	}
+	ids := []string{}
+	for _, id := range vmIdList {
+		if existing[id] {
+			ids = append(ids, id)
+			delete(existing, id)
+		}
+	}
+	for _, key := range vmKeys {
+		if id := path.Base(key); existing[id] {
+			ids = append(ids, id)
 		}
 	}
+	return ids
+}
+
+// commitOpsInBatches applies the operations in transactions of at most kvstore.MaxTxnOps operations
+func commitOpsInBatches(ops []kvstore.Op) error {
+	for len(ops) > 0 {
+		n := len(ops)
+		if n > kvstore.MaxTxnOps {
+			n = kvstore.MaxTxnOps
+		}
+		_, err := kvstore.Txn(nil, ops[:n])
+		if err != nil {
+			return err
+		}
+		ops = ops[n:]
+	}
+	return nil
 }
 
 // ProvisionDataDisk is func to provision DataDisk to VM (create and attach to VM)
@@ -1443,7 +1731,7 @@ func AttachDetachDataDisk(nsId string, mciId string, vmId string, command string
 	dataDisk := model.TbDataDiskInfo{}
 	json.Unmarshal([]byte(keyValue.Value), &dataDisk)
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "PUT"
 	var callResult interface{}
 	//var requestBody interface{}
@@ -1673,14 +1961,14 @@ func DelMci(nsId string, mciId string, option string) (model.IdList, error) {
 		if strings.EqualFold(option, model.ActionTerminate) {
 
 			// ActionRefine
-			_, err := HandleMciAction(nsId, mciId, model.ActionRefine, true)
+			_, err := HandleMciAction(context.Background(), nsId, mciId, model.ActionRefine, true)
 			if err != nil {
 				log.Error().Err(err).Msg("")
 				return deletedResources, err
 			}
 
 			// model.ActionTerminate
-			_, err = HandleMciAction(nsId, mciId, model.ActionTerminate, true)
+			_, err = HandleMciAction(context.Background(), nsId, mciId, model.ActionTerminate, true)
 			if err != nil {
 				log.Error().Err(err).Msg("")
 				return deletedResources, err
@@ -1705,91 +1993,20 @@ func DelMci(nsId string, mciId string, option string) (model.IdList, error) {
 
 	key := common.GenMciKey(nsId, mciId, "")
 
-	// delete associated MCI Policy
-	check, _ := CheckMciPolicy(nsId, mciId)
-	if check {
-		err = DelMciPolicy(nsId, mciId)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			return deletedResources, err
-		}
-		deletedResources.IdList = append(deletedResources.IdList, deleteStatus+"Policy: "+mciId)
-	}
-
 	vmList, err := ListVmId(nsId, mciId)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return deletedResources, err
 	}
 
-	// delete vms info
+	// delete vms info (each VM with its label and associations in a transaction)
 	for _, v := range vmList {
-		vmKey := common.GenMciKey(nsId, mciId, v)
-		fmt.Println(vmKey)
-
-		// get vm info
-		vmInfo, err := GetVmObject(nsId, mciId, v)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			return deletedResources, err
-		}
-
-		err = kvstore.Delete(vmKey)
+		err = delVmObject(nsId, mciId, v, false)
 		if err != nil {
 			log.Error().Err(err).Msg("")
 			return deletedResources, err
 		}
-
-		_, err = resource.UpdateAssociatedObjectList(nsId, model.StrImage, vmInfo.ImageId, model.StrDelete, vmKey)
-		if err != nil {
-			resource.UpdateAssociatedObjectList(nsId, model.StrCustomImage, vmInfo.ImageId, model.StrDelete, vmKey)
-		}
-
-		//resource.UpdateAssociatedObjectList(nsId, model.StrSpec, vmInfo.SpecId, model.StrDelete, vmKey)
-		resource.UpdateAssociatedObjectList(nsId, model.StrSSHKey, vmInfo.SshKeyId, model.StrDelete, vmKey)
-		resource.UpdateAssociatedObjectList(nsId, model.StrVNet, vmInfo.VNetId, model.StrDelete, vmKey)
-
-		for _, v2 := range vmInfo.SecurityGroupIds {
-			resource.UpdateAssociatedObjectList(nsId, model.StrSecurityGroup, v2, model.StrDelete, vmKey)
-		}
-
-		for _, v2 := range vmInfo.DataDiskIds {
-			resource.UpdateAssociatedObjectList(nsId, model.StrDataDisk, v2, model.StrDelete, vmKey)
-		}
 		deletedResources.IdList = append(deletedResources.IdList, deleteStatus+"VM: "+v)
-
-		err = label.DeleteLabelObject(model.StrVM, vmInfo.Uid)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-		}
-
-	}
-
-	// delete subGroup info
-	subGroupList, err := ListSubGroupId(nsId, mciId)
-	if err != nil {
-		log.Error().Err(err).Msg("")
-		return deletedResources, err
-	}
-	for _, v := range subGroupList {
-		subGroupKey := common.GenMciSubGroupKey(nsId, mciId, v)
-		subGroupInfo, err := GetSubGroup(nsId, mciId, v)
-		if err != nil {
-			log.Error().Err(err).Msg("Cannot get SubGroup")
-			return deletedResources, err
-		}
-
-		err = kvstore.Delete(subGroupKey)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			return deletedResources, err
-		}
-		deletedResources.IdList = append(deletedResources.IdList, deleteStatus+"SubGroup: "+v)
-
-		err = label.DeleteLabelObject(model.StrSubGroup, subGroupInfo.Uid)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-		}
 	}
 
 	// delete associated CSP NLBs
@@ -1806,7 +2023,7 @@ func DelMci(nsId string, mciId string, option string) (model.IdList, error) {
 
 	// delete associated MCI NLBs
 	mciNlbId := mciId + "-nlb"
-	check, _ = CheckMci(nsId, mciNlbId)
+	check, _ := CheckMci(nsId, mciNlbId)
 	if check {
 		mciNlbDeleteResult, err := DelMci(nsId, mciNlbId, option)
 		if err != nil {
@@ -1816,18 +2033,61 @@ func DelMci(nsId string, mciId string, option string) (model.IdList, error) {
 		deletedResources.IdList = append(deletedResources.IdList, mciNlbDeleteResult.IdList...)
 	}
 
-	// delete mci info
-	err = kvstore.Delete(key)
+	// delete subGroup info, MCI Policy and mci info with their labels.
+	// The MCI object is deleted in the last transaction, so an interrupted deletion can be retried.
+	subGroupList, err := ListSubGroupId(nsId, mciId)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return deletedResources, err
 	}
-	deletedResources.IdList = append(deletedResources.IdList, deleteStatus+"MCI: "+mciId)
+	subGroupOps := []kvstore.Op{}
+	for _, v := range subGroupList {
+		subGroupInfo, err := GetSubGroup(nsId, mciId, v)
+		if err != nil {
+			log.Error().Err(err).Msg("Cannot get SubGroup")
+			return deletedResources, err
+		}
+		subGroupOps = append(subGroupOps,
+			kvstore.OpDelete(common.GenMciSubGroupKey(nsId, mciId, v)),
+			kvstore.OpDelete(label.GenLabelKey(model.StrSubGroup, subGroupInfo.Uid)),
+		)
+	}
 
-	err = label.DeleteLabelObject(model.StrMCI, mciInfo.Uid)
+	mciOps := []kvstore.Op{
+		kvstore.OpDelete(key),
+		kvstore.OpDelete(label.GenLabelKey(model.StrMCI, mciInfo.Uid)),
+		kvstore.OpDeletePrefix(genMciDriftKey(nsId, mciId)),
+	}
+	checkPolicy, _ := CheckMciPolicy(nsId, mciId)
+	if checkPolicy {
+		mciOps = append(mciOps,
+			kvstore.OpDelete(common.GenMciPolicyKey(nsId, mciId, "")),
+			kvstore.OpDeletePrefix(genMciPolicyHistoryKey(nsId, mciId, "")),
+		)
+	}
+
+	if len(subGroupOps)+len(mciOps) > kvstore.MaxTxnOps {
+		err = commitOpsInBatches(subGroupOps)
+		subGroupOps = nil
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return deletedResources, err
+		}
+	}
+	_, err = kvstore.Txn(nil, append(subGroupOps, mciOps...))
 	if err != nil {
 		log.Error().Err(err).Msg("")
+		return deletedResources, err
 	}
+	forgetMciStatusMetrics(nsId, mciId)
+
+	for _, v := range subGroupList {
+		deletedResources.IdList = append(deletedResources.IdList, deleteStatus+"SubGroup: "+v)
+	}
+	if checkPolicy {
+		deletedResources.IdList = append(deletedResources.IdList, deleteStatus+"Policy: "+mciId)
+	}
+	deletedResources.IdList = append(deletedResources.IdList, deleteStatus+"MCI: "+mciId)
 
 	return deletedResources, nil
 }
@@ -1867,7 +2127,7 @@ func DelMciVm(nsId string, mciId string, vmId string, option string) error {
 		var wg sync.WaitGroup
 		results := make(chan model.ControlVmResult, 1)
 		wg.Add(1)
-		go ControlVmAsync(&wg, nsId, mciId, vmId, model.ActionTerminate, results)
+		go ControlVmAsync(context.Background(), &wg, nsId, mciId, vmId, model.ActionTerminate, results)
 		checkErr := <-results
 		wg.Wait()
 		close(results)
@@ -1884,61 +2144,13 @@ func DelMciVm(nsId string, mciId string, vmId string, option string) error {
 
 	}
 
-	// get vm info
-	vmInfo, _ := GetVmObject(nsId, mciId, vmId)
-
-	// delete vms info
-	key := common.GenMciKey(nsId, mciId, vmId)
-	err = kvstore.Delete(key)
+	// delete vms info with its label and associations, and remove empty SubGroups
+	err = delVmObject(nsId, mciId, vmId, true)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return err
 	}
 
-	// remove empty SubGroups
-	subGroup, err := ListSubGroupId(nsId, mciId)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to list subGroup to remove")
-		return err
-	}
-	for _, v := range subGroup {
-		vmListInSubGroup, err := ListVmBySubGroup(nsId, mciId, v)
-		if err != nil {
-			log.Error().Err(err).Msg("Failed to list vm in subGroup to remove")
-			return err
-		}
-		if len(vmListInSubGroup) == 0 {
-			subGroupKey := common.GenMciSubGroupKey(nsId, mciId, v)
-			err := kvstore.Delete(subGroupKey)
-			if err != nil {
-				log.Error().Err(err).Msg("Failed to remove the empty subGroup")
-				return err
-			}
-		}
-	}
-
-	_, err = resource.UpdateAssociatedObjectList(nsId, model.StrImage, vmInfo.ImageId, model.StrDelete, key)
-	if err != nil {
-		resource.UpdateAssociatedObjectList(nsId, model.StrCustomImage, vmInfo.ImageId, model.StrDelete, key)
-	}
-
-	//resource.UpdateAssociatedObjectList(nsId, model.StrSpec, vmInfo.SpecId, model.StrDelete, key)
-	resource.UpdateAssociatedObjectList(nsId, model.StrSSHKey, vmInfo.SshKeyId, model.StrDelete, key)
-	resource.UpdateAssociatedObjectList(nsId, model.StrVNet, vmInfo.VNetId, model.StrDelete, key)
-
-	for _, v := range vmInfo.SecurityGroupIds {
-		resource.UpdateAssociatedObjectList(nsId, model.StrSecurityGroup, v, model.StrDelete, key)
-	}
-
-	for _, v := range vmInfo.DataDiskIds {
-		resource.UpdateAssociatedObjectList(nsId, model.StrDataDisk, v, model.StrDelete, key)
-	}
-
-	err = label.DeleteLabelObject(model.StrVM, vmInfo.Uid)
-	if err != nil {
-		log.Error().Err(err).Msg("")
-	}
-
 	return nil
 }
 
@@ -0,0 +1,132 @@
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/bolt"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstoretest"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// localStores creates an empty store of each local kvstore backend
+var localStores = map[string]func(t *testing.T) kvstore.Store{
+	"memory": func(t *testing.T) kvstore.Store {
+		store, err := memory.NewMemoryStore(context.Background())
+		require.NoError(t, err)
+		return store
+	},
+	"bolt": func(t *testing.T) kvstore.Store {
+		store, err := bolt.NewBoltStore(context.Background(), bolt.Config{Path: filepath.Join(t.TempDir(), "tumblebug.db")})
+		require.NoError(t, err)
+		return store
+	},
+}
+
+// putTestMci stores an MCI with a SubGroup listing vmIdList and the VMs (objects as CreateMci stores them, without CSP resources)
+func putTestMci(t *testing.T, nsId string, mciId string, subGroupId string, vmIdList []string, vms []model.TbVmInfo) {
+	t.Helper()
+	mci := model.TbMciInfo{ResourceType: model.StrMCI, Id: mciId, Name: mciId, Uid: common.GenUid(), Status: model.StatusRunning}
+	val, err := json.Marshal(mci)
+	require.NoError(t, err)
+	created, err := putObjectWithLabel([]kvstore.Compare{kvstore.CompareNotExist(common.GenMciKey(nsId, mciId, ""))},
+		common.GenMciKey(nsId, mciId, ""), string(val), model.StrMCI, mci.Uid, map[string]string{model.LabelId: mciId})
+	require.NoError(t, err)
+	require.True(t, created)
+
+	subGroup := model.TbSubGroupInfo{ResourceType: model.StrSubGroup, Id: subGroupId, Name: subGroupId, Uid: common.GenUid(), VmId: vmIdList}
+	val, err = json.Marshal(subGroup)
+	require.NoError(t, err)
+	_, err = putObjectWithLabel(nil, common.GenMciSubGroupKey(nsId, mciId, subGroupId), string(val), model.StrSubGroup, subGroup.Uid,
+		map[string]string{model.LabelId: subGroupId, model.LabelMciId: mciId})
+	require.NoError(t, err)
+
+	for _, vm := range vms {
+		vm.ResourceType = model.StrVM
+		vm.Name = vm.Id
+		vm.Uid = common.GenUid()
+		vm.SubGroupId = subGroupId
+		val, err := json.Marshal(vm)
+		require.NoError(t, err)
+		_, err = putObjectWithLabel(nil, common.GenMciKey(nsId, mciId, vm.Id), string(val), model.StrVM, vm.Uid,
+			map[string]string{model.LabelId: vm.Id, model.LabelMciId: mciId})
+		require.NoError(t, err)
+	}
+}
+
+func TestMciOnLocalStore(t *testing.T) {
+	for name, newStore := range localStores {
+		t.Run(name, func(t *testing.T) {
+			kvstoretest.UseGlobalStore(t, newStore(t))
+
+			const nsId = "ns01"
+			_, err := common.CreateNs(&model.NsReq{Name: nsId})
+			require.NoError(t, err)
+			_, err = common.SetNsQuota(nsId, &model.NsQuota{MaxVms: 3})
+			require.NoError(t, err)
+
+			// the VM list of the SubGroup is stale: g-3 is not listed, and g-4 does not exist
+			running := model.TbVmInfo{Status: model.StatusRunning, TargetStatus: model.StatusComplete, TargetAction: model.ActionComplete}
+			vms := []model.TbVmInfo{running, running, running}
+			for i, id := range []string{"g-1", "g-2", "g-3"} {
+				vms[i].Id = id
+			}
+			putTestMci(t, nsId, "mci01", "g", []string{"g-1", "g-2", "g-4"}, vms)
+
+			vmIds, err := ListVmId(nsId, "mci01")
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{"g-1", "g-2", "g-3"}, vmIds)
+			vm, err := GetVmObject(nsId, "mci01", "g-2")
+			require.NoError(t, err)
+			assert.Equal(t, "g", vm.SubGroupId)
+
+			// the VMs of the MCI are counted in the usage of the namespace
+			err = resource.CheckNsQuota(nsId, []resource.QuotaDemand{{Count: 1}})
+			assert.ErrorContains(t, err, "exceeds the quota")
+
+			// the SubGroup keeps the VMs which exist, in the order of its VM list
+			require.NoError(t, DelMciVm(nsId, "mci01", "g-1", "force"))
+			subGroup, err := GetSubGroup(nsId, "mci01", "g")
+			require.NoError(t, err)
+			assert.Equal(t, []string{"g-2", "g-3"}, subGroup.VmId)
+			assert.Equal(t, "2", subGroup.SubGroupSize)
+			assert.NoError(t, resource.CheckNsQuota(nsId, []resource.QuotaDemand{{Count: 1}}))
+
+			// the SubGroup is deleted with its last VM (g-3 is not in its VM list)
+			require.NoError(t, DelMciVm(nsId, "mci01", "g-2", "force"))
+			require.NoError(t, DelMciVm(nsId, "mci01", "g-3", "force"))
+			subGroupIds, err := ListSubGroupId(nsId, "mci01")
+			require.NoError(t, err)
+			assert.Empty(t, subGroupIds)
+			assert.NoError(t, resource.CheckNsQuota(nsId, []resource.QuotaDemand{{Count: 3}}))
+
+			// terminated VMs are not counted, and the MCI is deleted with its VMs, SubGroups and labels
+			terminated := model.TbVmInfo{Status: model.StatusTerminated, TargetStatus: model.StatusTerminated, TargetAction: model.ActionTerminate}
+			vms = []model.TbVmInfo{terminated, terminated, terminated}
+			for i, id := range []string{"h-1", "h-2", "h-3"} {
+				vms[i].Id = id
+			}
+			putTestMci(t, nsId, "mci02", "h", []string{"h-1", "h-2", "h-3"}, vms)
+			assert.NoError(t, resource.CheckNsQuota(nsId, []resource.QuotaDemand{{Count: 3}}))
+
+			_, err = DelMci(nsId, "mci02", "")
+			require.NoError(t, err)
+			kvs, err := kvstore.GetKvList(common.GenMciKey(nsId, "mci02", ""))
+			require.NoError(t, err)
+			assert.Empty(t, kvs)
+			kvs, err = kvstore.GetKvList("/label/")
+			require.NoError(t, err)
+			for _, kv := range kvs {
+				assert.NotContains(t, kv.Value, "mci02", "label %s of a deleted object", kv.Key)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mci is to manage multi-cloud infra
+package infra
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// [Prometheus metrics of MCIs, provisioning and MCI policies]
+
+var (
+	vmProvisioningDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: common.MetricsNamespace,
+		Subsystem: "provisioning",
+		Name:      "vm_duration_seconds",
+		Help:      "Duration of VM creation (or registration) through CB-Spider by provider, option and result",
+		Buckets:   []float64{5, 10, 20, 30, 45, 60, 90, 120, 180, 300, 600, 1200},
+	}, []string{"provider", "option", "result"})
+
+	policyEvaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: common.MetricsNamespace,
+		Subsystem: "policy",
+		Name:      "evaluations_total",
+		Help:      "Number of MCI policy evaluations by result (met or notMet)",
+	}, []string{"result"})
+
+	policyActions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: common.MetricsNamespace,
+		Subsystem: "policy",
+		Name:      "actions_total",
+		Help:      "Number of MCI policy actions by action type and result (success or error)",
+	}, []string{"action", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(mciStatusCollector{})
+}
+
+// observeVmProvisioning records the duration of a VM creation through CB-Spider
+func observeVmProvisioning(provider string, option string, err error, elapsed time.Duration) {
+	if option == "" {
+		option = "create"
+	}
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	vmProvisioningDuration.WithLabelValues(strings.ToLower(provider), option, result).Observe(elapsed.Seconds())
+}
+
+// mciStatusSnapshot is the latest status of an MCI (updated whenever the status of the MCI is checked)
+type mciStatusSnapshot struct {
+	status      string
+	statusCount model.StatusCountInfo
+}
+
+// mciStatusSnapshots is the map of the latest status of MCIs (nsId/mciId -> mciStatusSnapshot)
+var mciStatusSnapshots sync.Map
+
+// recordMciStatusMetrics keeps the status of the MCI for the metrics of MCIs and VMs per status
+func recordMciStatusMetrics(nsId string, mciId string, mciStatus *model.MciStatusInfo) {
+	// "Partial-Running:2 (R:2/3)" -> "Partial-Running"
+	status, _, _ := strings.Cut(mciStatus.Status, ":")
+	mciStatusSnapshots.Store(nsId+"/"+mciId, mciStatusSnapshot{status: status, statusCount: mciStatus.StatusCount})
+}
+
+// forgetMciStatusMetrics removes the status of the deleted MCI from the metrics
+func forgetMciStatusMetrics(nsId string, mciId string) {
+	mciStatusSnapshots.Delete(nsId + "/" + mciId)
+}
+
+// mciStatusCollector exports the number of MCIs and VMs per status (from StatusCountInfo of MCIs)
+type mciStatusCollector struct{}
+
+var (
+	mciCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(common.MetricsNamespace, "", "mcis"),
+		"Number of MCIs by status (as of the latest status check of each MCI)",
+		[]string{"status"}, nil,
+	)
+	vmCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(common.MetricsNamespace, "", "vms"),
+		"Number of VMs in MCIs by status (as of the latest status check of each MCI)",
+		[]string{"status"}, nil,
+	)
+)
+
+// Describe implements prometheus.Collector
+func (mciStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- mciCountDesc
+	ch <- vmCountDesc
+}
+
+// Collect implements prometheus.Collector
+func (mciStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	mciCount := map[string]int{}
+	vmCount := map[string]int{
+		model.StatusCreating:    0,
+		model.StatusRunning:     0,
+		model.StatusFailed:      0,
+		model.StatusSuspended:   0,
+		model.StatusRebooting:   0,
+		model.StatusTerminated:  0,
+		model.StatusSuspending:  0,
+		model.StatusResuming:    0,
+		model.StatusTerminating: 0,
+		model.StatusUndefined:   0,
+	}
+	mciStatusSnapshots.Range(func(_, v interface{}) bool {
+		snapshot := v.(mciStatusSnapshot)
+		mciCount[snapshot.status]++
+
+		count := snapshot.statusCount
+		vmCount[model.StatusCreating] += count.CountCreating
+		vmCount[model.StatusRunning] += count.CountRunning
+		vmCount[model.StatusFailed] += count.CountFailed
+		vmCount[model.StatusSuspended] += count.CountSuspended
+		vmCount[model.StatusRebooting] += count.CountRebooting
+		vmCount[model.StatusTerminated] += count.CountTerminated
+		vmCount[model.StatusSuspending] += count.CountSuspending
+		vmCount[model.StatusResuming] += count.CountResuming
+		vmCount[model.StatusTerminating] += count.CountTerminating
+		vmCount[model.StatusUndefined] += count.CountUndefined
+		return true
+	})
+
+	for status, n := range mciCount {
+		ch <- prometheus.MustNewConstMetric(mciCountDesc, prometheus.GaugeValue, float64(n), status)
+	}
+	for status, n := range vmCount {
+		ch <- prometheus.MustNewConstMetric(vmCountDesc, prometheus.GaugeValue, float64(n), status)
+	}
+}
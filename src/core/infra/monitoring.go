@@ -17,14 +17,13 @@ package infra
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	validator "github.com/go-playground/validator/v10"
+	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 	"github.com/tidwall/gjson"
 
@@ -63,31 +62,27 @@ func CheckDragonflyEndpoint() error {
 	url := model.DragonflyRestUrl + cmd
 	method := "GET"
 
-	client := &http.Client{}
-	req, err := http.NewRequest(method, url, nil)
-
-	if err != nil {
-		log.Err(err).Msg("")
-		return err
-	}
-	res, err := client.Do(req)
+	client := common.NewHttpClient()
+	res, err := client.R().Execute(method, url)
 	if err != nil {
 		log.Err(err).Msg("")
 		return err
 	}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Err(err).Msg("")
-		return err
-	}
-	defer res.Body.Close()
-
-	log.Debug().Msg(string(body))
+	log.Debug().Msg(string(res.Body()))
 	return nil
 
 }
 
+// newDragonflyClient returns an outbound client for CB-Dragonfly which does not follow redirects
+func newDragonflyClient() *resty.Client {
+	client := common.NewHttpClient()
+	client.SetRedirectPolicy(resty.RedirectPolicyFunc(func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}))
+	return client
+}
+
 // CallMonitoringAsync is func to call CB-Dragonfly monitoring framework
 func CallMonitoringAsync(wg *sync.WaitGroup, nsID string, mciID string, mciServiceType string, vmID string, givenUserName string, method string, cmd string, returnResult *[]model.SshCmdResult) {
 
@@ -144,22 +139,10 @@ func CallMonitoringAsync(wg *sync.WaitGroup, nsID string, mciID string, mciServi
 	}
 
 	responseLimit := 8
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-		Timeout: time.Duration(responseLimit) * time.Minute,
-	}
-	req, err := http.NewRequest(method, url, strings.NewReader(string(payload)))
+	client := newDragonflyClient()
+	client.SetTimeout(time.Duration(responseLimit) * time.Minute)
 
-	if err != nil {
-		log.Error().Err(err).Msg("")
-		errStr += "/ " + err.Error()
-	}
-
-	req.Header.Add("Content-Type", "application/json")
-
-	res, err := client.Do(req)
+	res, err := client.R().SetHeader("Content-Type", "application/json").SetBody(payload).Execute(method, url)
 
 	result := ""
 
@@ -169,17 +152,12 @@ func CallMonitoringAsync(wg *sync.WaitGroup, nsID string, mciID string, mciServi
 		errStr += "/ " + err.Error()
 	} else {
 
-		body, err := io.ReadAll(res.Body)
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			errStr += "/ " + err.Error()
-		}
-		defer res.Body.Close()
+		body := res.Body()
 
-		// fmt.Println("HTTP Status code: " + strconv.Itoa(res.StatusCode))
+		// fmt.Println("HTTP Status code: " + strconv.Itoa(res.StatusCode()))
 		switch {
-		case res.StatusCode >= 400 || res.StatusCode < 200:
-			err = fmt.Errorf("CB-DF HTTP Status: " + strconv.Itoa(res.StatusCode) + " / " + string(body))
+		case res.StatusCode() >= 400 || res.StatusCode() < 200:
+			err = fmt.Errorf("CB-DF HTTP Status: " + strconv.Itoa(res.StatusCode()) + " / " + string(body))
 			log.Error().Err(err).Msg("")
 			errStr += "/ " + err.Error()
 		}
@@ -402,40 +380,25 @@ func CallGetMonitoringAsync(wg *sync.WaitGroup, nsID string, mciID string, vmID
 	log.Debug().Msg("URL: " + url)
 
 	responseLimit := 8
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			return http.ErrUseLastResponse
-		},
-		Timeout: time.Duration(responseLimit) * time.Minute,
-	}
-	req, err := http.NewRequest(method, url, nil)
-	if err != nil {
-		log.Error().Err(err).Msg("")
-		errStr = err.Error()
-	}
+	client := newDragonflyClient()
+	client.SetTimeout(time.Duration(responseLimit) * time.Minute)
 
 	fmt.Print("[Call CB-DF Result (" + mciID + "," + vmID + ")] ")
-	res, err := client.Do(req)
+	res, err := client.R().Execute(method, url)
 
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		errStr = err.Error()
 	} else {
-		// fmt.Println("HTTP Status code: " + strconv.Itoa(res.StatusCode))
+		// fmt.Println("HTTP Status code: " + strconv.Itoa(res.StatusCode()))
 		switch {
-		case res.StatusCode >= 400 || res.StatusCode < 200:
+		case res.StatusCode() >= 400 || res.StatusCode() < 200:
 			err1 := fmt.Errorf("HTTP Status: not in 200-399")
 			log.Error().Err(err1).Msg("")
 			errStr = err1.Error()
 		}
 
-		body, err2 := io.ReadAll(res.Body)
-		if err2 != nil {
-			log.Error().Err(err2).Msg("")
-			errStr = err2.Error()
-		}
-		defer res.Body.Close()
-		response = string(body)
+		response = string(res.Body())
 	}
 
 	if !gjson.Valid(response) {
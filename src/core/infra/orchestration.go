@@ -17,12 +17,12 @@ package infra
 import (
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvutil"
 	"github.com/rs/zerolog/log"
 )
 
@@ -32,8 +32,7 @@ func OrchestrationController() {
 
 	nsList, err := common.ListNsId()
 	if err != nil {
-		log.Error().Err(err).Msg("")
-		err = fmt.Errorf("an error occurred while getting namespaces' list: " + err.Error())
+		log.Error().Err(err).Msg("an error occurred while getting namespaces' list")
 		return
 	}
 
@@ -41,311 +40,11 @@ func OrchestrationController() {
 
 		mciPolicyList := ListMciPolicyId(nsId)
 
-		for _, m := range mciPolicyList {
-			log.Debug().Msg("NS[" + nsId + "]" + "MciPolicy[" + m + "]")
-		}
-
 		for _, v := range mciPolicyList {
-
-			key := common.GenMciPolicyKey(nsId, v, "")
-			keyValue, err := kvstore.GetKv(key)
-			if err != nil {
-				log.Error().Err(err).Msg("")
-				err = fmt.Errorf("In OrchestrationController(); kvstore.GetKv() returned an error.")
-				log.Error().Err(err).Msg("")
-				// return nil, err
-			}
-
-			if keyValue == (kvstore.KeyValue{}) {
-				log.Debug().Msg("keyValue is nil")
-			}
-			mciPolicyTmp := model.MciPolicyInfo{}
-			json.Unmarshal([]byte(keyValue.Value), &mciPolicyTmp)
-
-			/* FYI
-			const model.AutoStatusReady string = "Ready"
-			const model.AutoStatusChecking string = "Checking"
-			const model.AutoStatusHappened string = "Happened"
-			const model.AutoStatusOperating string = "Operating"
-			const model.AutoStatusTimeout string = "Timeout"
-			const model.AutoStatusError string = "Error"
-			const model.AutoStatusSuspend string = "Suspend"
-			*/
-
-			for policyIndex := range mciPolicyTmp.Policy {
-				log.Debug().Msg("\n[MCI-Policy-StateMachine]")
-				common.PrintJsonPretty(mciPolicyTmp.Policy[policyIndex])
-
-				switch {
-				case mciPolicyTmp.Policy[policyIndex].Status == model.AutoStatusReady:
-					log.Debug().Msg("- PolicyStatus[" + model.AutoStatusReady + "],[" + v + "]")
-					mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusChecking
-					UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-
-					log.Debug().Msg("[Check MCI Policy] " + mciPolicyTmp.Id)
-					check, err := CheckMci(nsId, mciPolicyTmp.Id)
-					log.Debug().Msg("[Check existence of MCI] " + mciPolicyTmp.Id)
-					//keyValueMci, _ := common.Ckvstore.GetKv(common.GenMciKey(nsId, mciPolicyTmp.Id, ""))
-
-					if !check || err != nil {
-						mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-						UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-						log.Debug().Msg("[MCI is not exist] " + mciPolicyTmp.Id)
-						break
-					} else { // need to enhance : loop for each policies and realize metric
-
-						//Checking (measuring)
-						mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusChecking
-						UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-						log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-
-						log.Debug().Msg("[MCI is exist] " + mciPolicyTmp.Id)
-						content, err := GetMonitoringData(nsId, mciPolicyTmp.Id, mciPolicyTmp.Policy[policyIndex].AutoCondition.Metric)
-						if err != nil {
-							log.Error().Err(err).Msg("")
-							mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							break
-						}
-
-						//Statistic
-						sumMci := 0.0
-						for _, monData := range content.MciMonitoring {
-							monDataValue, _ := strconv.ParseFloat(monData.Value, 64)
-							sumMci += monDataValue
-						}
-						averMci := (sumMci / float64(len(content.MciMonitoring)))
-						fmt.Printf("[monData.Value] AverMci: %f,  SumMci: %f \n", averMci, sumMci)
-
-						evaluationPeriod, _ := strconv.Atoi(mciPolicyTmp.Policy[policyIndex].AutoCondition.EvaluationPeriod)
-						evaluationValue := mciPolicyTmp.Policy[policyIndex].AutoCondition.EvaluationValue
-						evaluationValue = append([]string{fmt.Sprintf("%f", averMci)}, evaluationValue...) // prepend current aver date
-						mciPolicyTmp.Policy[policyIndex].AutoCondition.EvaluationValue = evaluationValue
-
-						sum := 0.0
-						aver := -0.1
-						// accumerate previous evaluation value
-						fmt.Printf("[Evaluation History]\n")
-						for evi, evv := range evaluationValue {
-							evvFloat, _ := strconv.ParseFloat(evv, 64)
-							sum += evvFloat
-							fmt.Printf("[%v] %f ", evi, evvFloat)
-							// break with outside evaluationValue
-							if evi >= evaluationPeriod-1 {
-								break
-							}
-						}
-						// average for evaluationPeriod (if data for the period is not enough, skip)
-						if evaluationPeriod != 0 && len(evaluationValue) >= evaluationPeriod {
-							aver = sum / float64(evaluationPeriod)
-						}
-						fmt.Printf("\n[Evaluation] Aver: %f,  Period: %v \n", aver, evaluationPeriod)
-
-						//Detecting
-						operator := mciPolicyTmp.Policy[policyIndex].AutoCondition.Operator
-						operand, _ := strconv.ParseFloat(mciPolicyTmp.Policy[policyIndex].AutoCondition.Operand, 64)
-
-						if evaluationPeriod == 0 {
-							log.Debug().Msg("[Checking] Not available evaluationPeriod ")
-							mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-							break
-						}
-						// not enough evaluationPeriod
-						if aver == -0.1 {
-							log.Debug().Msg("[Checking] Not enough evaluationPeriod ")
-							mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-							break
-						}
-						switch {
-						case operator == ">=":
-							if aver >= operand {
-								fmt.Printf("[Detected] Aver: %f >=  Operand: %f \n", aver, operand)
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusDetected
-							} else {
-								fmt.Printf("[Not Detected] Aver: %f >=  Operand: %f \n", aver, operand)
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							}
-						case operator == ">":
-							if aver > operand {
-								fmt.Printf("[Detected] Aver: %f >  Operand: %f \n", aver, operand)
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusDetected
-
-							} else {
-								fmt.Printf("[Not Detected] Aver: %f >  Operand: %f \n", aver, operand)
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							}
-						case operator == "<=":
-							if aver <= operand {
-								fmt.Printf("[Detected] Aver: %f <=  Operand: %f \n", aver, operand)
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusDetected
-
-							} else {
-								fmt.Printf("[Not Detected] Aver: %f <=  Operand: %f \n", aver, operand)
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							}
-						case operator == "<":
-							if aver < operand {
-								fmt.Printf("[Detected] Aver: %f <  Operand: %f \n", aver, operand)
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusDetected
-
-							} else {
-								fmt.Printf("[Not Detected] Aver: %f <  Operand: %f \n", aver, operand)
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-							}
-						default:
-							log.Debug().Msg("[Checking] Not available operator " + operator)
-							mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-						}
-					}
-					UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-
-				case mciPolicyTmp.Policy[policyIndex].Status == model.AutoStatusChecking:
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-					//mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusDetected
-
-				case mciPolicyTmp.Policy[policyIndex].Status == model.AutoStatusDetected:
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-					mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusOperating
-					UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-
-					//Action
-					/*
-						// Actions for mci automation
-						const model.AutoActionScaleOut string = "ScaleOut"
-						const model.AutoActionScaleIn string = "ScaleIn"
-					*/
-
-					autoAction := mciPolicyTmp.Policy[policyIndex].AutoAction
-					log.Debug().Msg("[autoAction] " + autoAction.ActionType)
-
-					switch {
-					case autoAction.ActionType == model.AutoActionScaleOut:
-
-						labels := map[string]string{
-							model.LabelDeploymentType: model.StrAutoGen,
-						}
-						autoAction.VmDynamicReq.Label = labels
-						// append uid to given vm name to avoid duplicated vm ID.
-						autoAction.VmDynamicReq.Name = common.ToLower(autoAction.VmDynamicReq.Name) + "-" + common.GenUid()
-						//vmReqTmp := autoAction.Vm
-						// autoAction.VmDynamicReq.SubGroupSize = "1"
-
-						if autoAction.PlacementAlgo == "random" {
-							log.Debug().Msg("[autoAction.PlacementAlgo] " + autoAction.PlacementAlgo)
-							// var vmTmpErr error
-							// existingVm, vmTmpErr := GetVmTemplate(nsId, mciPolicyTmp.Id, autoAction.PlacementAlgo)
-							// if vmTmpErr != nil {
-							// 	mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							// 	UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-							// }
-
-							autoAction.VmDynamicReq.CommonImage = "ubuntu18.04"                // temporal default value. will be changed
-							autoAction.VmDynamicReq.CommonSpec = "aws-ap-northeast-2-t2-small" // temporal default value. will be changed
-
-							deploymentPlan := model.DeploymentPlan{}
-
-							deploymentPlan.Priority.Policy = append(deploymentPlan.Priority.Policy, model.PriorityCondition{Metric: "random"})
-							specList, err := RecommendVm(model.SystemCommonNs, deploymentPlan)
-							if err != nil {
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-								UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-							}
-							if len(specList) != 0 {
-								recommendedSpec := specList[0].Id
-								autoAction.VmDynamicReq.CommonSpec = recommendedSpec
-							}
-
-							// autoAction.VmDynamicReq.Name = autoAction.VmDynamicReq.Name + "-random"
-							// autoAction.VmDynamicReq.Label = model.LabelAutoGen
-						}
-
-						common.PrintJsonPretty(autoAction.VmDynamicReq)
-						log.Debug().Msg("[Action] " + autoAction.ActionType)
-
-						// ScaleOut MCI according to the VM requirement.
-						log.Debug().Msg("[Generating VM]")
-						result, vmCreateErr := CreateMciVmDynamic(nsId, mciPolicyTmp.Id, &autoAction.VmDynamicReq)
-						if vmCreateErr != nil {
-							mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-						}
-						common.PrintJsonPretty(result)
-
-						if len(autoAction.PostCommand.Command) != 0 {
-
-							log.Debug().Msgf("[Post Command to VM] %v", autoAction.PostCommand.Command)
-							_, cmdErr := RemoteCommandToMci(nsId, mciPolicyTmp.Id, common.ToLower(autoAction.VmDynamicReq.Name), "", &autoAction.PostCommand)
-							if cmdErr != nil {
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-								UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-							}
-						}
-
-					case autoAction.ActionType == model.AutoActionScaleIn:
-						log.Debug().Msg("[Action] " + autoAction.ActionType)
-
-						// ScaleIn MCI.
-						log.Debug().Msg("[Removing VM]")
-						vmList, vmListErr := ListVmByLabel(nsId, mciPolicyTmp.Id, model.StrAutoGen)
-						if vmListErr != nil {
-							mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-							UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-						}
-						if len(vmList) != 0 {
-							removeTargetVm := vmList[len(vmList)-1]
-							log.Debug().Msg("[Removing VM ID] " + removeTargetVm)
-							delVmErr := DelMciVm(nsId, mciPolicyTmp.Id, removeTargetVm, "")
-							if delVmErr != nil {
-								mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusError
-								UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-							}
-						}
-
-					default:
-					}
-
-					mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusStabilizing
-					UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-
-				case mciPolicyTmp.Policy[policyIndex].Status == model.AutoStatusStabilizing:
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-
-					//initialize Evaluation history so that controller does not act too early.
-					//with this we can stablize MCI by init previously measures.
-					//Will invoke [Checking] Not enough evaluationPeriod
-					mciPolicyTmp.Policy[policyIndex].AutoCondition.EvaluationValue = nil
-
-					mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-					UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-
-				case mciPolicyTmp.Policy[policyIndex].Status == model.AutoStatusOperating:
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-					//mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-					//UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-
-				case mciPolicyTmp.Policy[policyIndex].Status == model.AutoStatusTimeout:
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-
-				case mciPolicyTmp.Policy[policyIndex].Status == model.AutoStatusError:
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-					mciPolicyTmp.Policy[policyIndex].Status = model.AutoStatusReady
-					UpdateMciPolicyInfo(nsId, mciPolicyTmp)
-
-				case mciPolicyTmp.Policy[policyIndex].Status == model.AutoStatusSuspended:
-					log.Debug().Msg("- PolicyStatus[" + mciPolicyTmp.Policy[policyIndex].Status + "],[" + v + "]")
-
-				default:
-				}
-			}
-
+			log.Debug().Msg("NS[" + nsId + "]" + "MciPolicy[" + v + "]")
+			EvaluateMciPolicy(nsId, v)
 		}
-
 	}
-
 }
 
 // UpdateMciPolicyInfo updates model.MciPolicyInfo object in DB.
@@ -384,8 +83,23 @@ func CreateMciPolicy(nsId string, mciId string, u *model.MciPolicyReq) (model.Mc
 		return temp, err
 	}
 
+	policyIds := map[string]bool{}
 	for policyIndex := range u.Policy {
 		u.Policy[policyIndex].Status = model.AutoStatusReady
+		u.Policy[policyIndex].State = model.PolicyState{}
+		if u.Policy[policyIndex].Id == "" {
+			u.Policy[policyIndex].Id = genPolicyId(policyIndex)
+		}
+		err = common.CheckString(u.Policy[policyIndex].Id)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return model.MciPolicyInfo{}, err
+		}
+		if policyIds[u.Policy[policyIndex].Id] {
+			err := fmt.Errorf("Duplicated policy ID: " + u.Policy[policyIndex].Id)
+			return model.MciPolicyInfo{}, err
+		}
+		policyIds[u.Policy[policyIndex].Id] = true
 	}
 
 	req := *u
@@ -490,11 +204,12 @@ func ListMciPolicyId(nsId string) []string {
 		// return nil, err
 	}
 
+	// only MCI policy objects (not VM policies or policy history)
+	keyValue = kvutil.FilterKvListBy(keyValue, key, 1)
+
 	var mciList []string
 	for _, v := range keyValue {
-		if !strings.Contains(v.Key, "vm") {
-			mciList = append(mciList, strings.TrimPrefix(v.Key, "/ns/"+nsId+"/policy/mci/"))
-		}
+		mciList = append(mciList, strings.TrimPrefix(v.Key, "/ns/"+nsId+"/policy/mci/"))
 	}
 	return mciList
 }
@@ -525,8 +240,11 @@ func DelMciPolicy(nsId string, mciId string) error {
 	key := common.GenMciPolicyKey(nsId, mciId, "")
 	log.Debug().Msg(key)
 
-	// delete mci Policy info
-	err = kvstore.Delete(key)
+	// delete mci Policy info with its history
+	_, err = kvstore.Txn(nil, []kvstore.Op{
+		kvstore.OpDelete(key),
+		kvstore.OpDeletePrefix(genMciPolicyHistoryKey(nsId, mciId, "")),
+	})
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return err
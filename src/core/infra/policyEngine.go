@@ -0,0 +1,729 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mci is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// [MCI policy rule engine]
+
+// PolicyActionContext is the context passed to a policy action handler
+type PolicyActionContext struct {
+	NsId   string
+	MciId  string
+	Policy model.Policy
+	// Evaluation is the evaluation result that triggered the action
+	Evaluation model.PolicyHistoryEntry
+}
+
+// PolicyActionHandler executes a policy action and returns a summary of the result
+type PolicyActionHandler func(actionCtx PolicyActionContext, action model.PolicyAction) (string, error)
+
+var (
+	policyActionHandlersMutex sync.RWMutex
+	policyActionHandlers      = map[string]PolicyActionHandler{}
+)
+
+func init() {
+	RegisterPolicyActionHandler(model.AutoActionScaleOut, policyActionScaleOut)
+	RegisterPolicyActionHandler(model.AutoActionScaleIn, policyActionScaleIn)
+	RegisterPolicyActionHandler(model.AutoActionCommand, policyActionCommand)
+	RegisterPolicyActionHandler(model.AutoActionSuspend, policyActionSuspend)
+	RegisterPolicyActionHandler(model.AutoActionResume, policyActionResume)
+	RegisterPolicyActionHandler(model.AutoActionWebhook, policyActionWebhook)
+}
+
+// RegisterPolicyActionHandler registers (or replaces) the handler of a policy action type
+func RegisterPolicyActionHandler(actionType string, handler PolicyActionHandler) {
+	policyActionHandlersMutex.Lock()
+	defer policyActionHandlersMutex.Unlock()
+	policyActionHandlers[actionType] = handler
+}
+
+// getPolicyActionHandler returns the handler of a policy action type
+func getPolicyActionHandler(actionType string) (PolicyActionHandler, bool) {
+	policyActionHandlersMutex.RLock()
+	defer policyActionHandlersMutex.RUnlock()
+	handler, ok := policyActionHandlers[actionType]
+	return handler, ok
+}
+
+// genPolicyId returns the default Id of the policy at the index
+func genPolicyId(index int) string {
+	return fmt.Sprintf("policy%02d", index+1)
+}
+
+// getPolicyId returns the Id of the policy (default Id for policies created without an Id)
+func getPolicyId(index int, policy model.Policy) string {
+	if policy.Id != "" {
+		return policy.Id
+	}
+	return genPolicyId(index)
+}
+
+// getPolicyRule returns the rule of the policy (converted from AutoCondition if no rule is given)
+func getPolicyRule(policy model.Policy) model.PolicyCondition {
+	if policy.Rule != nil {
+		return *policy.Rule
+	}
+	operand, _ := strconv.ParseFloat(policy.AutoCondition.Operand, 64)
+	evaluationPeriod, _ := strconv.Atoi(policy.AutoCondition.EvaluationPeriod)
+	return model.PolicyCondition{
+		Metric:           policy.AutoCondition.Metric,
+		Aggregation:      model.PolicyAggregationAvg,
+		Operator:         policy.AutoCondition.Operator,
+		Threshold:        operand,
+		EvaluationPeriod: evaluationPeriod,
+	}
+}
+
+// getPolicyActions returns the actions of the policy (converted from AutoAction if no actions are given)
+func getPolicyActions(policy model.Policy) []model.PolicyAction {
+	if len(policy.Actions) > 0 {
+		return policy.Actions
+	}
+	if policy.AutoAction.ActionType == "" {
+		return nil
+	}
+	return []model.PolicyAction{{ActionType: policy.AutoAction.ActionType}}
+}
+
+// policyMetricSource fetches monitoring data of an MCI once per evaluation round
+type policyMetricSource struct {
+	nsId  string
+	mciId string
+	cache map[string]model.MonResultSimpleResponse
+}
+
+// values returns the metric values of VMs in the scope (all VMs if vmScope is nil)
+func (s *policyMetricSource) values(metric string, vmScope map[string]bool) ([]float64, error) {
+	content, found := s.cache[metric]
+	if !found {
+		var err error
+		content, err = GetMonitoringData(s.nsId, s.mciId, metric)
+		if err != nil {
+			return nil, err
+		}
+		s.cache[metric] = content
+	}
+
+	values := []float64{}
+	for _, monData := range content.MciMonitoring {
+		if vmScope != nil && !vmScope[monData.VmId] {
+			continue
+		}
+		if monData.Err != "" {
+			continue
+		}
+		value, err := strconv.ParseFloat(monData.Value, 64)
+		if err != nil {
+			continue
+		}
+		values = append(values, value)
+	}
+	if len(values) == 0 {
+		return nil, fmt.Errorf("no monitoring data for metric %s", metric)
+	}
+	return values, nil
+}
+
+// aggregatePolicyValues combines metric values by the aggregation
+func aggregatePolicyValues(values []float64, aggregation string) (float64, error) {
+	result := values[0]
+	switch aggregation {
+	case "", model.PolicyAggregationAvg, model.PolicyAggregationSum:
+		result = 0
+		for _, v := range values {
+			result += v
+		}
+		if aggregation != model.PolicyAggregationSum {
+			result /= float64(len(values))
+		}
+	case model.PolicyAggregationMax:
+		for _, v := range values {
+			if v > result {
+				result = v
+			}
+		}
+	case model.PolicyAggregationMin:
+		for _, v := range values {
+			if v < result {
+				result = v
+			}
+		}
+	default:
+		return 0, fmt.Errorf("not available aggregation %s", aggregation)
+	}
+	return result, nil
+}
+
+// comparePolicyValue compares the value with the threshold by the operator
+func comparePolicyValue(value float64, operator string, threshold float64) (bool, error) {
+	switch operator {
+	case ">=":
+		return value >= threshold, nil
+	case ">":
+		return value > threshold, nil
+	case "<=":
+		return value <= threshold, nil
+	case "<":
+		return value < threshold, nil
+	default:
+		return false, fmt.Errorf("not available operator %s", operator)
+	}
+}
+
+// evaluatePolicyCondition evaluates a condition tree and updates the state of its leaf conditions.
+// All child conditions are evaluated (no short circuit) so that their states stay up to date.
+func evaluatePolicyCondition(condition model.PolicyCondition, path string, states map[string]model.PolicyConditionState, source *policyMetricSource, vmScope map[string]bool) (bool, []model.PolicyConditionResult) {
+
+	if condition.Logic != "" {
+		results := []model.PolicyConditionResult{}
+		met := strings.EqualFold(condition.Logic, model.PolicyLogicAnd)
+		for i, child := range condition.Conditions {
+			childMet, childResults := evaluatePolicyCondition(child, path+"."+strconv.Itoa(i), states, source, vmScope)
+			results = append(results, childResults...)
+			switch {
+			case strings.EqualFold(condition.Logic, model.PolicyLogicAnd):
+				met = met && childMet
+			case strings.EqualFold(condition.Logic, model.PolicyLogicOr):
+				met = met || childMet
+			}
+		}
+		if !strings.EqualFold(condition.Logic, model.PolicyLogicAnd) && !strings.EqualFold(condition.Logic, model.PolicyLogicOr) {
+			results = append(results, model.PolicyConditionResult{Path: path, Err: "not available logic " + condition.Logic})
+			return false, results
+		}
+		if len(condition.Conditions) == 0 {
+			return false, results
+		}
+		return met, results
+	}
+
+	result := model.PolicyConditionResult{
+		Path:      path,
+		Metric:    condition.Metric,
+		Operator:  condition.Operator,
+		Threshold: condition.Threshold,
+	}
+	state := states[path]
+
+	values, err := source.values(condition.Metric, vmScope)
+	if err != nil {
+		result.Err = err.Error()
+		return false, []model.PolicyConditionResult{result}
+	}
+	value, err := aggregatePolicyValues(values, condition.Aggregation)
+	if err != nil {
+		result.Err = err.Error()
+		return false, []model.PolicyConditionResult{result}
+	}
+
+	// keep the recent values for the evaluation period (latest first)
+	period := condition.EvaluationPeriod
+	if period < 1 {
+		period = 1
+	}
+	state.Values = append([]float64{value}, state.Values...)
+	if len(state.Values) > period {
+		state.Values = state.Values[:period]
+	}
+	states[path] = state
+
+	// not enough evaluations for the period (the last result is kept for hysteresis)
+	if len(state.Values) < period {
+		result.Value = value
+		result.Err = fmt.Sprintf("not enough evaluations (%d/%d)", len(state.Values), period)
+		return false, []model.PolicyConditionResult{result}
+	}
+
+	sum := 0.0
+	for _, v := range state.Values {
+		sum += v
+	}
+	result.Value = sum / float64(len(state.Values))
+
+	// apply hysteresis: a met condition stays met until the value crosses the threshold by the margin
+	threshold := condition.Threshold
+	if state.Met && condition.Hysteresis > 0 {
+		if strings.HasPrefix(condition.Operator, ">") {
+			threshold -= condition.Hysteresis
+		} else {
+			threshold += condition.Hysteresis
+		}
+	}
+	met, err := comparePolicyValue(result.Value, condition.Operator, threshold)
+	if err != nil {
+		result.Err = err.Error()
+		return false, []model.PolicyConditionResult{result}
+	}
+
+	state.Met = met
+	states[path] = state
+	result.Met = met
+	return met, []model.PolicyConditionResult{result}
+}
+
+// updateMciPolicyState applies the update to the policy with the policyId in the MCI policy object.
+// The update is applied with compare-and-swap, so it does not overwrite concurrent changes of other policies.
+// Nothing is updated if the MCI policy object or the policy has been deleted.
+func updateMciPolicyState(nsId string, mciId string, policyId string, update func(policy *model.Policy)) error {
+	key := common.GenMciPolicyKey(nsId, mciId, "")
+	return kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[key].Exists() {
+			return nil, nil
+		}
+		mciPolicy := model.MciPolicyInfo{}
+		err := json.Unmarshal([]byte(current[key].Value), &mciPolicy)
+		if err != nil {
+			return nil, err
+		}
+		for i := range mciPolicy.Policy {
+			if getPolicyId(i, mciPolicy.Policy[i]) == policyId {
+				update(&mciPolicy.Policy[i])
+				val, _ := json.Marshal(mciPolicy)
+				return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+			}
+		}
+		return nil, nil
+	})
+}
+
+// EvaluateMciPolicy evaluates the rules of all policies of an MCI and executes the actions of met policies
+func EvaluateMciPolicy(nsId string, mciId string) {
+
+	mciPolicy, err := GetMciPolicyObject(nsId, mciId)
+	if err != nil || mciPolicy.Id == "" {
+		return
+	}
+
+	check, err := CheckMci(nsId, mciId)
+	mciExists := check && err == nil
+
+	source := &policyMetricSource{nsId: nsId, mciId: mciId, cache: map[string]model.MonResultSimpleResponse{}}
+
+	for i, policy := range mciPolicy.Policy {
+		policyId := getPolicyId(i, policy)
+		now := time.Now()
+
+		if policy.Status == model.AutoStatusSuspended {
+			continue
+		}
+
+		if !mciExists {
+			if policy.Status != model.AutoStatusError {
+				log.Debug().Msgf("[MCI Policy] MCI %s does not exist (policy: %s)", mciId, policyId)
+				updateMciPolicyState(nsId, mciId, policyId, func(p *model.Policy) {
+					p.Status = model.AutoStatusError
+					p.State.LastError = "MCI does not exist"
+				})
+			}
+			continue
+		}
+
+		// skip evaluation in cooldown
+		if cooldownUntil, err := time.Parse(time.RFC3339, policy.State.CooldownUntil); err == nil && now.Before(cooldownUntil) {
+			if policy.Status != model.AutoStatusStabilizing {
+				updateMciPolicyState(nsId, mciId, policyId, func(p *model.Policy) {
+					p.Status = model.AutoStatusStabilizing
+				})
+			}
+			continue
+		}
+
+		// scope of VMs for the metrics
+		var vmScope map[string]bool
+		if policy.SubGroupId != "" {
+			vmList, err := ListVmBySubGroup(nsId, mciId, policy.SubGroupId)
+			if err != nil {
+				log.Error().Err(err).Msg("")
+				continue
+			}
+			vmScope = map[string]bool{}
+			for _, vmId := range vmList {
+				vmScope[vmId] = true
+			}
+		}
+
+		// evaluate the rule
+		states := map[string]model.PolicyConditionState{}
+		for k, v := range policy.State.Conditions {
+			states[k] = v
+		}
+		met, results := evaluatePolicyCondition(getPolicyRule(policy), "0", states, source, vmScope)
+
+		status := model.AutoStatusReady
+		if met {
+			status = model.AutoStatusDetected
+			policyEvaluations.WithLabelValues("met").Inc()
+		} else {
+			policyEvaluations.WithLabelValues("notMet").Inc()
+		}
+		evaluation := model.PolicyHistoryEntry{
+			PolicyId:   policyId,
+			Time:       now.Format(time.RFC3339),
+			Type:       model.PolicyHistoryEvaluation,
+			Status:     status,
+			Met:        met,
+			Conditions: results,
+		}
+		log.Debug().Msgf("[MCI Policy] %s/%s/%s met: %v", nsId, mciId, policyId, met)
+
+		err = updateMciPolicyState(nsId, mciId, policyId, func(p *model.Policy) {
+			p.Status = status
+			p.State.Conditions = states
+			p.State.LastEvaluated = evaluation.Time
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			continue
+		}
+		recordMciPolicyHistory(nsId, mciId, evaluation)
+
+		if !met {
+			continue
+		}
+
+		// execute the actions
+		updateMciPolicyState(nsId, mciId, policyId, func(p *model.Policy) {
+			p.Status = model.AutoStatusOperating
+		})
+
+		actionCtx := PolicyActionContext{NsId: nsId, MciId: mciId, Policy: policy, Evaluation: evaluation}
+		lastError := ""
+		for _, action := range getPolicyActions(policy) {
+			entry := model.PolicyHistoryEntry{
+				PolicyId:   policyId,
+				Time:       time.Now().Format(time.RFC3339),
+				Type:       model.PolicyHistoryAction,
+				Status:     model.AutoStatusOperating,
+				ActionType: action.ActionType,
+			}
+
+			handler, ok := getPolicyActionHandler(action.ActionType)
+			if !ok {
+				err = fmt.Errorf("not available action type %s", action.ActionType)
+			} else {
+				entry.Result, err = handler(actionCtx, action)
+			}
+			if err != nil {
+				log.Error().Err(err).Msgf("[MCI Policy] failed to execute action %s (policy: %s)", action.ActionType, policyId)
+				entry.Err = err.Error()
+				lastError = err.Error()
+				policyActions.WithLabelValues(action.ActionType, "error").Inc()
+			} else {
+				policyActions.WithLabelValues(action.ActionType, "success").Inc()
+			}
+			recordMciPolicyHistory(nsId, mciId, entry)
+		}
+
+		// stabilize the MCI after actions
+		updateMciPolicyState(nsId, mciId, policyId, func(p *model.Policy) {
+			p.State.LastFired = now.Format(time.RFC3339)
+			p.State.LastError = lastError
+			// initialize recent values so that the controller does not act too early
+			for k, v := range p.State.Conditions {
+				v.Values = nil
+				p.State.Conditions[k] = v
+			}
+			switch {
+			case lastError != "":
+				p.Status = model.AutoStatusError
+			case p.CooldownSec > 0:
+				p.Status = model.AutoStatusStabilizing
+			default:
+				p.Status = model.AutoStatusReady
+			}
+			if p.CooldownSec > 0 {
+				p.State.CooldownUntil = time.Now().Add(time.Duration(p.CooldownSec) * time.Second).Format(time.RFC3339)
+			}
+		})
+	}
+}
+
+// [MCI policy history]
+
+// genMciPolicyHistoryKey returns the key prefix of the history of a policy (all policies if policyId is empty)
+func genMciPolicyHistoryKey(nsId string, mciId string, policyId string) string {
+	key := common.GenMciPolicyKey(nsId, mciId, "") + "/history/"
+	if policyId != "" {
+		key += policyId + "/"
+	}
+	return key
+}
+
+// recordMciPolicyHistory stores a history entry of a policy and removes the oldest entries over the limit
+func recordMciPolicyHistory(nsId string, mciId string, entry model.PolicyHistoryEntry) {
+	prefix := genMciPolicyHistoryKey(nsId, mciId, entry.PolicyId)
+	key := fmt.Sprintf("%s%020d", prefix, time.Now().UnixNano())
+	val, _ := json.Marshal(entry)
+	err := kvstore.Put(key, string(val))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return
+	}
+
+	keyValue, err := kvstore.GetKvList(prefix)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return
+	}
+	if len(keyValue) <= model.PolicyHistoryMaxEntries {
+		return
+	}
+	ops := []kvstore.Op{}
+	for _, kv := range keyValue[:len(keyValue)-model.PolicyHistoryMaxEntries] {
+		ops = append(ops, kvstore.OpDelete(kv.Key))
+	}
+	err = commitOpsInBatches(ops)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+	}
+}
+
+// GetMciPolicyHistory returns the history of evaluations and actions of a policy (all policies if policyId is empty)
+func GetMciPolicyHistory(nsId string, mciId string, policyId string) (model.PolicyHistory, error) {
+	result := model.PolicyHistory{History: []model.PolicyHistoryEntry{}}
+
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	err = common.CheckString(mciId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	check, _ := CheckMciPolicy(nsId, mciId)
+	if !check {
+		err := fmt.Errorf("The mci Policy " + mciId + " does not exist.")
+		return result, err
+	}
+
+	keyValue, err := kvstore.GetKvList(genMciPolicyHistoryKey(nsId, mciId, policyId))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	for _, kv := range keyValue {
+		entry := model.PolicyHistoryEntry{}
+		err = json.Unmarshal([]byte(kv.Value), &entry)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			continue
+		}
+		result.History = append(result.History, entry)
+	}
+	sort.SliceStable(result.History, func(i, j int) bool {
+		return result.History[i].Time < result.History[j].Time
+	})
+	return result, nil
+}
+
+// [MCI policy actions]
+
+// getPolicyActionSubGroup returns the target subGroup of the action (default: scope of the policy)
+func getPolicyActionSubGroup(actionCtx PolicyActionContext, action model.PolicyAction) string {
+	if action.SubGroupId != "" {
+		return action.SubGroupId
+	}
+	return actionCtx.Policy.SubGroupId
+}
+
+// getPolicyActionNumVm returns the number of VMs to add or remove by the action (default: 1)
+func getPolicyActionNumVm(action model.PolicyAction) int {
+	if action.NumVm < 1 {
+		return 1
+	}
+	return action.NumVm
+}
+
+// policyActionScaleOut adds VMs to the subGroup, or creates a VM by AutoAction.VmDynamicReq if no subGroup is given
+func policyActionScaleOut(actionCtx PolicyActionContext, action model.PolicyAction) (string, error) {
+	nsId, mciId := actionCtx.NsId, actionCtx.MciId
+
+	subGroupId := getPolicyActionSubGroup(actionCtx, action)
+	if subGroupId != "" {
+		numVm := getPolicyActionNumVm(action)
+		_, err := ScaleOutMciSubGroup(nsId, mciId, subGroupId, strconv.Itoa(numVm))
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("added %d VM(s) to subGroup %s", numVm, subGroupId), nil
+	}
+
+	autoAction := actionCtx.Policy.AutoAction
+	labels := map[string]string{
+		model.LabelDeploymentType: model.StrAutoGen,
+	}
+	autoAction.VmDynamicReq.Label = labels
+	// append uid to given vm name to avoid duplicated vm ID.
+	autoAction.VmDynamicReq.Name = common.ToLower(autoAction.VmDynamicReq.Name) + "-" + common.GenUid()
+
+	if autoAction.PlacementAlgo == "random" {
+		log.Debug().Msg("[autoAction.PlacementAlgo] " + autoAction.PlacementAlgo)
+
+		autoAction.VmDynamicReq.CommonImage = "ubuntu18.04"                // temporal default value. will be changed
+		autoAction.VmDynamicReq.CommonSpec = "aws-ap-northeast-2-t2-small" // temporal default value. will be changed
+
+		deploymentPlan := model.DeploymentPlan{}
+		deploymentPlan.Priority.Policy = append(deploymentPlan.Priority.Policy, model.PriorityCondition{Metric: "random"})
+		specList, err := RecommendVm(model.SystemCommonNs, deploymentPlan)
+		if err != nil {
+			return "", err
+		}
+		if len(specList) != 0 {
+			autoAction.VmDynamicReq.CommonSpec = specList[0].Id
+		}
+	}
+
+	// ScaleOut MCI according to the VM requirement.
+	_, err := CreateMciVmDynamic(nsId, mciId, &autoAction.VmDynamicReq)
+	if err != nil {
+		return "", err
+	}
+
+	if len(autoAction.PostCommand.Command) != 0 {
+		log.Debug().Msgf("[Post Command to VM] %v", autoAction.PostCommand.Command)
+		_, err = RemoteCommandToMci(nsId, mciId, common.ToLower(autoAction.VmDynamicReq.Name), "", &autoAction.PostCommand)
+		if err != nil {
+			return "", err
+		}
+	}
+	return "added subGroup " + autoAction.VmDynamicReq.Name, nil
+}
+
+// policyActionScaleIn removes VMs from the subGroup, or removes an auto-generated VM if no subGroup is given
+func policyActionScaleIn(actionCtx PolicyActionContext, action model.PolicyAction) (string, error) {
+	nsId, mciId := actionCtx.NsId, actionCtx.MciId
+
+	subGroupId := getPolicyActionSubGroup(actionCtx, action)
+	if subGroupId != "" {
+		vmList, err := ListVmBySubGroup(nsId, mciId, subGroupId)
+		if err != nil {
+			return "", err
+		}
+		// remove the most recently added VMs and keep at least one VM in the subGroup
+		targetSize := len(vmList) - getPolicyActionNumVm(action)
+		if targetSize < 1 {
+			targetSize = 1
+		}
+		if targetSize >= len(vmList) {
+			return "", fmt.Errorf("subGroup %s has no VM to remove", subGroupId)
+		}
+		req := &model.TbScaleInSubGroupReq{
+			TargetSize: strconv.Itoa(targetSize),
+			Strategy:   model.ScaleInStrategyNewest,
+		}
+		_, err = ScaleInMciSubGroup(nsId, mciId, subGroupId, req)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("scaled in subGroup %s from %d to %d VMs", subGroupId, len(vmList), targetSize), nil
+	}
+
+	vmList, err := ListVmByLabel(nsId, mciId, model.StrAutoGen)
+	if err != nil {
+		return "", err
+	}
+	if len(vmList) == 0 {
+		return "", fmt.Errorf("no auto-generated VM to remove")
+	}
+	removeTargetVm := vmList[len(vmList)-1]
+	err = DelMciVm(nsId, mciId, removeTargetVm, "")
+	if err != nil {
+		return "", err
+	}
+	return "removed " + removeTargetVm, nil
+}
+
+// policyActionCommand runs a remote command on VMs of the subGroup (or the whole MCI)
+func policyActionCommand(actionCtx PolicyActionContext, action model.PolicyAction) (string, error) {
+	if action.Command == nil || len(action.Command.Command) == 0 {
+		return "", fmt.Errorf("no command is given")
+	}
+	subGroupId := getPolicyActionSubGroup(actionCtx, action)
+	results, err := RemoteCommandToMci(actionCtx.NsId, actionCtx.MciId, subGroupId, "", action.Command)
+	if err != nil {
+		return "", err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return "", fmt.Errorf("command failed on %d of %d VM(s)", failed, len(results))
+	}
+	return fmt.Sprintf("command executed on %d VM(s)", len(results)), nil
+}
+
+// policyActionSuspend suspends the MCI
+func policyActionSuspend(actionCtx PolicyActionContext, action model.PolicyAction) (string, error) {
+	return HandleMciAction(context.Background(), actionCtx.NsId, actionCtx.MciId, model.ActionSuspend, false)
+}
+
+// policyActionResume resumes the MCI
+func policyActionResume(actionCtx PolicyActionContext, action model.PolicyAction) (string, error) {
+	return HandleMciAction(context.Background(), actionCtx.NsId, actionCtx.MciId, model.ActionResume, false)
+}
+
+// policyActionWebhook calls the webhook with the evaluation result that triggered the action
+func policyActionWebhook(actionCtx PolicyActionContext, action model.PolicyAction) (string, error) {
+	if action.Webhook == nil || action.Webhook.Url == "" {
+		return "", fmt.Errorf("no webhook url is given")
+	}
+	method := strings.ToUpper(action.Webhook.Method)
+	if method == "" {
+		method = "POST"
+	}
+
+	payload := map[string]interface{}{
+		"nsId":       actionCtx.NsId,
+		"mciId":      actionCtx.MciId,
+		"policyId":   actionCtx.Evaluation.PolicyId,
+		"subGroupId": actionCtx.Policy.SubGroupId,
+		"evaluation": actionCtx.Evaluation,
+	}
+
+	client := common.NewHttpClient().SetTimeout(30 * time.Second)
+	resp, err := client.R().
+		SetHeader("Content-Type", "application/json").
+		SetHeaders(action.Webhook.Headers).
+		SetBody(payload).
+		Execute(method, action.Webhook.Url)
+	if err != nil {
+		return "", err
+	}
+	if resp.IsError() {
+		return "", fmt.Errorf("webhook returned %s", resp.Status())
+	}
+	return "webhook returned " + resp.Status(), nil
+}
@@ -15,8 +15,11 @@ limitations under the License.
 package infra
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,8 +31,8 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
 	validator "github.com/go-playground/validator/v10"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // TbMciReqStructLevelValidation is func to validate fields in TbMciReqStruct
@@ -102,7 +105,7 @@ func CreateMciVm(nsId string, mciId string, vmInfoData *model.TbVmInfo) (*model.
 	wg.Add(1)
 
 	option := "create"
-	go AddVmToMci(&wg, nsId, mciId, vmInfoData, option)
+	go AddVmToMci(context.Background(), &wg, nsId, mciId, vmInfoData, option)
 
 	wg.Wait()
 
@@ -155,6 +158,10 @@ func ScaleOutMciSubGroup(nsId string, mciId string, subGroupId string, numVMsToA
 		temp := &model.TbMciInfo{}
 		return temp, err
 	}
+	if len(vmIdList) == 0 {
+		err := fmt.Errorf("no VM in the subGroup %s to use as a template", subGroupId)
+		return &model.TbMciInfo{}, err
+	}
 	vmObj, err := GetVmObject(nsId, mciId, vmIdList[0])
 
 	vmTemplate := &model.TbVmReq{}
@@ -185,6 +192,209 @@ func ScaleOutMciSubGroup(nsId string, mciId string, subGroupId string, numVMsToA
 
 }
 
+// ScaleInMciSubGroup is func to remove VMs from a subGroup until it has the target number of VMs.
+// VMs to remove are selected by the strategy, drained from NLBs of the MCI, and then terminated.
+func ScaleInMciSubGroup(nsId string, mciId string, subGroupId string, req *model.TbScaleInSubGroupReq) (*model.TbMciInfo, error) {
+	for _, id := range []string{nsId, mciId, subGroupId} {
+		err := common.CheckString(id)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return &model.TbMciInfo{}, err
+		}
+	}
+
+	err := validate.Struct(req)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return &model.TbMciInfo{}, err
+	}
+
+	targetSize, err := strconv.Atoi(req.TargetSize)
+	if err != nil || targetSize < 1 {
+		err := fmt.Errorf("targetSize should be a positive integer (given: %s)", req.TargetSize)
+		log.Error().Err(err).Msg("")
+		return &model.TbMciInfo{}, err
+	}
+
+	vmIdList, err := ListVmBySubGroup(nsId, mciId, subGroupId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return &model.TbMciInfo{}, err
+	}
+	if len(vmIdList) == 0 {
+		err := fmt.Errorf("no VM in the subGroup %s", subGroupId)
+		log.Error().Err(err).Msg("")
+		return &model.TbMciInfo{}, err
+	}
+
+	numToRemove := len(vmIdList) - targetSize
+	if numToRemove <= 0 {
+		log.Info().Msgf("subGroup %s has %d VMs (target: %d); nothing to scale in", subGroupId, len(vmIdList), targetSize)
+		return GetMciInfo(nsId, mciId)
+	}
+
+	vmList := []model.TbVmInfo{}
+	for _, vmId := range vmIdList {
+		vmInfo, err := GetVmObject(nsId, mciId, vmId)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return &model.TbMciInfo{}, err
+		}
+		vmList = append(vmList, vmInfo)
+	}
+
+	victims, err := selectScaleInVms(nsId, mciId, vmList, req, numToRemove)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return &model.TbMciInfo{}, err
+	}
+	log.Info().Msgf("Scale in subGroup %s to %d VMs (strategy: %s); removing %v", subGroupId, targetSize, req.Strategy, victims)
+
+	// VMs should not receive traffic from NLBs when they are terminated
+	err = drainVmsFromNLBs(nsId, mciId, victims)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return &model.TbMciInfo{}, err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(victims))
+	for i, vmId := range victims {
+		wg.Add(1)
+		go func(i int, vmId string) {
+			defer wg.Done()
+			errs[i] = DelMciVm(nsId, mciId, vmId, "")
+		}(i, vmId)
+	}
+	wg.Wait()
+
+	failed := []string{}
+	for i, err := range errs {
+		if err != nil {
+			failed = append(failed, victims[i]+": "+err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		err := fmt.Errorf("failed to remove VMs from the subGroup %s (%s)", subGroupId, strings.Join(failed, "; "))
+		log.Error().Err(err).Msg("")
+		return &model.TbMciInfo{}, err
+	}
+
+	return GetMciInfo(nsId, mciId)
+}
+
+// selectScaleInVms returns the IDs of numToRemove VMs selected by the scale-in strategy
+func selectScaleInVms(nsId string, mciId string, vmList []model.TbVmInfo, req *model.TbScaleInSubGroupReq, numToRemove int) ([]string, error) {
+	// the base order is the newest VM first, and strategies reorder VMs on top of it
+	sort.SliceStable(vmList, func(i, j int) bool {
+		if vmList[i].CreatedTime != vmList[j].CreatedTime {
+			return vmList[i].CreatedTime > vmList[j].CreatedTime
+		}
+		return vmIndexInSubGroup(vmList[i].Id) > vmIndexInSubGroup(vmList[j].Id)
+	})
+
+	switch req.Strategy {
+	case "", model.ScaleInStrategyNewest:
+		req.Strategy = model.ScaleInStrategyNewest
+	case model.ScaleInStrategyOldest:
+		for i, j := 0, len(vmList)-1; i < j; i, j = i+1, j-1 {
+			vmList[i], vmList[j] = vmList[j], vmList[i]
+		}
+	case model.ScaleInStrategyZone:
+		if req.Zone == "" {
+			return nil, fmt.Errorf("zone is required for the scale-in strategy %s", req.Strategy)
+		}
+		sort.SliceStable(vmList, func(i, j int) bool {
+			return vmList[i].Region.Zone == req.Zone && vmList[j].Region.Zone != req.Zone
+		})
+	case model.ScaleInStrategyLeastLoaded:
+		metric := req.Metric
+		if metric == "" {
+			metric = "cpu"
+		}
+		monData, err := GetMonitoringData(nsId, mciId, metric)
+		if err != nil {
+			return nil, err
+		}
+		loads := map[string]float64{}
+		for _, v := range monData.MciMonitoring {
+			if v.Err != "" {
+				continue
+			}
+			value, err := strconv.ParseFloat(v.Value, 64)
+			if err != nil {
+				continue
+			}
+			loads[v.VmId] = value
+		}
+		// VMs without monitoring data are regarded as the least loaded ones
+		sort.SliceStable(vmList, func(i, j int) bool {
+			loadI, foundI := loads[vmList[i].Id]
+			loadJ, foundJ := loads[vmList[j].Id]
+			if foundI != foundJ {
+				return !foundI
+			}
+			return loadI < loadJ
+		})
+	default:
+		return nil, fmt.Errorf("unknown scale-in strategy %s (available: %s, %s, %s, %s)", req.Strategy,
+			model.ScaleInStrategyNewest, model.ScaleInStrategyOldest, model.ScaleInStrategyLeastLoaded, model.ScaleInStrategyZone)
+	}
+
+	victims := []string{}
+	for _, vm := range vmList[:numToRemove] {
+		victims = append(victims, vm.Id)
+	}
+	return victims, nil
+}
+
+// drainVmsFromNLBs removes the VMs from the target groups of NLBs in the MCI
+func drainVmsFromNLBs(nsId string, mciId string, vmIds []string) error {
+	nlbIdList, err := ListNLBId(nsId, mciId)
+	if err != nil {
+		return err
+	}
+
+	targets := map[string]bool{}
+	for _, vmId := range vmIds {
+		targets[vmId] = true
+	}
+
+	for _, nlbId := range nlbIdList {
+		nlb, err := GetNLB(nsId, mciId, nlbId)
+		if err != nil {
+			return err
+		}
+		drain := []string{}
+		for _, vmId := range nlb.TargetGroup.VMs {
+			if targets[vmId] {
+				drain = append(drain, vmId)
+			}
+		}
+		if len(drain) == 0 {
+			continue
+		}
+		log.Info().Msgf("Drain VMs %v from NLB %s", drain, nlbId)
+		req := &model.TbNLBAddRemoveVMReq{
+			TargetGroup: model.TbNLBTargetGroupInfo{SubGroupId: nlb.TargetGroup.SubGroupId, VMs: drain},
+		}
+		err = RemoveNLBVMs(nsId, mciId, nlbId, req)
+		if err != nil {
+			return fmt.Errorf("failed to drain VMs from the NLB %s: %w", nlbId, err)
+		}
+	}
+	return nil
+}
+
+// vmIndexInSubGroup returns the index of the VM in its subGroup (the number after the last "-" of the VM ID)
+func vmIndexInSubGroup(vmId string) int {
+	index, err := strconv.Atoi(vmId[strings.LastIndex(vmId, "-")+1:])
+	if err != nil {
+		return 0
+	}
+	return index
+}
+
 // CreateMciGroupVm is func to create MCI groupVM
 func CreateMciGroupVm(nsId string, mciId string, vmRequest *model.TbVmReq, newSubGroup bool) (*model.TbMciInfo, error) {
 
@@ -239,6 +449,15 @@ func CreateMciGroupVm(nsId string, mciId string, vmRequest *model.TbVmReq, newSu
 		return temp, err
 	}
 
+	// Check and reserve the quota of the namespace (for new subGroups and scale-out of subGroups)
+	// until the VM objects are stored and counted as the usage of the namespace
+	quotaDemand := resource.QuotaDemand{ConnectionName: vmRequest.ConnectionName, SpecId: vmRequest.SpecId, Count: resource.QuotaDemandCount(vmRequest.SubGroupSize)}
+	releaseQuota, err := resource.ReserveNsQuota(nsId, []resource.QuotaDemand{quotaDemand})
+	if err != nil {
+		return &model.TbMciInfo{}, err
+	}
+	defer releaseQuota()
+
 	//vmRequest := req
 
 	targetAction := model.ActionCreate
@@ -270,51 +489,67 @@ func CreateMciGroupVm(nsId string, mciId string, vmRequest *model.TbVmReq, newSu
 
 		log.Info().Msg("Create MCI subGroup object")
 
-		subGroupInfoData := model.TbSubGroupInfo{}
-		subGroupInfoData.ResourceType = model.StrSubGroup
-		subGroupInfoData.Id = tentativeVmId
-		subGroupInfoData.Name = tentativeVmId
-		subGroupInfoData.SubGroupSize = vmRequest.SubGroupSize
-
+		mciKey := common.GenMciKey(nsId, mciId, "")
 		key := common.GenMciSubGroupKey(nsId, mciId, vmRequest.Name)
-		keyValue, err := kvstore.GetKv(key)
-		if err != nil {
-			err = fmt.Errorf("In CreateMciGroupVm(); kvstore.GetKv(): " + err.Error())
-			log.Error().Err(err).Msg("")
-		}
-		if keyValue != (kvstore.KeyValue{}) {
-			if newSubGroup {
-				json.Unmarshal([]byte(keyValue.Value), &subGroupInfoData)
-				existingVmSize, err := strconv.Atoi(subGroupInfoData.SubGroupSize)
-				if err != nil {
-					err = fmt.Errorf("In CreateMciGroupVm(); kvstore.GetKv(): " + err.Error())
-					log.Error().Err(err).Msg("")
+
+		// The subGroup is updated with compare-and-swap, so concurrent scale-outs get disjoint VM indexes.
+		err = kvstore.ReadModifyWrite(context.Background(), []string{mciKey, key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+			if !current[mciKey].Exists() {
+				return nil, fmt.Errorf("Cannot find the MCI %s", mciId)
+			}
+
+			subGroupInfoData := model.TbSubGroupInfo{}
+			subGroupInfoData.ResourceType = model.StrSubGroup
+			subGroupInfoData.Id = tentativeVmId
+			subGroupInfoData.Name = tentativeVmId
+			subGroupInfoData.SubGroupSize = vmRequest.SubGroupSize
+			vmStartIndex = 1
+
+			ops := []kvstore.Op{}
+			if current[key].Exists() {
+				if !newSubGroup {
+					return nil, fmt.Errorf("Duplicated SubGroup ID")
+				}
+				json.Unmarshal([]byte(current[key].Value), &subGroupInfoData)
+				// new VMs take indexes after the largest one in the SubGroup,
+				// since VMs removed by scale-in leave gaps in the indexes
+				for _, vmId := range subGroupInfoData.VmId {
+					if index := vmIndexInSubGroup(vmId); index >= vmStartIndex {
+						vmStartIndex = index + 1
+					}
 				}
-				// add the number of existing VMs in the SubGroup with requested number for additions
-				subGroupInfoData.SubGroupSize = strconv.Itoa(existingVmSize + subGroupSize)
-				vmStartIndex = existingVmSize + 1
 			} else {
-				err = fmt.Errorf("Duplicated SubGroup ID")
-				log.Error().Err(err).Msg("")
-				return nil, err
+				subGroupInfoData.Uid = common.GenUid()
+				labels := map[string]string{
+					model.LabelManager:        model.StrManager,
+					model.LabelNamespace:      nsId,
+					model.LabelLabelType:      model.StrSubGroup,
+					model.LabelId:             subGroupInfoData.Id,
+					model.LabelName:           subGroupInfoData.Name,
+					model.LabelUid:            subGroupInfoData.Uid,
+					model.LabelMciId:          mciId,
+					model.LabelMciName:        mciTmp.Name,
+					model.LabelMciUid:         mciTmp.Uid,
+					model.LabelMciDescription: mciTmp.Description,
+				}
+				labelData, err := label.MergeLabels("", key, labels)
+				if err != nil {
+					return nil, err
+				}
+				ops = append(ops, kvstore.OpPut(label.GenLabelKey(model.StrSubGroup, subGroupInfoData.Uid), labelData))
 			}
-		}
 
-		for i := vmStartIndex; i < subGroupSize+vmStartIndex; i++ {
-			subGroupInfoData.VmId = append(subGroupInfoData.VmId, subGroupInfoData.Id+"-"+strconv.Itoa(i))
-		}
+			for i := vmStartIndex; i < subGroupSize+vmStartIndex; i++ {
+				subGroupInfoData.VmId = append(subGroupInfoData.VmId, subGroupInfoData.Id+"-"+strconv.Itoa(i))
+			}
+			subGroupInfoData.SubGroupSize = strconv.Itoa(len(subGroupInfoData.VmId))
 
-		val, _ := json.Marshal(subGroupInfoData)
-		err = kvstore.Put(key, string(val))
-		if err != nil {
-			log.Error().Err(err).Msg("")
-		}
-		// check stored subGroup object
-		keyValue, err = kvstore.GetKv(key)
+			val, _ := json.Marshal(subGroupInfoData)
+			return append(ops, kvstore.OpPut(key, string(val))), nil
+		})
 		if err != nil {
-			err = fmt.Errorf("In CreateMciGroupVm(); kvstore.GetKv(): " + err.Error())
 			log.Error().Err(err).Msg("")
-			// return nil, err
+			return nil, err
 		}
 
 	}
@@ -360,7 +595,8 @@ func CreateMciGroupVm(nsId string, mciId string, vmRequest *model.TbVmReq, newSu
 		//vmInfoData.PublicIpId = vmRequest.PublicIpId
 		vmInfoData.SecurityGroupIds = vmRequest.SecurityGroupIds
 		vmInfoData.DataDiskIds = vmRequest.DataDiskIds
-		vmInfoData.SshKeyId = vmRequest.SshKeyId
+		// a VM is given the CSP key pair of the original sshKey (if a rotated sshKey is requested)
+		vmInfoData.SshKeyId = sshKeyForNewVm(nsId, vmRequest.SshKeyId)
 		vmInfoData.Description = vmRequest.Description
 
 		vmInfoData.RootDiskType = vmRequest.RootDiskType
@@ -371,11 +607,12 @@ func CreateMciGroupVm(nsId string, mciId string, vmRequest *model.TbVmReq, newSu
 
 		wg.Add(1)
 		// option != register
-		go AddVmToMci(&wg, nsId, mciId, &vmInfoData, "")
+		go AddVmToMci(context.Background(), &wg, nsId, mciId, &vmInfoData, "")
 
 	}
 
 	wg.Wait()
+	releaseQuota()
 
 	//Update MCI status
 
@@ -435,7 +672,10 @@ func CreateMciGroupVm(nsId string, mciId string, vmRequest *model.TbVmReq, newSu
 }
 
 // CreateMci is func to create MCI obeject and deploy requested VMs (register CSP native VM with option=register)
-func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInfo, error) {
+func CreateMci(ctx context.Context, nsId string, req *model.TbMciReq, option string) (*model.TbMciInfo, error) {
+
+	ctx, span := common.StartSpan(ctx, "CreateMci", attribute.String("ns.id", nsId), attribute.String("mci.id", req.Name), attribute.String("option", option))
+	defer span.End()
 
 	err := common.CheckString(nsId)
 	if err != nil {
@@ -465,6 +705,17 @@ func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInf
 		req.SystemLabel = "Registered from CSP resource"
 	}
 
+	// Check and reserve the quota of the namespace until the VM objects are stored and counted as the usage of the namespace
+	quotaDemands := []resource.QuotaDemand{}
+	for _, k := range req.Vm {
+		quotaDemands = append(quotaDemands, resource.QuotaDemand{ConnectionName: k.ConnectionName, SpecId: k.SpecId, Count: resource.QuotaDemandCount(k.SubGroupSize)})
+	}
+	releaseQuota, err := resource.ReserveNsQuota(nsId, quotaDemands)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseQuota()
+
 	uid := common.GenUid()
 
 	targetAction := model.ActionCreate
@@ -484,6 +735,7 @@ func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInf
 		"status":          model.StatusCreating,
 		"targetAction":    targetAction,
 		"targetStatus":    targetStatus,
+		"desiredStatus":   targetStatus,
 		"installMonAgent": req.InstallMonAgent,
 		"systemLabel":     req.SystemLabel,
 	}
@@ -494,14 +746,7 @@ func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInf
 		return nil, err
 	}
 
-	err = kvstore.Put(key, string(val))
-	if err != nil {
-		err := fmt.Errorf("System Error: CreateMci kvstore.Put Error")
-		log.Error().Err(err).Msg("")
-		return nil, err
-	}
-
-	// Store label info using CreateOrUpdateLabel
+	// Store MCI object with its label info atomically
 	labels := map[string]string{
 		model.LabelManager:     model.StrManager,
 		model.LabelNamespace:   nsId,
@@ -515,8 +760,19 @@ func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInf
 		labels[key] = value
 	}
 
-	err = label.CreateOrUpdateLabel(model.StrMCI, uid, key, labels)
+	var cmps []kvstore.Compare
+	if option != "register" {
+		// the MCI object is created only if it has not been created by another request in the meantime
+		cmps = append(cmps, kvstore.CompareNotExist(key))
+	}
+	created, err := putObjectWithLabel(cmps, key, string(val), model.StrMCI, uid, labels)
 	if err != nil {
+		err := fmt.Errorf("System Error: CreateMci kvstore.Txn Error: %w", err)
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	if !created {
+		err := fmt.Errorf("The mci " + req.Name + " already exists.")
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
@@ -587,14 +843,9 @@ func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInf
 			for i := vmStartIndex; i < subGroupSize+vmStartIndex; i++ {
 				subGroupInfoData.VmId = append(subGroupInfoData.VmId, subGroupInfoData.Id+"-"+strconv.Itoa(i))
 			}
+			subGroupInfoData.SubGroupSize = strconv.Itoa(len(subGroupInfoData.VmId))
 
-			val, _ := json.Marshal(subGroupInfoData)
-			err := kvstore.Put(key, string(val))
-			if err != nil {
-				log.Error().Err(err).Msg("")
-			}
-
-			// Store label info using CreateOrUpdateLabel
+			// Store subGroup object with its label info atomically
 			labels := map[string]string{
 				model.LabelManager:        model.StrManager,
 				model.LabelNamespace:      nsId,
@@ -607,7 +858,8 @@ func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInf
 				model.LabelMciUid:         uid,
 				model.LabelMciDescription: req.Description,
 			}
-			err = label.CreateOrUpdateLabel(model.StrSubGroup, uid, key, labels)
+			val, _ := json.Marshal(subGroupInfoData)
+			_, err = putObjectWithLabel(nil, key, string(val), model.StrSubGroup, uidSubGroup, labels)
 			if err != nil {
 				log.Error().Err(err).Msg("")
 				return nil, err
@@ -653,7 +905,7 @@ func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInf
 			vmInfoData.SubnetId = k.SubnetId
 			vmInfoData.SecurityGroupIds = k.SecurityGroupIds
 			vmInfoData.DataDiskIds = k.DataDiskIds
-			vmInfoData.SshKeyId = k.SshKeyId
+			vmInfoData.SshKeyId = sshKeyForNewVm(nsId, k.SshKeyId)
 			vmInfoData.Description = k.Description
 			vmInfoData.VmUserName = k.VmUserName
 			vmInfoData.VmUserPassword = k.VmUserPassword
@@ -664,16 +916,14 @@ func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInf
 
 			vmInfoData.CspResourceId = k.CspResourceId
 
-			// Avoid concurrent requests to CSP.
-			time.Sleep(time.Duration(i) * time.Second)
-
 			wg.Add(1)
-			go AddVmToMci(&wg, nsId, mciId, &vmInfoData, option)
+			go AddVmToMci(ctx, &wg, nsId, mciId, &vmInfoData, option)
 			//AddVmToMci(nsId, req.Id, vmInfoData)
 
 		}
 	}
 	wg.Wait()
+	releaseQuota()
 
 	mciTmp, err := GetMciObject(nsId, mciId)
 	if err != nil {
@@ -681,7 +931,7 @@ func CreateMci(nsId string, req *model.TbMciReq, option string) (*model.TbMciInf
 		return nil, err
 	}
 
-	mciStatusTmp, err := GetMciStatus(nsId, mciId)
+	mciStatusTmp, err := GetMciStatusWithContext(ctx, nsId, mciId)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return nil, err
@@ -785,6 +1035,234 @@ func CheckMciDynamicReq(req *model.MciConnectionConfigCandidatesReq) (*model.Che
 	return &mciReqInfo, err
 }
 
+// ReviewMciDynamicReq is func to review a request to create MCI dynamically without calling CSPs (dry-run).
+// It resolves spec, image and shared resources of each VM as CreateMciDynamic does, validates them,
+// and estimates the cost of the MCI.
+func ReviewMciDynamicReq(nsId string, req *model.TbMciDynamicReq) (*model.ReviewMciDynamicReqInfo, error) {
+
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+	check, err := common.CheckNs(nsId)
+	if !check || err != nil {
+		err := fmt.Errorf("The namespace " + nsId + " does not exist.")
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+
+	reviewInfo := &model.ReviewMciDynamicReqInfo{
+		Name:     req.Name,
+		Vm:       []model.ReviewVmDynamicReqInfo{},
+		Errors:   []string{},
+		Warnings: []string{},
+	}
+
+	err = validate.Struct(req)
+	if err != nil {
+		reviewInfo.Errors = append(reviewInfo.Errors, err.Error())
+	}
+	err = common.CheckString(req.Name)
+	if err != nil {
+		reviewInfo.Errors = append(reviewInfo.Errors, "MCI name: "+err.Error())
+	} else if check, _ := CheckMci(nsId, req.Name); check {
+		reviewInfo.Errors = append(reviewInfo.Errors, "The mci "+req.Name+" already exists.")
+	}
+
+	vmNames := map[string]bool{}
+	for i := range req.Vm {
+		vmReview := reviewVmDynamicReq(nsId, &req.Vm[i])
+		if vmNames[vmReview.Name] {
+			vmReview.Errors = append(vmReview.Errors, "Duplicated VM (subGroup) name "+vmReview.Name)
+		}
+		vmNames[vmReview.Name] = true
+		vmReview.Valid = len(vmReview.Errors) == 0
+
+		if vmReview.Valid {
+			reviewInfo.TotalVmCount += vmReview.SubGroupSize
+			reviewInfo.TotalCostPerHour += vmReview.CostPerHour
+		}
+		reviewInfo.Vm = append(reviewInfo.Vm, vmReview)
+	}
+	reviewInfo.TotalCostPerMonth = reviewInfo.TotalCostPerHour * model.HoursPerMonth
+
+	reviewInfo.Valid = len(reviewInfo.Errors) == 0
+	for _, v := range reviewInfo.Vm {
+		if !v.Valid {
+			reviewInfo.Valid = false
+		}
+	}
+
+	return reviewInfo, nil
+}
+
+// reviewVmDynamicReq is func to review a VM dynamic request in the way of getVmReqFromDynamicReq without creating resources
+func reviewVmDynamicReq(nsId string, req *model.TbVmDynamicReq) model.ReviewVmDynamicReqInfo {
+	vmReview := model.ReviewVmDynamicReqInfo{
+		Name:         req.Name,
+		RootDiskType: req.RootDiskType,
+		RootDiskSize: req.RootDiskSize,
+		Resources:    []model.ReviewResourceInfo{},
+		Errors:       []string{},
+		Warnings:     []string{},
+	}
+	if vmReview.Name == "" {
+		vmReview.Name = req.CommonSpec
+		vmReview.Warnings = append(vmReview.Warnings, "name is empty; a random name will be given")
+	} else if err := common.CheckString(req.Name); err != nil {
+		vmReview.Errors = append(vmReview.Errors, "VM name: "+err.Error())
+	}
+
+	vmReview.SubGroupSize = 1
+	if req.SubGroupSize != "" {
+		subGroupSize, err := strconv.Atoi(req.SubGroupSize)
+		if err != nil || subGroupSize < 1 {
+			vmReview.Errors = append(vmReview.Errors, "subGroupSize should be a positive integer (given: "+req.SubGroupSize+")")
+		} else {
+			vmReview.SubGroupSize = subGroupSize
+		}
+	}
+
+	specInfo, err := resource.GetSpec(model.SystemCommonNs, req.CommonSpec)
+	if err != nil {
+		vmReview.Errors = append(vmReview.Errors, "Failed to get the Spec "+req.CommonSpec+": "+err.Error())
+		return vmReview
+	}
+	vmReview.Spec = specInfo
+
+	vmReview.ConnectionName = specInfo.ConnectionName
+	if req.ConnectionName != "" {
+		vmReview.ConnectionName = req.ConnectionName
+	}
+	connection, err := common.GetConnConfig(vmReview.ConnectionName)
+	if err != nil {
+		vmReview.Errors = append(vmReview.Errors, "Failed to get ConnectionName ("+vmReview.ConnectionName+") for Spec ("+req.CommonSpec+")")
+		return vmReview
+	}
+	if !strings.EqualFold(connection.ProviderName, specInfo.ProviderName) {
+		vmReview.Errors = append(vmReview.Errors, fmt.Sprintf("ConnectionName %s (%s) does not match the provider of Spec %s (%s)",
+			vmReview.ConnectionName, connection.ProviderName, req.CommonSpec, specInfo.ProviderName))
+	}
+
+	osType := strings.ReplaceAll(req.CommonImage, " ", "")
+	imageId := resource.GetProviderRegionZoneResourceKey(connection.ProviderName, connection.RegionDetail.RegionName, "", osType)
+	// incase of user provided image id completely (e.g. aws+ap-northeast-2+ubuntu22.04)
+	if strings.Contains(req.CommonImage, "+") {
+		imageId = req.CommonImage
+	}
+	imageInfo, err := resource.GetImage(model.SystemCommonNs, imageId)
+	if err != nil {
+		vmReview.Errors = append(vmReview.Errors, "Failed to get the Image "+imageId+" from "+vmReview.ConnectionName)
+	} else {
+		vmReview.Image = imageInfo
+		errs, warnings := checkImageFitsSpec(imageInfo, specInfo)
+		vmReview.Errors = append(vmReview.Errors, errs...)
+		vmReview.Warnings = append(vmReview.Warnings, warnings...)
+	}
+
+	vmReview.Errors = append(vmReview.Errors, checkRootDisk(connection.ProviderName, req.RootDiskType, req.RootDiskSize)...)
+
+	// Default resource name has this pattern (nsId + "-shared-" + ConnectionName)
+	resourceName := nsId + model.StrSharedResourceName + vmReview.ConnectionName
+	for _, resourceType := range []string{model.StrVNet, model.StrSSHKey, model.StrSecurityGroup} {
+		action := model.ReviewResourceReuse
+		_, err := resource.GetResource(nsId, resourceType, resourceName)
+		if err != nil {
+			action = model.ReviewResourceCreate
+		}
+		vmReview.Resources = append(vmReview.Resources, model.ReviewResourceInfo{ResourceType: resourceType, Id: resourceName, Action: action})
+	}
+
+	if specInfo.CostPerHour > 0 {
+		vmReview.CostPerHour = specInfo.CostPerHour * float32(vmReview.SubGroupSize)
+	} else {
+		vmReview.Warnings = append(vmReview.Warnings, "cost of the Spec "+specInfo.Id+" is unknown")
+	}
+
+	return vmReview
+}
+
+// checkImageFitsSpec is func to check if the image can be used with the spec, and returns errors and warnings
+func checkImageFitsSpec(imageInfo model.TbImageInfo, specInfo model.TbSpecInfo) ([]string, []string) {
+	errs := []string{}
+	warnings := []string{}
+
+	if imageInfo.InfraType != "" && !strings.Contains(strings.ToLower(imageInfo.InfraType), model.StrVM) {
+		errs = append(errs, fmt.Sprintf("Image %s is not for VMs (infraType: %s)", imageInfo.Id, imageInfo.InfraType))
+	}
+	if specInfo.InfraType != "" && !strings.Contains(strings.ToLower(specInfo.InfraType), model.StrVM) {
+		errs = append(errs, fmt.Sprintf("Spec %s is not for VMs (infraType: %s)", specInfo.Id, specInfo.InfraType))
+	}
+
+	imageIsWindows := strings.Contains(strings.ToLower(imageInfo.GuestOS), "windows")
+	if specInfo.OsType != "" && imageInfo.GuestOS != "" {
+		specIsWindows := strings.Contains(strings.ToLower(specInfo.OsType), "windows")
+		if imageIsWindows != specIsWindows {
+			errs = append(errs, fmt.Sprintf("osType of Image %s (%s) does not fit Spec %s (%s)", imageInfo.Id, imageInfo.GuestOS, specInfo.Id, specInfo.OsType))
+		}
+	}
+	if imageIsWindows && specInfo.MemoryGiB > 0 && specInfo.MemoryGiB < 2 {
+		warnings = append(warnings, fmt.Sprintf("Spec %s has %.1f GiB memory, which may be too small for %s", specInfo.Id, specInfo.MemoryGiB, imageInfo.GuestOS))
+	}
+	if imageInfo.Status != "" && !strings.EqualFold(imageInfo.Status, "available") {
+		warnings = append(warnings, fmt.Sprintf("Image %s is %s", imageInfo.Id, imageInfo.Status))
+	}
+	return errs, warnings
+}
+
+// checkRootDisk is func to validate root disk type and size by rules of the provider in cloud_conf.yaml
+func checkRootDisk(providerName string, rootDiskType string, rootDiskSize string) []string {
+	errs := []string{}
+	rule := getCloudSetting(providerName).RootDisk
+
+	if rootDiskType != "" && !strings.EqualFold(rootDiskType, "default") && len(rule.Type) > 0 {
+		found := false
+		for _, t := range rule.Type {
+			if strings.EqualFold(t, rootDiskType) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("rootDiskType %s is not available for %s (available: %s)", rootDiskType, providerName, strings.Join(rule.Type, ", ")))
+		}
+	}
+
+	if rootDiskSize != "" && !strings.EqualFold(rootDiskSize, "default") {
+		size, err := strconv.Atoi(rootDiskSize)
+		if err != nil || size < 1 {
+			errs = append(errs, "rootDiskSize should be a positive integer in GB (given: "+rootDiskSize+")")
+			return errs
+		}
+		if min, err := strconv.Atoi(rule.Min); err == nil && size < min {
+			errs = append(errs, fmt.Sprintf("rootDiskSize %d GB is smaller than the minimum (%d GB) of %s", size, min, providerName))
+		}
+		if max, err := strconv.Atoi(rule.Max); err == nil && size > max {
+			errs = append(errs, fmt.Sprintf("rootDiskSize %d GB is larger than the maximum (%d GB) of %s", size, max, providerName))
+		}
+	}
+	return errs
+}
+
+// getCloudSetting is func to get the cloud setting of the provider (the common setting if not found)
+func getCloudSetting(providerName string) (cloudSetting model.CloudSetting) {
+	// Convert cloud type to field name (e.g., AWS to Aws, OPENSTACK to Openstack)
+	lowercase := strings.ToLower(providerName)
+	if lowercase == "" {
+		return common.RuntimeConf.Cloud.Common
+	}
+	fieldName := strings.ToUpper(string(lowercase[0])) + lowercase[1:]
+
+	defer func() {
+		if err := recover(); err != nil {
+			log.Error().Msgf("%v", err)
+			cloudSetting = common.RuntimeConf.Cloud.Common
+		}
+	}()
+	return reflect.ValueOf(&common.RuntimeConf.Cloud).Elem().FieldByName(fieldName).Interface().(model.CloudSetting)
+}
+
 // CreateSystemMciDynamic is func to create MCI obeject and deploy requested VMs in a dynamic way
 func CreateSystemMciDynamic(option string) (*model.TbMciInfo, error) {
 	nsId := model.SystemCommonNs
@@ -850,11 +1328,14 @@ func CreateSystemMciDynamic(option string) (*model.TbMciInfo, error) {
 		return nil, err
 	}
 
-	return CreateMciDynamic("", nsId, req, "")
+	return CreateMciDynamic(context.Background(), "", nsId, req, "")
 }
 
 // CreateMciDynamic is func to create MCI obeject and deploy requested VMs in a dynamic way
-func CreateMciDynamic(reqID string, nsId string, req *model.TbMciDynamicReq, deployOption string) (*model.TbMciInfo, error) {
+func CreateMciDynamic(ctx context.Context, reqID string, nsId string, req *model.TbMciDynamicReq, deployOption string) (*model.TbMciInfo, error) {
+
+	ctx, span := common.StartSpan(ctx, "CreateMciDynamic", attribute.String("ns.id", nsId), attribute.String("mci.id", req.Name))
+	defer span.End()
 
 	mciReq := model.TbMciReq{}
 	mciReq.Name = req.Name
@@ -894,10 +1375,21 @@ func CreateMciDynamic(reqID string, nsId string, req *model.TbMciDynamicReq, dep
 		return emptyMci, err
 	}
 
+	// Check the quota of the namespace before preparing resources (reserved by CreateMci when VMs are created)
+	quotaDemands := []resource.QuotaDemand{}
+	for _, k := range vmRequest {
+		quotaDemands = append(quotaDemands, resource.QuotaDemand{ConnectionName: k.ConnectionName, SpecId: k.CommonSpec, Count: resource.QuotaDemandCount(k.SubGroupSize)})
+	}
+	if err := resource.CheckNsQuota(nsId, quotaDemands); err != nil {
+		return emptyMci, err
+	}
+
 	//If not, generate default resources dynamically.
+	_, prepareSpan := common.StartSpan(ctx, "PrepareMciResources", attribute.Int("vm.requests", len(vmRequest)))
 	for _, k := range vmRequest {
 		vmReq, err := getVmReqFromDynamicReq(reqID, nsId, &k)
 		if err != nil {
+			common.EndSpan(prepareSpan, err)
 			log.Error().Err(err).Msg("Failed to prefare resources for dynamic MCI creation")
 			// Rollback created default resources
 			time.Sleep(5 * time.Second)
@@ -913,9 +1405,15 @@ func CreateMciDynamic(reqID string, nsId string, req *model.TbMciDynamicReq, dep
 		}
 		mciReq.Vm = append(mciReq.Vm, *vmReq)
 	}
+	prepareSpan.End()
 
 	common.PrintJsonPretty(mciReq)
 	common.UpdateRequestProgress(reqID, common.ProgressInfo{Title: "Prepared all resources for provisioning MCI:" + mciReq.Name, Info: mciReq, Time: time.Now()})
+
+	// Last checkpoint to cancel the job of the request before provisioning VMs
+	if err := common.CheckJobCanceled(reqID); err != nil {
+		return emptyMci, fmt.Errorf("MCI %s is not provisioned: %w", mciReq.Name, err)
+	}
 	common.UpdateRequestProgress(reqID, common.ProgressInfo{Title: "Start provisioning", Time: time.Now()})
 
 	// Run create MCI with the generated MCI request (option != register)
@@ -923,7 +1421,7 @@ func CreateMciDynamic(reqID string, nsId string, req *model.TbMciDynamicReq, dep
 	if deployOption == "hold" {
 		option = "hold"
 	}
-	return CreateMci(nsId, &mciReq, option)
+	return CreateMci(ctx, nsId, &mciReq, option)
 }
 
 // CreateMciVmDynamic is func to create requested VM in a dynamic way and add it to MCI
@@ -1130,30 +1628,37 @@ func getVmReqFromDynamicReq(reqID string, nsId string, req *model.TbVmDynamicReq
 	return vmReq, nil
 }
 
-// AddVmToMci is func to add VM to MCI
-func AddVmToMci(wg *sync.WaitGroup, nsId string, mciId string, vmInfoData *model.TbVmInfo, option string) error {
+// AddVmToMci is func to add VM to MCI (traced as a child span of the span in ctx)
+func AddVmToMci(ctx context.Context, wg *sync.WaitGroup, nsId string, mciId string, vmInfoData *model.TbVmInfo, option string) (err error) {
 	log.Debug().Msg("Start to add VM To MCI")
 	//goroutin
 	defer wg.Done()
 
-	key := common.GenMciKey(nsId, mciId, "")
-	keyValue, err := kvstore.GetKv(key)
+	// the VM is created even if ctx is canceled (only the trace of ctx is kept)
+	ctx, span := common.StartSpan(context.WithoutCancel(ctx), "AddVmToMci",
+		attribute.String("ns.id", nsId), attribute.String("mci.id", mciId), attribute.String("vm.id", vmInfoData.Id),
+		attribute.String("connection.name", vmInfoData.ConnectionName))
+	defer func() { common.EndSpan(span, err) }()
+
+	mciKey := common.GenMciKey(nsId, mciId, "")
+
+	// Make VM object (only if the MCI object exists)
+	key := common.GenMciKey(nsId, mciId, vmInfoData.Id)
+	val, err := marshalVmInfo(*vmInfoData)
 	if err != nil {
-		log.Fatal().Err(err).Msg("AddVmToMci(); kvstore.GetKv() returned an error.")
 		return err
 	}
-	if keyValue == (kvstore.KeyValue{}) {
-		return fmt.Errorf("AddVmToMci: Cannot find mciId. Key: %s", key)
-	}
-
-	// Make VM object
-	key = common.GenMciKey(nsId, mciId, vmInfoData.Id)
-	val, _ := json.Marshal(vmInfoData)
-	err = kvstore.Put(key, string(val))
+	err = kvstore.ReadModifyWrite(ctx, []string{mciKey}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[mciKey].Exists() {
+			return nil, fmt.Errorf("AddVmToMci: Cannot find mciId. Key: %s", mciKey)
+		}
+		return []kvstore.Op{kvstore.OpPut(key, val)}, nil
+	})
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return err
 	}
+	trackVmCost(nsId, mciId, *vmInfoData)
 
 	configTmp, err := common.GetConnConfig(vmInfoData.ConnectionName)
 	if err != nil {
@@ -1164,15 +1669,18 @@ func AddVmToMci(wg *sync.WaitGroup, nsId string, mciId string, vmInfoData *model
 
 	//AddVmInfoToMci(nsId, mciId, *vmInfoData)
 	// Update VM object
-	val, _ = json.Marshal(vmInfoData)
-	err = kvstore.Put(key, string(val))
+	val, err = marshalVmInfo(*vmInfoData)
+	if err != nil {
+		return err
+	}
+	err = kvstore.PutWith(ctx, key, val)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return err
 	}
 
 	//instanceIds, publicIPs := CreateVm(&vmInfoData)
-	err = CreateVm(nsId, mciId, vmInfoData, option)
+	err = CreateVm(ctx, nsId, mciId, vmInfoData, option)
 
 	if err != nil {
 		vmInfoData.Status = model.StatusFailed
@@ -1187,7 +1695,7 @@ func AddVmToMci(wg *sync.WaitGroup, nsId string, mciId string, vmInfoData *model
 	vmInfoData.TargetStatus = model.StatusComplete
 
 	// get and set current vm status
-	vmStatusInfoTmp, err := FetchVmStatus(nsId, mciId, vmInfoData.Id)
+	vmStatusInfoTmp, err := fetchVmStatus(ctx, nsId, mciId, vmInfoData.Id)
 
 	if err != nil {
 		log.Error().Err(err).Msg("")
@@ -1205,9 +1713,7 @@ func AddVmToMci(wg *sync.WaitGroup, nsId string, mciId string, vmInfoData *model
 	vmInfoData.CreatedTime = t.Format("2006-01-02 15:04:05")
 	log.Debug().Msg(vmInfoData.CreatedTime)
 
-	UpdateVmInfo(nsId, mciId, *vmInfoData)
-
-	// Store label info using CreateOrUpdateLabel
+	// Store label info
 	labels := map[string]string{
 		model.LabelManager:         model.StrManager,
 		model.LabelNamespace:       nsId,
@@ -1225,7 +1731,23 @@ func AddVmToMci(wg *sync.WaitGroup, nsId string, mciId string, vmInfoData *model
 	for key, value := range vmInfoData.Label {
 		labels[key] = value
 	}
-	err = label.CreateOrUpdateLabel(model.StrVM, vmInfoData.Uid, key, labels)
+
+	// Update VM object with its label info atomically (no update if the VM has been deleted in the meantime)
+	labelKey := label.GenLabelKey(model.StrVM, vmInfoData.Uid)
+	val, err = marshalVmInfo(*vmInfoData)
+	if err != nil {
+		return err
+	}
+	err = kvstore.ReadModifyWrite(ctx, []string{key, labelKey}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[key].Exists() {
+			return nil, nil
+		}
+		labelData, err := label.MergeLabels(current[labelKey].Value, key, labels)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, val), kvstore.OpPut(labelKey, labelData)}, nil
+	})
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return err
@@ -1235,8 +1757,24 @@ func AddVmToMci(wg *sync.WaitGroup, nsId string, mciId string, vmInfoData *model
 
 }
 
+// putObjectWithLabel stores an object and its label object in a transaction if all conditions are met
+func putObjectWithLabel(cmps []kvstore.Compare, key string, val string, labelType string, uid string, labels map[string]string) (bool, error) {
+	labelData, err := label.MergeLabels("", key, labels)
+	if err != nil {
+		return false, err
+	}
+	resp, err := kvstore.Txn(cmps, []kvstore.Op{
+		kvstore.OpPut(key, val),
+		kvstore.OpPut(label.GenLabelKey(labelType, uid), labelData),
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
 // CreateVm is func to create VM (option = "register" for register existing VM)
-func CreateVm(nsId string, mciId string, vmInfoData *model.TbVmInfo, option string) error {
+func CreateVm(ctx context.Context, nsId string, mciId string, vmInfoData *model.TbVmInfo, option string) error {
 
 	var err error = nil
 	switch {
@@ -1402,9 +1940,7 @@ func CreateVm(nsId string, mciId string, vmInfoData *model.TbVmInfo, option stri
 	log.Info().Msg("VM request body to CB-Spider")
 	common.PrintJsonPretty(requestBody)
 
-	// Randomly sleep within 20 Secs to avoid rateLimit from CSP
-	common.RandomSleep(0, 20)
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "POST"
 	client.SetTimeout(20 * time.Minute)
 
@@ -1413,7 +1949,9 @@ func CreateVm(nsId string, mciId string, vmInfoData *model.TbVmInfo, option stri
 		url = model.SpiderRestUrl + "/regvm"
 	}
 
-	err = common.ExecuteHttpRequest(
+	provisioningStart := time.Now()
+	err = common.ExecuteHttpRequestWithContext(
+		ctx,
 		client,
 		method,
 		url,
@@ -1423,6 +1961,7 @@ func CreateVm(nsId string, mciId string, vmInfoData *model.TbVmInfo, option stri
 		&callResult,
 		common.MediumDuration,
 	)
+	observeVmProvisioning(vmInfoData.ConnectionConfig.ProviderName, option, err, time.Since(provisioningStart))
 
 	if err != nil {
 		log.Error().Err(err).Msg("Spider returned an error")
@@ -1434,6 +1973,8 @@ func CreateVm(nsId string, mciId string, vmInfoData *model.TbVmInfo, option stri
 	vmInfoData.VmUserPassword = callResult.VMUserPasswd
 	vmInfoData.CspResourceName = callResult.IId.NameId
 	vmInfoData.CspResourceId = callResult.IId.SystemId
+	// a new or registered instance is verified by its own SSH host key on the first connection
+	vmInfoData.SshHostKeyInfo = nil
 	vmInfoData.Region = callResult.Region
 	vmInfoData.PublicIP = callResult.PublicIP
 	vmInfoData.SSHPort, _ = TrimIP(callResult.SSHAccessPoint)
@@ -1482,24 +2023,14 @@ func CreateVm(nsId string, mciId string, vmInfoData *model.TbVmInfo, option stri
 		}
 
 	} else {
-		vmKey := common.GenMciKey(nsId, mciId, vmInfoData.Id)
-
-		if customImageFlag == false {
-			resource.UpdateAssociatedObjectList(nsId, model.StrImage, vmInfoData.ImageId, model.StrAdd, vmKey)
-		} else {
-			resource.UpdateAssociatedObjectList(nsId, model.StrCustomImage, vmInfoData.ImageId, model.StrAdd, vmKey)
+		imageType := model.StrImage
+		if customImageFlag {
+			imageType = model.StrCustomImage
 		}
-
-		//resource.UpdateAssociatedObjectList(nsId, model.StrSpec, vmInfoData.SpecId, model.StrAdd, vmKey)
-		resource.UpdateAssociatedObjectList(nsId, model.StrSSHKey, vmInfoData.SshKeyId, model.StrAdd, vmKey)
-		resource.UpdateAssociatedObjectList(nsId, model.StrVNet, vmInfoData.VNetId, model.StrAdd, vmKey)
-
-		for _, v := range vmInfoData.SecurityGroupIds {
-			resource.UpdateAssociatedObjectList(nsId, model.StrSecurityGroup, v, model.StrAdd, vmKey)
-		}
-
-		for _, v := range vmInfoData.DataDiskIds {
-			resource.UpdateAssociatedObjectList(nsId, model.StrDataDisk, v, model.StrAdd, vmKey)
+		// add the VM to associatedObjectList of its resources in a transaction
+		err = updateVmAssociations(nsId, mciId, *vmInfoData, imageType, model.StrAdd)
+		if err != nil {
+			log.Error().Err(err).Msg("")
 		}
 	}
 
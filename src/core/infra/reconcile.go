@@ -0,0 +1,438 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mci is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/label"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// reconcileBackoffBase is the delay before the second attempt to correct a drift
+	reconcileBackoffBase = 30 * time.Second
+	// reconcileBackoffMax is the maximum delay between attempts to correct a drift
+	reconcileBackoffMax = 30 * time.Minute
+	// reconcileRecreateConfirmations is the number of consecutive observations of a VM terminated
+	// by the CSP before it is recreated, so that a transient error of status checks does not recreate VMs
+	reconcileRecreateConfirmations = 3
+)
+
+// reconcileDrift tracks a drift of a VM across reconciliation cycles
+type reconcileDrift struct {
+	desiredStatus string
+	actualStatus  string
+	observed      int
+	attempt       int
+	nextAttempt   time.Time
+}
+
+// reconcileDrifts holds reconcileDrift of VMs by their keys
+var reconcileDrifts sync.Map
+
+// reconcileRunning prevents reconciliation cycles from overlapping
+var reconcileRunning atomic.Bool
+
+// ReconcileController drives VMs of all MCIs to the desired status of their MCIs.
+// ReconcileController will be periodically invoked by a time.NewTicker in main.go.
+func ReconcileController() {
+	if !reconcileRunning.CompareAndSwap(false, true) {
+		log.Debug().Msg("previous reconciliation is still running; skip this cycle")
+		return
+	}
+	defer reconcileRunning.Store(false)
+
+	nsList, err := common.ListNsId()
+	if err != nil {
+		log.Error().Err(err).Msg("an error occurred while getting namespaces' list")
+		return
+	}
+
+	for _, nsId := range nsList {
+		mciList, err := ListMciId(nsId)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			continue
+		}
+		for _, mciId := range mciList {
+			_, err := ReconcileMci(nsId, mciId)
+			if err != nil {
+				log.Error().Err(err).Msgf("failed to reconcile MCI %s/%s", nsId, mciId)
+			}
+		}
+	}
+}
+
+// ReconcileMci compares the status of each VM with its desired status (the one requested by the last
+// action on the VM, or the desired status of the MCI otherwise), and retries missing transitions with backoff. VMs terminated by the CSP are recreated if the MCI or the VM
+// has the label model.LabelReconcileRecreate. It returns the drift events of this reconciliation.
+func ReconcileMci(nsId string, mciId string) ([]model.MciDriftEvent, error) {
+	mci, err := GetMciObject(nsId, mciId)
+	if err != nil {
+		return nil, err
+	}
+	// MCIs under provisioning are not reconciled
+	if mci.TargetAction == model.ActionCreate {
+		return nil, nil
+	}
+
+	recreateAll := hasReconcileRecreateLabel(model.StrMCI, mci.Uid)
+
+	vmList, err := ListVmId(nsId, mciId)
+	if err != nil {
+		return nil, err
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	events := []model.MciDriftEvent{}
+	for _, vmId := range vmList {
+		wg.Add(1)
+		go func(vmId string) {
+			defer wg.Done()
+			event, drifted := reconcileVm(nsId, mciId, vmId, mci.DesiredStatus, recreateAll)
+			if !drifted {
+				return
+			}
+			recordMciDriftEvent(nsId, mciId, event)
+			mutex.Lock()
+			events = append(events, event)
+			mutex.Unlock()
+		}(vmId)
+	}
+	wg.Wait()
+
+	return events, nil
+}
+
+// reconcileVm corrects the drift of a VM and returns the drift event (false if no event is made)
+func reconcileVm(nsId string, mciId string, vmId string, desiredStatus string, recreateAll bool) (model.MciDriftEvent, bool) {
+	vmKey := common.GenMciKey(nsId, mciId, vmId)
+
+	vmInfo, err := GetVmObject(nsId, mciId, vmId)
+	if err != nil || vmInfo.TargetAction == model.ActionCreate {
+		return model.MciDriftEvent{}, false
+	}
+	// an action on the VM itself overrides the desired status of the MCI
+	if vmInfo.DesiredStatus != "" {
+		desiredStatus = vmInfo.DesiredStatus
+	}
+	// VMs of MCIs created before desired status has been introduced are not reconciled
+	if desiredStatus == "" {
+		return model.MciDriftEvent{}, false
+	}
+	vmStatus, err := FetchVmStatus(nsId, mciId, vmId)
+	if err != nil {
+		log.Debug().Err(err).Msgf("cannot fetch the status of VM %s", vmKey)
+		return model.MciDriftEvent{}, false
+	}
+	actualStatus := vmStatus.Status
+
+	switch actualStatus {
+	case model.StatusCreating, model.StatusSuspending, model.StatusResuming, model.StatusRebooting, model.StatusTerminating:
+		// the VM is under a transition
+		return model.MciDriftEvent{}, false
+	}
+	if actualStatus == desiredStatus {
+		reconcileDrifts.Delete(vmKey)
+		return model.MciDriftEvent{}, false
+	}
+
+	drift := &reconcileDrift{}
+	if v, found := reconcileDrifts.Load(vmKey); found {
+		drift = v.(*reconcileDrift)
+	}
+	if drift.desiredStatus != desiredStatus || drift.actualStatus != actualStatus {
+		drift = &reconcileDrift{desiredStatus: desiredStatus, actualStatus: actualStatus}
+	}
+	drift.observed++
+	reconcileDrifts.Store(vmKey, drift)
+
+	event := model.MciDriftEvent{
+		VmId:          vmId,
+		Time:          time.Now().Format("2006-01-02 15:04:05"),
+		DesiredStatus: desiredStatus,
+		ActualStatus:  actualStatus,
+		Action:        getReconcileAction(desiredStatus, actualStatus),
+	}
+
+	if event.Action == model.ReconcileActionRecreate {
+		// only VMs which have been terminated without a request of CB-Tumblebug are recreated
+		if vmInfo.TargetAction == model.ActionTerminate ||
+			!(recreateAll || hasReconcileRecreateLabel(model.StrVM, vmInfo.Uid)) {
+			event.Action = model.ReconcileActionNone
+		} else if drift.observed < reconcileRecreateConfirmations {
+			return model.MciDriftEvent{}, false
+		}
+	}
+
+	if event.Action == model.ReconcileActionNone {
+		// the drift is reported once
+		if drift.observed > 1 {
+			return model.MciDriftEvent{}, false
+		}
+		event.Result = "drift is reported without correction"
+		return event, true
+	}
+
+	if time.Now().Before(drift.nextAttempt) {
+		return model.MciDriftEvent{}, false
+	}
+	drift.attempt++
+	drift.nextAttempt = time.Now().Add(reconcileBackoff(drift.attempt))
+	event.Attempt = drift.attempt
+
+	log.Info().Msgf("Reconcile VM %s (desired: %s, actual: %s, action: %s, attempt: %d)", vmKey, desiredStatus, actualStatus, event.Action, drift.attempt)
+	if event.Action == model.ReconcileActionRecreate {
+		err = recreateVm(nsId, mciId, vmInfo)
+	} else {
+		err = controlVmForReconcile(nsId, mciId, vmId, event.Action)
+	}
+	if err != nil {
+		event.Err = err.Error()
+		event.Result = fmt.Sprintf("failed; next attempt after %s", drift.nextAttempt.Format("2006-01-02 15:04:05"))
+		return event, true
+	}
+	event.Result = "requested " + event.Action
+	return event, true
+}
+
+// getVmDesiredStatus returns the status that an action on a VM leads to (empty for unknown actions)
+func getVmDesiredStatus(action string) string {
+	switch {
+	case strings.EqualFold(action, model.ActionSuspend):
+		return model.StatusSuspended
+	case strings.EqualFold(action, model.ActionResume), strings.EqualFold(action, model.ActionReboot):
+		return model.StatusRunning
+	case strings.EqualFold(action, model.ActionTerminate):
+		return model.StatusTerminated
+	}
+	return ""
+}
+
+// setVmDesiredStatus is func to set the status that the reconciler keeps the VM in
+// (an empty status makes the VM follow the desired status of the MCI again)
+func setVmDesiredStatus(nsId string, mciId string, vmId string, desiredStatus string) error {
+	key := common.GenMciKey(nsId, mciId, vmId)
+	return kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[key].Exists() {
+			return nil, nil
+		}
+		// the VM object is updated as it is (its encrypted fields are kept)
+		vm := map[string]json.RawMessage{}
+		if err := json.Unmarshal([]byte(current[key].Value), &vm); err != nil {
+			return nil, err
+		}
+		var currentStatus string
+		json.Unmarshal(vm["desiredStatus"], &currentStatus)
+		if currentStatus == desiredStatus {
+			return nil, nil
+		}
+		if desiredStatus == "" {
+			delete(vm, "desiredStatus")
+		} else {
+			vm["desiredStatus"], _ = json.Marshal(desiredStatus)
+		}
+		val, err := json.Marshal(vm)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+}
+
+// getReconcileAction returns the action to drive a VM from the actual status to the desired status
+func getReconcileAction(desiredStatus string, actualStatus string) string {
+	switch desiredStatus {
+	case model.StatusRunning:
+		switch actualStatus {
+		case model.StatusSuspended:
+			return model.ActionResume
+		case model.StatusTerminated, model.StatusUndefined:
+			return model.ReconcileActionRecreate
+		}
+	case model.StatusSuspended:
+		if actualStatus == model.StatusRunning {
+			return model.ActionSuspend
+		}
+	case model.StatusTerminated:
+		if actualStatus == model.StatusRunning || actualStatus == model.StatusSuspended {
+			return model.ActionTerminate
+		}
+	}
+	return model.ReconcileActionNone
+}
+
+// reconcileBackoff returns the delay before the next attempt (exponential backoff)
+func reconcileBackoff(attempt int) time.Duration {
+	delay := reconcileBackoffBase
+	for i := 1; i < attempt && delay < reconcileBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > reconcileBackoffMax {
+		delay = reconcileBackoffMax
+	}
+	return delay
+}
+
+// hasReconcileRecreateLabel checks if the object opts in recreation of VMs terminated by the CSP
+func hasReconcileRecreateLabel(labelType string, uid string) bool {
+	if uid == "" {
+		return false
+	}
+	labelInfo, err := label.GetLabels(labelType, uid)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(labelInfo.Labels[model.LabelReconcileRecreate], "true")
+}
+
+// controlVmForReconcile requests the control action for a VM and waits for the request to be done
+func controlVmForReconcile(nsId string, mciId string, vmId string, action string) error {
+	var wg sync.WaitGroup
+	results := make(chan model.ControlVmResult, 1)
+	wg.Add(1)
+	go ControlVmAsync(context.Background(), &wg, nsId, mciId, vmId, action, results)
+	wg.Wait()
+
+	select {
+	case result := <-results:
+		return result.Error
+	default:
+		vmInfo, err := GetVmObject(nsId, mciId, vmId)
+		if err == nil && vmInfo.Status == model.StatusFailed {
+			return fmt.Errorf("%s", vmInfo.SystemMessage)
+		}
+		return nil
+	}
+}
+
+// recreateVm creates a VM again with the same configuration, replacing the VM terminated by the CSP
+func recreateVm(nsId string, mciId string, vmInfo model.TbVmInfo) error {
+	err := updateVmAssociations(nsId, mciId, vmInfo, "", model.StrDelete)
+	if err != nil {
+		return err
+	}
+	err = label.DeleteLabelObject(model.StrVM, vmInfo.Uid)
+	if err != nil {
+		log.Debug().Err(err).Msg("")
+	}
+
+	// the VM gets a new Uid, which is the name of the VM in the CSP
+	vmInfo.Uid = common.GenUid()
+	vmInfo.CspResourceId = ""
+	vmInfo.CspResourceName = ""
+	vmInfo.PublicIP = "empty"
+	vmInfo.PublicDNS = "empty"
+	vmInfo.PrivateIP = ""
+	vmInfo.TargetAction = model.ActionCreate
+	vmInfo.TargetStatus = model.StatusRunning
+	vmInfo.Status = model.StatusCreating
+	vmInfo.SystemMessage = "recreated by the reconciler"
+	// the new instance has its own SSH host key (the key pinned for the old instance is dropped)
+	vmInfo.SshHostKeyInfo = nil
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	return AddVmToMci(context.Background(), &wg, nsId, mciId, &vmInfo, "")
+}
+
+// genMciDriftKey returns the key prefix of drift events of an MCI
+func genMciDriftKey(nsId string, mciId string) string {
+	return "/ns/" + nsId + "/drift/mci/" + mciId + "/"
+}
+
+// recordMciDriftEvent stores a drift event of an MCI and removes the oldest events over the limit
+func recordMciDriftEvent(nsId string, mciId string, event model.MciDriftEvent) {
+	prefix := genMciDriftKey(nsId, mciId)
+	key := fmt.Sprintf("%s%020d", prefix, time.Now().UnixNano())
+	val, _ := json.Marshal(event)
+	err := kvstore.Put(key, string(val))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return
+	}
+
+	keyValue, err := kvstore.GetKvList(prefix)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return
+	}
+	if len(keyValue) <= model.DriftHistoryMaxEntries {
+		return
+	}
+	ops := []kvstore.Op{}
+	for _, kv := range keyValue[:len(keyValue)-model.DriftHistoryMaxEntries] {
+		ops = append(ops, kvstore.OpDelete(kv.Key))
+	}
+	err = commitOpsInBatches(ops)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+	}
+}
+
+// GetMciDriftHistory returns drift events of an MCI (of a VM if vmId is given)
+func GetMciDriftHistory(nsId string, mciId string, vmId string) (model.MciDriftHistory, error) {
+	result := model.MciDriftHistory{NsId: nsId, MciId: mciId, Events: []model.MciDriftEvent{}}
+
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	err = common.CheckString(mciId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	check, _ := CheckMci(nsId, mciId)
+	if !check {
+		err := fmt.Errorf("The mci " + mciId + " does not exist.")
+		return result, err
+	}
+
+	keyValue, err := kvstore.GetKvList(genMciDriftKey(nsId, mciId))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	for _, kv := range keyValue {
+		event := model.MciDriftEvent{}
+		err = json.Unmarshal([]byte(kv.Value), &event)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			continue
+		}
+		if vmId != "" && event.VmId != vmId {
+			continue
+		}
+		result.Events = append(result.Events, event)
+	}
+	sort.SliceStable(result.Events, func(i, j int) bool {
+		return result.Events[i].Time < result.Events[j].Time
+	})
+	return result, nil
+}
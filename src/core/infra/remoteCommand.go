@@ -15,7 +15,9 @@ limitations under the License.
 package infra
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -33,6 +35,7 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
 	validator "github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -48,8 +51,47 @@ func TbMciCmdReqStructLevelValidation(sl validator.StructLevel) {
 	// }
 }
 
+// RemoteCommandOptions is struct for options of remote command execution
+type RemoteCommandOptions struct {
+	// ReqId registers the execution so that it can be cancelled by CancelRemoteCommand (optional)
+	ReqId string
+	// OnOutput receives the output of the commands line by line as it arrives (optional, called serially)
+	OnOutput func(event model.SshCmdStreamEvent)
+}
+
+// runningRemoteCommand is a remote command execution that can be cancelled
+type runningRemoteCommand struct {
+	nsId   string
+	mciId  string
+	cancel context.CancelFunc
+}
+
+// runningRemoteCommands is the map of running remote command executions by request ID
+var runningRemoteCommands sync.Map
+
+// CancelRemoteCommand is func to cancel a running remote command by its request ID (SSH sessions are closed)
+func CancelRemoteCommand(nsId string, reqId string) (string, error) {
+	v, ok := runningRemoteCommands.Load(reqId)
+	if !ok {
+		return "", fmt.Errorf("no running remote command with request ID %s", reqId)
+	}
+	run := v.(*runningRemoteCommand)
+	if run.nsId != nsId {
+		return "", fmt.Errorf("no running remote command with request ID %s in namespace %s", reqId, nsId)
+	}
+	run.cancel()
+	log.Info().Msgf("[SSH] remote command %s to MCI %s is cancelled", reqId, run.mciId)
+	return run.mciId, nil
+}
+
 // RemoteCommandToMci is func to command to all VMs in MCI by SSH
 func RemoteCommandToMci(nsId string, mciId string, subGroupId string, vmId string, req *model.MciCmdReq) ([]model.SshCmdResult, error) {
+	return RemoteCommandToMciWithContext(context.Background(), nsId, mciId, subGroupId, vmId, req, RemoteCommandOptions{})
+}
+
+// RemoteCommandToMciWithContext is func to command to all VMs in MCI by SSH.
+// The SSH sessions are closed when ctx is done or when the execution is cancelled by its request ID.
+func RemoteCommandToMciWithContext(ctx context.Context, nsId string, mciId string, subGroupId string, vmId string, req *model.MciCmdReq, opts RemoteCommandOptions) ([]model.SshCmdResult, error) {
 
 	err := common.CheckString(nsId)
 	if err != nil {
@@ -95,12 +137,140 @@ func RemoteCommandToMci(nsId string, mciId string, subGroupId string, vmId strin
 		return temp, err
 	}
 
+	vmList, err := getRemoteCommandTargetVms(nsId, mciId, subGroupId, vmId)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.TimeoutSeconds < 0 {
+		return nil, fmt.Errorf("timeoutSeconds should not be negative")
+	}
+
+	// goroutine sync wg
+	var wg sync.WaitGroup
+
+	var resultArray []model.SshCmdResult
+	var resultMutex sync.Mutex
+
+	// Preprocess commands for each VM
+	vmCommands := make(map[string][]string)
+	vmSecrets := make(map[string][]string)
+	for i, vmId := range vmList {
+		secrets := []string{}
+		processedCommands, err := renderCommandsForVm(req.Command, CommandFuncContext{NsId: nsId, MciId: mciId, VmId: vmId, VmIndex: i, Secrets: &secrets})
+		if err != nil {
+			return nil, err
+		}
+		vmCommands[vmId] = processedCommands
+		vmSecrets[vmId] = secrets
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if opts.ReqId != "" {
+		run := &runningRemoteCommand{nsId: nsId, mciId: mciId, cancel: cancel}
+		if _, loaded := runningRemoteCommands.LoadOrStore(opts.ReqId, run); loaded {
+			return nil, fmt.Errorf("a remote command with request ID %s is already running", opts.ReqId)
+		}
+		defer runningRemoteCommands.Delete(opts.ReqId)
+	}
+
+	// serialize the output events of the VMs
+	var outputMutex sync.Mutex
+	emit := func(event model.SshCmdStreamEvent) {
+		if opts.OnOutput == nil {
+			return
+		}
+		event.Time = time.Now().UTC().Format(time.RFC3339Nano)
+		outputMutex.Lock()
+		defer outputMutex.Unlock()
+		opts.OnOutput(event)
+	}
+
+	// Execute commands in parallel using goroutines
+	for vmId, commands := range vmCommands {
+		wg.Add(1)
+		go func(vmId string, commands []string) {
+			defer wg.Done()
+			runOpts := sshRunOptions{Timeout: time.Duration(req.TimeoutSeconds) * time.Second, Secrets: vmSecrets[vmId]}
+			if opts.OnOutput != nil {
+				runOpts.OnLine = func(stream string, cmdIndex int, line string) {
+					emit(model.SshCmdStreamEvent{Type: stream, MciId: mciId, VmId: vmId, CmdIndex: cmdIndex, Line: line})
+				}
+			}
+			startTime := time.Now()
+			result := runRemoteCommandToVm(ctx, nsId, mciId, vmId, req.UserName, commands, runOpts)
+
+			// secret values are not returned nor recorded
+			for i, c := range result.Command {
+				result.Command[i] = maskSecrets(c, vmSecrets[vmId])
+			}
+			recordCmdHistory(nsId, opts.ReqId, model.CmdHistoryTypeCommand, getSshUserNameForHistory(nsId, mciId, vmId, req.UserName), startTime, result, vmSecrets[vmId])
+
+			doneEvent := model.SshCmdStreamEvent{Type: model.SshCmdStreamVmDone, MciId: mciId, VmId: vmId}
+			if result.Err != nil {
+				doneEvent.Err = result.Err.Error()
+			}
+			emit(doneEvent)
+
+			resultMutex.Lock()
+			resultArray = append(resultArray, result)
+			resultMutex.Unlock()
+		}(vmId, commands)
+	}
+	wg.Wait() // goroutine sync wg
+
+	return resultArray, nil
+}
+
+// RenderRemoteCommandToMci is func to render the command for each target VM in MCI without executing it (dry-run)
+func RenderRemoteCommandToMci(nsId string, mciId string, subGroupId string, vmId string, req *model.MciCmdReq) ([]model.VmCmdRenderResult, error) {
+
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+
+	err = common.CheckString(mciId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+
+	err = validate.Struct(req)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
+	}
+
+	vmList, err := getRemoteCommandTargetVms(nsId, mciId, subGroupId, vmId)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []model.VmCmdRenderResult{}
+	for i, vmId := range vmList {
+		result := model.VmCmdRenderResult{MciId: mciId, VmId: vmId, Command: []string{}}
+		commands, err := renderCommandsForVm(req.Command, CommandFuncContext{NsId: nsId, MciId: mciId, VmId: vmId, VmIndex: i, DryRun: true})
+		if err != nil {
+			result.Err = err.Error()
+		} else {
+			result.Command = commands
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// getRemoteCommandTargetVms returns the VMs addressed by a remote command (all, a subGroup or a VM of the MCI)
+func getRemoteCommandTargetVms(nsId string, mciId string, subGroupId string, vmId string) ([]string, error) {
 	check, _ := CheckMci(nsId, mciId)
 
 	if !check {
-		temp := []model.SshCmdResult{}
 		err := fmt.Errorf("The mci " + mciId + " does not exist.")
-		return temp, err
+		return nil, err
 	}
 
 	vmList, err := ListVmId(nsId, mciId)
@@ -124,63 +294,55 @@ func RemoteCommandToMci(nsId string, mciId string, subGroupId string, vmId strin
 	if vmId != "" {
 		vmList = []string{vmId}
 	}
+	return vmList, nil
+}
 
-	// goroutine sync wg
-	var wg sync.WaitGroup
-
-	var resultArray []model.SshCmdResult
-
-	// Preprocess commands for each VM
-	vmCommands := make(map[string][]string)
-	for i, vmId := range vmList {
-		processedCommands := make([]string, len(req.Command))
-		for j, cmd := range req.Command {
-			processedCmd, err := processCommand(cmd, nsId, mciId, vmId, i)
-			if err != nil {
-				return nil, err
-			}
-			processedCommands[j] = processedCmd
+// renderCommandsForVm replaces the built-in functions in the commands for a VM
+func renderCommandsForVm(commands []string, funcCtx CommandFuncContext) ([]string, error) {
+	rendered := make([]string, len(commands))
+	for i, cmd := range commands {
+		processedCmd, err := renderCommand(cmd, funcCtx)
+		if err != nil {
+			return nil, err
 		}
-		vmCommands[vmId] = processedCommands
+		rendered[i] = processedCmd
 	}
-
-	// Execute commands in parallel using goroutines
-	for vmId, commands := range vmCommands {
-		wg.Add(1)
-		go RunRemoteCommandAsync(&wg, nsId, mciId, vmId, req.UserName, commands, &resultArray)
-	}
-	wg.Wait() // goroutine sync wg
-
-	return resultArray, nil
+	return rendered, nil
 }
 
 // RunRemoteCommand is func to execute a SSH command to a VM (sync call)
 func RunRemoteCommand(nsId string, mciId string, vmId string, givenUserName string, cmds []string) (map[int]string, map[int]string, error) {
+	stdoutResults, stderrResults, _, err := runRemoteCommand(context.Background(), nsId, mciId, vmId, givenUserName, cmds, sshRunOptions{})
+	return stdoutResults, stderrResults, err
+}
+
+// runRemoteCommand is func to execute a SSH command to a VM with the context and options
+func runRemoteCommand(ctx context.Context, nsId string, mciId string, vmId string, givenUserName string, cmds []string, runOpts sshRunOptions) (map[int]string, map[int]string, map[int]int, error) {
 
 	// use privagte IP of the target VM
 	_, targetVmIP, targetSshPort, err := GetVmIp(nsId, mciId, vmId)
 	if err != nil {
 		log.Error().Err(err).Msg("")
-		return map[int]string{}, map[int]string{}, err
+		return map[int]string{}, map[int]string{}, map[int]int{}, err
 	}
 	targetUserName, targetPrivateKey, err := VerifySshUserName(nsId, mciId, vmId, targetVmIP, targetSshPort, givenUserName)
 	if err != nil {
 		log.Error().Err(err).Msg("")
-		return map[int]string{}, map[int]string{}, err
+		return map[int]string{}, map[int]string{}, map[int]int{}, err
 	}
 
 	// Set Bastion SSH config (bastionEndpoint, userName, Private Key)
 	bastionNodes, err := GetBastionNodes(nsId, mciId, vmId)
 	if err != nil {
 		log.Error().Err(err).Msg("")
-		return map[int]string{}, map[int]string{}, err
+		return map[int]string{}, map[int]string{}, map[int]int{}, err
 	}
 	bastionNode := bastionNodes[0]
 	// use public IP of the bastion VM
 	bastionIp, _, bastionSshPort, err := GetVmIp(nsId, bastionNode.MciId, bastionNode.VmId)
 	if err != nil {
 		log.Error().Err(err).Msg("")
-		return map[int]string{}, map[int]string{}, err
+		return map[int]string{}, map[int]string{}, map[int]int{}, err
 	}
 	bastionUserName, bastionSshKey, err := VerifySshUserName(nsId, bastionNode.MciId, bastionNode.VmId, bastionIp, bastionSshPort, givenUserName)
 	bastionEndpoint := fmt.Sprintf("%s:%s", bastionIp, bastionSshPort)
@@ -189,11 +351,14 @@ func RunRemoteCommand(nsId string, mciId string, vmId string, givenUserName stri
 		EndPoint:   bastionEndpoint,
 		UserName:   bastionUserName,
 		PrivateKey: []byte(bastionSshKey),
+		NsId:       nsId,
+		MciId:      bastionNode.MciId,
+		VmId:       bastionNode.VmId,
 	}
 
 	log.Debug().Msg("[SSH] " + mciId + "." + vmId + "(" + targetVmIP + ")" + " with userName: " + targetUserName)
 	for i, v := range cmds {
-		log.Debug().Msg("[SSH] cmd[" + fmt.Sprint(i) + "]: " + v)
+		log.Debug().Msg("[SSH] cmd[" + fmt.Sprint(i) + "]: " + maskSecrets(v, runOpts.Secrets))
 	}
 
 	// Set VM SSH config (targetEndpoint, userName, Private Key)
@@ -202,26 +367,50 @@ func RunRemoteCommand(nsId string, mciId string, vmId string, givenUserName stri
 		EndPoint:   targetEndpoint,
 		UserName:   targetUserName,
 		PrivateKey: []byte(targetPrivateKey),
+		NsId:       nsId,
+		MciId:      mciId,
+		VmId:       vmId,
+	}
+	if runOpts.TargetPrivateKey != nil {
+		targetSshInfo.PrivateKey = runOpts.TargetPrivateKey
 	}
 
 	// Execute SSH
-	stdoutResults, stderrResults, err := runSSH(bastionSshInfo, targetSshInfo, cmds)
+	stdoutResults, stderrResults, exitCodes, err := runSSH(ctx, bastionSshInfo, targetSshInfo, cmds, runOpts)
 	if err != nil {
 		fmt.Printf("Error executing commands: %s\n", err)
-		return stdoutResults, stderrResults, err
+		return stdoutResults, stderrResults, exitCodes, err
 	}
-	return stdoutResults, stderrResults, nil
+	return stdoutResults, stderrResults, exitCodes, nil
 
 }
 
-// RunRemoteCommandAsync is func to execute a SSH command to a VM (async call)
-func RunRemoteCommandAsync(wg *sync.WaitGroup, nsId string, mciId string, vmId string, givenUserName string, cmd []string, returnResult *[]model.SshCmdResult) {
+// getSshUserNameForHistory returns the SSH user name used for the VM (empty if unknown)
+func getSshUserNameForHistory(nsId string, mciId string, vmId string, givenUserName string) string {
+	userName, _, err := VerifySshUserName(nsId, mciId, vmId, "", "", givenUserName)
+	if err != nil {
+		return givenUserName
+	}
+	return userName
+}
+
+// RunRemoteCommandAsync is func to execute a SSH command to a VM (async call, traced as a child span of the span in ctx)
+func RunRemoteCommandAsync(ctx context.Context, wg *sync.WaitGroup, nsId string, mciId string, vmId string, givenUserName string, cmd []string, returnResult *[]model.SshCmdResult) {
 
 	defer wg.Done() //goroutine sync done
 
+	*returnResult = append(*returnResult, runRemoteCommandToVm(ctx, nsId, mciId, vmId, givenUserName, cmd, sshRunOptions{}))
+}
+
+// runRemoteCommandToVm is func to execute SSH commands to a VM and returns the result
+func runRemoteCommandToVm(ctx context.Context, nsId string, mciId string, vmId string, givenUserName string, cmd []string, runOpts sshRunOptions) (sshResultTmp model.SshCmdResult) {
+
+	ctx, span := common.StartSpan(ctx, "RunRemoteCommand",
+		attribute.String("ns.id", nsId), attribute.String("mci.id", mciId), attribute.String("vm.id", vmId), attribute.Int("commands", len(cmd)))
+	defer func() { common.EndSpan(span, sshResultTmp.Err) }()
+
 	vmIP, _, _, err := GetVmIp(nsId, mciId, vmId)
 
-	sshResultTmp := model.SshCmdResult{}
 	sshResultTmp.MciId = mciId
 	sshResultTmp.VmId = vmId
 	sshResultTmp.VmIp = vmIP
@@ -232,17 +421,17 @@ func RunRemoteCommandAsync(wg *sync.WaitGroup, nsId string, mciId string, vmId s
 
 	if err != nil {
 		sshResultTmp.Err = err
-		*returnResult = append(*returnResult, sshResultTmp)
+		return sshResultTmp
 	}
 
 	// RunRemoteCommand
-	stdoutResults, stderrResults, err := RunRemoteCommand(nsId, mciId, vmId, givenUserName, cmd)
+	stdoutResults, stderrResults, exitCodes, err := runRemoteCommand(ctx, nsId, mciId, vmId, givenUserName, cmd, runOpts)
 
 	if err != nil {
 		sshResultTmp.Stdout = stdoutResults
 		sshResultTmp.Stderr = stderrResults
+		sshResultTmp.ExitCode = exitCodes
 		sshResultTmp.Err = err
-		*returnResult = append(*returnResult, sshResultTmp)
 	} else {
 		log.Debug().Msg("[Begin] SSH Output")
 		fmt.Println(stdoutResults)
@@ -250,9 +439,10 @@ func RunRemoteCommandAsync(wg *sync.WaitGroup, nsId string, mciId string, vmId s
 
 		sshResultTmp.Stdout = stdoutResults
 		sshResultTmp.Stderr = stderrResults
+		sshResultTmp.ExitCode = exitCodes
 		sshResultTmp.Err = nil
-		*returnResult = append(*returnResult, sshResultTmp)
 	}
+	return sshResultTmp
 }
 
 // VerifySshUserName is func to verify SSH username
@@ -402,7 +592,7 @@ func GetVmSshKey(nsId string, mciId string, vmId string) (string, string, string
 		return "", "", "", err
 	}
 
-	return keyContent.Username, keyContent.VerifiedUsername, keyContent.PrivateKey, nil
+	return keyContent.Username, keyContent.VerifiedUsername, common.RevealSecret(keyContent.PrivateKey), nil
 }
 
 // UpdateVmSshKey is func to update VM SShKey
@@ -445,59 +635,104 @@ func init() {
 
 }
 
-// runSSH func execute a command by SSH
-func runSSH(bastionInfo model.SshInfo, targetInfo model.SshInfo, cmds []string) (map[int]string, map[int]string, error) {
+// sshRunOptions is struct for options of executing commands by SSH
+type sshRunOptions struct {
+	// Timeout is the timeout of each command (0: no timeout)
+	Timeout time.Duration
+	// OnLine receives each line of stdout and stderr as it arrives (optional)
+	OnLine func(stream string, cmdIndex int, line string)
+	// TargetPrivateKey overrides the private key of the sshKey of the target VM (e.g., to verify a new key)
+	TargetPrivateKey []byte
+	// Secrets are the values injected into the commands (e.g., by GetSecret), which are masked in logs
+	Secrets []string
+}
+
+// sshExitCode returns the exit code of a command from the error of the SSH session (-1 if unknown)
+func sshExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus()
+	}
+	return -1
+}
+
+// copyLines copies r to w and calls onLine for each line read (without the line break)
+func copyLines(r io.Reader, w io.Writer, onLine func(line string)) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			w.Write([]byte(line))
+			if onLine != nil {
+				onLine(strings.TrimRight(line, "\r\n"))
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// runSSH func execute a command by SSH and returns stdout, stderr and exit code of each command
+// (the SSH connection is closed when ctx is done, and a command is killed when it exceeds opts.Timeout)
+func runSSH(ctx context.Context, bastionInfo model.SshInfo, targetInfo model.SshInfo, cmds []string, opts sshRunOptions) (map[int]string, map[int]string, map[int]int, error) {
 
 	stdoutMap := make(map[int]string)
 	stderrMap := make(map[int]string)
+	exitCodeMap := make(map[int]int)
 
 	// Parse the private key for the bastion host
 	bastionSigner, err := ssh.ParsePrivateKey(bastionInfo.PrivateKey)
 	if err != nil {
-		return stdoutMap, stderrMap, err
+		return stdoutMap, stderrMap, exitCodeMap, err
 	}
 
-	// Create an SSH client configuration for the bastion host
-	bastionConfig := &ssh.ClientConfig{
-		User: bastionInfo.UserName,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(bastionSigner),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
+	// Create an SSH client configuration for the bastion host (host key is verified against the pinned key)
+	bastionHostKey := newHostKeyVerifier(bastionInfo)
+	bastionConfig := bastionHostKey.clientConfig(bastionInfo.UserName, bastionSigner)
 
 	// Parse the private key for the target host
 	targetSigner, err := ssh.ParsePrivateKey(targetInfo.PrivateKey)
 	if err != nil {
-		return stdoutMap, stderrMap, err
+		return stdoutMap, stderrMap, exitCodeMap, err
 	}
 
-	// Create an SSH client configuration for the target host
-	targetConfig := &ssh.ClientConfig{
-		User: targetInfo.UserName,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(targetSigner),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	// Create an SSH client configuration for the target host (host key is verified against the pinned key)
+	targetHostKey := newHostKeyVerifier(targetInfo)
+	targetConfig := targetHostKey.clientConfig(targetInfo.UserName, targetSigner)
+
+	if err := ctx.Err(); err != nil {
+		return stdoutMap, stderrMap, exitCodeMap, fmt.Errorf("remote command canceled: %w", err)
 	}
 
 	// Setup the bastion host connection
 	bastionClient, err := ssh.Dial("tcp", bastionInfo.EndPoint, bastionConfig)
 	if err != nil {
-		return stdoutMap, stderrMap, err
+		return stdoutMap, stderrMap, exitCodeMap, err
 	}
 	defer bastionClient.Close()
+	bastionHostKey.commit()
+
+	// Close the connection (and all sessions on it) if the context is done
+	stopCloseOnCancel := context.AfterFunc(ctx, func() {
+		bastionClient.Close()
+	})
+	defer stopCloseOnCancel()
 
 	// Setup the actual SSH client through the bastion host
 	conn, err := bastionClient.Dial("tcp", targetInfo.EndPoint)
 	if err != nil {
-		return stdoutMap, stderrMap, err
+		return stdoutMap, stderrMap, exitCodeMap, err
 	}
 
 	ncc, chans, reqs, err := ssh.NewClientConn(conn, targetInfo.EndPoint, targetConfig)
 	if err != nil {
-		return stdoutMap, stderrMap, err
+		return stdoutMap, stderrMap, exitCodeMap, err
 	}
+	targetHostKey.commit()
 	client := ssh.NewClient(ncc, chans, reqs)
 	defer client.Close()
 
@@ -506,38 +741,59 @@ func runSSH(bastionInfo model.SshInfo, targetInfo model.SshInfo, cmds []string)
 		// Create a new SSH session for each command
 		session, err := client.NewSession()
 		if err != nil {
-			return stdoutMap, stderrMap, err
+			if ctx.Err() != nil {
+				err = fmt.Errorf("remote command canceled: %w", ctx.Err())
+			}
+			return stdoutMap, stderrMap, exitCodeMap, err
 		}
 		defer session.Close() // Ensure session is closed
 
 		// Get pipes for stdout and stderr
 		stdoutPipe, err := session.StdoutPipe()
 		if err != nil {
-			return stdoutMap, stderrMap, err
+			return stdoutMap, stderrMap, exitCodeMap, err
 		}
 
 		stderrPipe, err := session.StderrPipe()
 		if err != nil {
-			return stdoutMap, stderrMap, err
+			return stdoutMap, stderrMap, exitCodeMap, err
 		}
 
 		// Start the command
 		if err := session.Start(cmd); err != nil {
-			return stdoutMap, stderrMap, err
+			return stdoutMap, stderrMap, exitCodeMap, err
+		}
+
+		// Kill the command on timeout or cancellation
+		cmdCtx, cancelCmd := ctx, context.CancelFunc(func() {})
+		if opts.Timeout > 0 {
+			cmdCtx, cancelCmd = context.WithTimeout(ctx, opts.Timeout)
 		}
+		stopKillOnDone := context.AfterFunc(cmdCtx, func() {
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+		})
 
 		// Read stdout and stderr
 		var stdoutBuf, stderrBuf bytes.Buffer
 		stdoutDone := make(chan struct{})
 		stderrDone := make(chan struct{})
 
+		onLine := func(stream string) func(line string) {
+			if opts.OnLine == nil {
+				return nil
+			}
+			cmdIndex := i
+			return func(line string) { opts.OnLine(stream, cmdIndex, line) }
+		}
+
 		go func() {
-			io.Copy(io.MultiWriter(os.Stdout, &stdoutBuf), stdoutPipe)
+			copyLines(stdoutPipe, io.MultiWriter(os.Stdout, &stdoutBuf), onLine(model.SshCmdStreamStdout))
 			close(stdoutDone)
 		}()
 
 		go func() {
-			io.Copy(io.MultiWriter(os.Stderr, &stderrBuf), stderrPipe)
+			copyLines(stderrPipe, io.MultiWriter(os.Stderr, &stderrBuf), onLine(model.SshCmdStreamStderr))
 			close(stderrDone)
 		}()
 
@@ -546,6 +802,22 @@ func runSSH(bastionInfo model.SshInfo, targetInfo model.SshInfo, cmds []string)
 		<-stdoutDone
 		<-stderrDone
 
+		stopKillOnDone()
+		cmdErr := cmdCtx.Err()
+		cancelCmd()
+		exitCodeMap[i] = sshExitCode(err)
+
+		if cmdErr != nil {
+			if ctx.Err() != nil {
+				err = fmt.Errorf("remote command canceled: %w", ctx.Err())
+			} else {
+				err = fmt.Errorf("remote command timed out after %s", opts.Timeout)
+			}
+			stderrMap[i] = fmt.Sprintf("(%s)\nStderr: %s", err, stderrBuf.String())
+			stdoutMap[i] = stdoutBuf.String()
+			return stdoutMap, stderrMap, exitCodeMap, err
+		}
+
 		if err != nil {
 			stderrMap[i] = fmt.Sprintf("(%s)\nStderr: %s", err, stderrBuf.String())
 			stdoutMap[i] = stdoutBuf.String()
@@ -556,7 +828,7 @@ func runSSH(bastionInfo model.SshInfo, targetInfo model.SshInfo, cmds []string)
 		stderrMap[i] = stderrBuf.String()
 	}
 
-	return stdoutMap, stderrMap, nil
+	return stdoutMap, stderrMap, exitCodeMap, nil
 }
 
 // TransferFileToMci is a function to transfer a file to all VMs in MCI by SSH through bastion hosts
@@ -599,9 +871,13 @@ func TransferFileToMci(nsId string, mciId string, subGroupId string, vmId string
 				EndPoint:   fmt.Sprintf("%s:%s", targetVmIP, targetSshPort),
 				UserName:   targetUserName,
 				PrivateKey: []byte(targetPrivateKey),
+				NsId:       nsId,
+				MciId:      mciId,
+				VmId:       vmId,
 			}
 
 			// Transfer file to the VM via bastion
+			startTime := time.Now()
 			err := transferFileToVmViaBastion(nsId, mciId, vmId, targetSshInfo, fileData, fileName, targetPath)
 
 			// Create the result for this VM
@@ -622,6 +898,7 @@ func TransferFileToMci(nsId string, mciId string, subGroupId string, vmId string
 				result.Stdout[0] = fmt.Sprintf("File transfer successful: %s%s", targetPath, fileName)
 				log.Info().Msgf("Successfully transferred file to VM: %s", vmId)
 			}
+			recordCmdHistory(nsId, "", model.CmdHistoryTypeFileTransfer, targetUserName, startTime, result, nil)
 
 			// Safely append to resultArray
 			resultMutex.Lock()
@@ -657,6 +934,9 @@ func transferFileToVmViaBastion(nsId string, mciId string, vmId string, targetSs
 		EndPoint:   fmt.Sprintf("%s:%s", bastionIp, bastionSshPort),
 		UserName:   bastionUserName,
 		PrivateKey: []byte(bastionPrivateKey),
+		NsId:       nsId,
+		MciId:      bastionNode.MciId,
+		VmId:       bastionNode.VmId,
 	}
 
 	err = runSCPWithBastion(bastionSshInfo, targetSshInfo, fileData, fileName, targetPath)
@@ -678,14 +958,9 @@ func runSCPWithBastion(bastionInfo model.SshInfo, targetInfo model.SshInfo, file
 		return fmt.Errorf("failed to parse bastion private key: %v", err)
 	}
 
-	// Create an SSH client configuration for the bastion host
-	bastionConfig := &ssh.ClientConfig{
-		User: bastionInfo.UserName,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(bastionSigner),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
+	// Create an SSH client configuration for the bastion host (host key is verified against the pinned key)
+	bastionHostKey := newHostKeyVerifier(bastionInfo)
+	bastionConfig := bastionHostKey.clientConfig(bastionInfo.UserName, bastionSigner)
 
 	// Parse the private key for the target host
 	targetSigner, err := ssh.ParsePrivateKey(targetInfo.PrivateKey)
@@ -693,14 +968,9 @@ func runSCPWithBastion(bastionInfo model.SshInfo, targetInfo model.SshInfo, file
 		return fmt.Errorf("failed to parse target private key: %v", err)
 	}
 
-	// Create an SSH client configuration for the target host
-	targetConfig := &ssh.ClientConfig{
-		User: targetInfo.UserName,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(targetSigner),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-	}
+	// Create an SSH client configuration for the target host (host key is verified against the pinned key)
+	targetHostKey := newHostKeyVerifier(targetInfo)
+	targetConfig := targetHostKey.clientConfig(targetInfo.UserName, targetSigner)
 
 	// Setup the bastion host connection
 	bastionClient, err := ssh.Dial("tcp", bastionInfo.EndPoint, bastionConfig)
@@ -708,6 +978,7 @@ func runSCPWithBastion(bastionInfo model.SshInfo, targetInfo model.SshInfo, file
 		return fmt.Errorf("failed to dial bastion: %v", err)
 	}
 	defer bastionClient.Close()
+	bastionHostKey.commit()
 
 	// Setup the actual SSH client through the bastion host
 	conn, err := bastionClient.Dial("tcp", targetInfo.EndPoint)
@@ -719,6 +990,7 @@ func runSCPWithBastion(bastionInfo model.SshInfo, targetInfo model.SshInfo, file
 	if err != nil {
 		return fmt.Errorf("failed to create target SSH connection: %v", err)
 	}
+	targetHostKey.commit()
 	client := ssh.NewClient(ncc, chans, reqs)
 	defer client.Close()
 
@@ -940,32 +1212,44 @@ func GetBastionNodes(nsId string, mciId string, targetVmId string) ([]model.Bast
 }
 
 // Helper function to extract function name and parameters from the string
-func extractFunctionAndParams(funcCall string) (string, map[string]string, error) {
-	regex := regexp.MustCompile(`^\s*([a-zA-Z0-9]+)\((.*?)\)\s*$`)
+// (key=value pairs are returned as params, values without a key as positional args)
+func extractFunctionAndParams(funcCall string) (string, map[string]string, []string, error) {
+	regex := regexp.MustCompile(`(?s)^\s*([a-zA-Z0-9]+)\((.*)\)\s*$`)
 	matches := regex.FindStringSubmatch(funcCall)
 	if len(matches) < 3 {
-		return "", nil, errors.New("Built-in function error in command: no function found in command")
+		return "", nil, nil, errors.New("Built-in function error in command: no function found in command")
 	}
 
 	funcName := matches[1]
 	paramsPart := matches[2]
 	params := make(map[string]string)
+	args := []string{}
 
 	paramPairs := splitParams(paramsPart)
 
 	for _, pair := range paramPairs {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
 		kv := strings.SplitN(pair, "=", 2)
-		if len(kv) == 2 {
+		if len(kv) == 2 && !strings.HasPrefix(pair, "'") {
 			key := strings.TrimSpace(kv[0])
-			value := strings.TrimSpace(kv[1])
-			if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
-				value = strings.Trim(value, "'")
-			}
-			params[key] = value
+			params[key] = unquoteParam(strings.TrimSpace(kv[1]))
+		} else {
+			args = append(args, unquoteParam(pair))
 		}
 	}
 
-	return funcName, params, nil
+	return funcName, params, args, nil
+}
+
+// unquoteParam removes the single quotes around a parameter value
+func unquoteParam(value string) string {
+	if len(value) >= 2 && strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+		return value[1 : len(value)-1]
+	}
+	return value
 }
 
 // Helper function to split parameters by comma, considering quoted parts
@@ -997,14 +1281,23 @@ func splitParams(paramsPart string) []string {
 	return result
 }
 
-// extractFunctionAndParams is a helper function to find matching parenthesis
+// findMatchingParenthesis is a helper function to find matching parenthesis
+// (parentheses in single-quoted parameters are ignored)
 func findMatchingParenthesis(command string, start int) int {
 	count := 1
+	inQuotes := false
 	for i := start; i < len(command); i++ {
 		switch command[i] {
+		case '\'':
+			inQuotes = !inQuotes
 		case '(':
-			count++
+			if !inQuotes {
+				count++
+			}
 		case ')':
+			if inQuotes {
+				continue
+			}
 			count--
 			if count == 0 {
 				return i
@@ -1014,15 +1307,16 @@ func findMatchingParenthesis(command string, start int) int {
 	return -1
 }
 
-// processCommand is function to replace the keywords with actual values
-func processCommand(command, nsId, mciId, vmId string, vmIndex int) (string, error) {
+// renderCommand is function to replace the $$Func(...) keywords with actual values for a VM
+func renderCommand(command string, funcCtx CommandFuncContext) (string, error) {
+	const funcKeyword = "$$Func("
 	start := 0
 	for {
-		start = strings.Index(command[start:], "$$Func(")
-		if start == -1 {
+		index := strings.Index(command[start:], funcKeyword)
+		if index == -1 {
 			break
 		}
-		start += 7 // Move past "$$Func("
+		start += index + len(funcKeyword) // Move past "$$Func("
 		end := findMatchingParenthesis(command, start)
 		if end == -1 {
 			return "", errors.New("Built-in function error in command: no matching parenthesis found")
@@ -1030,106 +1324,20 @@ func processCommand(command, nsId, mciId, vmId string, vmIndex int) (string, err
 
 		funcCall := command[start:end]
 
-		funcName, params, err := extractFunctionAndParams(funcCall)
+		funcName, params, args, err := extractFunctionAndParams(funcCall)
 		if err != nil {
 			return "", err
 		}
 
-		var replacement string
-		if strings.EqualFold(funcName, "GetPublicIP") {
-			targetMciId := mciId
-			targetVmId := vmId
-			if val, ok := params["target"]; ok {
-				parts := strings.Split(val, ".")
-				if len(parts) == 2 {
-					targetMciId = parts[0]
-					targetVmId = parts[1]
-				} else if strings.EqualFold(val, "this") {
-					targetMciId = mciId
-					targetVmId = vmId
-				}
-			}
-			prefix := ""
-			if pre, ok := params["prefix"]; ok {
-				prefix = pre
-			}
-			postfix := ""
-			if post, ok := params["postfix"]; ok {
-				postfix = post
-			}
-			replacement, err = getPublicIP(nsId, targetMciId, targetVmId, prefix, postfix)
-
-			if err != nil {
-				return "", fmt.Errorf("Built-in function getPublicIP error: %s", err.Error())
-			}
-
-		} else if strings.EqualFold(funcName, "GetPublicIPs") {
-			targetMciId := mciId
-
-			if val, ok := params["target"]; ok {
-				if strings.EqualFold(val, "this") {
-					targetMciId = mciId
-				} else {
-					targetMciId = val
-				}
-			}
-			separator := ","
-			if sep, ok := params["separator"]; ok {
-				separator = sep
-			}
-			prefix := ""
-			if pre, ok := params["prefix"]; ok {
-				prefix = pre
-			}
-			postfix := ""
-			if post, ok := params["postfix"]; ok {
-				postfix = post
-			}
-			replacement, err = getPublicIPs(nsId, targetMciId, separator, prefix, postfix)
-
-			if err != nil {
-				return "", fmt.Errorf("Built-in function getPublicIPs error: %s", err.Error())
-			}
-
-		} else if strings.EqualFold(funcName, "AssignTask") {
-			taskListParam, ok := params["task"]
-			if !ok {
-				return "", fmt.Errorf("Built-in function AssignTask error: no task list provided")
-			}
-			tasks := splitParams(taskListParam)
-			replacement = tasks[vmIndex%len(tasks)]
-		} else {
-			return "", fmt.Errorf("Built-in function error in command: Unknown function: %s", funcName)
+		replacement, err := callCommandFunc(funcCtx, funcName, params, args)
+		if err != nil {
+			return "", err
 		}
 
 		// Replace the entire $$Func(...) expression with the result
-		command = command[:start-7] + replacement + command[end+1:]
-		start = start - 7 + len(replacement) // Adjust start for the next iteration
+		command = command[:start-len(funcKeyword)] + replacement + command[end+1:]
+		start = start - len(funcKeyword) + len(replacement) // Adjust start for the next iteration
 	}
 
 	return command, nil
 }
-
-// Built-in functions for remote command
-// getPublicIP function to get and replace string with the public IP of the target
-func getPublicIP(nsId, mciId, vmId, prefix, postfix string) (string, error) {
-	vmStatus, err := GetVmCurrentPublicIp(nsId, mciId, vmId)
-	if err != nil {
-		return "", err
-	}
-	ip := vmStatus.PublicIp
-	return prefix + ip + postfix, err
-}
-
-// getPublicIP function to get and replace string with the public IP list of the target
-func getPublicIPs(nsId, mciId, separator, prefix, postfix string) (string, error) {
-	mciStatus, err := GetMciStatus(nsId, mciId)
-	if err != nil {
-		return "", err
-	}
-	ips := make([]string, len(mciStatus.Vm))
-	for i, vmStatus := range mciStatus.Vm {
-		ips[i] = prefix + vmStatus.PublicIp + postfix
-	}
-	return strings.Join(ips, separator), nil
-}
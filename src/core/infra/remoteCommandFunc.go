@@ -0,0 +1,444 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mci is to manage multi-cloud infra
+package infra
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/common/label"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+)
+
+// [Built-in functions for remote command]
+
+// CommandFuncContext is the context of the VM for which a remote command is rendered
+type CommandFuncContext struct {
+	NsId  string
+	MciId string
+	VmId  string
+	// VmIndex is the position of the VM among the targets of the command
+	VmIndex int
+	// DryRun is set when the command is only rendered (secrets are masked)
+	DryRun bool
+	// Secrets collects the secret values inserted in the command (optional, to mask them in records)
+	Secrets *[]string
+}
+
+// CommandFunc renders a $$Func(...) call into the string that replaces it.
+// params contains the declared parameters of the function (defaults applied).
+type CommandFunc func(funcCtx CommandFuncContext, params map[string]string) (string, error)
+
+type commandFuncEntry struct {
+	info model.RemoteCommandFuncInfo
+	fn   CommandFunc
+}
+
+var (
+	commandFuncsMutex sync.RWMutex
+	commandFuncs      = map[string]commandFuncEntry{}
+)
+
+var (
+	paramTargetVm = model.RemoteCommandFuncParam{Name: "target", Description: "target VM in the form of mciId.vmId or this", Default: "this"}
+	paramPrefix   = model.RemoteCommandFuncParam{Name: "prefix", Description: "string prepended to each value"}
+	paramPostfix  = model.RemoteCommandFuncParam{Name: "postfix", Description: "string appended to each value"}
+	paramSep      = model.RemoteCommandFuncParam{Name: "separator", Description: "separator between values", Default: ","}
+)
+
+func init() {
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetPublicIP",
+		Description: "Public IP of the target VM",
+		Params:      []model.RemoteCommandFuncParam{paramTargetVm, paramPrefix, paramPostfix},
+		Example:     "$$Func(GetPublicIP(target=this, prefix='http://', postfix=':8080'))",
+	}, cmdFuncGetPublicIP)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetPublicIPs",
+		Description: "Public IPs of all VMs in the target MCI",
+		Params: []model.RemoteCommandFuncParam{
+			{Name: "target", Description: "target MCI ID or this", Default: "this"},
+			paramSep, paramPrefix, paramPostfix,
+		},
+		Example: "$$Func(GetPublicIPs(separator=' '))",
+	}, cmdFuncGetPublicIPs)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetPrivateIP",
+		Description: "Private IP of the target VM",
+		Params:      []model.RemoteCommandFuncParam{paramTargetVm, paramPrefix, paramPostfix},
+		Example:     "$$Func(GetPrivateIP())",
+	}, cmdFuncGetPrivateIP)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetPrivateIPs",
+		Description: "Private IPs of VMs in the target MCI (optionally only in a subGroup)",
+		Params: []model.RemoteCommandFuncParam{
+			{Name: "target", Description: "target MCI ID or this", Default: "this"},
+			{Name: "subGroup", Description: "only VMs in this subGroup"},
+			paramSep, paramPrefix, paramPostfix,
+		},
+		Example: "$$Func(GetPrivateIPs(subGroup=g1, postfix=':2379'))",
+	}, cmdFuncGetPrivateIPs)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetVmId",
+		Description: "ID of the VM running the command",
+		Example:     "hostnamectl set-hostname $$Func(GetVmId())",
+	}, cmdFuncGetVmId)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetSubGroupId",
+		Description: "subGroup ID of the VM running the command",
+		Example:     "echo $$Func(GetSubGroupId())",
+	}, cmdFuncGetSubGroupId)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetVmIndex",
+		Description: "index of the VM running the command (index in its subGroup, or 0-based position among the command targets)",
+		Params: []model.RemoteCommandFuncParam{
+			{Name: "scope", Description: "subGroup or command", Default: "subGroup"},
+		},
+		Example: "echo node-$$Func(GetVmIndex())",
+	}, cmdFuncGetVmIndex)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetMciLabel",
+		Description: "value of a label of the MCI",
+		Params: []model.RemoteCommandFuncParam{
+			{Name: "key", Description: "label key", Required: true},
+			{Name: "default", Description: "value used if the label does not exist (error if not given)"},
+		},
+		Example: "echo $$Func(GetMciLabel(key=env, default=dev))",
+	}, cmdFuncGetMciLabel)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetNlbEndpoint",
+		Description: "listener endpoint (host:port) of an NLB of the MCI",
+		Params: []model.RemoteCommandFuncParam{
+			{Name: "nlb", Description: "NLB ID (the first NLB of the MCI if not given)"},
+			paramPrefix, paramPostfix,
+		},
+		Example: "curl $$Func(GetNlbEndpoint(prefix='http://'))",
+	}, cmdFuncGetNlbEndpoint)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "GetSecret",
+		Description: "value of a secret of the namespace",
+		Params: []model.RemoteCommandFuncParam{
+			{Name: "name", Description: "secret name", Required: true},
+		},
+		Example: "export DB_PASSWORD='$$Func(GetSecret(dbPassword))'",
+	}, cmdFuncGetSecret)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "AssignTask",
+		Description: "one task of the list assigned to the VM in round-robin",
+		Params: []model.RemoteCommandFuncParam{
+			{Name: "task", Description: "comma-separated task list", Required: true},
+		},
+		Example: "$$Func(AssignTask(task='sleep 1, sleep 2'))",
+	}, cmdFuncAssignTask)
+	RegisterCommandFunc(model.RemoteCommandFuncInfo{
+		Name:        "If",
+		Description: "then if the VM matches all given conditions, else otherwise (conditions take comma-separated values)",
+		Params: []model.RemoteCommandFuncParam{
+			{Name: "subGroup", Description: "condition on the subGroup ID of the VM"},
+			{Name: "vmId", Description: "condition on the ID of the VM"},
+			{Name: "then", Description: "command used if the conditions match", Required: true},
+			{Name: "else", Description: "command used otherwise"},
+		},
+		Example: "$$Func(If(subGroup='g1,g2', then='./start-master.sh', else='./start-worker.sh'))",
+	}, cmdFuncIf)
+}
+
+// RegisterCommandFunc registers (or replaces) a built-in function for remote commands.
+// Function names are case-insensitive.
+func RegisterCommandFunc(info model.RemoteCommandFuncInfo, fn CommandFunc) {
+	commandFuncsMutex.Lock()
+	defer commandFuncsMutex.Unlock()
+	commandFuncs[strings.ToLower(info.Name)] = commandFuncEntry{info: info, fn: fn}
+}
+
+// getCommandFunc returns the built-in function of the name
+func getCommandFunc(name string) (commandFuncEntry, bool) {
+	commandFuncsMutex.RLock()
+	defer commandFuncsMutex.RUnlock()
+	entry, ok := commandFuncs[strings.ToLower(name)]
+	return entry, ok
+}
+
+// ListCommandFunc returns the built-in functions for remote commands sorted by name
+func ListCommandFunc() model.RemoteCommandFuncList {
+	commandFuncsMutex.RLock()
+	defer commandFuncsMutex.RUnlock()
+	result := model.RemoteCommandFuncList{Functions: []model.RemoteCommandFuncInfo{}}
+	for _, entry := range commandFuncs {
+		result.Functions = append(result.Functions, entry.info)
+	}
+	sort.Slice(result.Functions, func(i, j int) bool {
+		return result.Functions[i].Name < result.Functions[j].Name
+	})
+	return result
+}
+
+// callCommandFunc binds named and positional arguments to the declared parameters and calls the function
+func callCommandFunc(funcCtx CommandFuncContext, funcName string, params map[string]string, args []string) (string, error) {
+	entry, ok := getCommandFunc(funcName)
+	if !ok {
+		return "", fmt.Errorf("Built-in function error in command: Unknown function: %s", funcName)
+	}
+	info := entry.info
+
+	bound := make(map[string]string)
+	for key, value := range params {
+		declared := ""
+		for _, p := range info.Params {
+			if strings.EqualFold(p.Name, key) {
+				declared = p.Name
+				break
+			}
+		}
+		if declared == "" {
+			return "", fmt.Errorf("Built-in function %s error: unknown parameter %s", info.Name, key)
+		}
+		bound[declared] = value
+	}
+	for i, arg := range args {
+		if i >= len(info.Params) {
+			return "", fmt.Errorf("Built-in function %s error: too many arguments", info.Name)
+		}
+		if _, dup := bound[info.Params[i].Name]; dup {
+			return "", fmt.Errorf("Built-in function %s error: parameter %s is given twice", info.Name, info.Params[i].Name)
+		}
+		bound[info.Params[i].Name] = arg
+	}
+	for _, p := range info.Params {
+		if _, ok := bound[p.Name]; ok {
+			continue
+		}
+		if p.Required {
+			return "", fmt.Errorf("Built-in function %s error: parameter %s is required", info.Name, p.Name)
+		}
+		if p.Default != "" {
+			bound[p.Name] = p.Default
+		}
+	}
+
+	result, err := entry.fn(funcCtx, bound)
+	if err != nil {
+		return "", fmt.Errorf("Built-in function %s error: %s", info.Name, err.Error())
+	}
+	return result, nil
+}
+
+// secretMask replaces secret values in rendered commands that are returned or recorded
+const secretMask = "********"
+
+// maskSecrets replaces the secret values in s with secretMask
+func maskSecrets(s string, secrets []string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, secretMask)
+		}
+	}
+	return s
+}
+
+// resolveTargetVm returns the MCI and VM addressed by a target param (mciId.vmId or this)
+func resolveTargetVm(funcCtx CommandFuncContext, target string) (string, string) {
+	parts := strings.Split(target, ".")
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return funcCtx.MciId, funcCtx.VmId
+}
+
+// resolveTargetMci returns the MCI addressed by a target param (mciId or this)
+func resolveTargetMci(funcCtx CommandFuncContext, target string) string {
+	if target == "" || strings.EqualFold(target, "this") {
+		return funcCtx.MciId
+	}
+	return target
+}
+
+func cmdFuncGetPublicIP(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	mciId, vmId := resolveTargetVm(funcCtx, params["target"])
+	vmStatus, err := GetVmCurrentPublicIp(funcCtx.NsId, mciId, vmId)
+	if err != nil {
+		return "", err
+	}
+	return params["prefix"] + vmStatus.PublicIp + params["postfix"], nil
+}
+
+func cmdFuncGetPublicIPs(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	mciStatus, err := GetMciStatus(funcCtx.NsId, resolveTargetMci(funcCtx, params["target"]))
+	if err != nil {
+		return "", err
+	}
+	ips := make([]string, len(mciStatus.Vm))
+	for i, vmStatus := range mciStatus.Vm {
+		ips[i] = params["prefix"] + vmStatus.PublicIp + params["postfix"]
+	}
+	return strings.Join(ips, params["separator"]), nil
+}
+
+func cmdFuncGetPrivateIP(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	mciId, vmId := resolveTargetVm(funcCtx, params["target"])
+	vm, err := GetVmObject(funcCtx.NsId, mciId, vmId)
+	if err != nil {
+		return "", err
+	}
+	return params["prefix"] + vm.PrivateIP + params["postfix"], nil
+}
+
+func cmdFuncGetPrivateIPs(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	mci, err := GetMciObject(funcCtx.NsId, resolveTargetMci(funcCtx, params["target"]))
+	if err != nil {
+		return "", err
+	}
+	ips := []string{}
+	for _, vm := range mci.Vm {
+		if params["subGroup"] != "" && vm.SubGroupId != params["subGroup"] {
+			continue
+		}
+		ips = append(ips, params["prefix"]+vm.PrivateIP+params["postfix"])
+	}
+	return strings.Join(ips, params["separator"]), nil
+}
+
+func cmdFuncGetVmId(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	return funcCtx.VmId, nil
+}
+
+func cmdFuncGetSubGroupId(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	vm, err := GetVmObject(funcCtx.NsId, funcCtx.MciId, funcCtx.VmId)
+	if err != nil {
+		return "", err
+	}
+	return vm.SubGroupId, nil
+}
+
+func cmdFuncGetVmIndex(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	switch strings.ToLower(params["scope"]) {
+	case "subgroup":
+		return strconv.Itoa(vmIndexInSubGroup(funcCtx.VmId)), nil
+	case "command":
+		return strconv.Itoa(funcCtx.VmIndex), nil
+	default:
+		return "", fmt.Errorf("unknown scope %s (subGroup or command)", params["scope"])
+	}
+}
+
+func cmdFuncGetMciLabel(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	mci, err := GetMciObject(funcCtx.NsId, funcCtx.MciId)
+	if err != nil {
+		return "", err
+	}
+	labelInfo, err := label.GetLabels(model.StrMCI, mci.Uid)
+	if err != nil {
+		return "", err
+	}
+	if value, ok := labelInfo.Labels[params["key"]]; ok {
+		return value, nil
+	}
+	if value, ok := params["default"]; ok {
+		return value, nil
+	}
+	return "", fmt.Errorf("the MCI %s has no label %s", funcCtx.MciId, params["key"])
+}
+
+func cmdFuncGetNlbEndpoint(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	nlbId := params["nlb"]
+	if nlbId == "" {
+		nlbList, err := ListNLBId(funcCtx.NsId, funcCtx.MciId)
+		if err != nil {
+			return "", err
+		}
+		if len(nlbList) == 0 {
+			return "", fmt.Errorf("the MCI %s has no NLB", funcCtx.MciId)
+		}
+		sort.Strings(nlbList)
+		nlbId = nlbList[0]
+	}
+	nlb, err := GetNLB(funcCtx.NsId, funcCtx.MciId, nlbId)
+	if err != nil {
+		return "", err
+	}
+	host := nlb.Listener.DNSName
+	if host == "" {
+		host = nlb.Listener.IP
+	}
+	if host == "" {
+		return "", fmt.Errorf("the NLB %s has no listener address yet", nlbId)
+	}
+	return params["prefix"] + net.JoinHostPort(host, nlb.Listener.Port) + params["postfix"], nil
+}
+
+func cmdFuncGetSecret(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	value, err := common.GetSecretValue(funcCtx.NsId, params["name"])
+	if err != nil {
+		return "", err
+	}
+	if funcCtx.DryRun {
+		return secretMask, nil
+	}
+	if funcCtx.Secrets != nil {
+		*funcCtx.Secrets = append(*funcCtx.Secrets, value)
+	}
+	return value, nil
+}
+
+func cmdFuncAssignTask(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	tasks := splitParams(params["task"])
+	if len(tasks) == 0 {
+		return "", fmt.Errorf("no task list provided")
+	}
+	return strings.TrimSpace(tasks[funcCtx.VmIndex%len(tasks)]), nil
+}
+
+func cmdFuncIf(funcCtx CommandFuncContext, params map[string]string) (string, error) {
+	conditions := map[string]func() (string, error){
+		"subGroup": func() (string, error) { return cmdFuncGetSubGroupId(funcCtx, nil) },
+		"vmId":     func() (string, error) { return funcCtx.VmId, nil },
+	}
+	matched := true
+	hasCondition := false
+	for key, actualValue := range conditions {
+		expected, ok := params[key]
+		if !ok {
+			continue
+		}
+		hasCondition = true
+		actual, err := actualValue()
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, v := range strings.Split(expected, ",") {
+			if strings.TrimSpace(v) == actual {
+				found = true
+				break
+			}
+		}
+		matched = matched && found
+	}
+	if !hasCondition {
+		return "", fmt.Errorf("no condition provided (subGroup or vmId)")
+	}
+
+	branch := params["else"]
+	if matched {
+		branch = params["then"]
+	}
+	// the chosen branch may contain built-in functions as well
+	return renderCommand(branch, funcCtx)
+}
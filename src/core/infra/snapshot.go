@@ -22,7 +22,6 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 )
 
@@ -56,7 +55,7 @@ func CreateVmSnapshot(nsId string, mciId string, vmId string, snapshotName strin
 		},
 	}
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	req := client.R().
@@ -0,0 +1,275 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mci is to manage multi-cloud infra
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// [SSH host key verification (trust-on-first-use)]
+
+// ErrSshHostKeyMismatch is returned when a VM presents a host key different from the pinned one
+var ErrSshHostKeyMismatch = errors.New("SSH host key mismatch")
+
+// hostKeyVerifier verifies the host key of a VM against the key pinned in the VM object.
+// If no key is pinned yet, the presented key is pinned once the connection succeeds.
+type hostKeyVerifier struct {
+	nsId  string
+	mciId string
+	vmId  string
+
+	pinned  ssh.PublicKey
+	loadErr error
+
+	// presented is the key accepted on first use (pinned by commit)
+	presented ssh.PublicKey
+}
+
+// newHostKeyVerifier loads the pinned host key of the VM in the SSH info
+func newHostKeyVerifier(info model.SshInfo) *hostKeyVerifier {
+	v := &hostKeyVerifier{nsId: info.NsId, mciId: info.MciId, vmId: info.VmId}
+	if info.VmId == "" {
+		v.loadErr = fmt.Errorf("no VM is given to verify the SSH host key of %s", info.EndPoint)
+		return v
+	}
+	vm, err := GetVmObject(info.NsId, info.MciId, info.VmId)
+	if err != nil {
+		v.loadErr = err
+		return v
+	}
+	if vm.SshHostKeyInfo != nil && vm.SshHostKeyInfo.HostKey != "" {
+		v.pinned, err = parseSshHostKey(vm.SshHostKeyInfo.HostKey)
+		if err != nil {
+			v.loadErr = fmt.Errorf("the pinned SSH host key of VM %s is invalid: %w", info.VmId, err)
+		}
+	}
+	return v
+}
+
+// hostKeyAlgorithms returns the host key algorithms to negotiate (the pinned key type if a key is pinned)
+func (v *hostKeyVerifier) hostKeyAlgorithms() []string {
+	if v.pinned == nil {
+		return nil
+	}
+	if v.pinned.Type() == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{v.pinned.Type()}
+}
+
+// callback is the ssh.HostKeyCallback of the verifier
+func (v *hostKeyVerifier) callback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	if v.loadErr != nil {
+		return v.loadErr
+	}
+	if v.pinned == nil {
+		v.presented = key
+		return nil
+	}
+	if bytes.Equal(v.pinned.Marshal(), key.Marshal()) {
+		return nil
+	}
+
+	log.Error().Msgf("[SSH] host key of VM %s (MCI: %s, NS: %s, %s) has changed: pinned %s, presented %s. "+
+		"Rotate or reset the pinned key if the change is expected.",
+		v.vmId, v.mciId, v.nsId, hostname, ssh.FingerprintSHA256(v.pinned), ssh.FingerprintSHA256(key))
+	if err := recordRejectedSshHostKey(v.nsId, v.mciId, v.vmId, key); err != nil {
+		log.Error().Err(err).Msg("failed to record the rejected SSH host key")
+	}
+	return fmt.Errorf("%w: VM %s presented %s but %s is pinned",
+		ErrSshHostKeyMismatch, v.vmId, ssh.FingerprintSHA256(key), ssh.FingerprintSHA256(v.pinned))
+}
+
+// clientConfig returns the SSH client config for the user and signer verified by this verifier
+func (v *hostKeyVerifier) clientConfig(userName string, signer ssh.Signer) *ssh.ClientConfig {
+	return &ssh.ClientConfig{
+		User: userName,
+		Auth: []ssh.AuthMethod{
+			ssh.PublicKeys(signer),
+		},
+		HostKeyCallback:   v.callback,
+		HostKeyAlgorithms: v.hostKeyAlgorithms(),
+	}
+}
+
+// commit pins the host key accepted on first use (called after the connection succeeded)
+func (v *hostKeyVerifier) commit() {
+	if v.presented == nil {
+		return
+	}
+	pinned, err := pinSshHostKey(v.nsId, v.mciId, v.vmId, v.presented, false)
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to pin the SSH host key of VM %s", v.vmId)
+		return
+	}
+	if pinned.HostKey == marshalSshHostKey(v.presented) {
+		log.Info().Msgf("[SSH] pinned host key %s of VM %s (MCI: %s, NS: %s) on first use",
+			pinned.Fingerprint, v.vmId, v.mciId, v.nsId)
+	} else {
+		// another connection pinned a different key in the meantime
+		log.Warn().Msgf("[SSH] VM %s presented %s on first use, but %s was pinned concurrently",
+			v.vmId, ssh.FingerprintSHA256(v.presented), pinned.Fingerprint)
+	}
+	v.presented = nil
+}
+
+// parseSshHostKey parses a host key in authorized_keys format
+func parseSshHostKey(hostKey string) (ssh.PublicKey, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(strings.TrimSpace(hostKey)))
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// marshalSshHostKey formats a host key in authorized_keys format (without newline)
+func marshalSshHostKey(key ssh.PublicKey) string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+}
+
+// updateVmSshHostKeyInfo updates the SshHostKeyInfo of the VM object with the update function
+func updateVmSshHostKeyInfo(nsId string, mciId string, vmId string, update func(info *model.SshHostKeyInfo) error) (model.SshHostKeyInfo, error) {
+	key := common.GenMciKey(nsId, mciId, vmId)
+	result := model.SshHostKeyInfo{}
+	err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if current[key].Value == "" {
+			return nil, fmt.Errorf("failed to get the VM object (ID: %s)", key)
+		}
+		vm := model.TbVmInfo{}
+		if err := json.Unmarshal([]byte(current[key].Value), &vm); err != nil {
+			return nil, err
+		}
+		info := model.SshHostKeyInfo{}
+		if vm.SshHostKeyInfo != nil {
+			info = *vm.SshHostKeyInfo
+		}
+		if err := update(&info); err != nil {
+			return nil, err
+		}
+		result = info
+		if info == (model.SshHostKeyInfo{}) {
+			vm.SshHostKeyInfo = nil
+		} else {
+			vm.SshHostKeyInfo = &info
+		}
+		val, err := json.Marshal(vm)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+	return result, err
+}
+
+// pinSshHostKey pins the host key of the VM. Unless replace is set, an already pinned key is kept.
+func pinSshHostKey(nsId string, mciId string, vmId string, hostKey ssh.PublicKey, replace bool) (model.SshHostKeyInfo, error) {
+	return updateVmSshHostKeyInfo(nsId, mciId, vmId, func(info *model.SshHostKeyInfo) error {
+		if info.HostKey != "" && !replace {
+			return nil
+		}
+		*info = model.SshHostKeyInfo{
+			HostKey:     marshalSshHostKey(hostKey),
+			KeyType:     hostKey.Type(),
+			Fingerprint: ssh.FingerprintSHA256(hostKey),
+			PinnedAt:    time.Now().UTC().Format(time.RFC3339),
+		}
+		return nil
+	})
+}
+
+// recordRejectedSshHostKey records the host key presented by the VM that did not match the pinned key
+func recordRejectedSshHostKey(nsId string, mciId string, vmId string, hostKey ssh.PublicKey) error {
+	_, err := updateVmSshHostKeyInfo(nsId, mciId, vmId, func(info *model.SshHostKeyInfo) error {
+		info.RejectedHostKey = marshalSshHostKey(hostKey)
+		info.RejectedFingerprint = ssh.FingerprintSHA256(hostKey)
+		info.RejectedAt = time.Now().UTC().Format(time.RFC3339)
+		return nil
+	})
+	return err
+}
+
+// GetVmSshHostKey is func to get the pinned SSH host key of a VM
+func GetVmSshHostKey(nsId string, mciId string, vmId string) (model.SshHostKeyInfo, error) {
+	vm, err := GetVmObject(nsId, mciId, vmId)
+	if err != nil {
+		return model.SshHostKeyInfo{}, err
+	}
+	if vm.SshHostKeyInfo == nil {
+		return model.SshHostKeyInfo{}, nil
+	}
+	return *vm.SshHostKeyInfo, nil
+}
+
+// RotateVmSshHostKey is func to replace the pinned SSH host key of a VM
+// with the given key or with the last rejected key
+func RotateVmSshHostKey(nsId string, mciId string, vmId string, req *model.SshHostKeyReq) (model.SshHostKeyInfo, error) {
+	hostKeyStr := req.HostKey
+	if req.AcceptRejected {
+		if hostKeyStr != "" {
+			return model.SshHostKeyInfo{}, fmt.Errorf("hostKey and acceptRejected cannot be used together")
+		}
+		current, err := GetVmSshHostKey(nsId, mciId, vmId)
+		if err != nil {
+			return model.SshHostKeyInfo{}, err
+		}
+		if current.RejectedHostKey == "" {
+			return model.SshHostKeyInfo{}, fmt.Errorf("no rejected SSH host key is recorded for VM %s", vmId)
+		}
+		hostKeyStr = current.RejectedHostKey
+	}
+	if hostKeyStr == "" {
+		return model.SshHostKeyInfo{}, fmt.Errorf("hostKey is required unless acceptRejected is set")
+	}
+	hostKey, err := parseSshHostKey(hostKeyStr)
+	if err != nil {
+		return model.SshHostKeyInfo{}, fmt.Errorf("invalid SSH host key: %w", err)
+	}
+
+	info, err := pinSshHostKey(nsId, mciId, vmId, hostKey, true)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.SshHostKeyInfo{}, err
+	}
+	log.Warn().Msgf("[SSH] pinned host key of VM %s (MCI: %s, NS: %s) is rotated to %s", vmId, mciId, nsId, info.Fingerprint)
+	return info, nil
+}
+
+// ResetVmSshHostKey is func to remove the pinned SSH host key of a VM
+// (the key presented on the next connection is pinned again)
+func ResetVmSshHostKey(nsId string, mciId string, vmId string) error {
+	_, err := updateVmSshHostKeyInfo(nsId, mciId, vmId, func(info *model.SshHostKeyInfo) error {
+		*info = model.SshHostKeyInfo{}
+		return nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return err
+	}
+	log.Warn().Msgf("[SSH] pinned host key of VM %s (MCI: %s, NS: %s) is reset", vmId, mciId, nsId)
+	return nil
+}
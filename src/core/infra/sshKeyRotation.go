@@ -0,0 +1,379 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mci is to manage multi-cloud infra
+package infra
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/core/resource"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// [SSH key rotation of VMs in an MCI]
+
+const (
+	// sshKeyRotationBits is the size of RSA keys generated for rotation
+	sshKeyRotationBits = 4096
+	// sshKeyRotationCmdTimeout is the timeout of each command to install, verify or remove a key in a VM
+	sshKeyRotationCmdTimeout = 60 * time.Second
+	// sshKeyRotationComment is the comment of the new key in authorized_keys
+	sshKeyRotationComment = "cb-tumblebug"
+)
+
+// sshKeyPair is a key pair for SSH
+type sshKeyPair struct {
+	privateKey []byte
+	// authorizedKey is the public key in authorized_keys format (without comment)
+	authorizedKey string
+	fingerprint   string
+}
+
+// blob returns the base64 part of the public key, which identifies the key in authorized_keys
+func (k sshKeyPair) blob() string {
+	fields := strings.Fields(k.authorizedKey)
+	if len(fields) < 2 {
+		return ""
+	}
+	return fields[1]
+}
+
+// newSshKeyPair returns the key pair of the request (a new RSA key pair if no private key is given)
+func newSshKeyPair(req *model.TbSshKeyRotationReq) (sshKeyPair, error) {
+	if req.PrivateKey == "" {
+		if req.PublicKey != "" {
+			return sshKeyPair{}, fmt.Errorf("privateKey is required with publicKey (to verify login with the new key)")
+		}
+		key, err := rsa.GenerateKey(rand.Reader, sshKeyRotationBits)
+		if err != nil {
+			return sshKeyPair{}, err
+		}
+		privateKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		return parseSshKeyPair(privateKey)
+	}
+
+	pair, err := parseSshKeyPair([]byte(req.PrivateKey))
+	if err != nil {
+		return sshKeyPair{}, err
+	}
+	if req.PublicKey != "" {
+		publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
+		if err != nil {
+			return sshKeyPair{}, fmt.Errorf("invalid publicKey: %w", err)
+		}
+		if strings.TrimSpace(string(ssh.MarshalAuthorizedKey(publicKey))) != pair.authorizedKey {
+			return sshKeyPair{}, fmt.Errorf("publicKey does not match privateKey")
+		}
+	}
+	return pair, nil
+}
+
+// parseSshKeyPair returns the key pair of the private key in PEM
+func parseSshKeyPair(privateKey []byte) (sshKeyPair, error) {
+	signer, err := ssh.ParsePrivateKey(privateKey)
+	if err != nil {
+		return sshKeyPair{}, fmt.Errorf("invalid privateKey: %w", err)
+	}
+	return sshKeyPair{
+		privateKey:    privateKey,
+		authorizedKey: strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))),
+		fingerprint:   ssh.FingerprintSHA256(signer.PublicKey()),
+	}, nil
+}
+
+// installSshKeyCmd returns the command to add the public key to authorized_keys (if not added yet)
+func installSshKeyCmd(pair sshKeyPair) string {
+	return fmt.Sprintf("mkdir -p ~/.ssh && chmod 700 ~/.ssh && touch ~/.ssh/authorized_keys && chmod 600 ~/.ssh/authorized_keys && "+
+		"(grep -qF '%s' ~/.ssh/authorized_keys || echo '%s %s' >> ~/.ssh/authorized_keys)",
+		pair.blob(), pair.authorizedKey, sshKeyRotationComment)
+}
+
+// removeSshKeyCmd returns the command to remove the public key from authorized_keys
+// (the file is rewritten in place to keep its owner and permissions)
+func removeSshKeyCmd(blob string) string {
+	return fmt.Sprintf("f=~/.ssh/authorized_keys; if [ -f \"$f\" ]; then grep -vF '%s' \"$f\" > \"$f.tb\"; cat \"$f.tb\" > \"$f\" && rm -f \"$f.tb\"; fi; "+
+		"! grep -qF '%s' \"$f\" 2>/dev/null", blob, blob)
+}
+
+// runSshKeyCmd runs a command in the VM with the private key (or the key of the sshKey of the VM if nil)
+func runSshKeyCmd(nsId string, mciId string, vmId string, cmd string, privateKey []byte) error {
+	_, stderr, exitCodes, err := runRemoteCommand(context.Background(), nsId, mciId, vmId, "", []string{cmd},
+		sshRunOptions{Timeout: sshKeyRotationCmdTimeout, TargetPrivateKey: privateKey})
+	if err != nil {
+		return err
+	}
+	if exitCodes[0] != 0 {
+		return fmt.Errorf("exit code %d: %s", exitCodes[0], strings.TrimSpace(stderr[0]))
+	}
+	return nil
+}
+
+// sshKeyRotationTarget is a VM to rotate the key and its progress
+type sshKeyRotationTarget struct {
+	result  *model.TbSshKeyRotationVmResult
+	oldBlob string
+	// installed is set when the new key is added to the VM, verified when login with the new key succeeded
+	installed bool
+	verified  bool
+}
+
+// forEachSshKeyTarget calls fn for the targets in parallel
+func forEachSshKeyTarget(targets []*sshKeyRotationTarget, fn func(t *sshKeyRotationTarget)) {
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t *sshKeyRotationTarget) {
+			defer wg.Done()
+			fn(t)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// RotateMciSshKey is func to roll the SSH key of the VMs in an MCI (or its subGroup) to a new key pair.
+// The new public key is installed in each VM with the current key and login with the new key is verified.
+// Then the VM is switched to a new sshKey object for the key pair, and the old public key is removed from the VM.
+// If the new key cannot be verified in a VM, the new public key is removed and the VM keeps the current key.
+func RotateMciSshKey(nsId string, mciId string, subGroupId string, req *model.TbSshKeyRotationReq) (model.TbSshKeyRotationResult, error) {
+	result := model.TbSshKeyRotationResult{MciId: mciId, SubGroupId: subGroupId, NewSshKeyIds: []string{}, Results: []model.TbSshKeyRotationVmResult{}}
+
+	err := common.CheckString(nsId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	err = common.CheckString(mciId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+
+	vmList, err := getRemoteCommandTargetVms(nsId, mciId, subGroupId, "")
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	if len(vmList) == 0 {
+		return result, fmt.Errorf("no VM in the MCI %s to rotate the SSH key", mciId)
+	}
+
+	pair, err := newSshKeyPair(req)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return result, err
+	}
+	result.Fingerprint = pair.fingerprint
+
+	// the current sshKey of each VM (the old public key is removed after the rotation)
+	oldKeys := map[string]model.TbSshKeyInfo{}
+	oldBlobs := map[string]string{}
+	results := make([]model.TbSshKeyRotationVmResult, len(vmList))
+	targets := []*sshKeyRotationTarget{}
+	for i, vmId := range vmList {
+		results[i] = model.TbSshKeyRotationVmResult{VmId: vmId, Status: model.SshKeyRotationFailed}
+		vm, err := GetVmObject(nsId, mciId, vmId)
+		if err != nil {
+			results[i].Message = err.Error()
+			continue
+		}
+		results[i].OldSshKeyId = vm.SshKeyId
+		if vm.Status != model.StatusRunning {
+			results[i].Status = model.SshKeyRotationSkipped
+			results[i].Message = fmt.Sprintf("the VM is not running (%s)", vm.Status)
+			continue
+		}
+
+		if _, ok := oldKeys[vm.SshKeyId]; !ok {
+			obj, err := resource.GetResource(nsId, model.StrSSHKey, vm.SshKeyId)
+			if err != nil {
+				results[i].Message = err.Error()
+				continue
+			}
+			oldKey := obj.(model.TbSshKeyInfo)
+			oldPair, err := parseSshKeyPair([]byte(oldKey.PrivateKey))
+			if err != nil {
+				results[i].Message = fmt.Sprintf("the sshKey %s: %s", vm.SshKeyId, err.Error())
+				continue
+			}
+			oldKeys[vm.SshKeyId] = oldKey
+			oldBlobs[vm.SshKeyId] = oldPair.blob()
+		}
+		if oldBlobs[vm.SshKeyId] == pair.blob() {
+			results[i].Message = "the new key is the same as the current key"
+			continue
+		}
+		targets = append(targets, &sshKeyRotationTarget{result: &results[i], oldBlob: oldBlobs[vm.SshKeyId]})
+	}
+
+	// install the new public key with the current key
+	forEachSshKeyTarget(targets, func(t *sshKeyRotationTarget) {
+		err := runSshKeyCmd(nsId, mciId, t.result.VmId, installSshKeyCmd(pair), nil)
+		if err != nil {
+			t.result.Message = "failed to install the new key: " + err.Error()
+			return
+		}
+		t.installed = true
+	})
+
+	// verify login with the new key, and roll back the VMs where it failed (before any VM is switched,
+	// so that bastion VMs are still reachable with their current keys)
+	forEachSshKeyTarget(targets, func(t *sshKeyRotationTarget) {
+		if !t.installed {
+			return
+		}
+		err := runSshKeyCmd(nsId, mciId, t.result.VmId, "true", pair.privateKey)
+		if err == nil {
+			t.verified = true
+			return
+		}
+		rollbackSshKey(nsId, mciId, t, pair, "failed to log in with the new key: "+err.Error())
+	})
+
+	// create a new sshKey object for each old sshKey, and switch the verified VMs to it
+	suffix := fmt.Sprintf("-rot%d", time.Now().Unix())
+	newKeyIds := map[string]string{}
+	for _, t := range targets {
+		if !t.verified {
+			continue
+		}
+		oldKeyId := t.result.OldSshKeyId
+		newKeyId, ok := newKeyIds[oldKeyId]
+		if !ok {
+			base := oldKeys[oldKeyId]
+			newKeyId = resource.GetOriginalSshKeyId(base) + suffix
+			for n := 2; containsString(result.NewSshKeyIds, newKeyId); n++ {
+				newKeyId = fmt.Sprintf("%s%s-%d", resource.GetOriginalSshKeyId(base), suffix, n)
+			}
+			_, err := resource.CreateRotatedSshKey(nsId, newKeyId, base, pair.authorizedKey, string(pair.privateKey), pair.fingerprint, req.Description)
+			if err != nil {
+				newKeyId = ""
+			} else {
+				result.NewSshKeyIds = append(result.NewSshKeyIds, newKeyId)
+			}
+			newKeyIds[oldKeyId] = newKeyId
+		}
+		if newKeyId == "" {
+			rollbackSshKey(nsId, mciId, t, pair, "failed to create the sshKey for the new key")
+			continue
+		}
+		err := switchVmSshKey(nsId, mciId, t.result.VmId, oldKeyId, newKeyId)
+		if err != nil {
+			rollbackSshKey(nsId, mciId, t, pair, "failed to update the VM: "+err.Error())
+			continue
+		}
+		t.result.NewSshKeyId = newKeyId
+		t.result.Status = model.SshKeyRotationRotated
+	}
+
+	// remove the old public key with the new key (bastion VMs are reached with their keys after the switch)
+	forEachSshKeyTarget(targets, func(t *sshKeyRotationTarget) {
+		if t.result.Status != model.SshKeyRotationRotated {
+			return
+		}
+		err := runSshKeyCmd(nsId, mciId, t.result.VmId, removeSshKeyCmd(t.oldBlob), nil)
+		if err != nil {
+			t.result.Message = "the old key is not removed from the VM: " + err.Error()
+			log.Warn().Err(err).Msgf("failed to remove the old key from the VM %s", t.result.VmId)
+		}
+	})
+
+	result.Results = results
+	for _, r := range results {
+		log.Info().Msgf("[SSH key rotation] %s/%s/%s: %s %s", nsId, mciId, r.VmId, r.Status, r.Message)
+	}
+	return result, nil
+}
+
+// rollbackSshKey removes the new public key from the VM (with the current key of the VM)
+func rollbackSshKey(nsId string, mciId string, t *sshKeyRotationTarget, pair sshKeyPair, reason string) {
+	t.result.Message = reason
+	err := runSshKeyCmd(nsId, mciId, t.result.VmId, removeSshKeyCmd(pair.blob()), nil)
+	if err != nil {
+		t.result.Status = model.SshKeyRotationFailed
+		t.result.Message = reason + " (and failed to remove the new key: " + err.Error() + ")"
+		log.Error().Err(err).Msgf("failed to roll back the new key in the VM %s", t.result.VmId)
+		return
+	}
+	t.result.Status = model.SshKeyRotationRolledBack
+}
+
+// switchVmSshKey sets the sshKey of the VM and moves the VM from associatedObjectList of the old sshKey to the new one in a transaction
+func switchVmSshKey(nsId string, mciId string, vmId string, oldKeyId string, newKeyId string) error {
+	vmKey := common.GenMciKey(nsId, mciId, vmId)
+	oldKey := common.GenResourceKey(nsId, model.StrSSHKey, oldKeyId)
+	newKey := common.GenResourceKey(nsId, model.StrSSHKey, newKeyId)
+
+	return kvstore.ReadModifyWrite(context.Background(), []string{vmKey, oldKey, newKey}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[vmKey].Exists() {
+			return nil, fmt.Errorf("the VM %s does not exist", vmId)
+		}
+		// the VM object is updated as it is (its encrypted fields are kept)
+		vm := map[string]json.RawMessage{}
+		if err := json.Unmarshal([]byte(current[vmKey].Value), &vm); err != nil {
+			return nil, err
+		}
+		var currentKeyId string
+		json.Unmarshal(vm["sshKeyId"], &currentKeyId)
+		if currentKeyId != oldKeyId {
+			return nil, fmt.Errorf("the sshKey of the VM has been changed to %s", currentKeyId)
+		}
+		vm["sshKeyId"], _ = json.Marshal(newKeyId)
+		val, err := json.Marshal(vm)
+		if err != nil {
+			return nil, err
+		}
+
+		ops := []kvstore.Op{kvstore.OpPut(vmKey, string(val))}
+		ops = append(ops, vmAssociationOps(current, []string{oldKey}, model.StrDelete, vmKey)...)
+		ops = append(ops, vmAssociationOps(current, []string{newKey}, model.StrAdd, vmKey)...)
+		return ops, nil
+	})
+}
+
+// containsString returns whether the list has the string
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sshKeyForNewVm returns the sshKey to create a VM with, in place of the given sshKey.
+// A rotated sshKey is replaced with its original sshKey, since CSPs give VMs the key pair of the original.
+func sshKeyForNewVm(nsId string, sshKeyId string) string {
+	obj, err := resource.GetResource(nsId, model.StrSSHKey, sshKeyId)
+	if err != nil {
+		return sshKeyId
+	}
+	sshKey, ok := obj.(model.TbSshKeyInfo)
+	if !ok {
+		return sshKeyId
+	}
+	return resource.GetOriginalSshKeyId(sshKey)
+}
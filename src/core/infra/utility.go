@@ -15,6 +15,7 @@ limitations under the License.
 package infra
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"strconv"
@@ -26,8 +27,6 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
 	"github.com/rs/zerolog/log"
 
-	"github.com/go-resty/resty/v2"
-
 	"math"
 	"reflect"
 	"sync"
@@ -450,7 +449,7 @@ func InspectResources(connConfig string, resourceType string) (model.InspectReso
 		}
 	}
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	// Create Req body
@@ -587,7 +586,6 @@ func InspectResourcesOverview() (model.InspectResourceAllResult, error) {
 		go func(k model.ConnConfig) {
 			defer wait.Done()
 
-			common.RandomSleep(0, 60)
 			temp := model.InspectResourceResult{}
 			temp.ConnectionName = k.ConfigName
 			startTimeForConnection := time.Now()
@@ -726,22 +724,8 @@ func RegisterCspNativeResourcesAll(nsId string, mciId string, option string, mci
 			defer wait.Done()
 
 			mciNameForRegister := mciId + "-" + k.ConfigName
-			// Assign RandomSleep range by clouds
-			// This code is temporal, CB-Spider needs to be enhnaced for locking mechanism.
-			// CB-SP v0.5.9 will not help with rate limit issue.
-			if option != "onlyVm" {
-				if strings.Contains(k.ConfigName, "alibaba") {
-					common.RandomSleep(100, 200)
-				} else if strings.Contains(k.ConfigName, "aws") {
-					common.RandomSleep(300, 500)
-				} else if strings.Contains(k.ConfigName, "gcp") {
-					common.RandomSleep(700, 900)
-				} else {
-				}
-			}
-
-			common.RandomSleep(0, 50)
 
+			// requests to CB-Spider are rate-limited per connection and provider (cloud_conf.yaml)
 			registerResult, err := RegisterCspNativeResources(nsId, k.ConfigName, mciNameForRegister, option, mciFlag)
 			if err != nil {
 				log.Error().Err(err).Msg("")
@@ -991,7 +975,7 @@ func RegisterCspNativeResources(nsId string, connConfig string, mciId string, op
 
 			req.Vm = append(req.Vm, vm)
 
-			_, err = CreateMci(nsId, &req, optionFlag)
+			_, err = CreateMci(context.Background(), nsId, &req, optionFlag)
 
 			registeredStatus = ""
 			if err != nil {
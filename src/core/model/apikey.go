@@ -0,0 +1,65 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+import "time"
+
+// ApiKeyPrefix is the prefix of API keys issued by CB-Tumblebug (tbk_<keyId>_<secret>)
+const ApiKeyPrefix string = "tbk_"
+
+// ApiKeyReq is struct for the request to create an API key (for TB_AUTH_MODE=local)
+type ApiKeyReq struct {
+	Name        string `json:"name" validate:"required" example:"ci-pipeline"`
+	Description string `json:"description,omitempty" example:"API key for the CI pipeline"`
+	// Role is the role of the caller with the API key (see conf/authz.yaml)
+	Role string `json:"role" validate:"required" enums:"maintainer,admin,user,guest" example:"user"`
+	// Namespaces is the roles granted per namespace (e.g., {"ns01": "owner"})
+	Namespaces map[string]string `json:"namespaces,omitempty"`
+	// ExpiresInHours is the validity of the API key in hours (0: no expiry)
+	ExpiresInHours int `json:"expiresInHours,omitempty" example:"720"`
+}
+
+// ApiKeyInfo is struct for an API key (the key itself is not kept; only its hash is stored in the kvstore)
+type ApiKeyInfo struct {
+	Id          string            `json:"id" example:"3f9a0c1d2b4e6f70"`
+	Name        string            `json:"name" example:"ci-pipeline"`
+	Description string            `json:"description,omitempty"`
+	Role        string            `json:"role" example:"user"`
+	Namespaces  map[string]string `json:"namespaces,omitempty"`
+	CreatedBy   string            `json:"createdBy,omitempty"`
+	CreatedTime time.Time         `json:"createdTime"`
+	// ExpireTime is empty if the API key does not expire
+	ExpireTime  *time.Time `json:"expireTime,omitempty"`
+	Revoked     bool       `json:"revoked"`
+	RevokedTime *time.Time `json:"revokedTime,omitempty"`
+}
+
+// ApiKeyRecord is struct for an API key stored in the kvstore
+type ApiKeyRecord struct {
+	ApiKeyInfo
+	// KeyHash is the SHA-256 hash (hex) of the API key
+	KeyHash string `json:"keyHash"`
+}
+
+// ApiKeyCreateResponse is struct for a created API key (the key is returned only once)
+type ApiKeyCreateResponse struct {
+	ApiKeyInfo
+	Key string `json:"key" example:"tbk_3f9a0c1d2b4e6f70_Xq3...(secret)"`
+}
+
+// ApiKeyListResponse is struct for the list of API keys
+type ApiKeyListResponse struct {
+	ApiKey []ApiKeyInfo `json:"apiKey"`
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditEnabled is whether to record mutating API calls (POST, PUT, DELETE) in the audit log (TB_AUDIT_ENABLED)
+var AuditEnabled string
+
+// AuditRetentionDays is the days to keep audit records (TB_AUDIT_RETENTION_DAYS; 0 to keep them forever)
+var AuditRetentionDays string
+
+const (
+	StrAuditEnabled       string = "TB_AUDIT_ENABLED"
+	StrAuditRetentionDays string = "TB_AUDIT_RETENTION_DAYS"
+
+	// AuditBodyMaxBytes is the max size of a request body stored in an audit record (larger bodies are not stored)
+	AuditBodyMaxBytes int = 64 * 1024
+)
+
+// AuditRecord is struct for an audit record of a mutating API call
+type AuditRecord struct {
+	Id        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	RequestId string    `json:"requestId"`
+
+	// User is the authenticated caller (empty if the caller is not authenticated)
+	User     string `json:"user"`
+	Role     string `json:"role,omitempty"`
+	ClientIp string `json:"clientIp"`
+
+	NsId   string `json:"nsId,omitempty"`
+	Method string `json:"method"`
+	// Path is the requested resource path (e.g., /tumblebug/ns/default/mci/mci01)
+	Path string `json:"path"`
+	// Route is the path template of the API (e.g., /tumblebug/ns/:nsId/mci/:mciId)
+	Route string `json:"route"`
+	Query string `json:"query,omitempty"`
+
+	// RequestBody is the request body with the sensitive fields redacted
+	RequestBody json.RawMessage `json:"requestBody,omitempty" swaggertype:"object"`
+
+	Status     int    `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// AuditQuery is struct for the filters of audit records
+type AuditQuery struct {
+	StartTime time.Time
+	EndTime   time.Time
+	User      string
+	NsId      string
+	// Resource matches the records whose path contains it (e.g., mci/mci01)
+	Resource string
+	Method   string
+	Limit    int
+}
+
+// AuditListResponse is struct for the list of audit records (latest first)
+type AuditListResponse struct {
+	Audit []AuditRecord `json:"audit"`
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// Roles of API callers
+const (
+	RoleMaintainer string = "maintainer"
+	RoleAdmin      string = "admin"
+	RoleUser       string = "user"
+	RoleGuest      string = "guest"
+	// RoleAnonymous is the role of requests which are not authenticated (e.g., readyz)
+	RoleAnonymous string = "anonymous"
+
+	// Roles granted per namespace
+	RoleNamespaceOwner  string = "owner"
+	RoleNamespaceViewer string = "viewer"
+)
+
+// AuthzConfig is structure for the authorization policy file (conf/authz.yaml)
+type AuthzConfig struct {
+	Authz AuthzPolicy `mapstructure:"authz" json:"authz"`
+}
+
+// AuthzPolicy is structure for the authorization policy of REST APIs
+type AuthzPolicy struct {
+	// NamespaceClaim is the JWT claim of the roles granted per namespace (e.g., {"ns01": "owner"} or ["ns01:owner"])
+	NamespaceClaim string `mapstructure:"namespaceclaim" json:"namespaceClaim"`
+	// Roles is the map of role name and its rules
+	Roles map[string]AuthzRole `mapstructure:"roles" json:"roles"`
+}
+
+// AuthzRole is structure for the rules of a role
+// (a role allows a request if one of the allow rules matches and none of the deny rules matches)
+type AuthzRole struct {
+	Allow []AuthzRule `mapstructure:"allow" json:"allow"`
+	Deny  []AuthzRule `mapstructure:"deny" json:"deny"`
+}
+
+// AuthzRule is structure for a rule of HTTP methods and path patterns
+// ('*' in a method matches any method, '*' in a path matches any characters including '/')
+type AuthzRule struct {
+	Methods []string `mapstructure:"methods" json:"methods"`
+	Paths   []string `mapstructure:"paths" json:"paths"`
+	// Queries is the query parameters ("key=value") the request must have for the rule to match (all of them)
+	Queries []string `mapstructure:"queries" json:"queries,omitempty"`
+}
@@ -70,9 +70,12 @@ var DBDatabase string
 var DBUser string
 var DBPassword string
 var AutocontrolDurationMs string
+var ReconcileDurationMs string
 var DefaultNamespace string
 var DefaultCredentialHolder string
 var EtcdEndpoints string
+var KvStoreType string
+var KvStorePath string
 var SelfEndpoint string
 var MyDB *sql.DB
 var err error
@@ -88,6 +91,7 @@ const (
 	StrDBUser                string = "TB_SQLITE_USER"
 	StrDBPassword            string = "TB_SQLITE_PASSWORD"
 	StrAutocontrolDurationMs string = "TB_AUTOCONTROL_DURATION_MS"
+	StrReconcileDurationMs   string = "TB_RECONCILE_DURATION_MS"
 	StrEtcdEndpoints         string = "TB_ETCD_ENDPOINTS"
 	ErrStrKeyNotFound        string = "key not found"
 	StrAdd                   string = "add"
@@ -137,6 +137,24 @@ type CloudSetting struct {
 	Enable     string            `yaml:"enable"`
 	Nlb        NlbSetting        `yaml:"nlb"`
 	K8sCluster K8sClusterSetting `yaml:"k8scluster"`
+	RootDisk   RootDiskSetting   `yaml:"rootdisk"`
+	RateLimit  RateLimitSetting  `yaml:"ratelimit"`
+}
+
+// RateLimitSetting is structure for the rate limit of CB-Spider calls (requests per second, no limit if empty or 0)
+// Each call takes a token from the bucket of its connection and from the bucket of its provider.
+type RateLimitSetting struct {
+	ConnectionRps   string `yaml:"connectionrps"`
+	ConnectionBurst string `yaml:"connectionburst"`
+	ProviderRps     string `yaml:"providerrps"`
+	ProviderBurst   string `yaml:"providerburst"`
+}
+
+// RootDiskSetting is structure for root disk rules of VMs (no rule if empty)
+type RootDiskSetting struct {
+	Type []string `yaml:"type"`
+	Min  string   `yaml:"min"`
+	Max  string   `yaml:"max"`
 }
 
 // NlbSetting is structure for NLB setting
@@ -0,0 +1,89 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+import "time"
+
+// Grouping keys of cost reports (a label key is given as "label:<key>", e.g., label:project)
+const (
+	CostGroupByNs       string = "ns"
+	CostGroupByMci      string = "mci"
+	CostGroupBySubGroup string = "subGroup"
+	CostGroupByVm       string = "vm"
+	CostGroupByProvider string = "provider"
+	CostGroupByLabel    string = "label:"
+)
+
+// VmRunningInterval is struct for an interval in which a VM is billed (End is nil while the VM is running)
+type VmRunningInterval struct {
+	Start time.Time  `json:"start"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// VmCostRecord is struct for the running intervals of a VM, accumulated from its status transitions.
+// The record is kept after the VM is deleted, so that the spend of deleted VMs is reported.
+type VmCostRecord struct {
+	NsId           string `json:"nsId"`
+	MciId          string `json:"mciId"`
+	SubGroupId     string `json:"subGroupId"`
+	VmId           string `json:"vmId"`
+	VmUid          string `json:"vmUid"`
+	SpecId         string `json:"specId"`
+	ConnectionName string `json:"connectionName"`
+	ProviderName   string `json:"providerName"`
+	RegionName     string `json:"regionName"`
+	// CostPerHour is the hourly cost of the spec of the VM (negative if unknown)
+	CostPerHour float32 `json:"costPerHour"`
+	// Label is the labels of the MCI and the VM (the labels of the VM take precedence)
+	Label map[string]string `json:"label"`
+
+	Status      string              `json:"status"`
+	Intervals   []VmRunningInterval `json:"intervals"`
+	CreatedTime time.Time           `json:"createdTime"`
+	DeletedTime *time.Time          `json:"deletedTime,omitempty"`
+}
+
+// CostReportQuery is struct for the conditions of a cost report
+type CostReportQuery struct {
+	NsId      string
+	MciId     string
+	StartTime time.Time
+	EndTime   time.Time
+	// GroupBy is the grouping keys (ns, mci, subGroup, vm, provider or label:<key>)
+	GroupBy []string
+}
+
+// CostReportItem is struct for the estimated cost of a group of VMs
+type CostReportItem struct {
+	// Group is the values of the grouping keys (e.g., {"mci": "mci01", "label:team": "infra"})
+	Group map[string]string `json:"group"`
+	// VmCount is the number of VMs running in the time range
+	VmCount      int     `json:"vmCount"`
+	RunningHours float64 `json:"runningHours"`
+	// EstimatedCost is the running hours multiplied by CostPerHour of the specs
+	EstimatedCost float64 `json:"estimatedCost"`
+	// UnknownCostVms is the number of VMs whose CostPerHour is unknown (not included in EstimatedCost)
+	UnknownCostVms int `json:"unknownCostVms,omitempty"`
+}
+
+// CostReport is struct for a cost report (estimated from CostPerHour of specs and running intervals of VMs)
+type CostReport struct {
+	StartTime          time.Time        `json:"startTime"`
+	EndTime            time.Time        `json:"endTime"`
+	GroupBy            []string         `json:"groupBy"`
+	Item               []CostReportItem `json:"item"`
+	TotalRunningHours  float64          `json:"totalRunningHours"`
+	TotalEstimatedCost float64          `json:"totalEstimatedCost"`
+}
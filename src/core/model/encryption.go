@@ -0,0 +1,69 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+import "time"
+
+// Master keys to encrypt sensitive fields (e.g., privateKey of SSH keys, vmUserPassword of VMs) in the kvstore.
+// The master key is given by TB_SECRET_MASTER_KEY (base64 of 32 bytes) or TB_SECRET_MASTER_KEY_FILE;
+// otherwise it is generated and kept in the local KMS keyring file (TB_SECRET_KMS_PATH).
+var (
+	SecretMasterKey         string
+	SecretMasterKeyFile     string
+	SecretMasterKeyPrevious string
+	SecretKmsPath           string
+)
+
+const (
+	StrSecretMasterKey         string = "TB_SECRET_MASTER_KEY"
+	StrSecretMasterKeyFile     string = "TB_SECRET_MASTER_KEY_FILE"
+	StrSecretMasterKeyPrevious string = "TB_SECRET_MASTER_KEY_PREVIOUS"
+	StrSecretKmsPath           string = "TB_SECRET_KMS_PATH"
+
+	// EncryptedSecretPrefix is the prefix of encrypted values
+	// (tbenc:v1:<master key ID>:<data key wrapped by the master key>:<value encrypted by the data key>)
+	EncryptedSecretPrefix string = "tbenc:v1:"
+
+	// SecretKeySourceEnv, SecretKeySourceFile and SecretKeySourceKms are the sources of master keys
+	SecretKeySourceEnv  string = "env"
+	SecretKeySourceFile string = "file"
+	SecretKeySourceKms  string = "kms"
+)
+
+// SecretKeyInfo is struct for a master key (the key itself is not included)
+type SecretKeyInfo struct {
+	// KeyId is the fingerprint of the key (the first 8 bytes of its SHA-256 in hex)
+	KeyId  string `json:"keyId" example:"3f2a9c0d1e4b5a6c"`
+	Source string `json:"source" example:"kms"`
+	// Active is set for the key encrypting new values
+	Active      bool      `json:"active"`
+	CreatedTime time.Time `json:"createdTime,omitempty"`
+}
+
+// SecretKeyListResponse is struct for the list of master keys
+type SecretKeyListResponse struct {
+	SecretKey []SecretKeyInfo `json:"secretKey"`
+}
+
+// SecretKeyRotationResult is struct for the result of rotating the master key
+type SecretKeyRotationResult struct {
+	ActiveKeyId string `json:"activeKeyId" example:"3f2a9c0d1e4b5a6c"`
+	// Records is the number of records re-encrypted with the active key
+	Records int `json:"records"`
+	// Fields is the number of sensitive fields re-encrypted (including the fields stored in plain text before)
+	Fields int `json:"fields"`
+	// Failed is the keys of the records which could not be re-encrypted
+	Failed []string `json:"failed,omitempty"`
+}
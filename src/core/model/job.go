@@ -0,0 +1,118 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+import "time"
+
+// JobRetentionHours is the hours to keep finished jobs (TB_JOB_RETENTION_HOURS)
+var JobRetentionHours string
+
+// ShutdownTimeoutSec is the seconds to wait for in-flight operations at shutdown (TB_SHUTDOWN_TIMEOUT_SEC).
+// The operations still running at the deadline are checkpointed as interrupted jobs.
+// It must be shorter than the stop grace period of the deployment (e.g., 10s of Docker, 30s of Kubernetes),
+// or the process is killed before the checkpoint.
+var ShutdownTimeoutSec string
+
+const (
+	StrJobRetentionHours  string = "TB_JOB_RETENTION_HOURS"
+	StrShutdownTimeoutSec string = "TB_SHUTDOWN_TIMEOUT_SEC"
+
+	// JobProgressMaxEntries is the max number of progress events kept in a job (the latest are kept)
+	JobProgressMaxEntries int = 500
+
+	// RedactedValue replaces the values of sensitive fields (e.g., passwords) in the request bodies and results stored with jobs
+	RedactedValue string = "[REDACTED]"
+)
+
+// Job status
+const (
+	JobStatusQueued      string = "Queued"
+	JobStatusRunning     string = "Running"
+	JobStatusSucceeded   string = "Succeeded"
+	JobStatusFailed      string = "Failed"
+	JobStatusCanceled    string = "Canceled"
+	JobStatusInterrupted string = "Interrupted"
+)
+
+// Job kind
+const (
+	JobKindCreateMci           string = "createMci"
+	JobKindCreateMciDynamic    string = "createMciDynamic"
+	JobKindDeleteMci           string = "deleteMci"
+	JobKindLoadAssets          string = "loadAssets"
+	JobKindRegisterCspResource string = "registerCspResourcesAll"
+	JobKindCreateVpn           string = "createVpn"
+	JobKindDeleteVpn           string = "deleteVpn"
+	// JobKindRequest is a mutating request (not run as a job) which was in flight when the instance shut down
+	JobKindRequest string = "request"
+)
+
+// JobProgress is struct for a progress event of a job
+type JobProgress struct {
+	Title string      `json:"title"`
+	Info  interface{} `json:"info,omitempty"`
+	Time  time.Time   `json:"time"`
+}
+
+// JobInfo is struct for a long-running operation persisted in the kvstore
+type JobInfo struct {
+	// Id is the job ID (generated by the server)
+	Id       string `json:"id" example:"cs4k2i0dvtd2n5l3b1kg"`
+	Kind     string `json:"kind" example:"createMciDynamic"`
+	NsId     string `json:"nsId,omitempty" example:"default"`
+	TargetId string `json:"targetId,omitempty" example:"mci01"`
+	Status   string `json:"status" example:"Running"`
+
+	// Owner is the Tumblebug instance running the job
+	Owner string `json:"owner"`
+	// Cancelable is set if the job stops at its next checkpoint when canceled
+	Cancelable      bool `json:"cancelable"`
+	CancelRequested bool `json:"cancelRequested,omitempty"`
+
+	// RequestId is the request ID (X-Request-Id) of the request that started the job
+	RequestId     string      `json:"requestId,omitempty" example:"1730000000000000000"`
+	RequestMethod string      `json:"requestMethod,omitempty" example:"POST"`
+	RequestUrl    string      `json:"requestUrl,omitempty" example:"/tumblebug/ns/default/mciDynamic?async=true"`
+	RequestBody   interface{} `json:"requestBody,omitempty"`
+
+	Progress []JobProgress `json:"progress,omitempty"`
+	Result   interface{}   `json:"result,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	// Checkpoint is where the job stopped if it is interrupted by the shutdown of the instance
+	Checkpoint *JobCheckpoint `json:"checkpoint,omitempty"`
+
+	CreatedTime   time.Time `json:"createdTime"`
+	StartTime     time.Time `json:"startTime"`
+	EndTime       time.Time `json:"endTime"`
+	HeartbeatTime time.Time `json:"heartbeatTime"`
+	// ExpireTime is the time the finished job is removed (EndTime + TB_JOB_RETENTION_HOURS)
+	ExpireTime time.Time `json:"expireTime"`
+}
+
+// JobListResponse is struct for the list of jobs
+type JobListResponse struct {
+	Job []JobInfo `json:"job"`
+}
+
+// JobCheckpoint is struct for the state of an operation interrupted by the shutdown of the instance.
+// A restarted instance reports it with the job, and the reconciler resumes MCIs toward their desired status.
+type JobCheckpoint struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason"`
+	// MciStatus, MciTargetAction and VmStatus are of the target MCI (if the operation is on an MCI)
+	MciStatus       string            `json:"mciStatus,omitempty" example:"Partial-Creating"`
+	MciTargetAction string            `json:"mciTargetAction,omitempty" example:"Create"`
+	VmStatus        map[string]string `json:"vmStatus,omitempty"`
+}
@@ -33,4 +33,40 @@ type NsInfo struct {
 	Name string `json:"name" example:"default"`
 
 	Description string `json:"description" example:"Description for this namespace"`
+
+	// Quota is the limits of resources in the namespace (no limit if nil)
+	Quota *NsQuota `json:"quota,omitempty"`
+}
+
+// NsQuota is struct for the limits of resources in a namespace (0 or empty means no limit)
+type NsQuota struct {
+	// MaxVms is the max number of VMs (including the nodes of K8s clusters)
+	MaxVms int `json:"maxVms,omitempty" example:"20"`
+	// MaxVCpu is the max total vCPUs of VMs
+	MaxVCpu int `json:"maxVCpu,omitempty" example:"64"`
+	// MaxMemoryGiB is the max total memory of VMs
+	MaxMemoryGiB float32 `json:"maxMemoryGiB,omitempty" example:"256"`
+	// MaxCostPerHour is the max total hourly cost of VMs (computed from CostPerHour of their specs)
+	MaxCostPerHour float32 `json:"maxCostPerHour,omitempty" example:"10.5"`
+	// AllowedProviders is the providers allowed to create resources (e.g., aws, azure)
+	AllowedProviders []string `json:"allowedProviders,omitempty" example:"aws,azure"`
+	// AllowedRegions is the regions allowed to create resources (e.g., ap-northeast-2, koreacentral)
+	AllowedRegions []string `json:"allowedRegions,omitempty" example:"ap-northeast-2,koreacentral"`
+}
+
+// NsQuotaUsage is struct for the current consumption of resources in a namespace
+type NsQuotaUsage struct {
+	Vms         int     `json:"vms"`
+	VCpu        int     `json:"vCpu"`
+	MemoryGiB   float32 `json:"memoryGiB"`
+	CostPerHour float32 `json:"costPerHour"`
+	// UnknownSpecVms is the number of VMs whose specs are not found (not counted in vCPU, memory and cost)
+	UnknownSpecVms int `json:"unknownSpecVms,omitempty"`
+}
+
+// NsQuotaInfo is struct for the quota and the usage of a namespace
+type NsQuotaInfo struct {
+	NsId  string       `json:"nsId" example:"default"`
+	Quota NsQuota      `json:"quota"`
+	Usage NsQuotaUsage `json:"usage"`
 }
@@ -0,0 +1,70 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+import "time"
+
+// Settings of outbound calls (CB-Spider, CB-Dragonfly, Terrarium, MC-IAM, ...)
+var OutboundTimeoutSec string
+var OutboundRetryMax string
+var OutboundRetryWaitMs string
+var OutboundRetryMaxWaitMs string
+var CircuitBreakerThreshold string
+var CircuitBreakerOpenSec string
+
+const (
+	StrOutboundTimeoutSec      string = "TB_OUTBOUND_TIMEOUT_SEC"
+	StrOutboundRetryMax        string = "TB_OUTBOUND_RETRY_MAX"
+	StrOutboundRetryWaitMs     string = "TB_OUTBOUND_RETRY_WAIT_MS"
+	StrOutboundRetryMaxWaitMs  string = "TB_OUTBOUND_RETRY_MAX_WAIT_MS"
+	StrCircuitBreakerThreshold string = "TB_CIRCUIT_BREAKER_THRESHOLD"
+	StrCircuitBreakerOpenSec   string = "TB_CIRCUIT_BREAKER_OPEN_SEC"
+)
+
+// Circuit breaker state
+const (
+	CircuitBreakerClosed   string = "Closed"
+	CircuitBreakerOpen     string = "Open"
+	CircuitBreakerHalfOpen string = "HalfOpen"
+)
+
+// CircuitBreakerStatus is struct for the state of the circuit breaker of an outbound endpoint
+type CircuitBreakerStatus struct {
+	// Endpoint is the host of the call (with the connection name for CB-Spider calls)
+	Endpoint            string    `json:"endpoint" example:"localhost:1024/aws-ap-northeast-2"`
+	State               string    `json:"state" example:"Open"`
+	ConsecutiveFailures int       `json:"consecutiveFailures" example:"5"`
+	LastError           string    `json:"lastError,omitempty"`
+	OpenedTime          time.Time `json:"openedTime,omitempty"`
+}
+
+// ReadyzResponse is struct for the readiness of CB-Tumblebug
+type ReadyzResponse struct {
+	Message string `json:"message" example:"CB-Tumblebug is ready"`
+	// CircuitBreakers lists the outbound endpoints whose circuit breaker is not closed
+	CircuitBreakers []CircuitBreakerStatus `json:"circuitBreakers,omitempty"`
+	// IsLeader is whether this instance runs the singleton background controllers (e.g., MCI orchestration)
+	IsLeader bool `json:"isLeader"`
+	// Leader is the instance elected as the leader among the Tumblebug instances sharing the kvstore
+	Leader *LeaderInfo `json:"leader,omitempty"`
+}
+
+// LeaderInfo is struct for the leader among the Tumblebug instances sharing the kvstore
+type LeaderInfo struct {
+	// InstanceId identifies the Tumblebug process (hostname/pid/start time)
+	InstanceId string    `json:"instanceId" example:"tumblebug-0/1/1720000000000000000"`
+	Hostname   string    `json:"hostname" example:"tumblebug-0"`
+	Since      time.Time `json:"since"`
+}
@@ -0,0 +1,32 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// SecretReq is struct for the request to set a namespace secret
+type SecretReq struct {
+	// Value is the secret value (never returned by the API)
+	Value string `json:"value" validate:"required" example:"my-db-password"`
+}
+
+// SecretInfo is struct for the metadata of a namespace secret (value is not included)
+type SecretInfo struct {
+	Name        string `json:"name" example:"dbPassword"`
+	UpdatedTime string `json:"updatedTime" example:"2024-01-01T00:00:00Z"`
+}
+
+// SecretListResponse is struct for the list of namespace secrets
+type SecretListResponse struct {
+	Secret []SecretInfo `json:"secret"`
+}
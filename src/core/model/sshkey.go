@@ -83,3 +83,52 @@ type TbSshKeyInfo struct {
 	// SystemLabel is for describing the Resource in a keyword (any string can be used) for special System purpose
 	SystemLabel string `json:"systemLabel,omitempty" example:"Managed by CB-Tumblebug" default:""`
 }
+
+const (
+	// SshKeyRotatedSystemLabel is the systemLabel of an sshKey generated by rotating the keys of VMs.
+	// It is not a CSP key pair (VMs created later are still given the key pair of the original sshKey).
+	SshKeyRotatedSystemLabel string = "Rotated by CB-Tumblebug"
+	// SshKeyRotatedFromKey is the key in keyValueList of a rotated sshKey to record the original sshKey (the CSP key pair)
+	SshKeyRotatedFromKey string = "rotatedFrom"
+
+	// SshKeyRotationRotated is the result of a VM whose key is rotated
+	SshKeyRotationRotated string = "Rotated"
+	// SshKeyRotationRolledBack is the result of a VM where login with the new key failed (the new key is removed)
+	SshKeyRotationRolledBack string = "RolledBack"
+	// SshKeyRotationFailed is the result of a VM where the new key could not be installed (or rolled back)
+	SshKeyRotationFailed string = "Failed"
+	// SshKeyRotationSkipped is the result of a VM which is not running
+	SshKeyRotationSkipped string = "Skipped"
+)
+
+// TbSshKeyRotationReq is struct for the request to rotate the SSH key of VMs in an MCI
+type TbSshKeyRotationReq struct {
+	// PrivateKey is the new private key in PEM (a new RSA key pair is generated if empty)
+	PrivateKey string `json:"privateKey,omitempty"`
+	// PublicKey is the new public key in authorized_keys format (derived from PrivateKey if empty)
+	PublicKey string `json:"publicKey,omitempty" example:"ssh-rsa AAAAB3NzaC1yc2EAAAADAQABAAACAQ..."`
+	// Description of the new sshKey objects
+	Description string `json:"description,omitempty" example:"Rotated after the key leak"`
+}
+
+// TbSshKeyRotationVmResult is struct for the result of rotating the SSH key of a VM
+type TbSshKeyRotationVmResult struct {
+	VmId        string `json:"vmId" example:"g1-1"`
+	OldSshKeyId string `json:"oldSshKeyId" example:"aws-ap-southeast-1"`
+	// NewSshKeyId is the sshKey of the VM after the rotation (empty if not rotated)
+	NewSshKeyId string `json:"newSshKeyId,omitempty" example:"aws-ap-southeast-1-rot1718000000"`
+	Status      string `json:"status" example:"Rotated" enums:"Rotated,RolledBack,Failed,Skipped"`
+	// Message describes the failure (or a warning, e.g., the old key could not be removed)
+	Message string `json:"message,omitempty"`
+}
+
+// TbSshKeyRotationResult is struct for the result of rotating the SSH key of VMs in an MCI
+type TbSshKeyRotationResult struct {
+	MciId      string `json:"mciId" example:"mci01"`
+	SubGroupId string `json:"subGroupId,omitempty" example:"g1"`
+	// Fingerprint is the SHA-256 fingerprint of the new key
+	Fingerprint string `json:"fingerprint" example:"SHA256:2Dp9w3c1b0..."`
+	// NewSshKeyIds are the sshKey objects created for the new key (one for each sshKey rotated)
+	NewSshKeyIds []string                   `json:"newSshKeyIds"`
+	Results      []TbSshKeyRotationVmResult `json:"results"`
+}
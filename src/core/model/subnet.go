@@ -16,8 +16,10 @@ package model
 
 // TbSubnetReq is a struct that represents TB subnet object.
 type TbSubnetReq struct { // Tumblebug
-	Name        string `json:"name" validate:"required" example:"subnet00"`
-	IPv4_CIDR   string `json:"ipv4_CIDR" validate:"required" example:"10.0.1.0/24"`
+	Name      string `json:"name" validate:"required" example:"subnet00"`
+	IPv4_CIDR string `json:"ipv4_CIDR" validate:"required" example:"10.0.1.0/24"`
+	// IPv6_CIDR is the optional IPv6 CIDR block for a dual-stack subnet (the vNet needs cidrBlockIpv6)
+	IPv6_CIDR   string `json:"ipv6_CIDR,omitempty" example:"fd00:10:0:1::/64"`
 	Zone        string `json:"zone,omitempty"`
 	Description string `json:"description,omitempty" example:"subnet00 managed by CB-Tumblebug"`
 	// todo: restore the tag list later
@@ -55,6 +57,7 @@ type TbSubnetInfo struct { // Tumblebug
 	CspVNetId    string        `json:"cspResourceId,omitempty" example:"csp-45eb41e14121c550a"`
 	Status       string        `json:"status"`
 	IPv4_CIDR    string        `json:"ipv4_CIDR"`
+	IPv6_CIDR    string        `json:"ipv6_CIDR,omitempty"`
 	Zone         string        `json:"zone,omitempty"`
 	BastionNodes []BastionNode `json:"bastionNodes,omitempty"`
 	KeyValueList []KeyValue    `json:"keyValueList,omitempty"`
@@ -0,0 +1,28 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package model is to handle object of CB-Tumblebug
+package model
+
+// Settings of OpenTelemetry tracing
+// (OtlpEndpoint is the URL of an OTLP/HTTP collector, e.g. http://localhost:4318; spans are not exported if empty)
+var OtlpEndpoint string
+var OtlpSamplingRatio string
+
+const (
+	StrOtlpEndpoint      string = "TB_OTLP_ENDPOINT"
+	StrOtlpSamplingRatio string = "TB_OTLP_SAMPLING_RATIO"
+)
+
+// TracingServiceName is the service name of the spans of CB-Tumblebug
+const TracingServiceName string = "cb-tumblebug"
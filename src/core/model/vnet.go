@@ -16,9 +16,11 @@ package model
 
 // TbVNetReq is a struct to handle 'Create vNet' request toward CB-Tumblebug.
 type TbVNetReq struct { // Tumblebug
-	Name           string        `json:"name" validate:"required" example:"vnet00"`
-	ConnectionName string        `json:"connectionName" validate:"required" example:"aws-ap-northeast-2"`
-	CidrBlock      string        `json:"cidrBlock" example:"10.0.0.0/16"`
+	Name           string `json:"name" validate:"required" example:"vnet00"`
+	ConnectionName string `json:"connectionName" validate:"required" example:"aws-ap-northeast-2"`
+	CidrBlock      string `json:"cidrBlock" example:"10.0.0.0/16"`
+	// CidrBlockIpv6 is the optional IPv6 CIDR block for a dual-stack vNet
+	CidrBlockIpv6  string        `json:"cidrBlockIpv6,omitempty" example:"fd00:10::/56"`
 	SubnetInfoList []TbSubnetReq `json:"subnetInfoList"`
 	Description    string        `json:"description" example:"vnet00 managed by CB-Tumblebug"`
 	// todo: restore the tag list later
@@ -52,6 +54,7 @@ type TbVNetInfo struct {
 	Name                 string         `json:"name" example:"aws-ap-southeast-1"`
 	ConnectionName       string         `json:"connectionName"`
 	CidrBlock            string         `json:"cidrBlock"`
+	CidrBlockIpv6        string         `json:"cidrBlockIpv6,omitempty"`
 	SubnetInfoList       []TbSubnetInfo `json:"subnetInfoList"`
 	Description          string         `json:"description"`
 	Status               string         `json:"status"`
@@ -77,9 +80,11 @@ type BastionNode struct {
 
 // VNetDesignRequest is a struct to handle the utility function, DesignVNet()
 type VNetDesignRequest struct {
-	TargetPrivateNetwork string      `json:"targetPrivateNetwork"`
-	SupernettingEnabled  string      `json:"supernettingEnabled"`
-	CspRegions           []CspRegion `json:"cspRegions"`
+	TargetPrivateNetwork string `json:"targetPrivateNetwork"`
+	// TargetPrivateNetworkIpv6 is the optional IPv6 network to design dual-stack vNets (/64 subnets)
+	TargetPrivateNetworkIpv6 string      `json:"targetPrivateNetworkIpv6,omitempty" example:"fd00:10::/48"`
+	SupernettingEnabled      string      `json:"supernettingEnabled"`
+	CspRegions               []CspRegion `json:"cspRegions"`
 }
 
 type CspRegion struct {
@@ -94,6 +99,7 @@ type NeededVNet struct {
 }
 
 type VNetDesignResponse struct {
-	RootNetworkCIDR string      `json:"rootNetworkCIDR,omitempty"` // in case of supernetting enabled
-	VNetReqList     []TbVNetReq `json:"vNetReqList"`
+	RootNetworkCIDR     string      `json:"rootNetworkCIDR,omitempty"`     // in case of supernetting enabled
+	RootNetworkCIDRIpv6 string      `json:"rootNetworkCIDRIpv6,omitempty"` // in case of supernetting enabled with the IPv6 target network
+	VNetReqList         []TbVNetReq `json:"vNetReqList"`
 }
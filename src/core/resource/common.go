@@ -16,6 +16,7 @@ package resource
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
@@ -31,7 +32,6 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvutil"
-	"github.com/go-resty/resty/v2"
 
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
@@ -251,6 +251,19 @@ func DelResource(nsId string, resourceType string, resourceId string, forceFlag
 			log.Error().Err(err).Msg("")
 			return err
 		}
+		if temp.SystemLabel == model.SshKeyRotatedSystemLabel {
+			// a rotated sshKey shares the CSP key pair with its original sshKey (only the object is deleted)
+			err = kvstore.Delete(key)
+			if err != nil {
+				log.Error().Err(err).Msg("")
+				return err
+			}
+			err = label.DeleteLabelObject(resourceType, temp.Uid)
+			if err != nil {
+				log.Error().Err(err).Msg("")
+			}
+			return nil
+		}
 		requestBody.ConnectionName = temp.ConnectionName
 		url = model.SpiderRestUrl + "/keypair/" + temp.CspResourceName
 		uid = temp.Uid
@@ -313,7 +326,7 @@ func DelResource(nsId string, resourceType string, resourceId string, forceFlag
 		url += "?force=true"
 	}
 	var callResult interface{}
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "DELETE"
 	//client.SetTimeout(60 * time.Second)
 
@@ -588,6 +601,7 @@ func ListResource(nsId string, resourceType string, filterKey string, filterVal
 					log.Error().Err(err).Msg("")
 					return nil, err
 				}
+				tempObj.PrivateKey = common.RevealSecret(tempObj.PrivateKey)
 				// Check the JSON body inclues both filterKey and filterVal strings. (assume key and value)
 				if filterKey != "" {
 					// If not inclues both, do not append current item to the list result.
@@ -775,110 +789,79 @@ func GetAssociatedObjectList(nsId string, resourceType string, resourceId string
 	return nil, err
 }
 
-// UpdateAssociatedObjectList adds or deletes the objectKey (currently, vmKey) to/from TB object's associatedObjectList
-func UpdateAssociatedObjectList(nsId string, resourceType string, resourceId string, cmd string, objectKey string) ([]string, error) {
-
-	err := common.CheckString(nsId)
+// ModifyAssociatedObjectList returns the resource object (JSON) with the objectKey added to or deleted from its associatedObjectList.
+// It does not access the Key-Value store, so it can be used to build a transaction.
+func ModifyAssociatedObjectList(resourceValue string, cmd string, objectKey string) (string, error) {
+	type stringList struct {
+		AssociatedObjectList []string `json:"associatedObjectList"`
+	}
+	res := stringList{}
+	err := json.Unmarshal([]byte(resourceValue), &res)
 	if err != nil {
-		log.Error().Err(err).Msg("")
-		return nil, err
+		return "", err
 	}
+	objList := res.AssociatedObjectList
 
-	// err = common.CheckString(resourceId)
-	// if err != nil {
-	// 	log.Error().Err(err).Msg("")
-	// 	return nil, err
-	// }
-	/*
-		check, err := CheckResource(nsId, resourceType, resourceId)
-
-		if !check {
-			errString := "The " + resourceType + " " + resourceId + " does not exist."
-			err := fmt.Errorf(errString)
-			return -1, err
+	switch cmd {
+	case model.StrAdd:
+		for _, v := range objList {
+			if v == objectKey {
+				return "", fmt.Errorf("%s is already associated", objectKey)
+			}
 		}
-
+		var anyJson map[string]interface{}
+		err = json.Unmarshal([]byte(resourceValue), &anyJson)
 		if err != nil {
-			log.Error().Err(err).Msg("")
-			return -1, err
+			return "", err
 		}
-	*/
-	log.Trace().Msg("[Set count] " + resourceType + ", " + resourceId)
+		anyJson["associatedObjectList"] = append(objList, objectKey)
+		updatedJson, err := json.Marshal(anyJson)
+		if err != nil {
+			return "", err
+		}
+		return string(updatedJson), nil
+	case model.StrDelete:
+		for k, v := range objList {
+			if v == objectKey {
+				return sjson.Delete(resourceValue, "associatedObjectList."+strconv.Itoa(k))
+			}
+		}
+		return "", fmt.Errorf("Cannot find the associated object %s.", objectKey)
+	}
+	return "", fmt.Errorf("unknown command: %s", cmd)
+}
 
-	key := common.GenResourceKey(nsId, resourceType, resourceId)
+// UpdateAssociatedObjectList adds or deletes the objectKey (currently, vmKey) to/from TB object's associatedObjectList
+// The update is applied with compare-and-swap, so concurrent updates on the same resource are not lost.
+func UpdateAssociatedObjectList(nsId string, resourceType string, resourceId string, cmd string, objectKey string) ([]string, error) {
 
-	keyValue, err := kvstore.GetKv(key)
+	err := common.CheckString(nsId)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return nil, err
 	}
 
-	if keyValue != (kvstore.KeyValue{}) {
-		objList, _ := GetAssociatedObjectList(nsId, resourceType, resourceId)
-		switch cmd {
-		case model.StrAdd:
-			for _, v := range objList {
-				if v == objectKey {
-					errString := objectKey + " is already associated with " + resourceType + " " + resourceId + "."
-					err = fmt.Errorf(errString)
-					return nil, err
-				}
-			}
-			var anyJson map[string]interface{}
-			json.Unmarshal([]byte(keyValue.Value), &anyJson)
-			if anyJson["associatedObjectList"] == nil {
-				arrayToBe := []string{objectKey}
-
-				anyJson["associatedObjectList"] = arrayToBe
-			} else { // anyJson["associatedObjectList"] != nil
-				arrayAsIs := anyJson["associatedObjectList"].([]interface{})
-
-				arrayToBe := append(arrayAsIs, objectKey)
+	log.Trace().Msg("[Set count] " + resourceType + ", " + resourceId)
 
-				anyJson["associatedObjectList"] = arrayToBe
-			}
-			updatedJson, _ := json.Marshal(anyJson)
-
-			keyValue.Value = string(updatedJson)
-		case model.StrDelete:
-			var foundKey int
-			var foundVal string
-			for k, v := range objList {
-				if v == objectKey {
-					foundKey = k
-					foundVal = v
-					break
-				}
-			}
-			if foundVal == "" {
-				errString := "Cannot find the associated object " + objectKey + "."
-				err = fmt.Errorf(errString)
-				return nil, err
-			} else {
-				keyValue.Value, err = sjson.Delete(keyValue.Value, "associatedObjectList."+strconv.Itoa(foundKey))
-				if err != nil {
-					log.Error().Err(err).Msg("")
-					return nil, err
-				}
-			}
-		}
+	key := common.GenResourceKey(nsId, resourceType, resourceId)
 
-		if err != nil {
-			log.Error().Err(err).Msg("")
-			return nil, err
+	err = kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[key].Exists() {
+			return nil, fmt.Errorf("Cannot get %s %s.", resourceType, resourceId)
 		}
-		err = kvstore.Put(key, keyValue.Value)
+		updatedValue, err := ModifyAssociatedObjectList(current[key].Value, cmd, objectKey)
 		if err != nil {
-			log.Error().Err(err).Msg("")
-			return nil, err
+			return nil, fmt.Errorf("%s %s: %w", resourceType, resourceId, err)
 		}
-
-		result, _ := GetAssociatedObjectList(nsId, resourceType, resourceId)
-		return result, nil
+		return []kvstore.Op{kvstore.OpPut(key, updatedValue)}, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return nil, err
 	}
-	errString := "Cannot get " + resourceType + " " + resourceId + "."
-	err = fmt.Errorf(errString)
-	return nil, err
+
+	result, _ := GetAssociatedObjectList(nsId, resourceType, resourceId)
+	return result, nil
 }
 
 // GetResource returns the requested TB Resource object
@@ -938,7 +921,7 @@ func GetResource(nsId string, resourceType string, resourceId string) (interface
 			// Update TB CustomImage object's 'status' field
 			url := fmt.Sprintf("%s/myimage/%s", model.SpiderRestUrl, res.CspResourceName)
 
-			client := resty.New().SetCloseConnection(true)
+			client := common.NewHttpClient().SetCloseConnection(true)
 			client.SetAllowGetMethodPayload(true)
 
 			connectionName := model.SpiderConnectionName{
@@ -995,6 +978,7 @@ func GetResource(nsId string, resourceType string, resourceId string) (interface
 				log.Error().Err(err).Msg("")
 				return nil, err
 			}
+			res.PrivateKey = common.RevealSecret(res.PrivateKey)
 			return res, nil
 		case model.StrVNet:
 			res := model.TbVNetInfo{}
@@ -1015,7 +999,7 @@ func GetResource(nsId string, resourceType string, resourceId string) (interface
 			// Update TB DataDisk object's 'status' field
 			url := fmt.Sprintf("%s/disk/%s", model.SpiderRestUrl, res.CspResourceName)
 
-			client := resty.New().SetCloseConnection(true)
+			client := common.NewHttpClient().SetCloseConnection(true)
 			client.SetAllowGetMethodPayload(true)
 
 			connectionName := model.SpiderConnectionName{
@@ -24,7 +24,6 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
 	validator "github.com/go-playground/validator/v10"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 )
 
@@ -106,7 +105,7 @@ func LookupMyImage(connConfig string, myImageId string) (model.SpiderMyImageInfo
 	}
 
 	var callResult model.SpiderMyImageInfo
-	client := resty.New()
+	client := common.NewHttpClient()
 	client.SetTimeout(2 * time.Minute)
 	url := model.SpiderRestUrl + "/myimage/" + url.QueryEscape(myImageId)
 	method := "GET"
@@ -197,7 +196,7 @@ func RegisterCustomImageWithId(nsId string, u *model.TbCustomImageReq) (model.Tb
 		return model.TbCustomImageInfo{}, err
 	}
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	client.SetTimeout(2 * time.Minute)
 	url := ""
 	method := ""
@@ -77,6 +77,12 @@ func CreateDataDisk(nsId string, u *model.TbDataDiskReq, option string) (model.T
 		return model.TbDataDiskInfo{}, err
 	}
 
+	// Check the allowed providers and regions of the namespace
+	err = CheckNsQuota(nsId, []QuotaDemand{{ConnectionName: u.ConnectionName}})
+	if err != nil {
+		return model.TbDataDiskInfo{}, err
+	}
+
 	uid := common.GenUid()
 
 	requestBody := model.SpiderDiskReqInfoWrapper{
@@ -91,7 +97,7 @@ func CreateDataDisk(nsId string, u *model.TbDataDiskReq, option string) (model.T
 
 	var tempSpiderDiskInfo *model.SpiderDiskInfo
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	req := client.R().
@@ -258,7 +264,7 @@ func UpsizeDataDisk(nsId string, resourceId string, u *model.TbDataDiskUpsizeReq
 		},
 	}
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	req := client.R().
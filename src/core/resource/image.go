@@ -21,7 +21,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
@@ -226,7 +225,7 @@ func LookupImageList(connConfig string) (model.SpiderImageList, error) {
 	requestBody := model.SpiderConnectionName{}
 	requestBody.ConnectionName = connConfig
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	resp, err := client.R().
@@ -274,7 +273,7 @@ func LookupImage(connConfig string, imageId string) (model.SpiderImageInfo, erro
 		return content, err
 	}
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	client.SetTimeout(2 * time.Minute)
 	url := model.SpiderRestUrl + "/vmimage/" + url.QueryEscape(imageId)
 	method := "GET"
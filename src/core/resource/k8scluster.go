@@ -27,7 +27,6 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvutil"
 	validator "github.com/go-playground/validator/v10"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 )
 
@@ -82,6 +81,19 @@ func CreateK8sCluster(nsId string, req *model.TbK8sClusterReq, option string) (m
 		return emptyObj, err
 	}
 
+	// Check and reserve the quota of the namespace until the cluster object is stored
+	// (nodes of the node groups are counted as VMs)
+	quotaDemands := []QuotaDemand{{ConnectionName: req.ConnectionName}}
+	for _, v := range req.K8sNodeGroupList {
+		quotaDemands = append(quotaDemands, QuotaDemand{ConnectionName: req.ConnectionName, SpecId: v.SpecId, Count: QuotaDemandCount(v.DesiredNodeSize)})
+	}
+	releaseQuota, err := ReserveNsQuota(nsId, quotaDemands)
+	if err != nil {
+		log.Err(err).Msg("Failed to Create a K8sCluster")
+		return emptyObj, err
+	}
+	defer releaseQuota()
+
 	connectionConfig, err := common.GetConnConfig(req.ConnectionName)
 	if err != nil {
 		err = fmt.Errorf("Cannot retrieve ConnectionConfig" + err.Error())
@@ -229,7 +241,7 @@ func CreateK8sCluster(nsId string, req *model.TbK8sClusterReq, option string) (m
 
 	// Randomly sleep within 20 Secs to avoid rateLimit from CSP
 	//common.RandomSleep(0, 20)
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "POST"
 	client.SetTimeout(20 * time.Minute)
 
@@ -394,6 +406,15 @@ func AddK8sNodeGroup(nsId string, k8sClusterId string, u *model.TbK8sNodeGroupRe
 		return emptyObj, err
 	}
 
+	// Check and reserve the quota of the namespace until the cluster object is updated
+	// (nodes of the node group are counted as VMs)
+	releaseQuota, err := ReserveNsQuota(nsId, []QuotaDemand{{ConnectionName: oldTbK8sCInfo.ConnectionName, SpecId: u.SpecId, Count: QuotaDemandCount(u.DesiredNodeSize)}})
+	if err != nil {
+		log.Err(err).Msg("Failed to Add K8sNodeGroup")
+		return emptyObj, err
+	}
+	defer releaseQuota()
+
 	/*
 	 * Build RequestBody for SpiderNodeGroupReq{}
 	 */
@@ -447,7 +468,7 @@ func AddK8sNodeGroup(nsId string, k8sClusterId string, u *model.TbK8sNodeGroupRe
 		},
 	}
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "POST"
 	client.SetTimeout(20 * time.Minute)
 
@@ -567,7 +588,7 @@ func RemoveK8sNodeGroup(nsId string, k8sClusterId string, k8sNodeGroupName strin
 	requestBody.NameSpace = "" // should be empty string from Tumblebug
 	requestBody.ConnectionName = tbK8sCInfo.ConnectionName
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	url := model.SpiderRestUrl + "/cluster/" + tbK8sCInfo.CspResourceName + "/nodegroup/" + k8sNodeGroupName
 	if forceFlag == "true" {
 		url += "?force=true"
@@ -663,7 +684,7 @@ func SetK8sNodeGroupAutoscaling(nsId string, k8sClusterId string, k8sNodeGroupNa
 		},
 	}
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	url := model.SpiderRestUrl + "/cluster/" + tbK8sCInfo.CspResourceName + "/nodegroup/" + k8sNodeGroupName + "/onautoscaling"
 	method := "PUT"
 
@@ -752,7 +773,7 @@ func ChangeK8sNodeGroupAutoscaleSize(nsId string, k8sClusterId string, k8sNodeGr
 		},
 	}
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	url := model.SpiderRestUrl + "/cluster/" + tbK8sCInfo.CspResourceName + "/nodegroup/" + k8sNodeGroupName + "/autoscalesize"
 	method := "PUT"
 
@@ -840,7 +861,7 @@ func GetK8sCluster(nsId string, k8sClusterId string) (model.TbK8sClusterInfo, er
 	 * Get model.TbK8sClusterInfo object from CB-Spider
 	 */
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	client.SetTimeout(10 * time.Minute)
 	url := model.SpiderRestUrl + "/cluster/" + storedTbK8sCInfo.CspResourceName
 	method := "GET"
@@ -1131,7 +1152,7 @@ func DeleteK8sCluster(nsId string, k8sClusterId string, forceFlag string) (bool,
 	requestBody.NameSpace = "" // should be empty string from Tumblebug
 	requestBody.ConnectionName = tbK8sCInfo.ConnectionName
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	url := model.SpiderRestUrl + "/cluster/" + tbK8sCInfo.CspResourceName
 	if forceFlag == "true" {
 		url += "?force=true"
@@ -1297,7 +1318,7 @@ func UpgradeK8sCluster(nsId string, k8sClusterId string, u *model.TbUpgradeK8sCl
 		},
 	}
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	url := model.SpiderRestUrl + "/cluster/" + oldTbK8sCInfo.CspResourceName + "/upgrade"
 	method := "PUT"
 
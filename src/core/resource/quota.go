@@ -0,0 +1,370 @@
+/*
+Copyright 2019 The Cloud-Barista Authors.
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+    http://www.apache.org/licenses/LICENSE-2.0
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resource is to manage multi-cloud infra resource
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvutil"
+	"github.com/rs/zerolog/log"
+)
+
+// QuotaDemand is the resources to be created by a request, checked against the quota of the namespace
+type QuotaDemand struct {
+	// ConnectionName is the connection of the resources (the connection of the spec if empty)
+	ConnectionName string
+	// SpecId is the spec of the VMs (in the namespace or the system namespace; empty for resources other than VMs)
+	SpecId string
+	// Count is the number of VMs
+	Count int
+}
+
+// QuotaDemandCount returns the number of VMs of a subGroup size (1 if it is not a positive integer, as provisioning does)
+func QuotaDemandCount(size string) int {
+	n, err := strconv.Atoi(size)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// quotaSpecResolver finds specs of VMs (cached while computing the usage of a namespace)
+type quotaSpecResolver struct {
+	nsId  string
+	specs map[string]*model.TbSpecInfo
+}
+
+// resolve returns the spec in the namespace or the system namespace (nil if not found)
+func (r *quotaSpecResolver) resolve(specId string) *model.TbSpecInfo {
+	if specId == "" {
+		return nil
+	}
+	if spec, ok := r.specs[specId]; ok {
+		return spec
+	}
+	var found *model.TbSpecInfo
+	for _, ns := range []string{r.nsId, model.SystemCommonNs} {
+		if spec, err := GetSpec(ns, specId); err == nil {
+			found = &spec
+			break
+		}
+	}
+	r.specs[specId] = found
+	return found
+}
+
+// quotaUsage is the usage of resources to be compared with the quota
+type quotaUsage struct {
+	model.NsQuotaUsage
+}
+
+// add adds the VMs of the spec to the usage
+func (u *quotaUsage) add(spec *model.TbSpecInfo, count int) {
+	u.Vms += count
+	if spec == nil {
+		u.UnknownSpecVms += count
+		return
+	}
+	u.VCpu += int(spec.VCPU) * count
+	u.MemoryGiB += spec.MemoryGiB * float32(count)
+	if spec.CostPerHour > 0 {
+		// the cost of some specs is unknown (e.g., -1)
+		u.CostPerHour += spec.CostPerHour * float32(count)
+	}
+}
+
+// GetNsQuotaInfo is func to get the quota and the current usage of the namespace
+func GetNsQuotaInfo(nsId string) (model.NsQuotaInfo, error) {
+	result := model.NsQuotaInfo{NsId: nsId}
+	ns, err := common.GetNs(nsId)
+	if err != nil {
+		return result, err
+	}
+	if ns.Quota != nil {
+		result.Quota = *ns.Quota
+	}
+	result.Usage, err = GetNsUsage(nsId)
+	return result, err
+}
+
+// GetNsUsage is func to compute the current usage of the namespace
+// (VMs of MCIs which are not terminated, and nodes of K8s clusters)
+func GetNsUsage(nsId string) (model.NsQuotaUsage, error) {
+	usage := quotaUsage{}
+	resolver := &quotaSpecResolver{nsId: nsId, specs: map[string]*model.TbSpecInfo{}}
+
+	// VMs of MCIs (/ns/{nsId}/mci/{mciId}/vm/{vmId})
+	mciKey := common.GenMciKey(nsId, "", "") + "/mci"
+	keyValue, err := kvstore.GetKvList(mciKey)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return usage.NsQuotaUsage, err
+	}
+	for _, kv := range kvutil.FilterKvListBy(keyValue, mciKey, 3) {
+		if !strings.Contains(kv.Key, "/vm/") {
+			continue
+		}
+		vm := model.TbVmInfo{}
+		if err := json.Unmarshal([]byte(kv.Value), &vm); err != nil {
+			log.Error().Err(err).Msgf("failed to unmarshal the VM %s", kv.Key)
+			continue
+		}
+		if vm.Status == model.StatusTerminated {
+			continue
+		}
+		usage.add(resolver.resolve(vm.SpecId), 1)
+	}
+
+	// Nodes of K8s clusters
+	clusters, err := ListK8sCluster(nsId, "", "")
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return usage.NsQuotaUsage, err
+	}
+	if clusterList, ok := clusters.([]model.TbK8sClusterInfo); ok {
+		for _, cluster := range clusterList {
+			for _, nodeGroup := range cluster.CspViewK8sClusterDetail.NodeGroupList {
+				count := len(nodeGroup.Nodes)
+				if count == 0 {
+					count = nodeGroup.DesiredNodeSize
+				}
+				specId := GetProviderRegionZoneResourceKey(cluster.ConnectionConfig.ProviderName, cluster.ConnectionConfig.RegionDetail.RegionName, "", nodeGroup.VMSpecName)
+				usage.add(resolver.resolve(specId), count)
+			}
+		}
+	}
+
+	return usage.NsQuotaUsage, nil
+}
+
+// CheckNsQuota is func to check if the resources to be created are allowed by the quota of the namespace.
+// It returns an error describing all violations (e.g., the number of VMs in use and requested) if not allowed.
+// Use ReserveNsQuota to keep the checked resources from being used by concurrent requests.
+func CheckNsQuota(nsId string, demands []QuotaDemand) error {
+	reserved, err := getNsQuotaReserved(nsId)
+	if err != nil {
+		return err
+	}
+	_, _, err = checkNsQuota(nsId, demands, reserved)
+	return err
+}
+
+// quotaReservationTtl is the time after which a reservation which is not released is not counted anymore
+// (e.g., the instance creating the resources stopped)
+const quotaReservationTtl = time.Hour
+
+// quotaReservation is the resources reserved by a request until they are created
+type quotaReservation struct {
+	Usage      model.NsQuotaUsage `json:"usage"`
+	ExpireTime time.Time          `json:"expireTime"`
+}
+
+// genNsQuotaReservationKey returns the kvstore key of the quota reservations of the namespace
+func genNsQuotaReservationKey(nsId string) string {
+	return "/quotaReservation/" + nsId
+}
+
+// parseQuotaReservations returns the reservations which are not expired
+func parseQuotaReservations(value string) map[string]quotaReservation {
+	reservations := map[string]quotaReservation{}
+	if value != "" {
+		if err := json.Unmarshal([]byte(value), &reservations); err != nil {
+			log.Error().Err(err).Msg("failed to unmarshal the quota reservations")
+		}
+	}
+	for id, r := range reservations {
+		if time.Now().After(r.ExpireTime) {
+			delete(reservations, id)
+		}
+	}
+	return reservations
+}
+
+// sumQuotaReservations returns the total usage of the reservations
+func sumQuotaReservations(reservations map[string]quotaReservation) model.NsQuotaUsage {
+	total := model.NsQuotaUsage{}
+	for _, r := range reservations {
+		total.Vms += r.Usage.Vms
+		total.VCpu += r.Usage.VCpu
+		total.MemoryGiB += r.Usage.MemoryGiB
+		total.CostPerHour += r.Usage.CostPerHour
+		total.UnknownSpecVms += r.Usage.UnknownSpecVms
+	}
+	return total
+}
+
+// getNsQuotaReserved returns the resources reserved in the namespace
+func getNsQuotaReserved(nsId string) (model.NsQuotaUsage, error) {
+	value, err := kvstore.Get(genNsQuotaReservationKey(nsId))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.NsQuotaUsage{}, err
+	}
+	return sumQuotaReservations(parseQuotaReservations(value)), nil
+}
+
+// ReserveNsQuota is func to check the quota of the namespace as CheckNsQuota does and reserve the requested resources.
+// The check and the reservation are applied atomically (compare-and-swap on the reservation key of the namespace),
+// so concurrent requests cannot exceed the quota together. The reserved resources are counted as in use
+// until the returned release function is called (after the resources are created or failed) or the reservation expires.
+// The release function can be called more than once.
+func ReserveNsQuota(nsId string, demands []QuotaDemand) (func(), error) {
+	key := genNsQuotaReservationKey(nsId)
+	reservationId := common.GenUid()
+	reserved := false
+	err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		reservations := parseQuotaReservations(current[key].Value)
+		requested, limited, err := checkNsQuota(nsId, demands, sumQuotaReservations(reservations))
+		if err != nil {
+			return nil, err
+		}
+		reserved = limited && requested.Vms > 0
+		if !reserved {
+			return nil, nil
+		}
+		reservations[reservationId] = quotaReservation{Usage: requested, ExpireTime: time.Now().Add(quotaReservationTtl)}
+		val, err := json.Marshal(reservations)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+	if err != nil {
+		return func() {}, err
+	}
+	if !reserved {
+		return func() {}, nil
+	}
+	var once sync.Once
+	return func() { once.Do(func() { releaseNsQuota(nsId, reservationId) }) }, nil
+}
+
+// releaseNsQuota releases the reservation (expired reservations are removed as well)
+func releaseNsQuota(nsId string, reservationId string) {
+	key := genNsQuotaReservationKey(nsId)
+	err := kvstore.ReadModifyWrite(context.Background(), []string{key}, func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+		if !current[key].Exists() {
+			return nil, nil
+		}
+		reservations := parseQuotaReservations(current[key].Value)
+		delete(reservations, reservationId)
+		if len(reservations) == 0 {
+			return []kvstore.Op{kvstore.OpDelete(key)}, nil
+		}
+		val, err := json.Marshal(reservations)
+		if err != nil {
+			return nil, err
+		}
+		return []kvstore.Op{kvstore.OpPut(key, string(val))}, nil
+	})
+	if err != nil {
+		log.Error().Err(err).Msgf("failed to release the quota reservation %s of the namespace %s", reservationId, nsId)
+	}
+}
+
+// checkNsQuota checks the demands against the quota of the namespace, counting the reserved resources as in use.
+// It returns the requested resources and whether the namespace has limits on them.
+func checkNsQuota(nsId string, demands []QuotaDemand, reserved model.NsQuotaUsage) (model.NsQuotaUsage, bool, error) {
+	requested := quotaUsage{}
+	ns, err := common.GetNs(nsId)
+	if err != nil {
+		return requested.NsQuotaUsage, false, err
+	}
+	if ns.Quota == nil {
+		return requested.NsQuotaUsage, false, nil
+	}
+	quota := ns.Quota
+	limited := quota.MaxVms > 0 || quota.MaxVCpu > 0 || quota.MaxMemoryGiB > 0 || quota.MaxCostPerHour > 0
+
+	violations := []string{}
+	resolver := &quotaSpecResolver{nsId: nsId, specs: map[string]*model.TbSpecInfo{}}
+	for _, d := range demands {
+		spec := resolver.resolve(d.SpecId)
+		if d.Count > 0 {
+			requested.add(spec, d.Count)
+		}
+
+		providerName, regionName := "", ""
+		if d.ConnectionName != "" {
+			connConfig, err := common.GetConnConfig(d.ConnectionName)
+			if err != nil {
+				return requested.NsQuotaUsage, limited, fmt.Errorf("failed to get the connection %s to check the quota: %w", d.ConnectionName, err)
+			}
+			providerName, regionName = connConfig.ProviderName, connConfig.RegionDetail.RegionName
+		} else if spec != nil {
+			providerName, regionName = spec.ProviderName, spec.RegionName
+		}
+		if len(quota.AllowedProviders) > 0 && !containsFold(quota.AllowedProviders, providerName) {
+			violations = append(violations, fmt.Sprintf("provider %q is not allowed (allowed: %s)", providerName, strings.Join(quota.AllowedProviders, ", ")))
+		}
+		if len(quota.AllowedRegions) > 0 && !containsFold(quota.AllowedRegions, regionName) {
+			violations = append(violations, fmt.Sprintf("region %q is not allowed (allowed: %s)", regionName, strings.Join(quota.AllowedRegions, ", ")))
+		}
+	}
+
+	if requested.Vms > 0 && limited {
+		usage, err := GetNsUsage(nsId)
+		if err != nil {
+			return requested.NsQuotaUsage, limited, fmt.Errorf("failed to get the usage of the namespace %s to check the quota: %w", nsId, err)
+		}
+		// resources reserved by other requests are counted as in use until they are created
+		usage.Vms += reserved.Vms
+		usage.VCpu += reserved.VCpu
+		usage.MemoryGiB += reserved.MemoryGiB
+		usage.CostPerHour += reserved.CostPerHour
+		if quota.MaxVms > 0 && usage.Vms+requested.Vms > quota.MaxVms {
+			violations = append(violations, fmt.Sprintf("VMs %d > max %d (in use or reserved: %d, requested: %d)",
+				usage.Vms+requested.Vms, quota.MaxVms, usage.Vms, requested.Vms))
+		}
+		if quota.MaxVCpu > 0 && usage.VCpu+requested.VCpu > quota.MaxVCpu {
+			violations = append(violations, fmt.Sprintf("vCPUs %d > max %d (in use or reserved: %d, requested: %d)",
+				usage.VCpu+requested.VCpu, quota.MaxVCpu, usage.VCpu, requested.VCpu))
+		}
+		if quota.MaxMemoryGiB > 0 && usage.MemoryGiB+requested.MemoryGiB > quota.MaxMemoryGiB {
+			violations = append(violations, fmt.Sprintf("memory %.1f GiB > max %.1f GiB (in use or reserved: %.1f, requested: %.1f)",
+				usage.MemoryGiB+requested.MemoryGiB, quota.MaxMemoryGiB, usage.MemoryGiB, requested.MemoryGiB))
+		}
+		if quota.MaxCostPerHour > 0 && usage.CostPerHour+requested.CostPerHour > quota.MaxCostPerHour {
+			violations = append(violations, fmt.Sprintf("cost %.4f/h > max %.4f/h (in use or reserved: %.4f, requested: %.4f)",
+				usage.CostPerHour+requested.CostPerHour, quota.MaxCostPerHour, usage.CostPerHour, requested.CostPerHour))
+		}
+	}
+
+	if len(violations) > 0 {
+		err := fmt.Errorf("the request exceeds the quota of the namespace %s: %s", nsId, strings.Join(violations, "; "))
+		log.Warn().Err(err).Msg("")
+		return requested.NsQuotaUsage, limited, err
+	}
+	return requested.NsQuotaUsage, limited, nil
+}
+
+// containsFold checks if the list contains the value (case-insensitive)
+func containsFold(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package resource
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cloud-barista/cb-tumblebug/src/core/common"
+	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstoretest"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReserveNsQuotaConcurrent(t *testing.T) {
+	store, err := memory.NewMemoryStore(context.Background())
+	require.NoError(t, err)
+	kvstoretest.UseGlobalStore(t, store)
+
+	const nsId = "quota-ns"
+	const maxVms = 3
+	_, err = common.CreateNs(&model.NsReq{Name: nsId})
+	require.NoError(t, err)
+	_, err = common.SetNsQuota(nsId, &model.NsQuota{MaxVms: maxVms})
+	require.NoError(t, err)
+
+	// VMs without a spec are counted by the number of VMs only
+	const requests = 10
+	var wg sync.WaitGroup
+	releases := make([]func(), requests)
+	errs := make([]error, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			releases[i], errs[i] = ReserveNsQuota(nsId, []QuotaDemand{{Count: 1}})
+		}(i)
+	}
+	wg.Wait()
+
+	reserved := 0
+	for _, err := range errs {
+		if err == nil {
+			reserved++
+			continue
+		}
+		assert.True(t, strings.Contains(err.Error(), "exceeds the quota"), err.Error())
+	}
+	assert.Equal(t, maxVms, reserved)
+	assert.Error(t, CheckNsQuota(nsId, []QuotaDemand{{Count: 1}}))
+
+	for _, release := range releases {
+		release()
+	}
+	assert.NoError(t, CheckNsQuota(nsId, []QuotaDemand{{Count: maxVms}}))
+	kv, err := kvstore.GetKv(genNsQuotaReservationKey(nsId))
+	require.NoError(t, err)
+	assert.Equal(t, kvstore.KeyValue{}, kv, "the reservations are removed when released")
+}
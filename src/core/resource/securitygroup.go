@@ -176,7 +176,7 @@ func CreateSecurityGroup(nsId string, u *model.TbSecurityGroupReq, option string
 
 	var tempSpiderSecurityInfo *model.SpiderSecurityInfo
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	req := client.R().
@@ -362,7 +362,7 @@ func CreateFirewallRules(nsId string, securityGroupId string, req []model.TbFire
 
 		url := fmt.Sprintf("%s/securitygroup/%s/rules", model.SpiderRestUrl, oldSecurityGroup.CspResourceName)
 
-		client := resty.New().SetCloseConnection(true)
+		client := common.NewHttpClient().SetCloseConnection(true)
 
 		resp, err := client.R().
 			SetHeader("Content-Type", "application/json").
@@ -521,7 +521,7 @@ func DeleteFirewallRules(nsId string, securityGroupId string, req []model.TbFire
 
 	url := fmt.Sprintf("%s/securitygroup/%s/rules", model.SpiderRestUrl, oldSecurityGroup.CspResourceName)
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 
 	resp, err := client.R().
 		SetHeader("Content-Type", "application/json").
@@ -561,7 +561,7 @@ func DeleteFirewallRules(nsId string, securityGroupId string, req []model.TbFire
 
 	url = fmt.Sprintf("%s/securitygroup/%s", model.SpiderRestUrl, oldSecurityGroup.CspResourceName)
 
-	client = resty.New().SetCloseConnection(true)
+	client = common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	resp, err = client.R().
@@ -24,7 +24,6 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/common"
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	validator "github.com/go-playground/validator/v10"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 
 	//"github.com/cloud-barista/cb-tumblebug/src/core/mci"
@@ -78,7 +77,7 @@ func LookupSpecList(connConfig string) (model.SpiderSpecList, error) {
 	}
 
 	var callResult model.SpiderSpecList
-	client := resty.New()
+	client := common.NewHttpClient()
 	client.SetTimeout(10 * time.Minute)
 	url := model.SpiderRestUrl + "/vmspec"
 	method := "GET"
@@ -122,7 +121,7 @@ func LookupSpec(connConfig string, specName string) (model.SpiderSpecInfo, error
 		return content, err
 	}
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	client.SetTimeout(2 * time.Minute)
 	url := model.SpiderRestUrl + "/vmspec/" + specName
 	method := "GET"
@@ -98,7 +98,7 @@ func CreateSshKey(nsId string, u *model.TbSshKeyReq, option string) (model.TbSsh
 
 	var tempSpiderKeyPairInfo *model.SpiderKeyPairInfo
 
-	client := resty.New().SetCloseConnection(true)
+	client := common.NewHttpClient().SetCloseConnection(true)
 	client.SetAllowGetMethodPayload(true)
 
 	req := client.R().
@@ -170,7 +170,14 @@ func CreateSshKey(nsId string, u *model.TbSshKeyReq, option string) (model.TbSsh
 
 	log.Info().Msg("PUT CreateSshKey")
 	Key := common.GenResourceKey(nsId, resourceType, content.Id)
-	Val, _ := json.Marshal(content)
+	// the private key is stored encrypted (content keeps the plain one to be returned)
+	stored := content
+	err = common.EncryptSecretFields(&stored.PrivateKey)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return content, err
+	}
+	Val, _ := json.Marshal(stored)
 	err = kvstore.Put(Key, string(Val))
 	if err != nil {
 		log.Error().Err(err).Msg("")
@@ -250,7 +257,13 @@ func UpdateSshKey(nsId string, sshKeyId string, fieldsToUpdate model.TbSshKeyInf
 
 	log.Info().Msg("PUT UpdateSshKey")
 	Key := common.GenResourceKey(nsId, resourceType, toBeSshKey.Id)
-	Val, _ := json.Marshal(toBeSshKey)
+	stored := toBeSshKey
+	err = common.EncryptSecretFields(&stored.PrivateKey)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return emptyObj, err
+	}
+	Val, _ := json.Marshal(stored)
 	err = kvstore.Put(Key, string(Val))
 	if err != nil {
 		log.Error().Err(err).Msg("")
@@ -269,3 +282,95 @@ func UpdateSshKey(nsId string, sshKeyId string, fieldsToUpdate model.TbSshKeyInf
 
 	return toBeSshKey, nil
 }
+
+// CreateRotatedSshKey creates an sshKey object for the new key pair of VMs rotated from the base sshKey.
+// The object keeps the CSP key pair of the original sshKey (the new key pair exists only in the VMs).
+func CreateRotatedSshKey(nsId string, sshKeyId string, base model.TbSshKeyInfo, publicKey string, privateKey string, fingerprint string, description string) (model.TbSshKeyInfo, error) {
+
+	resourceType := model.StrSSHKey
+
+	err := common.CheckString(sshKeyId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.TbSshKeyInfo{}, err
+	}
+	check, err := CheckResource(nsId, resourceType, sshKeyId)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return model.TbSshKeyInfo{}, err
+	}
+	if check {
+		err := fmt.Errorf("The sshKey %s already exists.", sshKeyId)
+		return model.TbSshKeyInfo{}, err
+	}
+
+	content := model.TbSshKeyInfo{}
+	content.ResourceType = resourceType
+	content.Id = sshKeyId
+	content.Name = sshKeyId
+	content.Uid = common.GenUid()
+	content.ConnectionName = base.ConnectionName
+	content.CspResourceId = base.CspResourceId
+	content.CspResourceName = base.CspResourceName
+	content.Fingerprint = fingerprint
+	content.Username = base.Username
+	content.VerifiedUsername = base.VerifiedUsername
+	content.PublicKey = publicKey
+	content.PrivateKey = privateKey
+	content.Description = description
+	if content.Description == "" {
+		content.Description = "Rotated from the sshKey " + base.Id
+	}
+	content.KeyValueList = []model.KeyValue{{Key: model.SshKeyRotatedFromKey, Value: GetOriginalSshKeyId(base)}}
+	content.AssociatedObjectList = []string{}
+	content.SystemLabel = model.SshKeyRotatedSystemLabel
+
+	log.Info().Msg("PUT CreateRotatedSshKey")
+	Key := common.GenResourceKey(nsId, resourceType, content.Id)
+	stored := content
+	err = common.EncryptSecretFields(&stored.PrivateKey)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return content, err
+	}
+	Val, _ := json.Marshal(stored)
+	err = kvstore.Put(Key, string(Val))
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return content, err
+	}
+
+	labels := map[string]string{
+		model.LabelManager:         model.StrManager,
+		model.LabelNamespace:       nsId,
+		model.LabelLabelType:       model.StrSSHKey,
+		model.LabelId:              content.Id,
+		model.LabelName:            content.Name,
+		model.LabelUid:             content.Uid,
+		model.LabelCspResourceId:   content.CspResourceId,
+		model.LabelCspResourceName: content.CspResourceName,
+		model.LabelDescription:     content.Description,
+		model.LabelConnectionName:  content.ConnectionName,
+	}
+	err = label.CreateOrUpdateLabel(model.StrSSHKey, content.Uid, Key, labels)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return content, err
+	}
+
+	return content, nil
+}
+
+// GetOriginalSshKeyId returns the sshKey of the CSP key pair that the sshKey is rotated from
+// (the sshKey itself if it is not rotated)
+func GetOriginalSshKeyId(sshKey model.TbSshKeyInfo) string {
+	if sshKey.SystemLabel != model.SshKeyRotatedSystemLabel {
+		return sshKey.Id
+	}
+	for _, kv := range sshKey.KeyValueList {
+		if kv.Key == model.SshKeyRotatedFromKey && kv.Value != "" {
+			return kv.Value
+		}
+	}
+	return sshKey.Id
+}
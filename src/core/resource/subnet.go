@@ -26,7 +26,6 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
 	validator "github.com/go-playground/validator/v10"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 )
 
@@ -124,6 +123,18 @@ func ValidateSubnetReq(subnetReq *model.TbSubnetReq, existingVNet model.TbVNetIn
 		return err
 	}
 
+	// Validate the IPv6 network object in case of a dual-stack vNet
+	var subnetIpv6Cidrs []string
+	for _, subnetInfo := range existingVNet.SubnetInfoList {
+		subnetIpv6Cidrs = append(subnetIpv6Cidrs, subnetInfo.IPv6_CIDR)
+	}
+	subnetIpv6Cidrs = append(subnetIpv6Cidrs, subnetReq.IPv6_CIDR)
+	err = ValidateIpv6Network(existingVNet.CidrBlockIpv6, subnetIpv6Cidrs)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return err
+	}
+
 	return nil
 }
 
@@ -144,6 +155,7 @@ type spiderAddSubnetRequestInfo struct {
 	Name      string           `json:"Name" validate:"required" example:"subnet-01"`
 	Zone      string           `json:"Zone,omitempty" validate:"omitempty" example:"us-east-1b"` // target zone for the subnet, if not specified, it will be created in the same zone as the Connection.
 	IPv4_CIDR string           `json:"IPv4_CIDR" validate:"required" example:"10.0.12.0/22"`
+	IPv6_CIDR string           `json:"IPv6_CIDR,omitempty" validate:"omitempty" example:"fd00:10:0:1::/64"` // Only for a dual-stack subnet
 	TagList   []model.KeyValue `json:"TagList,omitempty" validate:"omitempty"`
 }
 
@@ -201,6 +213,7 @@ func CreateSubnet(nsId string, vNetId string, subnetReq *model.TbSubnetReq) (mod
 	var err error = nil
 	subnetInfo.Id = subnetReq.Name
 	subnetInfo.Name = subnetReq.Name
+	subnetInfo.IPv6_CIDR = subnetReq.IPv6_CIDR
 
 	// Set the resource type
 	parentResourceType := model.StrVNet
@@ -299,10 +312,11 @@ func CreateSubnet(nsId string, vNetId string, subnetReq *model.TbSubnetReq) (mod
 	spReqt.ReqInfo.Name = subnetInfo.Uid
 	spReqt.ReqInfo.Zone = subnetReq.Zone
 	spReqt.ReqInfo.IPv4_CIDR = subnetReq.IPv4_CIDR
+	spReqt.ReqInfo.IPv6_CIDR = subnetReq.IPv6_CIDR
 	// todo: restore the tag list later
 	// spReqt.ReqInfo.TagList = subnetReq.TagList
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "POST"
 	var spResp spiderVPCInfo
 
@@ -635,7 +649,7 @@ func DeleteSubnet(nsId string, vNetId string, subnetId string) (model.SimpleMsg,
 
 	var spResp spiderBooleanInfoResp
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "DELETE"
 
 	err = common.ExecuteHttpRequest(
@@ -814,7 +828,7 @@ func RegisterSubnet(nsId string, vNetId string, subnetReq *model.TbRegisterSubne
 	spReqt.ReqInfo.Zone = subnetReq.Zone
 	spReqt.ReqInfo.CSPId = subnetReq.CspResourceId
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "POST"
 	var spResp spiderSubnetInfo
 
@@ -1042,7 +1056,7 @@ func DeregisterSubnet(nsId string, vNetId string, subnetId string) (model.Simple
 
 	var spResp spiderBooleanInfoResp
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "DELETE"
 
 	err = common.ExecuteHttpRequest(
@@ -27,7 +27,6 @@ import (
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
 	validator "github.com/go-playground/validator/v10"
-	"github.com/go-resty/resty/v2"
 	"github.com/rs/zerolog/log"
 )
 
@@ -144,6 +143,12 @@ func ValidateVNetReq(vNetReq *model.TbVNetReq) error {
 	var network netutil.Network
 	var subnets []netutil.Network
 
+	if netutil.IsIPv6CIDR(vNetReq.CidrBlock) {
+		err := fmt.Errorf("cidrBlock should be an IPv4 CIDR block (use cidrBlockIpv6 for IPv6): %s", vNetReq.CidrBlock)
+		log.Error().Err(err).Msg("")
+		return err
+	}
+
 	network = netutil.Network{
 		CidrBlock: vNetReq.CidrBlock,
 	}
@@ -164,9 +169,50 @@ func ValidateVNetReq(vNetReq *model.TbVNetReq) error {
 		return err
 	}
 
+	// Validate the IPv6 network object in case of a dual-stack vNet
+	var subnetIpv6Cidrs []string
+	for _, subnetInfo := range vNetReq.SubnetInfoList {
+		subnetIpv6Cidrs = append(subnetIpv6Cidrs, subnetInfo.IPv6_CIDR)
+	}
+	err = ValidateIpv6Network(vNetReq.CidrBlockIpv6, subnetIpv6Cidrs)
+	if err != nil {
+		log.Error().Err(err).Msg("")
+		return err
+	}
+
 	return nil
 }
 
+// ValidateIpv6Network validates the optional IPv6 CIDR blocks of a dual-stack vNet and its subnets
+// (empty CIDR blocks of subnets are skipped since IPv6 can be enabled for a part of the subnets).
+func ValidateIpv6Network(vNetCidrBlockIpv6 string, subnetCidrBlocksIpv6 []string) error {
+	var subnets []netutil.Network
+	for _, cidrBlock := range subnetCidrBlocksIpv6 {
+		if cidrBlock == "" {
+			continue
+		}
+		subnets = append(subnets, netutil.Network{CidrBlock: cidrBlock})
+	}
+
+	if vNetCidrBlockIpv6 == "" {
+		if len(subnets) > 0 {
+			return fmt.Errorf("the IPv6 CIDR block of the vNet is required for the IPv6 subnet (%s)", subnets[0].CidrBlock)
+		}
+		return nil
+	}
+	if !netutil.IsIPv6CIDR(vNetCidrBlockIpv6) {
+		return fmt.Errorf("invalid IPv6 CIDR block: %s", vNetCidrBlockIpv6)
+	}
+
+	network := netutil.Network{
+		CidrBlock: vNetCidrBlockIpv6,
+		Subnets:   subnets,
+	}
+	log.Debug().Msgf("IPv6 network: %+v", network)
+
+	return netutil.ValidateNetwork(network)
+}
+
 func ContainsZone(zones []string, zone string) bool {
 	for _, z := range zones {
 		if z == zone {
@@ -208,7 +254,8 @@ type spiderCreateVPCRequest struct {
 
 type spiderCreateVPCRequestInfo struct {
 	Name           string                       `json:"Name" validate:"required" example:"vpc-01"`
-	IPv4_CIDR      string                       `json:"IPv4_CIDR" validate:"omitempty"` // Some CSPs unsupported VPC CIDR
+	IPv4_CIDR      string                       `json:"IPv4_CIDR" validate:"omitempty"`           // Some CSPs unsupported VPC CIDR
+	IPv6_CIDR      string                       `json:"IPv6_CIDR,omitempty" validate:"omitempty"` // Only for a dual-stack VPC
 	SubnetInfoList []spiderAddSubnetRequestInfo `json:"SubnetInfoList" validate:"required"`
 	TagList        []model.KeyValue             `json:"TagList,omitempty" validate:"omitempty"`
 }
@@ -313,6 +360,7 @@ func CreateVNet(nsId string, vNetReq *model.TbVNetReq) (model.TbVNetInfo, error)
 	vNetInfo.Id = vNetReq.Name
 	vNetInfo.Uid = uid
 	vNetInfo.ConnectionName = vNetReq.ConnectionName
+	vNetInfo.CidrBlockIpv6 = vNetReq.CidrBlockIpv6
 	vNetInfo.Description = vNetReq.Description
 	// todo: restore the tag list later
 	// vNetInfo.TagList = vNetReq.TagList
@@ -332,6 +380,12 @@ func CreateVNet(nsId string, vNetReq *model.TbVNetReq) (model.TbVNetInfo, error)
 		return emptyRet, err
 	}
 
+	// Check the allowed providers and regions of the namespace
+	err = CheckNsQuota(nsId, []QuotaDemand{{ConnectionName: vNetReq.ConnectionName}})
+	if err != nil {
+		return emptyRet, err
+	}
+
 	// Note: Set subnetInfoList in vNetInfo in advance
 	//       since each subnet uid must be consistent
 	for _, subnetInfo := range vNetReq.SubnetInfoList {
@@ -341,6 +395,7 @@ func CreateVNet(nsId string, vNetReq *model.TbVNetReq) (model.TbVNetInfo, error)
 			Name:         subnetInfo.Name,
 			Uid:          common.GenUid(),
 			IPv4_CIDR:    subnetInfo.IPv4_CIDR,
+			IPv6_CIDR:    subnetInfo.IPv6_CIDR,
 			Zone:         subnetInfo.Zone,
 			// todo: restore the tag list later
 			// TagList:   subnetInfo.TagList,
@@ -369,6 +424,7 @@ func CreateVNet(nsId string, vNetReq *model.TbVNetReq) (model.TbVNetInfo, error)
 	spReqt.ConnectionName = vNetReq.ConnectionName
 	spReqt.ReqInfo.Name = vNetInfo.Uid
 	spReqt.ReqInfo.IPv4_CIDR = vNetReq.CidrBlock
+	spReqt.ReqInfo.IPv6_CIDR = vNetReq.CidrBlockIpv6
 
 	// Note: Use the subnets in the vNetInfo object (instead of the vNetReq object)
 	//       since each subnet uid must be consistent
@@ -376,6 +432,7 @@ func CreateVNet(nsId string, vNetReq *model.TbVNetReq) (model.TbVNetInfo, error)
 		spReqt.ReqInfo.SubnetInfoList = append(spReqt.ReqInfo.SubnetInfoList, spiderAddSubnetRequestInfo{
 			Name:      subnetInfo.Uid,
 			IPv4_CIDR: subnetInfo.IPv4_CIDR,
+			IPv6_CIDR: subnetInfo.IPv6_CIDR,
 			Zone:      subnetInfo.Zone,
 			// todo: restore the tag list later
 			// TagList:   subnetInfo.TagList,
@@ -384,7 +441,7 @@ func CreateVNet(nsId string, vNetReq *model.TbVNetReq) (model.TbVNetInfo, error)
 
 	log.Debug().Msgf("spReqt: %+v", spReqt)
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "POST"
 	var spResp spiderVPCInfo
 
@@ -621,7 +678,7 @@ func GetVNet(nsId string, vNetId string) (model.TbVNetInfo, error) {
 	}
 
 	// Get a vNet and subnets
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "GET"
 	spReqt := common.NoBody
 	var spResp spiderVPCInfo
@@ -778,7 +835,7 @@ func DeleteVNet(nsId string, vNetId string, withSubnets string) (model.SimpleMsg
 
 	var spResp spiderBooleanInfoResp
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "DELETE"
 
 	err = common.ExecuteHttpRequest(
@@ -902,7 +959,7 @@ func RegisterVNet(nsId string, vNetRegisterReq *model.TbRegisterVNetReq) (model.
 	spReqt.ReqInfo.Name = vNetInfo.Uid
 	spReqt.ReqInfo.CSPId = vNetRegisterReq.CspResourceId
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "POST"
 	var spResp spiderVPCInfo
 
@@ -1208,7 +1265,7 @@ func DeregisterVNet(nsId string, vNetId string, withSubnets string) (model.Simpl
 
 	var spResp spiderBooleanInfoResp
 
-	client := resty.New()
+	client := common.NewHttpClient()
 	method := "DELETE"
 
 	err = common.ExecuteHttpRequest(
@@ -1271,15 +1328,38 @@ func DesignVNets(reqt *model.VNetDesignRequest) (model.VNetDesignResponse, error
 	var vNetDesignResp model.VNetDesignResponse
 	var vNetReqList []model.TbVNetReq
 	var allCIDRs []string
+	var allIpv6CIDRs []string
 
 	baseIP, _, err := net.ParseCIDR(reqt.TargetPrivateNetwork)
 	if err != nil {
 		log.Error().Err(err).Msg("")
 		return model.VNetDesignResponse{}, err
 	}
+	if netutil.AddressBits(baseIP) != net.IPv4len*8 {
+		err := fmt.Errorf("targetPrivateNetwork should be an IPv4 network (use targetPrivateNetworkIpv6 for IPv6): %s", reqt.TargetPrivateNetwork)
+		log.Error().Err(err).Msg("")
+		return model.VNetDesignResponse{}, err
+	}
 
 	nextAvailableIP := baseIP
 
+	// [Optional] The IPv6 network for dual-stack vNets
+	var targetIpv6Net *net.IPNet
+	var nextAvailableIpv6 net.IP
+	if reqt.TargetPrivateNetworkIpv6 != "" {
+		nextAvailableIpv6, targetIpv6Net, err = net.ParseCIDR(reqt.TargetPrivateNetworkIpv6)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return model.VNetDesignResponse{}, err
+		}
+		nextAvailableIpv6 = targetIpv6Net.IP
+		if netutil.AddressBits(nextAvailableIpv6) != net.IPv6len*8 {
+			err := fmt.Errorf("targetPrivateNetworkIpv6 should be an IPv6 network: %s", reqt.TargetPrivateNetworkIpv6)
+			log.Error().Err(err).Msg("")
+			return model.VNetDesignResponse{}, err
+		}
+	}
+
 	idx := 0
 	for i, region := range reqt.CspRegions {
 		for j, vnet := range region.NeededVNets {
@@ -1301,6 +1381,29 @@ func DesignVNets(reqt *model.VNetDesignRequest) (model.VNetDesignResponse, error
 				Description:    fmt.Sprintf("vnet%02d designed by util/vNet/design", idx),
 			}
 
+			// Calculate IPv6 CIDR blocks (/64 subnets) for vNet and subnets in case of dual-stack
+			var ipv6Subnets []string
+			if targetIpv6Net != nil {
+				var ipv6Cidr string
+				var newNextAvailableIpv6 net.IP
+				ipv6Cidr, ipv6Subnets, newNextAvailableIpv6, err = netutil.DeriveIPv6VNetAndSubnets(nextAvailableIpv6, vnet.SubnetCount)
+				if err == nil {
+					// The vNet fits in the target network if its last subnet does (subnets are contiguous)
+					lastSubnetIP, _, _ := net.ParseCIDR(ipv6Subnets[len(ipv6Subnets)-1])
+					if !targetIpv6Net.Contains(lastSubnetIP) {
+						err = fmt.Errorf("no room for the vNet in the IPv6 target network (%s)", reqt.TargetPrivateNetworkIpv6)
+					}
+				}
+				if err != nil {
+					log.Error().Err(err).Msg("")
+					return model.VNetDesignResponse{}, err
+				}
+				log.Debug().Msgf("vNet (IPv6): %s", ipv6Cidr)
+				vNetReq.CidrBlockIpv6 = ipv6Cidr
+				nextAvailableIpv6 = newNextAvailableIpv6
+				allIpv6CIDRs = append(allIpv6CIDRs, ipv6Cidr)
+			}
+
 			log.Debug().Msgf("Subnets:")
 			zones, length, err := GetFirstNZones(region.ConnectionName, 2)
 			if err != nil {
@@ -1310,6 +1413,9 @@ func DesignVNets(reqt *model.VNetDesignRequest) (model.VNetDesignResponse, error
 			for k, subnet := range subnets {
 				subnetReq := model.TbSubnetReq{}
 				subnetReq.IPv4_CIDR = subnet
+				if k < len(ipv6Subnets) {
+					subnetReq.IPv6_CIDR = ipv6Subnets[k]
+				}
 
 				// Note - Depending on the input, a few more subnets can be created
 				if k < vnet.SubnetCount {
@@ -1351,5 +1457,15 @@ func DesignVNets(reqt *model.VNetDesignRequest) (model.VNetDesignResponse, error
 		vNetDesignResp.RootNetworkCIDR = supernet
 	}
 
+	if reqt.SupernettingEnabled == "true" && len(allIpv6CIDRs) > 0 {
+		supernet, err := netutil.CalculateSupernet(allIpv6CIDRs)
+		if err != nil {
+			log.Error().Err(err).Msg("")
+			return model.VNetDesignResponse{}, err
+		}
+		log.Info().Msgf("Supernet of all vNets (IPv6): %s", supernet)
+		vNetDesignResp.RootNetworkCIDRIpv6 = supernet
+	}
+
 	return vNetDesignResp, nil
 }
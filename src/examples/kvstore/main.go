@@ -2,36 +2,51 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"strconv"
 	"sync"
 	"time"
 
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/bolt"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/etcd"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvutil"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/memory"
 )
 
 func main() {
-	// EtcdStore configuration
-	config := etcd.Config{
-		Endpoints:   []string{"localhost:2379"}, // Replace with your etcd server endpoints
-		DialTimeout: 5 * time.Second,
-		Username:    "default",
-		Password:    "default",
-	}
+	backend := flag.String("backend", "etcd", "kvstore backend (etcd, memory, or bolt)")
+	boltPath := flag.String("path", "./kvstore-example.db", "database file path for the bolt backend")
+	flag.Parse()
 
-	// Create EtcdStore instance (singleton)
+	// Create Store instance
 	ctx := context.Background()
-	etcd, err := etcd.NewEtcdStore(ctx, config)
+	var store kvstore.Store
+	var err error
+	switch *backend {
+	case "memory":
+		store, err = memory.NewMemoryStore(ctx)
+	case "bolt":
+		store, err = bolt.NewBoltStore(ctx, bolt.Config{Path: *boltPath, Timeout: 5 * time.Second})
+	default:
+		// EtcdStore configuration
+		config := etcd.Config{
+			Endpoints:   []string{"localhost:2379"}, // Replace with your etcd server endpoints
+			DialTimeout: 5 * time.Second,
+			Username:    "default",
+			Password:    "default",
+		}
+		store, err = etcd.NewEtcdStore(ctx, config)
+	}
 	if err != nil {
-		log.Fatalf("Failed to create EtcdStore: %v", err)
+		log.Fatalf("Failed to create Store (%s): %v", *backend, err)
 	}
-	defer etcd.Close()
+	defer store.Close()
 
-	// Initialize global Store with EtcdStore
-	err = kvstore.InitializeStore(etcd)
+	// Initialize global Store
+	err = kvstore.InitializeStore(store)
 	if err != nil {
 		log.Fatalf("Failed to initialize global Store: %v", err)
 	}
@@ -144,12 +159,14 @@ func ExampleBasicCRUDTest(ctx context.Context) {
 	}
 	fmt.Printf("Successfully deleted key '%s'\n", key)
 
-	// Verify deletion
-	_, err = kvstore.GetWith(ctx, key)
+	// Verify deletion (an empty value is returned for a key that does not exist)
+	retrievedValue, err = kvstore.GetWith(ctx, key)
 	if err != nil {
-		fmt.Printf("As expected, failed to get deleted key '%s': %v\n", key, err)
+		log.Fatalf("Failed to get deleted key '%s': %v", key, err)
+	} else if retrievedValue == "" {
+		fmt.Printf("As expected, got an empty value for deleted key '%s'\n", key)
 	} else {
-		log.Fatalf("Unexpectedly succeeded in getting deleted key '%s'", key)
+		log.Fatalf("Unexpectedly got a value '%s' for deleted key '%s'", retrievedValue, key)
 	}
 }
 
@@ -443,7 +460,7 @@ func watchSingleKey(ctx context.Context, wg *sync.WaitGroup) {
 				return
 			}
 			for _, ev := range resp.Events {
-				fmt.Printf("(Single key watch) Type: %s Key: %s Value: %s\n", ev.Type, ev.Kv.Key, ev.Kv.Value)
+				fmt.Printf("(Single key watch) Type: %s Key: %s Value: %s\n", ev.Type, ev.Key, ev.Value)
 			}
 		case <-ctx.Done():
 			fmt.Println("Single key watch cancelled")
@@ -463,7 +480,7 @@ func watchMultipleKeys(ctx context.Context, wg *sync.WaitGroup) {
 				return
 			}
 			for _, ev := range resp.Events {
-				fmt.Printf("(Multiple keys watch) Type: %s Key: %s Value: %s\n", ev.Type, ev.Kv.Key, ev.Kv.Value)
+				fmt.Printf("(Multiple keys watch) Type: %s Key: %s Value: %s\n", ev.Type, ev.Key, ev.Value)
 			}
 		case <-ctx.Done():
 			fmt.Println("Multiple keys watch cancelled")
@@ -0,0 +1,559 @@
+// Package bolt provides an embedded on-disk implementation of kvstore.Store based on bbolt.
+// Key-value pairs survive process restarts, while sessions, locks and watches are process-local.
+// It is useful to run a single CB-Tumblebug instance without an etcd cluster.
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bbolt "go.etcd.io/bbolt"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvlocal"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+var (
+	// bucketKv is the bucket for key-value records
+	bucketKv = []byte("kv")
+	// bucketMeta is the bucket for store metadata (e.g., the current revision)
+	bucketMeta = []byte("meta")
+	// keyRevision is the key of the current revision in bucketMeta
+	keyRevision = []byte("revision")
+)
+
+// recordHeaderSize is the size of the encoded revision metadata (CreateRevision, ModRevision, Version)
+const recordHeaderSize = 24
+
+// BoltStore represents an embedded key-value store based on bbolt.
+type BoltStore struct {
+	db *bbolt.DB
+	// writeMu serializes writes with watch notifications to keep events in revision order
+	writeMu sync.Mutex
+
+	ctx     context.Context
+	locks   *kvlocal.LockManager
+	watches *kvlocal.WatchHub
+}
+
+// Config holds the configuration for BoltStore.
+type Config struct {
+	// Path is the database file path (created if it does not exist)
+	Path string
+	// Timeout is the amount of time to wait to obtain the file lock (0 means waiting indefinitely)
+	Timeout time.Duration
+}
+
+// NewBoltStore creates a new instance of BoltStore.
+// It opens (or creates) the database file with the provided configuration.
+func NewBoltStore(ctx context.Context, config Config) (kvstore.Store, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("database path is empty")
+	}
+	err := os.MkdirAll(filepath.Dir(config.Path), os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", config.Path, err)
+	}
+	db, err := bbolt.Open(config.Path, 0600, &bbolt.Options{Timeout: config.Timeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", config.Path, err)
+	}
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(bucketKv); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(bucketMeta)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize buckets: %w", err)
+	}
+
+	return &BoltStore{
+		db:      db,
+		ctx:     ctx,
+		locks:   kvlocal.NewLockManager(),
+		watches: kvlocal.NewWatchHub(),
+	}, nil
+}
+
+// encodeRecord encodes a record into bytes (header of revisions followed by the value).
+func encodeRecord(r kvlocal.Record) []byte {
+	buf := make([]byte, recordHeaderSize+len(r.Value))
+	binary.BigEndian.PutUint64(buf[0:8], uint64(r.CreateRevision))
+	binary.BigEndian.PutUint64(buf[8:16], uint64(r.ModRevision))
+	binary.BigEndian.PutUint64(buf[16:24], uint64(r.Version))
+	copy(buf[recordHeaderSize:], r.Value)
+	return buf
+}
+
+// decodeRecord decodes bytes into a record.
+func decodeRecord(b []byte) (kvlocal.Record, error) {
+	if len(b) < recordHeaderSize {
+		return kvlocal.Record{}, fmt.Errorf("corrupted record (size: %d)", len(b))
+	}
+	return kvlocal.Record{
+		CreateRevision: int64(binary.BigEndian.Uint64(b[0:8])),
+		ModRevision:    int64(binary.BigEndian.Uint64(b[8:16])),
+		Version:        int64(binary.BigEndian.Uint64(b[16:24])),
+		Value:          string(b[recordHeaderSize:]),
+	}, nil
+}
+
+// nextRevision increases and returns the current revision within the given transaction.
+func nextRevision(tx *bbolt.Tx) (int64, error) {
+	meta := tx.Bucket(bucketMeta)
+	var revision int64
+	if b := meta.Get(keyRevision); len(b) == 8 {
+		revision = int64(binary.BigEndian.Uint64(b))
+	}
+	revision++
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(revision))
+	return revision, meta.Put(keyRevision, buf)
+}
+
+// NewSession creates a new process-local session.
+// A session is needed for acquiring locks.
+func (s *BoltStore) NewSession(ctx context.Context) (kvstore.Session, error) {
+	return s.locks.NewSession(ctx)
+}
+
+// NewLock acquires a lock on the given key and returns the lock.
+// It uses the provided session to ensure the lock's lifecycle is tied to the session.
+func (s *BoltStore) NewLock(ctx context.Context, session kvstore.Session, lockKey string) (kvstore.Lock, error) {
+	return s.locks.NewLock(ctx, session, lockKey)
+}
+
+// Put stores a key-value pair.
+func (s *BoltStore) Put(key, value string) error {
+	return s.PutWith(s.ctx, key, value)
+}
+
+// PutWith stores a key-value pair using the provided context.
+func (s *BoltStore) PutWith(ctx context.Context, key, value string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to put key-value: %w", err)
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var revision int64
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		var err error
+		revision, err = nextRevision(tx)
+		if err != nil {
+			return err
+		}
+		bucket := tx.Bucket(bucketKv)
+		record := kvlocal.Record{CreateRevision: revision}
+		if b := bucket.Get([]byte(key)); b != nil {
+			record, err = decodeRecord(b)
+			if err != nil {
+				return err
+			}
+		}
+		record.Value = value
+		record.ModRevision = revision
+		record.Version++
+		return bucket.Put([]byte(key), encodeRecord(record))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put key-value: %w", err)
+	}
+
+	s.watches.Notify(kvstore.Event{
+		Type:        kvstore.EventTypePut,
+		KeyValue:    kvstore.KeyValue{Key: key, Value: value},
+		ModRevision: revision,
+	})
+	return nil
+}
+
+// Get retrieves the value for a given key.
+func (s *BoltStore) Get(key string) (string, error) {
+	return s.GetWith(s.ctx, key)
+}
+
+// GetWith retrieves the value for a given key using the provided context.
+// It returns an empty string if the key does not exist.
+func (s *BoltStore) GetWith(ctx context.Context, key string) (string, error) {
+	kv, err := s.GetKvWith(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	return kv.Value, nil
+}
+
+// GetList retrieves multiple values for keys with the given keyPrefix.
+func (s *BoltStore) GetList(keyPrefix string) ([]string, error) {
+	return s.GetListWith(s.ctx, keyPrefix)
+}
+
+// GetListWith retrieves multiple values for keys with the given keyPrefix using the provided context.
+func (s *BoltStore) GetListWith(ctx context.Context, keyPrefix string) ([]string, error) {
+	entries, err := s.listEntries(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+	if err != nil {
+		return nil, err
+	}
+	values := []string{}
+	for _, e := range entries {
+		values = append(values, e.Value)
+	}
+	return values, nil
+}
+
+// GetKv retrieves a key-value pair.
+func (s *BoltStore) GetKv(key string) (kvstore.KeyValue, error) {
+	return s.GetKvWith(s.ctx, key)
+}
+
+// GetKvWith retrieves a key-value pair using the provided context.
+// It returns an empty key-value pair if the key does not exist.
+func (s *BoltStore) GetKvWith(ctx context.Context, key string) (kvstore.KeyValue, error) {
+	if err := ctx.Err(); err != nil {
+		return kvstore.KeyValue{}, fmt.Errorf("failed to get key: %w", err)
+	}
+	keyValue := kvstore.KeyValue{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketKv).Get([]byte(key))
+		if b == nil {
+			return nil
+		}
+		record, err := decodeRecord(b)
+		if err != nil {
+			return err
+		}
+		keyValue = kvstore.KeyValue{Key: key, Value: record.Value}
+		return nil
+	})
+	if err != nil {
+		return kvstore.KeyValue{}, fmt.Errorf("failed to get key: %w", err)
+	}
+	return keyValue, nil
+}
+
+// GetKvList retrieves multiple key-value pairs with the given keyPrefix.
+func (s *BoltStore) GetKvList(keyPrefix string) ([]kvstore.KeyValue, error) {
+	return s.GetKvListWith(s.ctx, keyPrefix)
+}
+
+// GetKvListWith retrieves multiple key-value pairs with the given keyPrefix using the provided context.
+func (s *BoltStore) GetKvListWith(ctx context.Context, keyPrefix string) ([]kvstore.KeyValue, error) {
+	return s.GetSortedKvListWith(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+}
+
+// GetSortedKvList retrieves multiple key-value pairs with the given keyPrefix, sortBy, and order.
+func (s *BoltStore) GetSortedKvList(keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	return s.GetSortedKvListWith(s.ctx, keyPrefix, sortBy, order)
+}
+
+// GetSortedKvListWith retrieves multiple key-value pairs with the given keyPrefix, sortBy, and order using the provided context.
+func (s *BoltStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	entries, err := s.listEntries(ctx, keyPrefix, sortBy, order)
+	if err != nil {
+		return nil, err
+	}
+	return kvlocal.ToKeyValues(entries), nil
+}
+
+// GetKvRange retrieves key-value pairs of keys in [startKey, endKey) sorted by key (at most limit pairs; 0 for no limit).
+func (s *BoltStore) GetKvRange(startKey, endKey string, order kvstore.SortOrder, limit int64) ([]kvstore.KeyValue, error) {
+	return s.GetKvRangeWith(s.ctx, startKey, endKey, order, limit)
+}
+
+// GetKvRangeWith retrieves key-value pairs of keys in [startKey, endKey) sorted by key using the provided context.
+// The cursor walks the range in the requested order, so only the returned pairs are read.
+func (s *BoltStore) GetKvRangeWith(ctx context.Context, startKey, endKey string, order kvstore.SortOrder, limit int64) ([]kvstore.KeyValue, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get range of keys: %w", err)
+	}
+	entries := []kvlocal.Entry{}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketKv).Cursor()
+		var k, v []byte
+		next := c.Next
+		if order == kvstore.SortDescend {
+			next = c.Prev
+			if endKey == "" {
+				k, v = c.Last()
+			} else if k, v = c.Seek([]byte(endKey)); k == nil {
+				k, v = c.Last()
+			} else {
+				k, v = c.Prev()
+			}
+		} else {
+			k, v = c.Seek([]byte(startKey))
+		}
+		for ; k != nil && kvlocal.InRange(string(k), startKey, endKey); k, v = next() {
+			if limit > 0 && int64(len(entries)) >= limit {
+				break
+			}
+			record, err := decodeRecord(v)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", k, err)
+			}
+			entries = append(entries, kvlocal.Entry{Key: string(k), Record: record})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get range of keys: %w", err)
+	}
+	return kvlocal.ToKeyValues(entries), nil
+}
+
+// GetKvMap retrieves multiple key-value pairs with the given keyPrefix.
+func (s *BoltStore) GetKvMap(keyPrefix string) (kvstore.KeyValueMap, error) {
+	return s.GetKvMapWith(s.ctx, keyPrefix)
+}
+
+// GetKvMapWith retrieves multiple key-value pairs with the given keyPrefix using the provided context.
+func (s *BoltStore) GetKvMapWith(ctx context.Context, keyPrefix string) (kvstore.KeyValueMap, error) {
+	entries, err := s.listEntries(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+	if err != nil {
+		return nil, err
+	}
+	kvs := kvstore.KeyValueMap{}
+	for _, e := range entries {
+		kvs[e.Key] = e.Value
+	}
+	return kvs, nil
+}
+
+// listEntries returns the sorted entries of keys with the given keyPrefix.
+func (s *BoltStore) listEntries(ctx context.Context, keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvlocal.Entry, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get list with keyPrefix: %w", err)
+	}
+	entries := []kvlocal.Entry{}
+	prefix := []byte(keyPrefix)
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(bucketKv).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			record, err := decodeRecord(v)
+			if err != nil {
+				return fmt.Errorf("key %s: %w", k, err)
+			}
+			entries = append(entries, kvlocal.Entry{Key: string(k), Record: record})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list with keyPrefix: %w", err)
+	}
+	kvlocal.SortEntries(entries, sortBy, order)
+	return entries, nil
+}
+
+// Delete removes a key-value pair.
+func (s *BoltStore) Delete(key string) error {
+	return s.DeleteWith(s.ctx, key)
+}
+
+// DeleteWith removes a key-value pair using the provided context.
+func (s *BoltStore) DeleteWith(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	var revision int64
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketKv)
+		if bucket.Get([]byte(key)) == nil {
+			return nil
+		}
+		var err error
+		revision, err = nextRevision(tx)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+
+	if revision > 0 {
+		s.watches.Notify(kvstore.Event{
+			Type:        kvstore.EventTypeDelete,
+			KeyValue:    kvstore.KeyValue{Key: key},
+			ModRevision: revision,
+		})
+	}
+	return nil
+}
+
+// GetRevisionedKv retrieves a key-value pair with its revision metadata.
+func (s *BoltStore) GetRevisionedKv(key string) (kvstore.RevisionedKeyValue, error) {
+	return s.GetRevisionedKvWith(s.ctx, key)
+}
+
+// GetRevisionedKvWith retrieves a key-value pair with its revision metadata using the provided context.
+// It returns an empty value with ModRevision 0 if the key does not exist.
+func (s *BoltStore) GetRevisionedKvWith(ctx context.Context, key string) (kvstore.RevisionedKeyValue, error) {
+	if err := ctx.Err(); err != nil {
+		return kvstore.RevisionedKeyValue{}, fmt.Errorf("failed to get key: %w", err)
+	}
+	keyValue := kvstore.RevisionedKeyValue{KeyValue: kvstore.KeyValue{Key: key}}
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(bucketKv).Get([]byte(key))
+		if b == nil {
+			return nil
+		}
+		record, err := decodeRecord(b)
+		if err != nil {
+			return err
+		}
+		keyValue = kvlocal.ToRevisionedKeyValue(key, record)
+		return nil
+	})
+	if err != nil {
+		return kvstore.RevisionedKeyValue{}, fmt.Errorf("failed to get key: %w", err)
+	}
+	return keyValue, nil
+}
+
+// Txn applies the operations atomically if all conditions are met.
+func (s *BoltStore) Txn(cmps []kvstore.Compare, ops []kvstore.Op) (kvstore.TxnResponse, error) {
+	return s.TxnWith(s.ctx, cmps, ops)
+}
+
+// TxnWith applies the operations atomically if all conditions are met using the provided context.
+// The conditions and operations are evaluated in a single bbolt read-write transaction.
+func (s *BoltStore) TxnWith(ctx context.Context, cmps []kvstore.Compare, ops []kvstore.Op) (kvstore.TxnResponse, error) {
+	if len(ops) > kvstore.MaxTxnOps || len(cmps) > kvstore.MaxTxnOps {
+		return kvstore.TxnResponse{}, kvstore.ErrTooManyOps
+	}
+	if err := ctx.Err(); err != nil {
+		return kvstore.TxnResponse{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	resp := kvstore.TxnResponse{}
+	var events []kvstore.Event
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(bucketKv)
+		meta := tx.Bucket(bucketMeta)
+		if b := meta.Get(keyRevision); len(b) == 8 {
+			resp.Revision = int64(binary.BigEndian.Uint64(b))
+		}
+
+		for _, cmp := range cmps {
+			var modRevision int64
+			if b := bucket.Get([]byte(cmp.Key)); b != nil {
+				record, err := decodeRecord(b)
+				if err != nil {
+					return err
+				}
+				modRevision = record.ModRevision
+			}
+			if modRevision != cmp.ModRevision {
+				return nil
+			}
+		}
+		resp.Succeeded = true
+
+		// All operations of a transaction share one revision, as in etcd.
+		revision := resp.Revision + 1
+		var opErr error
+		events = kvlocal.ApplyOps(ops, revision, func(keyPrefix string) []string {
+			keys := []string{}
+			prefix := []byte(keyPrefix)
+			c := bucket.Cursor()
+			for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				keys = append(keys, string(k))
+			}
+			return keys
+		}, func(key string) (kvlocal.Record, bool) {
+			b := bucket.Get([]byte(key))
+			if b == nil {
+				return kvlocal.Record{}, false
+			}
+			record, err := decodeRecord(b)
+			if err != nil && opErr == nil {
+				opErr = fmt.Errorf("key %s: %w", key, err)
+			}
+			return record, true
+		}, func(key string, record kvlocal.Record, deleted bool) {
+			var err error
+			if deleted {
+				err = bucket.Delete([]byte(key))
+			} else {
+				err = bucket.Put([]byte(key), encodeRecord(record))
+			}
+			if err != nil && opErr == nil {
+				opErr = err
+			}
+		})
+		if opErr != nil {
+			return opErr
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		var err error
+		resp.Revision, err = nextRevision(tx)
+		return err
+	})
+	if err != nil {
+		return kvstore.TxnResponse{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	if len(events) > 0 {
+		s.watches.Notify(events...)
+	}
+	return resp, nil
+}
+
+// CompareAndSwap puts a key-value pair if the key was last modified at the given revision (0 for a new key).
+func (s *BoltStore) CompareAndSwap(key, value string, modRevision int64) (bool, error) {
+	return s.CompareAndSwapWith(s.ctx, key, value, modRevision)
+}
+
+// CompareAndSwapWith puts a key-value pair if the key was last modified at the given revision (0 for a new key)
+// using the provided context.
+func (s *BoltStore) CompareAndSwapWith(ctx context.Context, key, value string, modRevision int64) (bool, error) {
+	resp, err := s.TxnWith(ctx, []kvstore.Compare{kvstore.CompareModRevision(key, modRevision)}, []kvstore.Op{kvstore.OpPut(key, value)})
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+// WatchKey watches for changes on the given key.
+func (s *BoltStore) WatchKey(key string) kvstore.WatchChan {
+	return s.WatchKeyWith(s.ctx, key)
+}
+
+// WatchKeyWith watches for changes on the given key using the provided context.
+func (s *BoltStore) WatchKeyWith(ctx context.Context, key string) kvstore.WatchChan {
+	return s.watches.Watch(ctx, key, false)
+}
+
+// WatchKeys watches for changes on keys with the given keyPrefix.
+func (s *BoltStore) WatchKeys(keyPrefix string) kvstore.WatchChan {
+	return s.WatchKeysWith(s.ctx, keyPrefix)
+}
+
+// WatchKeysWith watches for changes on keys with the given keyPrefix using the provided context.
+func (s *BoltStore) WatchKeysWith(ctx context.Context, keyPrefix string) kvstore.WatchChan {
+	return s.watches.Watch(ctx, keyPrefix, true)
+}
+
+// Close closes the database file and stops all watches.
+// This is necessary to release the file lock.
+func (s *BoltStore) Close() error {
+	s.watches.Close()
+	return s.db.Close()
+}
@@ -0,0 +1,50 @@
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstoretest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltStore(t *testing.T) {
+	kvstoretest.Run(t, func(t *testing.T) kvstore.Store {
+		store, err := NewBoltStore(context.Background(), Config{Path: filepath.Join(t.TempDir(), "tumblebug.db")})
+		require.NoError(t, err)
+		return store
+	})
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	config := Config{Path: filepath.Join(t.TempDir(), "tumblebug.db")}
+	store, err := NewBoltStore(context.Background(), config)
+	require.NoError(t, err)
+	resp, err := store.Txn(nil, []kvstore.Op{kvstore.OpPut("a", "1"), kvstore.OpPut("b", "1")})
+	require.NoError(t, err)
+	require.True(t, resp.Succeeded)
+	require.NoError(t, store.Put("a", "2"))
+	before, err := store.GetRevisionedKv("a")
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	// key-value pairs and revisions survive a restart
+	store, err = NewBoltStore(context.Background(), config)
+	require.NoError(t, err)
+	defer store.Close()
+	after, err := store.GetRevisionedKv("a")
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	// the revision keeps increasing, so the revisions read before the restart stay valid for compares
+	swapped, err := store.CompareAndSwap("a", "3", before.ModRevision)
+	require.NoError(t, err)
+	assert.True(t, swapped)
+	current, err := store.GetRevisionedKv("a")
+	require.NoError(t, err)
+	assert.Greater(t, current.ModRevision, before.ModRevision)
+	assert.Equal(t, int64(3), current.Version)
+}
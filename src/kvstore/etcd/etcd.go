@@ -41,21 +41,65 @@ func NewEtcdStore(ctx context.Context, config Config) (kvstore.Store, error) {
 	return &EtcdStore{cli: cli, ctx: ctx}, nil
 }
 
-// OpenSession creates a new etcd session.
+// etcdSession wraps concurrency.Session to implement kvstore.Session.
+type etcdSession struct {
+	session *concurrency.Session
+}
+
+// Done returns a channel that is closed when the lease of the session is expired or revoked.
+func (es *etcdSession) Done() <-chan struct{} {
+	return es.session.Done()
+}
+
+// Close revokes the lease of the session, which releases all locks held by it.
+func (es *etcdSession) Close() error {
+	return es.session.Close()
+}
+
+// etcdLock wraps concurrency.Mutex to implement kvstore.Lock.
+type etcdLock struct {
+	mutex *concurrency.Mutex
+	key   string
+}
+
+// Lock acquires the mutex.
+func (el *etcdLock) Lock(ctx context.Context) error {
+	return el.mutex.Lock(ctx)
+}
+
+// Unlock releases the mutex.
+func (el *etcdLock) Unlock(ctx context.Context) error {
+	return el.mutex.Unlock(ctx)
+}
+
+// Key returns the key of the lock.
+func (el *etcdLock) Key() string {
+	return el.key
+}
+
+// NewSession creates a new etcd session.
 // A session is needed for acquiring locks.
-func (s *EtcdStore) NewSession(ctx context.Context) (*concurrency.Session, error) {
-	return concurrency.NewSession(s.cli)
+func (s *EtcdStore) NewSession(ctx context.Context) (kvstore.Session, error) {
+	session, err := concurrency.NewSession(s.cli, concurrency.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return &etcdSession{session: session}, nil
 }
 
-// NewLock acquires a lock on the given key and returns the mutex.
+// NewLock acquires a lock on the given key and returns the lock.
 // It uses the provided session to ensure the lock's lifecycle is tied to the session.
-func (s *EtcdStore) NewLock(ctx context.Context, session *concurrency.Session, lockKey string) (*concurrency.Mutex, error) {
-	mutex := concurrency.NewMutex(session, lockKey)
+func (s *EtcdStore) NewLock(ctx context.Context, session kvstore.Session, lockKey string) (kvstore.Lock, error) {
+	es, ok := session.(*etcdSession)
+	if !ok {
+		return nil, fmt.Errorf("session is not an etcd session: %T", session)
+	}
+	mutex := concurrency.NewMutex(es.session, lockKey)
 	err := mutex.Lock(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return mutex, nil
+	return &etcdLock{mutex: mutex, key: lockKey}, nil
 }
 
 // Put stores a key-value pair in etcd.
@@ -112,8 +156,8 @@ func (s *EtcdStore) GetListWith(ctx context.Context, keyPrefix string) ([]string
 	}
 
 	values := []string{}
-	for i, kv := range resp.Kvs {
-		values[i] = string(kv.Value)
+	for _, kv := range resp.Kvs {
+		values = append(values, string(kv.Value))
 	}
 	return values, nil
 }
@@ -164,14 +208,42 @@ func (s *EtcdStore) GetKvListWith(ctx context.Context, keyPrefix string) ([]kvst
 	return kvs, nil
 }
 
+// toEtcdSortTarget converts kvstore.SortTarget to clientv3.SortTarget.
+func toEtcdSortTarget(sortBy kvstore.SortTarget) clientv3.SortTarget {
+	switch sortBy {
+	case kvstore.SortByVersion:
+		return clientv3.SortByVersion
+	case kvstore.SortByCreateRevision:
+		return clientv3.SortByCreateRevision
+	case kvstore.SortByModRevision:
+		return clientv3.SortByModRevision
+	case kvstore.SortByValue:
+		return clientv3.SortByValue
+	default:
+		return clientv3.SortByKey
+	}
+}
+
+// toEtcdSortOrder converts kvstore.SortOrder to clientv3.SortOrder.
+func toEtcdSortOrder(order kvstore.SortOrder) clientv3.SortOrder {
+	switch order {
+	case kvstore.SortAscend:
+		return clientv3.SortAscend
+	case kvstore.SortDescend:
+		return clientv3.SortDescend
+	default:
+		return clientv3.SortNone
+	}
+}
+
 // GetSortedKvList retrieves multiple values for keys with the given keyPrefix, sortBy, and order from etcd.
-func (s *EtcdStore) GetSortedKvList(keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]kvstore.KeyValue, error) {
+func (s *EtcdStore) GetSortedKvList(keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
 	return s.GetSortedKvListWith(s.ctx, keyPrefix, sortBy, order)
 }
 
 // GetSortedKvListWith retrieves multiple values for keys with  the given keyPrefix, sortBy, and order from etcd using the provided context.
-func (s *EtcdStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]kvstore.KeyValue, error) {
-	sortOp := clientv3.WithSort(sortBy, order)
+func (s *EtcdStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	sortOp := clientv3.WithSort(toEtcdSortTarget(sortBy), toEtcdSortOrder(order))
 	resp, err := s.cli.Get(ctx, keyPrefix, clientv3.WithPrefix(), sortOp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get list with keyPrefix: %w", err)
@@ -184,6 +256,31 @@ func (s *EtcdStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, s
 	return kvs, nil
 }
 
+// GetKvRange retrieves key-value pairs of keys in [startKey, endKey) sorted by key from etcd (at most limit pairs; 0 for no limit).
+func (s *EtcdStore) GetKvRange(startKey, endKey string, order kvstore.SortOrder, limit int64) ([]kvstore.KeyValue, error) {
+	return s.GetKvRangeWith(s.ctx, startKey, endKey, order, limit)
+}
+
+// GetKvRangeWith retrieves key-value pairs of keys in [startKey, endKey) sorted by key from etcd using the provided context.
+func (s *EtcdStore) GetKvRangeWith(ctx context.Context, startKey, endKey string, order kvstore.SortOrder, limit int64) ([]kvstore.KeyValue, error) {
+	// an empty endKey means no upper bound (WithRange("") would get the startKey only)
+	rangeOp := clientv3.WithRange(endKey)
+	if endKey == "" {
+		rangeOp = clientv3.WithFromKey()
+	}
+	sortOp := clientv3.WithSort(clientv3.SortByKey, toEtcdSortOrder(order))
+	resp, err := s.cli.Get(ctx, startKey, rangeOp, sortOp, clientv3.WithLimit(limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get range of keys: %w", err)
+	}
+
+	kvs := []kvstore.KeyValue{}
+	for _, kv := range resp.Kvs {
+		kvs = append(kvs, kvstore.KeyValue{Key: string(kv.Key), Value: string(kv.Value)})
+	}
+	return kvs, nil
+}
+
 // GetKvMap retrieves multiple key-value pairs with the given keyPrefix from etcd.
 func (s *EtcdStore) GetKvMap(keyPrefix string) (kvstore.KeyValueMap, error) {
 	return s.GetKvMapWith(s.ctx, keyPrefix)
@@ -221,24 +318,128 @@ func (s *EtcdStore) DeleteWith(ctx context.Context, key string) error {
 	return nil
 }
 
+// GetRevisionedKv retrieves a key-value pair with its revision metadata from etcd.
+func (s *EtcdStore) GetRevisionedKv(key string) (kvstore.RevisionedKeyValue, error) {
+	return s.GetRevisionedKvWith(s.ctx, key)
+}
+
+// GetRevisionedKvWith retrieves a key-value pair with its revision metadata from etcd using the provided context.
+// It returns an empty value with ModRevision 0 if the key does not exist.
+func (s *EtcdStore) GetRevisionedKvWith(ctx context.Context, key string) (kvstore.RevisionedKeyValue, error) {
+	resp, err := s.cli.Get(ctx, key)
+	if err != nil {
+		return kvstore.RevisionedKeyValue{}, fmt.Errorf("failed to get key: %w", err)
+	}
+	for _, kv := range resp.Kvs {
+		return kvstore.RevisionedKeyValue{
+			KeyValue:       kvstore.KeyValue{Key: string(kv.Key), Value: string(kv.Value)},
+			CreateRevision: kv.CreateRevision,
+			ModRevision:    kv.ModRevision,
+			Version:        kv.Version,
+		}, nil
+	}
+	return kvstore.RevisionedKeyValue{KeyValue: kvstore.KeyValue{Key: key}}, nil
+}
+
+// Txn applies the operations atomically in etcd if all conditions are met.
+func (s *EtcdStore) Txn(cmps []kvstore.Compare, ops []kvstore.Op) (kvstore.TxnResponse, error) {
+	return s.TxnWith(s.ctx, cmps, ops)
+}
+
+// TxnWith applies the operations atomically in etcd if all conditions are met using the provided context.
+func (s *EtcdStore) TxnWith(ctx context.Context, cmps []kvstore.Compare, ops []kvstore.Op) (kvstore.TxnResponse, error) {
+	if len(ops) > kvstore.MaxTxnOps || len(cmps) > kvstore.MaxTxnOps {
+		return kvstore.TxnResponse{}, kvstore.ErrTooManyOps
+	}
+
+	etcdCmps := make([]clientv3.Cmp, 0, len(cmps))
+	for _, cmp := range cmps {
+		etcdCmps = append(etcdCmps, clientv3.Compare(clientv3.ModRevision(cmp.Key), "=", cmp.ModRevision))
+	}
+
+	etcdOps := make([]clientv3.Op, 0, len(ops))
+	for _, op := range ops {
+		switch op.Type {
+		case kvstore.OpTypePut:
+			etcdOps = append(etcdOps, clientv3.OpPut(op.Key, op.Value))
+		case kvstore.OpTypeDelete:
+			etcdOps = append(etcdOps, clientv3.OpDelete(op.Key))
+		case kvstore.OpTypeDeletePrefix:
+			etcdOps = append(etcdOps, clientv3.OpDelete(op.Key, clientv3.WithPrefix()))
+		default:
+			return kvstore.TxnResponse{}, fmt.Errorf("unknown operation type: %d", op.Type)
+		}
+	}
+
+	resp, err := s.cli.Txn(ctx).If(etcdCmps...).Then(etcdOps...).Commit()
+	if err != nil {
+		return kvstore.TxnResponse{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return kvstore.TxnResponse{Succeeded: resp.Succeeded, Revision: resp.Header.Revision}, nil
+}
+
+// CompareAndSwap puts a key-value pair in etcd if the key was last modified at the given revision (0 for a new key).
+func (s *EtcdStore) CompareAndSwap(key, value string, modRevision int64) (bool, error) {
+	return s.CompareAndSwapWith(s.ctx, key, value, modRevision)
+}
+
+// CompareAndSwapWith puts a key-value pair in etcd if the key was last modified at the given revision (0 for a new key)
+// using the provided context.
+func (s *EtcdStore) CompareAndSwapWith(ctx context.Context, key, value string, modRevision int64) (bool, error) {
+	resp, err := s.TxnWith(ctx, []kvstore.Compare{kvstore.CompareModRevision(key, modRevision)}, []kvstore.Op{kvstore.OpPut(key, value)})
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+// toWatchChan converts clientv3.WatchChan to kvstore.WatchChan.
+// The returned channel is closed when the etcd watch channel is closed.
+func toWatchChan(ctx context.Context, etcdWatchChan clientv3.WatchChan) kvstore.WatchChan {
+	watchChan := make(chan kvstore.WatchResponse)
+	go func() {
+		defer close(watchChan)
+		for etcdResp := range etcdWatchChan {
+			resp := kvstore.WatchResponse{Err: etcdResp.Err()}
+			for _, ev := range etcdResp.Events {
+				eventType := kvstore.EventTypePut
+				if ev.Type == clientv3.EventTypeDelete {
+					eventType = kvstore.EventTypeDelete
+				}
+				resp.Events = append(resp.Events, kvstore.Event{
+					Type:        eventType,
+					KeyValue:    kvstore.KeyValue{Key: string(ev.Kv.Key), Value: string(ev.Kv.Value)},
+					ModRevision: ev.Kv.ModRevision,
+				})
+			}
+			select {
+			case watchChan <- resp:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return watchChan
+}
+
 // WatchKey watches for changes on the given key.
-func (s *EtcdStore) WatchKey(key string) clientv3.WatchChan {
+func (s *EtcdStore) WatchKey(key string) kvstore.WatchChan {
 	return s.WatchKeyWith(s.ctx, key)
 }
 
 // WatchKeyWith watches for changes on the given key using the provided context.
-func (s *EtcdStore) WatchKeyWith(ctx context.Context, key string) clientv3.WatchChan {
-	return s.cli.Watch(ctx, key)
+func (s *EtcdStore) WatchKeyWith(ctx context.Context, key string) kvstore.WatchChan {
+	return toWatchChan(ctx, s.cli.Watch(ctx, key))
 }
 
 // WatchKeys watches for changes on keys with the given keyPrefix.
-func (s *EtcdStore) WatchKeys(keyPrefix string) clientv3.WatchChan {
+func (s *EtcdStore) WatchKeys(keyPrefix string) kvstore.WatchChan {
 	return s.WatchKeysWith(s.ctx, keyPrefix)
 }
 
 // WatchKeysWith watches for changes on keys with the given keyPrefix using the provided context.
-func (s *EtcdStore) WatchKeysWith(ctx context.Context, keyPrefix string) clientv3.WatchChan {
-	return s.cli.Watch(ctx, keyPrefix, clientv3.WithPrefix())
+func (s *EtcdStore) WatchKeysWith(ctx context.Context, keyPrefix string) kvstore.WatchChan {
+	return toWatchChan(ctx, s.cli.Watch(ctx, keyPrefix, clientv3.WithPrefix()))
 }
 
 // Close closes the etcd client.
@@ -246,15 +447,3 @@ func (s *EtcdStore) WatchKeysWith(ctx context.Context, keyPrefix string) clientv
 func (s *EtcdStore) Close() error {
 	return s.cli.Close()
 }
-
-// // CloseSession closes the given etcd session.
-// // It's important to close sessions to release resources.
-// func (s *EtcdStore) CloseSession(session *concurrency.Session) error {
-// 	return session.Close()
-// }
-
-// // Unlock releases the given lock.
-// // It is important to release the lock to allow other clients to acquire it.
-// func (s *EtcdStore) Unlock(ctx context.Context, mutex *concurrency.Mutex) error {
-// 	return mutex.Unlock(ctx)
-// }
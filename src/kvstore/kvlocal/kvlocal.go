@@ -0,0 +1,401 @@
+// Package kvlocal provides process-local building blocks (revisioned records, sorting,
+// locks, sessions and watches) shared by the embedded kvstore backends such as memory and bolt.
+package kvlocal
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+// ErrSessionClosed is returned when a lock is requested on a closed session.
+var ErrSessionClosed = errors.New("session is closed")
+
+// ErrLockNotHeld is returned when a lock is released by a session that does not hold it.
+var ErrLockNotHeld = errors.New("lock is not held by the session")
+
+// Record is a value with the revision metadata tracked by embedded backends.
+type Record struct {
+	Value          string
+	CreateRevision int64
+	ModRevision    int64
+	Version        int64
+}
+
+// Entry is a key and its record.
+type Entry struct {
+	Key string
+	Record
+}
+
+// HasKey checks if the key matches the given key (or keyPrefix when prefix is true).
+func HasKey(key, target string, prefix bool) bool {
+	if prefix {
+		return strings.HasPrefix(key, target)
+	}
+	return key == target
+}
+
+// InRange checks if the key is in [startKey, endKey) (an empty endKey means no upper bound).
+func InRange(key, startKey, endKey string) bool {
+	return key >= startKey && (endKey == "" || key < endKey)
+}
+
+// SortEntries sorts entries by the given target and order.
+// Entries are sorted ascending by key for kvstore.SortNone.
+func SortEntries(entries []Entry, sortBy kvstore.SortTarget, order kvstore.SortOrder) {
+	if order == kvstore.SortNone {
+		sortBy = kvstore.SortByKey
+	}
+	less := func(a, b Entry) bool {
+		switch sortBy {
+		case kvstore.SortByVersion:
+			return a.Version < b.Version
+		case kvstore.SortByCreateRevision:
+			return a.CreateRevision < b.CreateRevision
+		case kvstore.SortByModRevision:
+			return a.ModRevision < b.ModRevision
+		case kvstore.SortByValue:
+			return a.Value < b.Value
+		default:
+			return a.Key < b.Key
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if order == kvstore.SortDescend {
+			return less(entries[j], entries[i])
+		}
+		return less(entries[i], entries[j])
+	})
+}
+
+// ToKeyValues converts entries to a slice of KeyValue pairs.
+func ToKeyValues(entries []Entry) []kvstore.KeyValue {
+	kvs := make([]kvstore.KeyValue, 0, len(entries))
+	for _, e := range entries {
+		kvs = append(kvs, kvstore.KeyValue{Key: e.Key, Value: e.Value})
+	}
+	return kvs
+}
+
+// ToRevisionedKeyValue converts a record to a RevisionedKeyValue.
+func ToRevisionedKeyValue(key string, record Record) kvstore.RevisionedKeyValue {
+	return kvstore.RevisionedKeyValue{
+		KeyValue:       kvstore.KeyValue{Key: key, Value: record.Value},
+		CreateRevision: record.CreateRevision,
+		ModRevision:    record.ModRevision,
+		Version:        record.Version,
+	}
+}
+
+// ApplyOps applies the operations of a transaction at the given revision and returns the resulting events.
+// Backends provide access to their storage: listKeys returns the keys with a prefix, get returns the
+// current record of a key, and set stores (or deletes, when deleted is true) the record of a key.
+// Operations are applied in order, so a later operation sees the result of an earlier one.
+func ApplyOps(
+	ops []kvstore.Op,
+	revision int64,
+	listKeys func(keyPrefix string) []string,
+	get func(key string) (Record, bool),
+	set func(key string, record Record, deleted bool),
+) []kvstore.Event {
+	events := []kvstore.Event{}
+	deleteKey := func(key string) {
+		if _, found := get(key); !found {
+			return
+		}
+		set(key, Record{}, true)
+		events = append(events, kvstore.Event{
+			Type:        kvstore.EventTypeDelete,
+			KeyValue:    kvstore.KeyValue{Key: key},
+			ModRevision: revision,
+		})
+	}
+
+	for _, op := range ops {
+		switch op.Type {
+		case kvstore.OpTypePut:
+			record, found := get(op.Key)
+			if !found {
+				record = Record{CreateRevision: revision}
+			}
+			record.Value = op.Value
+			record.ModRevision = revision
+			record.Version++
+			set(op.Key, record, false)
+			events = append(events, kvstore.Event{
+				Type:        kvstore.EventTypePut,
+				KeyValue:    kvstore.KeyValue{Key: op.Key, Value: op.Value},
+				ModRevision: revision,
+			})
+		case kvstore.OpTypeDelete:
+			deleteKey(op.Key)
+		case kvstore.OpTypeDeletePrefix:
+			for _, key := range listKeys(op.Key) {
+				deleteKey(key)
+			}
+		}
+	}
+	return events
+}
+
+//
+// Sessions and locks
+//
+
+// LockManager manages process-local sessions and locks.
+// Locks are reentrant within a session, which follows the behavior of etcd mutexes.
+type LockManager struct {
+	mu    sync.Mutex
+	locks map[string]*lockState
+}
+
+type lockState struct {
+	owner    *session
+	released chan struct{}
+}
+
+type session struct {
+	manager *LockManager
+	done    chan struct{}
+	once    sync.Once
+}
+
+type lock struct {
+	manager *LockManager
+	session *session
+	key     string
+}
+
+// NewLockManager creates a new LockManager.
+func NewLockManager() *LockManager {
+	return &LockManager{locks: make(map[string]*lockState)}
+}
+
+// NewSession creates a new session. The session is closed when the ctx is done.
+func (m *LockManager) NewSession(ctx context.Context) (kvstore.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s := &session{manager: m, done: make(chan struct{})}
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.Close()
+			case <-s.done:
+			}
+		}()
+	}
+	return s, nil
+}
+
+// NewLock acquires a lock on the given key with the given session and returns the lock.
+func (m *LockManager) NewLock(ctx context.Context, kvSession kvstore.Session, lockKey string) (kvstore.Lock, error) {
+	s, ok := kvSession.(*session)
+	if !ok || s.manager != m {
+		return nil, errors.New("session is not created by this store")
+	}
+	l := &lock{manager: m, session: s, key: lockKey}
+	if err := l.Lock(ctx); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Done returns a channel that is closed when the session is closed.
+func (s *session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close closes the session and releases all locks held by it.
+func (s *session) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		s.manager.releaseAll(s)
+	})
+	return nil
+}
+
+// Lock acquires the lock. It blocks until the lock is acquired, the ctx is done, or the session is closed.
+func (l *lock) Lock(ctx context.Context) error {
+	m := l.manager
+	for {
+		m.mu.Lock()
+		select {
+		case <-l.session.done:
+			m.mu.Unlock()
+			return ErrSessionClosed
+		default:
+		}
+		st, found := m.locks[l.key]
+		if !found {
+			m.locks[l.key] = &lockState{owner: l.session, released: make(chan struct{})}
+			m.mu.Unlock()
+			return nil
+		}
+		if st.owner == l.session {
+			m.mu.Unlock()
+			return nil
+		}
+		released := st.released
+		m.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.session.done:
+			return ErrSessionClosed
+		}
+	}
+}
+
+// Unlock releases the lock.
+func (l *lock) Unlock(ctx context.Context) error {
+	m := l.manager
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st, found := m.locks[l.key]
+	if !found || st.owner != l.session {
+		return ErrLockNotHeld
+	}
+	delete(m.locks, l.key)
+	close(st.released)
+	return nil
+}
+
+// Key returns the key of the lock.
+func (l *lock) Key() string {
+	return l.key
+}
+
+// releaseAll releases all locks held by the session.
+func (m *LockManager) releaseAll(s *session) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, st := range m.locks {
+		if st.owner == s {
+			delete(m.locks, key)
+			close(st.released)
+		}
+	}
+}
+
+//
+// Watches
+//
+
+// WatchHub fans out events to process-local watchers.
+// Notify never blocks: each watcher buffers pending events until its consumer receives them.
+type WatchHub struct {
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+	closed   atomic.Bool
+}
+
+type watcher struct {
+	key     string
+	prefix  bool
+	mu      sync.Mutex
+	pending []kvstore.Event
+	signal  chan struct{}
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// NewWatchHub creates a new WatchHub.
+func NewWatchHub() *WatchHub {
+	return &WatchHub{watchers: make(map[*watcher]struct{})}
+}
+
+// Watch watches for changes on the given key (or keyPrefix when prefix is true).
+// The returned channel is closed when the ctx is done or the hub is closed.
+func (h *WatchHub) Watch(ctx context.Context, key string, prefix bool) kvstore.WatchChan {
+	out := make(chan kvstore.WatchResponse)
+	w := &watcher{key: key, prefix: prefix, signal: make(chan struct{}, 1), stop: make(chan struct{})}
+
+	h.mu.Lock()
+	if h.closed.Load() {
+		h.mu.Unlock()
+		close(out)
+		return out
+	}
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+
+	go func() {
+		defer close(out)
+		defer h.remove(w)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-w.stop:
+				return
+			case <-w.signal:
+			}
+			w.mu.Lock()
+			events := w.pending
+			w.pending = nil
+			w.mu.Unlock()
+			if len(events) == 0 {
+				continue
+			}
+			select {
+			case out <- kvstore.WatchResponse{Events: events}:
+			case <-ctx.Done():
+				return
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Notify delivers events to the watchers interested in them.
+func (h *WatchHub) Notify(events ...kvstore.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for w := range h.watchers {
+		var matched []kvstore.Event
+		for _, ev := range events {
+			if HasKey(ev.Key, w.key, w.prefix) {
+				matched = append(matched, ev)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		w.mu.Lock()
+		w.pending = append(w.pending, matched...)
+		w.mu.Unlock()
+		select {
+		case w.signal <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close stops all watchers. Their channels are closed.
+func (h *WatchHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed.Store(true)
+	for w := range h.watchers {
+		w.once.Do(func() { close(w.stop) })
+	}
+}
+
+// remove unregisters the watcher.
+func (h *WatchHub) remove(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.watchers, w)
+}
@@ -0,0 +1,224 @@
+package kvlocal
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHasKey(t *testing.T) {
+	cases := []struct {
+		key    string
+		target string
+		prefix bool
+		want   bool
+	}{
+		{key: "/ns/ns01", target: "/ns/ns01", prefix: false, want: true},
+		{key: "/ns/ns01/mci", target: "/ns/ns01", prefix: false, want: false},
+		{key: "/ns/ns01/mci", target: "/ns/ns01", prefix: true, want: true},
+		{key: "/ns/ns0", target: "/ns/ns01", prefix: true, want: false},
+		{key: "/ns/ns01", target: "", prefix: true, want: true},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, HasKey(tc.key, tc.target, tc.prefix), "HasKey(%q, %q, %v)", tc.key, tc.target, tc.prefix)
+	}
+}
+
+func TestInRange(t *testing.T) {
+	cases := []struct {
+		key      string
+		startKey string
+		endKey   string
+		want     bool
+	}{
+		{key: "b", startKey: "a", endKey: "c", want: true},
+		{key: "a", startKey: "a", endKey: "c", want: true},
+		{key: "c", startKey: "a", endKey: "c", want: false},
+		{key: "0", startKey: "a", endKey: "c", want: false},
+		{key: "z", startKey: "a", endKey: "", want: true},
+		{key: "a", startKey: "a", endKey: "a", want: false},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, InRange(tc.key, tc.startKey, tc.endKey), "InRange(%q, %q, %q)", tc.key, tc.startKey, tc.endKey)
+	}
+}
+
+func TestSortEntries(t *testing.T) {
+	entries := []Entry{
+		{Key: "b", Record: Record{Value: "1", CreateRevision: 1, ModRevision: 5, Version: 3}},
+		{Key: "c", Record: Record{Value: "3", CreateRevision: 2, ModRevision: 2, Version: 1}},
+		{Key: "a", Record: Record{Value: "2", CreateRevision: 3, ModRevision: 4, Version: 2}},
+	}
+	cases := []struct {
+		name   string
+		sortBy kvstore.SortTarget
+		order  kvstore.SortOrder
+		want   []string
+	}{
+		{name: "key ascend", sortBy: kvstore.SortByKey, order: kvstore.SortAscend, want: []string{"a", "b", "c"}},
+		{name: "key descend", sortBy: kvstore.SortByKey, order: kvstore.SortDescend, want: []string{"c", "b", "a"}},
+		{name: "none is by key", sortBy: kvstore.SortByValue, order: kvstore.SortNone, want: []string{"a", "b", "c"}},
+		{name: "version", sortBy: kvstore.SortByVersion, order: kvstore.SortAscend, want: []string{"c", "a", "b"}},
+		{name: "create revision", sortBy: kvstore.SortByCreateRevision, order: kvstore.SortDescend, want: []string{"a", "c", "b"}},
+		{name: "mod revision", sortBy: kvstore.SortByModRevision, order: kvstore.SortAscend, want: []string{"c", "a", "b"}},
+		{name: "value", sortBy: kvstore.SortByValue, order: kvstore.SortDescend, want: []string{"c", "a", "b"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sorted := append([]Entry{}, entries...)
+			SortEntries(sorted, tc.sortBy, tc.order)
+			keys := []string{}
+			for _, e := range sorted {
+				keys = append(keys, e.Key)
+			}
+			assert.Equal(t, tc.want, keys)
+		})
+	}
+}
+
+func TestApplyOps(t *testing.T) {
+	const revision = 10
+	type event struct {
+		Type kvstore.EventType
+		Key  string
+	}
+	cases := []struct {
+		name       string
+		initial    map[string]Record
+		ops        []kvstore.Op
+		wantEvents []event
+		want       map[string]Record
+	}{
+		{
+			name:       "create",
+			ops:        []kvstore.Op{kvstore.OpPut("a", "1")},
+			wantEvents: []event{{kvstore.EventTypePut, "a"}},
+			want:       map[string]Record{"a": {Value: "1", CreateRevision: revision, ModRevision: revision, Version: 1}},
+		},
+		{
+			name:       "update",
+			initial:    map[string]Record{"a": {Value: "1", CreateRevision: 3, ModRevision: 5, Version: 2}},
+			ops:        []kvstore.Op{kvstore.OpPut("a", "2")},
+			wantEvents: []event{{kvstore.EventTypePut, "a"}},
+			want:       map[string]Record{"a": {Value: "2", CreateRevision: 3, ModRevision: revision, Version: 3}},
+		},
+		{
+			name:       "put twice in a transaction",
+			ops:        []kvstore.Op{kvstore.OpPut("a", "1"), kvstore.OpPut("a", "2")},
+			wantEvents: []event{{kvstore.EventTypePut, "a"}, {kvstore.EventTypePut, "a"}},
+			want:       map[string]Record{"a": {Value: "2", CreateRevision: revision, ModRevision: revision, Version: 2}},
+		},
+		{
+			name:       "delete",
+			initial:    map[string]Record{"a": {Value: "1", CreateRevision: 3, ModRevision: 3, Version: 1}},
+			ops:        []kvstore.Op{kvstore.OpDelete("a"), kvstore.OpDelete("b")},
+			wantEvents: []event{{kvstore.EventTypeDelete, "a"}},
+			want:       map[string]Record{},
+		},
+		{
+			name: "delete prefix",
+			initial: map[string]Record{
+				"p/1": {Value: "1", CreateRevision: 1, ModRevision: 1, Version: 1},
+				"p/2": {Value: "2", CreateRevision: 2, ModRevision: 2, Version: 1},
+				"q/1": {Value: "3", CreateRevision: 3, ModRevision: 3, Version: 1},
+			},
+			ops:        []kvstore.Op{kvstore.OpDeletePrefix("p/")},
+			wantEvents: []event{{kvstore.EventTypeDelete, "p/1"}, {kvstore.EventTypeDelete, "p/2"}},
+			want:       map[string]Record{"q/1": {Value: "3", CreateRevision: 3, ModRevision: 3, Version: 1}},
+		},
+		{
+			name:       "delete and create again",
+			initial:    map[string]Record{"a": {Value: "1", CreateRevision: 3, ModRevision: 5, Version: 2}},
+			ops:        []kvstore.Op{kvstore.OpDelete("a"), kvstore.OpPut("a", "2")},
+			wantEvents: []event{{kvstore.EventTypeDelete, "a"}, {kvstore.EventTypePut, "a"}},
+			want:       map[string]Record{"a": {Value: "2", CreateRevision: revision, ModRevision: revision, Version: 1}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := map[string]Record{}
+			for k, r := range tc.initial {
+				data[k] = r
+			}
+			listKeys := func(keyPrefix string) []string {
+				keys := []string{}
+				for k := range data {
+					if HasKey(k, keyPrefix, true) {
+						keys = append(keys, k)
+					}
+				}
+				sort.Strings(keys)
+				return keys
+			}
+			get := func(key string) (Record, bool) {
+				r, found := data[key]
+				return r, found
+			}
+			set := func(key string, record Record, deleted bool) {
+				if deleted {
+					delete(data, key)
+					return
+				}
+				data[key] = record
+			}
+
+			events := ApplyOps(tc.ops, revision, listKeys, get, set)
+			got := []event{}
+			for _, ev := range events {
+				got = append(got, event{ev.Type, ev.Key})
+				assert.Equal(t, int64(revision), ev.ModRevision)
+			}
+			assert.Equal(t, tc.wantEvents, got)
+			assert.Equal(t, tc.want, data)
+		})
+	}
+}
+
+func TestWatchHub(t *testing.T) {
+	hub := NewWatchHub()
+	keyCh := hub.Watch(context.Background(), "a", false)
+	prefixCh := hub.Watch(context.Background(), "p/", true)
+
+	// Notify does not block even if nobody receives the events yet
+	hub.Notify(
+		kvstore.Event{Type: kvstore.EventTypePut, KeyValue: kvstore.KeyValue{Key: "a", Value: "1"}, ModRevision: 1},
+		kvstore.Event{Type: kvstore.EventTypePut, KeyValue: kvstore.KeyValue{Key: "p/1", Value: "1"}, ModRevision: 1},
+	)
+	hub.Notify(kvstore.Event{Type: kvstore.EventTypeDelete, KeyValue: kvstore.KeyValue{Key: "p/1"}, ModRevision: 2})
+
+	receive := func(ch kvstore.WatchChan, n int) []string {
+		keys := []string{}
+		for len(keys) < n {
+			select {
+			case resp, ok := <-ch:
+				require.True(t, ok)
+				for _, ev := range resp.Events {
+					keys = append(keys, ev.Type.String()+" "+ev.Key)
+				}
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "timed out")
+			}
+		}
+		return keys
+	}
+	assert.Equal(t, []string{"PUT a"}, receive(keyCh, 1))
+	assert.Equal(t, []string{"PUT p/1", "DELETE p/1"}, receive(prefixCh, 2))
+
+	hub.Close()
+	for _, ch := range []kvstore.WatchChan{keyCh, prefixCh} {
+		select {
+		case _, ok := <-ch:
+			assert.False(t, ok)
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "watch is not closed")
+		}
+	}
+	// a watch on a closed hub is closed at once
+	_, ok := <-hub.Watch(context.Background(), "a", false)
+	assert.False(t, ok)
+}
@@ -2,11 +2,11 @@ package kvstore
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"sync"
-
-	clientv3 "go.etcd.io/etcd/client/v3"
-	"go.etcd.io/etcd/client/v3/concurrency"
+	"time"
 )
 
 // Extensibility: Abstraction and Polymorphism
@@ -14,10 +14,12 @@ import (
 // Initially for etcd, but adaptable to other stores.
 
 // Store defines operations as an interface for key-value store.
-// This was mainly implemented for etcd, but can be extended to other key-value stores later.
+// This was mainly implemented for etcd, but it only depends on the backend-neutral types
+// defined in this package (Session, Lock, WatchChan, SortTarget, SortOrder),
+// so other key-value stores (e.g., in-memory, embedded on-disk) can implement it as well.
 type Store interface {
-	NewSession(ctx context.Context) (*concurrency.Session, error)
-	NewLock(ctx context.Context, session *concurrency.Session, lockKey string) (*concurrency.Mutex, error)
+	NewSession(ctx context.Context) (Session, error)
+	NewLock(ctx context.Context, session Session, lockKey string) (Lock, error)
 	Put(key, value string) error
 	PutWith(ctx context.Context, key, value string) error
 	Get(key string) (string, error)
@@ -28,21 +30,114 @@ type Store interface {
 	GetKvWith(ctx context.Context, key string) (KeyValue, error)
 	GetKvList(keyPrefix string) ([]KeyValue, error)
 	GetKvListWith(ctx context.Context, keyPrefix string) ([]KeyValue, error)
-	GetSortedKvList(keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]KeyValue, error)
-	GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]KeyValue, error)
+	GetSortedKvList(keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error)
+	GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error)
+	GetKvRange(startKey, endKey string, order SortOrder, limit int64) ([]KeyValue, error)
+	GetKvRangeWith(ctx context.Context, startKey, endKey string, order SortOrder, limit int64) ([]KeyValue, error)
 	GetKvMap(keyPrefix string) (KeyValueMap, error)
 	GetKvMapWith(ctx context.Context, keyPrefix string) (KeyValueMap, error)
 	Delete(key string) error
 	DeleteWith(ctx context.Context, key string) error
-	WatchKey(key string) clientv3.WatchChan
-	WatchKeyWith(ctx context.Context, key string) clientv3.WatchChan
-	WatchKeys(keyPrefix string) clientv3.WatchChan
-	WatchKeysWith(ctx context.Context, keyPrefix string) clientv3.WatchChan
+	WatchKey(key string) WatchChan
+	WatchKeyWith(ctx context.Context, key string) WatchChan
+	WatchKeys(keyPrefix string) WatchChan
+	WatchKeysWith(ctx context.Context, keyPrefix string) WatchChan
+	GetRevisionedKv(key string) (RevisionedKeyValue, error)
+	GetRevisionedKvWith(ctx context.Context, key string) (RevisionedKeyValue, error)
+	Txn(cmps []Compare, ops []Op) (TxnResponse, error)
+	TxnWith(ctx context.Context, cmps []Compare, ops []Op) (TxnResponse, error)
+	CompareAndSwap(key, value string, modRevision int64) (bool, error)
+	CompareAndSwapWith(ctx context.Context, key, value string, modRevision int64) (bool, error)
+	Close() error
+}
+
+// Session represents a liveness scope for locks.
+// Locks acquired with a session are released when the session is closed (or expires).
+type Session interface {
+	// Done returns a channel that is closed when the session is closed or expired.
+	Done() <-chan struct{}
+	// Close releases the session and all locks held by it.
 	Close() error
-	// CloseSession(session *concurrency.Session) error
-	// Unlock(ctx context.Context, mutex *concurrency.Mutex) error
 }
 
+// Lock represents a distributed (or process-local) mutual exclusion on a key.
+type Lock interface {
+	// Lock acquires the lock. It blocks until the lock is acquired or the ctx is done.
+	Lock(ctx context.Context) error
+	// Unlock releases the lock.
+	Unlock(ctx context.Context) error
+	// Key returns the key of the lock.
+	Key() string
+}
+
+// SortTarget specifies the field used to sort key-value pairs.
+type SortTarget int
+
+const (
+	// SortByKey sorts by key
+	SortByKey SortTarget = iota
+	// SortByVersion sorts by the number of modifications of a key
+	SortByVersion
+	// SortByCreateRevision sorts by the store revision at which a key was created
+	SortByCreateRevision
+	// SortByModRevision sorts by the store revision at which a key was last modified
+	SortByModRevision
+	// SortByValue sorts by value
+	SortByValue
+)
+
+// SortOrder specifies the order of sorting.
+type SortOrder int
+
+const (
+	// SortNone keeps the backend default order (ascending by key)
+	SortNone SortOrder = iota
+	// SortAscend sorts in ascending order
+	SortAscend
+	// SortDescend sorts in descending order
+	SortDescend
+)
+
+// EventType is the type of a watch event.
+type EventType int
+
+const (
+	// EventTypePut is for a created or updated key
+	EventTypePut EventType = iota
+	// EventTypeDelete is for a deleted key
+	EventTypeDelete
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case EventTypePut:
+		return "PUT"
+	case EventTypeDelete:
+		return "DELETE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// Event is a change of a key observed by a watch.
+type Event struct {
+	Type EventType `json:"type"`
+	KeyValue
+	// ModRevision is the store revision of the change
+	ModRevision int64 `json:"modRevision"`
+}
+
+// WatchResponse is a batch of events delivered through a WatchChan.
+type WatchResponse struct {
+	Events []Event
+	// Err is set when the watch is broken (e.g., compacted or canceled by the backend)
+	Err error
+}
+
+// WatchChan is a channel of watch responses. It is closed when the watch ends.
+type WatchChan <-chan WatchResponse
+
 type KeyValue struct {
 	Key   string `json:"key"`
 	Value string `json:"value"`
@@ -51,6 +146,91 @@ type KeyValue struct {
 // KeyValueMap represents a key-value pair.
 type KeyValueMap map[string]string
 
+// RevisionedKeyValue is a key-value pair with the revision metadata used for optimistic concurrency.
+type RevisionedKeyValue struct {
+	KeyValue
+	// CreateRevision is the store revision at which the key was created
+	CreateRevision int64 `json:"createRevision"`
+	// ModRevision is the store revision at which the key was last modified (0 if the key does not exist)
+	ModRevision int64 `json:"modRevision"`
+	// Version is the number of modifications of the key since its creation
+	Version int64 `json:"version"`
+}
+
+// Exists checks if the key exists in the store.
+func (rkv RevisionedKeyValue) Exists() bool {
+	return rkv.ModRevision != 0
+}
+
+// Compare is a condition of a transaction on the ModRevision of a key.
+// A ModRevision of 0 means that the key must not exist.
+type Compare struct {
+	Key         string
+	ModRevision int64
+}
+
+// CompareModRevision returns a condition that the key was last modified at the given revision.
+func CompareModRevision(key string, modRevision int64) Compare {
+	return Compare{Key: key, ModRevision: modRevision}
+}
+
+// CompareNotExist returns a condition that the key does not exist.
+func CompareNotExist(key string) Compare {
+	return Compare{Key: key, ModRevision: 0}
+}
+
+// OpType is the type of an operation in a transaction.
+type OpType int
+
+const (
+	// OpTypePut puts a key-value pair
+	OpTypePut OpType = iota
+	// OpTypeDelete deletes a key
+	OpTypeDelete
+	// OpTypeDeletePrefix deletes all keys with a prefix
+	OpTypeDeletePrefix
+)
+
+// Op is an operation in a transaction.
+type Op struct {
+	Type  OpType
+	Key   string
+	Value string
+}
+
+// OpPut returns an operation that puts a key-value pair.
+func OpPut(key, value string) Op {
+	return Op{Type: OpTypePut, Key: key, Value: value}
+}
+
+// OpDelete returns an operation that deletes a key.
+func OpDelete(key string) Op {
+	return Op{Type: OpTypeDelete, Key: key}
+}
+
+// OpDeletePrefix returns an operation that deletes all keys with the given keyPrefix.
+func OpDeletePrefix(keyPrefix string) Op {
+	return Op{Type: OpTypeDeletePrefix, Key: keyPrefix}
+}
+
+// TxnResponse is the result of a transaction.
+type TxnResponse struct {
+	// Succeeded is true if all conditions were met and the operations were applied
+	Succeeded bool
+	// Revision is the store revision after the transaction
+	Revision int64
+}
+
+// MaxTxnOps is the maximum number of operations (and of conditions) in a transaction.
+// It follows the default limit of etcd (--max-txn-ops), and all backends enforce it.
+const MaxTxnOps = 128
+
+// ErrTooManyOps is returned when a transaction has more than MaxTxnOps operations or conditions.
+var ErrTooManyOps = fmt.Errorf("too many operations in a transaction (max: %d)", MaxTxnOps)
+
+// ErrTxnConflict is returned by ReadModifyWrite when the keys keep being modified concurrently.
+var ErrTxnConflict = errors.New("transaction conflicted with concurrent updates")
+
 var (
 	globalStore Store
 	initOnce    sync.Once
@@ -80,7 +260,7 @@ func getStore() (Store, error) {
 }
 
 // NewSession creates a new session
-func NewSession(ctx context.Context) (*concurrency.Session, error) {
+func NewSession(ctx context.Context) (Session, error) {
 	store, err := getStore()
 	if err != nil {
 		return nil, err
@@ -89,7 +269,7 @@ func NewSession(ctx context.Context) (*concurrency.Session, error) {
 }
 
 // NewLock creates a new lock
-func NewLock(ctx context.Context, session *concurrency.Session, lockKey string) (*concurrency.Mutex, error) {
+func NewLock(ctx context.Context, session Session, lockKey string) (Lock, error) {
 	store, err := getStore()
 	if err != nil {
 		return nil, err
@@ -188,7 +368,7 @@ func GetKvListWith(ctx context.Context, keyPrefix string) ([]KeyValue, error) {
 }
 
 // GetSortedKvList retrieves sorted key-value pairs with the given prefix
-func GetSortedKvList(keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]KeyValue, error) {
+func GetSortedKvList(keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error) {
 	store, err := getStore()
 	if err != nil {
 		return nil, err
@@ -197,7 +377,7 @@ func GetSortedKvList(keyPrefix string, sortBy clientv3.SortTarget, order clientv
 }
 
 // GetSortedKvListWith retrieves sorted key-value pairs with the given prefix with context
-func GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy clientv3.SortTarget, order clientv3.SortOrder) ([]KeyValue, error) {
+func GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error) {
 	store, err := getStore()
 	if err != nil {
 		return nil, err
@@ -205,6 +385,24 @@ func GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy clientv3.
 	return store.GetSortedKvListWith(ctx, keyPrefix, sortBy, order)
 }
 
+// GetKvRange retrieves key-value pairs of keys in [startKey, endKey) sorted by key (at most limit pairs; 0 for no limit)
+func GetKvRange(startKey, endKey string, order SortOrder, limit int64) ([]KeyValue, error) {
+	store, err := getStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetKvRange(startKey, endKey, order, limit)
+}
+
+// GetKvRangeWith retrieves key-value pairs of keys in [startKey, endKey) sorted by key with context
+func GetKvRangeWith(ctx context.Context, startKey, endKey string, order SortOrder, limit int64) ([]KeyValue, error) {
+	store, err := getStore()
+	if err != nil {
+		return nil, err
+	}
+	return store.GetKvRangeWith(ctx, startKey, endKey, order, limit)
+}
+
 // GetKvMap retrieves a map of key-value pairs with the given prefix
 func GetKvMap(keyPrefix string) (KeyValueMap, error) {
 	store, err := getStore()
@@ -242,7 +440,7 @@ func DeleteWith(ctx context.Context, key string) error {
 }
 
 // WatchKey watches for changes on a specific key
-func WatchKey(key string) clientv3.WatchChan {
+func WatchKey(key string) WatchChan {
 	store, err := getStore()
 	if err != nil {
 		return nil
@@ -251,7 +449,7 @@ func WatchKey(key string) clientv3.WatchChan {
 }
 
 // WatchKeyWith watches for changes on a specific key with context
-func WatchKeyWith(ctx context.Context, key string) clientv3.WatchChan {
+func WatchKeyWith(ctx context.Context, key string) WatchChan {
 	store, err := getStore()
 	if err != nil {
 		return nil
@@ -260,7 +458,7 @@ func WatchKeyWith(ctx context.Context, key string) clientv3.WatchChan {
 }
 
 // WatchKeys watches for changes on keys with the given prefix
-func WatchKeys(keyPrefix string) clientv3.WatchChan {
+func WatchKeys(keyPrefix string) WatchChan {
 	store, err := getStore()
 	if err != nil {
 		return nil
@@ -269,7 +467,7 @@ func WatchKeys(keyPrefix string) clientv3.WatchChan {
 }
 
 // WatchKeysWith watches for changes on keys with the given prefix with context
-func WatchKeysWith(ctx context.Context, keyPrefix string) clientv3.WatchChan {
+func WatchKeysWith(ctx context.Context, keyPrefix string) WatchChan {
 	store, err := getStore()
 	if err != nil {
 		return nil
@@ -277,6 +475,120 @@ func WatchKeysWith(ctx context.Context, keyPrefix string) clientv3.WatchChan {
 	return store.WatchKeysWith(ctx, keyPrefix)
 }
 
+// GetRevisionedKv retrieves a key-value pair with its revision metadata
+func GetRevisionedKv(key string) (RevisionedKeyValue, error) {
+	store, err := getStore()
+	if err != nil {
+		return RevisionedKeyValue{}, err
+	}
+	return store.GetRevisionedKv(key)
+}
+
+// GetRevisionedKvWith retrieves a key-value pair with its revision metadata with context
+func GetRevisionedKvWith(ctx context.Context, key string) (RevisionedKeyValue, error) {
+	store, err := getStore()
+	if err != nil {
+		return RevisionedKeyValue{}, err
+	}
+	return store.GetRevisionedKvWith(ctx, key)
+}
+
+// Txn applies the operations atomically if all conditions are met
+func Txn(cmps []Compare, ops []Op) (TxnResponse, error) {
+	store, err := getStore()
+	if err != nil {
+		return TxnResponse{}, err
+	}
+	return store.Txn(cmps, ops)
+}
+
+// TxnWith applies the operations atomically if all conditions are met with context
+func TxnWith(ctx context.Context, cmps []Compare, ops []Op) (TxnResponse, error) {
+	store, err := getStore()
+	if err != nil {
+		return TxnResponse{}, err
+	}
+	return store.TxnWith(ctx, cmps, ops)
+}
+
+// CompareAndSwap puts a key-value pair if the key was last modified at the given revision (0 for a new key)
+func CompareAndSwap(key, value string, modRevision int64) (bool, error) {
+	store, err := getStore()
+	if err != nil {
+		return false, err
+	}
+	return store.CompareAndSwap(key, value, modRevision)
+}
+
+// CompareAndSwapWith puts a key-value pair if the key was last modified at the given revision (0 for a new key) with context
+func CompareAndSwapWith(ctx context.Context, key, value string, modRevision int64) (bool, error) {
+	store, err := getStore()
+	if err != nil {
+		return false, err
+	}
+	return store.CompareAndSwapWith(ctx, key, value, modRevision)
+}
+
+// maxTxnRetries is the maximum number of attempts of ReadModifyWrite
+const maxTxnRetries = 10
+
+// ReadModifyWrite reads the given keys, builds operations from their current values with the build function,
+// and applies them in a transaction that succeeds only if none of the keys were modified in the meantime.
+// On a conflict, it reads the keys again and retries, so concurrent updates do not overwrite each other.
+// The build function may be called several times and should not have side effects.
+// If the build function returns an error or no operations, nothing is applied.
+func ReadModifyWrite(ctx context.Context, keys []string, build func(current map[string]RevisionedKeyValue) ([]Op, error)) error {
+	store, err := getStore()
+	if err != nil {
+		return err
+	}
+	return ReadModifyWriteOn(ctx, store, keys, build)
+}
+
+// ReadModifyWriteOn is ReadModifyWrite on the given store instead of the global Store
+func ReadModifyWriteOn(ctx context.Context, store Store, keys []string, build func(current map[string]RevisionedKeyValue) ([]Op, error)) error {
+	for attempt := 1; attempt <= maxTxnRetries; attempt++ {
+		current := make(map[string]RevisionedKeyValue, len(keys))
+		cmps := make([]Compare, 0, len(keys))
+		for _, key := range keys {
+			if _, found := current[key]; found {
+				continue
+			}
+			rkv, err := store.GetRevisionedKvWith(ctx, key)
+			if err != nil {
+				return err
+			}
+			current[key] = rkv
+			cmps = append(cmps, CompareModRevision(key, rkv.ModRevision))
+		}
+
+		ops, err := build(current)
+		if err != nil {
+			return err
+		}
+		if len(ops) == 0 {
+			return nil
+		}
+
+		resp, err := store.TxnWith(ctx, cmps, ops)
+		if err != nil {
+			return err
+		}
+		if resp.Succeeded {
+			return nil
+		}
+
+		// back off with jitter before retrying
+		backoff := time.Duration(attempt*10+rand.Intn(20)) * time.Millisecond
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return fmt.Errorf("%w (keys: %v)", ErrTxnConflict, keys)
+}
+
 // Close closes the store
 func Close() error {
 	store, err := getStore()
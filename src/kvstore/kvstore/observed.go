@@ -0,0 +1,222 @@
+package kvstore
+
+import (
+	"context"
+	"time"
+)
+
+// ObserveFunc is called after each operation of an observed Store with the context of the operation
+// (context.Background() for the methods without a context), the operation name, its start time and error.
+type ObserveFunc func(ctx context.Context, op string, start time.Time, err error)
+
+// observedStore is a Store decorator that reports the latency of operations (e.g., for metrics and tracing).
+// Sessions, locks and watches are long-lived, so they are passed through without observation.
+type observedStore struct {
+	store   Store
+	observe ObserveFunc
+}
+
+// NewObservedStore wraps the store so that observe is called after each key-value operation.
+func NewObservedStore(store Store, observe ObserveFunc) Store {
+	return &observedStore{store: store, observe: observe}
+}
+
+func (s *observedStore) done(ctx context.Context, op string, start time.Time, err error) {
+	s.observe(ctx, op, start, err)
+}
+
+func (s *observedStore) NewSession(ctx context.Context) (Session, error) {
+	return s.store.NewSession(ctx)
+}
+
+func (s *observedStore) NewLock(ctx context.Context, session Session, lockKey string) (Lock, error) {
+	return s.store.NewLock(ctx, session, lockKey)
+}
+
+func (s *observedStore) Put(key, value string) error {
+	start := time.Now()
+	err := s.store.Put(key, value)
+	s.done(context.Background(), "put", start, err)
+	return err
+}
+
+func (s *observedStore) PutWith(ctx context.Context, key, value string) error {
+	start := time.Now()
+	err := s.store.PutWith(ctx, key, value)
+	s.done(ctx, "put", start, err)
+	return err
+}
+
+func (s *observedStore) Get(key string) (string, error) {
+	start := time.Now()
+	value, err := s.store.Get(key)
+	s.done(context.Background(), "get", start, err)
+	return value, err
+}
+
+func (s *observedStore) GetWith(ctx context.Context, key string) (string, error) {
+	start := time.Now()
+	value, err := s.store.GetWith(ctx, key)
+	s.done(ctx, "get", start, err)
+	return value, err
+}
+
+func (s *observedStore) GetList(keyPrefix string) ([]string, error) {
+	start := time.Now()
+	values, err := s.store.GetList(keyPrefix)
+	s.done(context.Background(), "getList", start, err)
+	return values, err
+}
+
+func (s *observedStore) GetListWith(ctx context.Context, keyPrefix string) ([]string, error) {
+	start := time.Now()
+	values, err := s.store.GetListWith(ctx, keyPrefix)
+	s.done(ctx, "getList", start, err)
+	return values, err
+}
+
+func (s *observedStore) GetKv(key string) (KeyValue, error) {
+	start := time.Now()
+	kv, err := s.store.GetKv(key)
+	s.done(context.Background(), "getKv", start, err)
+	return kv, err
+}
+
+func (s *observedStore) GetKvWith(ctx context.Context, key string) (KeyValue, error) {
+	start := time.Now()
+	kv, err := s.store.GetKvWith(ctx, key)
+	s.done(ctx, "getKv", start, err)
+	return kv, err
+}
+
+func (s *observedStore) GetKvList(keyPrefix string) ([]KeyValue, error) {
+	start := time.Now()
+	kvs, err := s.store.GetKvList(keyPrefix)
+	s.done(context.Background(), "getKvList", start, err)
+	return kvs, err
+}
+
+func (s *observedStore) GetKvListWith(ctx context.Context, keyPrefix string) ([]KeyValue, error) {
+	start := time.Now()
+	kvs, err := s.store.GetKvListWith(ctx, keyPrefix)
+	s.done(ctx, "getKvList", start, err)
+	return kvs, err
+}
+
+func (s *observedStore) GetSortedKvList(keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error) {
+	start := time.Now()
+	kvs, err := s.store.GetSortedKvList(keyPrefix, sortBy, order)
+	s.done(context.Background(), "getSortedKvList", start, err)
+	return kvs, err
+}
+
+func (s *observedStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy SortTarget, order SortOrder) ([]KeyValue, error) {
+	start := time.Now()
+	kvs, err := s.store.GetSortedKvListWith(ctx, keyPrefix, sortBy, order)
+	s.done(ctx, "getSortedKvList", start, err)
+	return kvs, err
+}
+
+func (s *observedStore) GetKvRange(startKey, endKey string, order SortOrder, limit int64) ([]KeyValue, error) {
+	start := time.Now()
+	kvs, err := s.store.GetKvRange(startKey, endKey, order, limit)
+	s.done(context.Background(), "getKvRange", start, err)
+	return kvs, err
+}
+
+func (s *observedStore) GetKvRangeWith(ctx context.Context, startKey, endKey string, order SortOrder, limit int64) ([]KeyValue, error) {
+	start := time.Now()
+	kvs, err := s.store.GetKvRangeWith(ctx, startKey, endKey, order, limit)
+	s.done(ctx, "getKvRange", start, err)
+	return kvs, err
+}
+
+func (s *observedStore) GetKvMap(keyPrefix string) (KeyValueMap, error) {
+	start := time.Now()
+	kvMap, err := s.store.GetKvMap(keyPrefix)
+	s.done(context.Background(), "getKvMap", start, err)
+	return kvMap, err
+}
+
+func (s *observedStore) GetKvMapWith(ctx context.Context, keyPrefix string) (KeyValueMap, error) {
+	start := time.Now()
+	kvMap, err := s.store.GetKvMapWith(ctx, keyPrefix)
+	s.done(ctx, "getKvMap", start, err)
+	return kvMap, err
+}
+
+func (s *observedStore) Delete(key string) error {
+	start := time.Now()
+	err := s.store.Delete(key)
+	s.done(context.Background(), "delete", start, err)
+	return err
+}
+
+func (s *observedStore) DeleteWith(ctx context.Context, key string) error {
+	start := time.Now()
+	err := s.store.DeleteWith(ctx, key)
+	s.done(ctx, "delete", start, err)
+	return err
+}
+
+func (s *observedStore) WatchKey(key string) WatchChan {
+	return s.store.WatchKey(key)
+}
+
+func (s *observedStore) WatchKeyWith(ctx context.Context, key string) WatchChan {
+	return s.store.WatchKeyWith(ctx, key)
+}
+
+func (s *observedStore) WatchKeys(keyPrefix string) WatchChan {
+	return s.store.WatchKeys(keyPrefix)
+}
+
+func (s *observedStore) WatchKeysWith(ctx context.Context, keyPrefix string) WatchChan {
+	return s.store.WatchKeysWith(ctx, keyPrefix)
+}
+
+func (s *observedStore) GetRevisionedKv(key string) (RevisionedKeyValue, error) {
+	start := time.Now()
+	rkv, err := s.store.GetRevisionedKv(key)
+	s.done(context.Background(), "getRevisionedKv", start, err)
+	return rkv, err
+}
+
+func (s *observedStore) GetRevisionedKvWith(ctx context.Context, key string) (RevisionedKeyValue, error) {
+	start := time.Now()
+	rkv, err := s.store.GetRevisionedKvWith(ctx, key)
+	s.done(ctx, "getRevisionedKv", start, err)
+	return rkv, err
+}
+
+func (s *observedStore) Txn(cmps []Compare, ops []Op) (TxnResponse, error) {
+	start := time.Now()
+	resp, err := s.store.Txn(cmps, ops)
+	s.done(context.Background(), "txn", start, err)
+	return resp, err
+}
+
+func (s *observedStore) TxnWith(ctx context.Context, cmps []Compare, ops []Op) (TxnResponse, error) {
+	start := time.Now()
+	resp, err := s.store.TxnWith(ctx, cmps, ops)
+	s.done(ctx, "txn", start, err)
+	return resp, err
+}
+
+func (s *observedStore) CompareAndSwap(key, value string, modRevision int64) (bool, error) {
+	start := time.Now()
+	swapped, err := s.store.CompareAndSwap(key, value, modRevision)
+	s.done(context.Background(), "compareAndSwap", start, err)
+	return swapped, err
+}
+
+func (s *observedStore) CompareAndSwapWith(ctx context.Context, key, value string, modRevision int64) (bool, error) {
+	start := time.Now()
+	swapped, err := s.store.CompareAndSwapWith(ctx, key, value, modRevision)
+	s.done(ctx, "compareAndSwap", start, err)
+	return swapped, err
+}
+
+func (s *observedStore) Close() error {
+	return s.store.Close()
+}
@@ -0,0 +1,32 @@
+package kvstoretest
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/stretchr/testify/require"
+)
+
+// globalStore is registered as the global Store of kvstore for the tests of packages using it (e.g., core/infra).
+// kvstore.InitializeStore takes effect only once in a process, so it forwards to the store of the running test.
+type globalStore struct {
+	kvstore.Store
+}
+
+var (
+	global         = &globalStore{}
+	initGlobalOnce sync.Once
+)
+
+// UseGlobalStore makes the store the global Store of kvstore (used by kvstore.Put, kvstore.Txn, etc.)
+// until the test ends, and closes the store when the test ends.
+// The tests using it must not run in parallel with each other.
+func UseGlobalStore(t *testing.T, store kvstore.Store) {
+	t.Helper()
+	initGlobalOnce.Do(func() {
+		require.NoError(t, kvstore.InitializeStore(global))
+	})
+	global.Store = store
+	t.Cleanup(func() { store.Close() })
+}
@@ -0,0 +1,103 @@
+package kvstoretest
+
+import (
+	"testing"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKeyValue(t *testing.T, store kvstore.Store) {
+	putAll(t, store, map[string]string{"p/1": "a", "p/2": "b", "p/10": "c", "q/1": "d"})
+	require.NoError(t, store.Put("p/2", "e"))
+	require.NoError(t, store.Delete("q/1"))
+	// deleting a key that does not exist is not an error
+	require.NoError(t, store.Delete("q/2"))
+
+	assertValues(t, store, map[string]string{"p/1": "a", "p/2": "e", "p/10": "c", "q/1": ""})
+	value, err := store.Get("q/1")
+	require.NoError(t, err)
+	assert.Empty(t, value)
+
+	cases := []struct {
+		name   string
+		prefix string
+		want   []kvstore.KeyValue
+	}{
+		{
+			name:   "prefix",
+			prefix: "p/",
+			want:   []kvstore.KeyValue{{Key: "p/1", Value: "a"}, {Key: "p/10", Value: "c"}, {Key: "p/2", Value: "e"}},
+		},
+		{
+			name:   "key as prefix",
+			prefix: "p/1",
+			want:   []kvstore.KeyValue{{Key: "p/1", Value: "a"}, {Key: "p/10", Value: "c"}},
+		},
+		{
+			name:   "no match",
+			prefix: "q/",
+			want:   []kvstore.KeyValue{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kvs, err := store.GetKvList(tc.prefix)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tc.want, kvs)
+
+			values, err := store.GetList(tc.prefix)
+			require.NoError(t, err)
+			wantValues := []string{}
+			wantMap := kvstore.KeyValueMap{}
+			for _, kv := range tc.want {
+				wantValues = append(wantValues, kv.Value)
+				wantMap[kv.Key] = kv.Value
+			}
+			assert.ElementsMatch(t, wantValues, values)
+
+			kvMap, err := store.GetKvMap(tc.prefix)
+			require.NoError(t, err)
+			assert.Equal(t, len(wantMap), len(kvMap))
+			for k, v := range wantMap {
+				assert.Equal(t, v, kvMap[k], "value of %s", k)
+			}
+		})
+	}
+}
+
+func testSortedKvList(t *testing.T, store kvstore.Store) {
+	// created in this order, and "s/b" is updated last
+	for _, kv := range []kvstore.KeyValue{{Key: "s/b", Value: "2"}, {Key: "s/c", Value: "1"}, {Key: "s/a", Value: "3"}} {
+		require.NoError(t, store.Put(kv.Key, kv.Value))
+	}
+	require.NoError(t, store.Put("s/b", "4"))
+
+	cases := []struct {
+		name   string
+		sortBy kvstore.SortTarget
+		order  kvstore.SortOrder
+		want   []string
+	}{
+		{name: "key ascend", sortBy: kvstore.SortByKey, order: kvstore.SortAscend, want: []string{"s/a", "s/b", "s/c"}},
+		{name: "key descend", sortBy: kvstore.SortByKey, order: kvstore.SortDescend, want: []string{"s/c", "s/b", "s/a"}},
+		{name: "value ascend", sortBy: kvstore.SortByValue, order: kvstore.SortAscend, want: []string{"s/c", "s/a", "s/b"}},
+		{name: "create revision ascend", sortBy: kvstore.SortByCreateRevision, order: kvstore.SortAscend, want: []string{"s/b", "s/c", "s/a"}},
+		{name: "mod revision descend", sortBy: kvstore.SortByModRevision, order: kvstore.SortDescend, want: []string{"s/b", "s/a", "s/c"}},
+		{name: "version descend", sortBy: kvstore.SortByVersion, order: kvstore.SortDescend, want: []string{"s/b"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kvs, err := store.GetSortedKvList("s/", tc.sortBy, tc.order)
+			require.NoError(t, err)
+			require.Len(t, kvs, 3)
+			keys := []string{}
+			for _, kv := range kvs {
+				keys = append(keys, kv.Key)
+			}
+			// keys of the same version are in any order
+			assert.Equal(t, tc.want, keys[:len(tc.want)])
+		})
+	}
+}
@@ -0,0 +1,65 @@
+// Package kvstoretest provides the conformance tests of kvstore.Store.
+// The tests of each backend (e.g., memory, bolt) run them on the stores created by the backend,
+// so that all backends keep the same semantics of transactions, revisions, watches and locks.
+package kvstoretest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitTimeout is the time to wait for an event or a lock that is expected to happen
+const waitTimeout = 5 * time.Second
+
+// blockTimeout is the time to wait for a lock that is expected to stay blocked
+const blockTimeout = 100 * time.Millisecond
+
+// NewStoreFunc creates an empty store for a test (the store is closed when the test ends)
+type NewStoreFunc func(t *testing.T) kvstore.Store
+
+// Run runs the conformance tests of kvstore.Store on the stores created by newStore
+func Run(t *testing.T, newStore NewStoreFunc) {
+	open := func(t *testing.T) kvstore.Store {
+		store := newStore(t)
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+	t.Run("KeyValue", func(t *testing.T) { testKeyValue(t, open(t)) })
+	t.Run("SortedKvList", func(t *testing.T) { testSortedKvList(t, open(t)) })
+	t.Run("Revision", func(t *testing.T) { testRevision(t, open(t)) })
+	t.Run("Txn", func(t *testing.T) { testTxn(t, open) })
+	t.Run("TxnLimit", func(t *testing.T) { testTxnLimit(t, open(t)) })
+	t.Run("CompareAndSwap", func(t *testing.T) { testCompareAndSwap(t, open) })
+	t.Run("ReadModifyWrite", func(t *testing.T) { testReadModifyWrite(t, open) })
+	t.Run("ReadModifyWriteConcurrent", func(t *testing.T) { testReadModifyWriteConcurrent(t, open(t)) })
+	t.Run("GetKvRange", func(t *testing.T) { testGetKvRange(t, open(t)) })
+	t.Run("Watch", func(t *testing.T) { testWatch(t, open) })
+	t.Run("Lock", func(t *testing.T) { testLock(t, open) })
+	t.Run("LockWaiter", func(t *testing.T) { testLockWaiter(t, open(t)) })
+}
+
+// putAll puts the key-value pairs
+func putAll(t *testing.T, store kvstore.Store, kvs map[string]string) {
+	t.Helper()
+	for k, v := range kvs {
+		require.NoError(t, store.Put(k, v))
+	}
+}
+
+// assertValues checks the values of the keys ("" for a key that must not exist)
+func assertValues(t *testing.T, store kvstore.Store, want map[string]string) {
+	t.Helper()
+	for k, v := range want {
+		kv, err := store.GetKv(k)
+		require.NoError(t, err)
+		if v == "" {
+			assert.Equal(t, kvstore.KeyValue{}, kv, "key %s must not exist", k)
+			continue
+		}
+		assert.Equal(t, v, kv.Value, "value of %s", k)
+	}
+}
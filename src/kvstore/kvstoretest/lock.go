@@ -0,0 +1,171 @@
+package kvstoretest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tryLock acquires the lock of the key with the session within the timeout
+func tryLock(store kvstore.Store, session kvstore.Session, key string, timeout time.Duration) (kvstore.Lock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return store.NewLock(ctx, session, key)
+}
+
+func testLock(t *testing.T, open NewStoreFunc) {
+	cases := []struct {
+		name string
+		// setup uses the lock of "lock/a" (or another key) with the first session
+		setup func(t *testing.T, store kvstore.Store, first kvstore.Session)
+		// acquired is whether the second session acquires the lock of "lock/a"
+		acquired bool
+	}{
+		{
+			name:     "free",
+			setup:    func(t *testing.T, store kvstore.Store, first kvstore.Session) {},
+			acquired: true,
+		},
+		{
+			name: "held by another session",
+			setup: func(t *testing.T, store kvstore.Store, first kvstore.Session) {
+				_, err := tryLock(store, first, "lock/a", waitTimeout)
+				require.NoError(t, err)
+			},
+			acquired: false,
+		},
+		{
+			name: "unlocked",
+			setup: func(t *testing.T, store kvstore.Store, first kvstore.Session) {
+				lock, err := tryLock(store, first, "lock/a", waitTimeout)
+				require.NoError(t, err)
+				require.NoError(t, lock.Unlock(context.Background()))
+			},
+			acquired: true,
+		},
+		{
+			name: "session of the holder closed",
+			setup: func(t *testing.T, store kvstore.Store, first kvstore.Session) {
+				_, err := tryLock(store, first, "lock/a", waitTimeout)
+				require.NoError(t, err)
+				require.NoError(t, first.Close())
+			},
+			acquired: true,
+		},
+		{
+			name: "another key held",
+			setup: func(t *testing.T, store kvstore.Store, first kvstore.Session) {
+				_, err := tryLock(store, first, "lock/b", waitTimeout)
+				require.NoError(t, err)
+			},
+			acquired: true,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := open(t)
+			first, err := store.NewSession(context.Background())
+			require.NoError(t, err)
+			defer first.Close()
+			second, err := store.NewSession(context.Background())
+			require.NoError(t, err)
+			defer second.Close()
+
+			tc.setup(t, store, first)
+			lock, err := tryLock(store, second, "lock/a", blockTimeout)
+			if !tc.acquired {
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, "lock/a", lock.Key())
+		})
+	}
+
+	t.Run("reentrant in a session", func(t *testing.T) {
+		store := open(t)
+		session, err := store.NewSession(context.Background())
+		require.NoError(t, err)
+		defer session.Close()
+		_, err = tryLock(store, session, "lock/a", waitTimeout)
+		require.NoError(t, err)
+		_, err = tryLock(store, session, "lock/a", blockTimeout)
+		assert.NoError(t, err)
+	})
+
+	t.Run("unlock by another session", func(t *testing.T) {
+		store := open(t)
+		first, err := store.NewSession(context.Background())
+		require.NoError(t, err)
+		defer first.Close()
+		second, err := store.NewSession(context.Background())
+		require.NoError(t, err)
+		defer second.Close()
+
+		firstLock, err := tryLock(store, first, "lock/a", waitTimeout)
+		require.NoError(t, err)
+		require.NoError(t, firstLock.Unlock(context.Background()))
+		_, err = tryLock(store, second, "lock/a", waitTimeout)
+		require.NoError(t, err)
+		// the lock released by the first session is now held by the second one
+		assert.Error(t, firstLock.Unlock(context.Background()))
+	})
+
+	t.Run("closed session", func(t *testing.T) {
+		store := open(t)
+		session, err := store.NewSession(context.Background())
+		require.NoError(t, err)
+		require.NoError(t, session.Close())
+		_, err = tryLock(store, session, "lock/a", waitTimeout)
+		assert.Error(t, err)
+	})
+
+	t.Run("session of a canceled context", func(t *testing.T) {
+		store := open(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		session, err := store.NewSession(ctx)
+		require.NoError(t, err)
+		cancel()
+		select {
+		case <-session.Done():
+		case <-time.After(waitTimeout):
+			require.FailNow(t, "session is not closed")
+		}
+	})
+}
+
+func testLockWaiter(t *testing.T, store kvstore.Store) {
+	first, err := store.NewSession(context.Background())
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := store.NewSession(context.Background())
+	require.NoError(t, err)
+	defer second.Close()
+
+	lock, err := tryLock(store, first, "lock/a", waitTimeout)
+	require.NoError(t, err)
+
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := tryLock(store, second, "lock/a", waitTimeout)
+		acquired <- err
+	}()
+	select {
+	case err := <-acquired:
+		require.FailNow(t, "lock is acquired while it is held", "err: %v", err)
+	case <-time.After(blockTimeout):
+	}
+
+	// the waiter acquires the lock as soon as it is released
+	require.NoError(t, lock.Unlock(context.Background()))
+	select {
+	case err := <-acquired:
+		assert.NoError(t, err)
+	case <-time.After(waitTimeout):
+		require.FailNow(t, "waiter does not acquire the released lock")
+	}
+}
@@ -0,0 +1,41 @@
+package kvstoretest
+
+import (
+	"testing"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testGetKvRange(t *testing.T, store kvstore.Store) {
+	putAll(t, store, map[string]string{"a/1": "1", "a/2": "2", "a/3": "3", "a/4": "4", "a/5": "5", "b/1": "6"})
+	cases := []struct {
+		name     string
+		startKey string
+		endKey   string
+		order    kvstore.SortOrder
+		limit    int64
+		want     []string
+	}{
+		{name: "ascend", startKey: "a/2", endKey: "a/4", order: kvstore.SortAscend, want: []string{"a/2", "a/3"}},
+		{name: "descend", startKey: "a/2", endKey: "a/4", order: kvstore.SortDescend, want: []string{"a/3", "a/2"}},
+		{name: "ascend with limit", startKey: "a/", endKey: "a0", order: kvstore.SortAscend, limit: 2, want: []string{"a/1", "a/2"}},
+		{name: "descend with limit", startKey: "a/", endKey: "a0", order: kvstore.SortDescend, limit: 2, want: []string{"a/5", "a/4"}},
+		{name: "no upper bound", startKey: "a/4", order: kvstore.SortAscend, want: []string{"a/4", "a/5", "b/1"}},
+		{name: "no upper bound descend", startKey: "a/4", order: kvstore.SortDescend, limit: 2, want: []string{"b/1", "a/5"}},
+		{name: "end key is exclusive", startKey: "a/5", endKey: "a/5", order: kvstore.SortAscend, want: []string{}},
+		{name: "end key between keys", startKey: "a/", endKey: "a/3a", order: kvstore.SortDescend, limit: 1, want: []string{"a/3"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			kvs, err := store.GetKvRange(tc.startKey, tc.endKey, tc.order, tc.limit)
+			require.NoError(t, err)
+			keys := []string{}
+			for _, kv := range kvs {
+				keys = append(keys, kv.Key)
+			}
+			assert.Equal(t, tc.want, keys)
+		})
+	}
+}
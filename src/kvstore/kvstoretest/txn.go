@@ -0,0 +1,399 @@
+package kvstoretest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// getAll returns the current records of the keys
+func getAll(t *testing.T, store kvstore.Store, keys ...string) map[string]kvstore.RevisionedKeyValue {
+	t.Helper()
+	current := map[string]kvstore.RevisionedKeyValue{}
+	for _, k := range keys {
+		rkv, err := store.GetRevisionedKv(k)
+		require.NoError(t, err)
+		current[k] = rkv
+	}
+	return current
+}
+
+func testRevision(t *testing.T, store kvstore.Store) {
+	rkv, err := store.GetRevisionedKv("a")
+	require.NoError(t, err)
+	assert.False(t, rkv.Exists())
+	assert.Zero(t, rkv.Version)
+
+	require.NoError(t, store.Put("a", "1"))
+	first, err := store.GetRevisionedKv("a")
+	require.NoError(t, err)
+	assert.True(t, first.Exists())
+	assert.Equal(t, int64(1), first.Version)
+	assert.Equal(t, first.CreateRevision, first.ModRevision)
+
+	require.NoError(t, store.Put("a", "2"))
+	second, err := store.GetRevisionedKv("a")
+	require.NoError(t, err)
+	assert.Equal(t, "2", second.Value)
+	assert.Equal(t, int64(2), second.Version)
+	assert.Equal(t, first.CreateRevision, second.CreateRevision)
+	assert.Greater(t, second.ModRevision, first.ModRevision)
+
+	// a key created again starts a new version history
+	require.NoError(t, store.Delete("a"))
+	rkv, err = store.GetRevisionedKv("a")
+	require.NoError(t, err)
+	assert.False(t, rkv.Exists())
+	require.NoError(t, store.Put("a", "3"))
+	third, err := store.GetRevisionedKv("a")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), third.Version)
+	assert.Greater(t, third.CreateRevision, second.ModRevision)
+}
+
+func testTxn(t *testing.T, open NewStoreFunc) {
+	cases := []struct {
+		name    string
+		initial map[string]string
+		// cmps builds the conditions from the current records of a, b, and p/1
+		cmps      func(current map[string]kvstore.RevisionedKeyValue) []kvstore.Compare
+		ops       []kvstore.Op
+		succeeded bool
+		want      map[string]string
+	}{
+		{
+			name:      "no conditions",
+			ops:       []kvstore.Op{kvstore.OpPut("a", "1"), kvstore.OpPut("b", "1")},
+			succeeded: true,
+			want:      map[string]string{"a": "1", "b": "1"},
+		},
+		{
+			name: "key does not exist",
+			cmps: func(current map[string]kvstore.RevisionedKeyValue) []kvstore.Compare {
+				return []kvstore.Compare{kvstore.CompareNotExist("a")}
+			},
+			ops:       []kvstore.Op{kvstore.OpPut("a", "1")},
+			succeeded: true,
+			want:      map[string]string{"a": "1"},
+		},
+		{
+			name:    "key exists",
+			initial: map[string]string{"a": "0"},
+			cmps: func(current map[string]kvstore.RevisionedKeyValue) []kvstore.Compare {
+				return []kvstore.Compare{kvstore.CompareNotExist("a")}
+			},
+			ops:       []kvstore.Op{kvstore.OpPut("a", "1"), kvstore.OpPut("b", "1")},
+			succeeded: false,
+			want:      map[string]string{"a": "0", "b": ""},
+		},
+		{
+			name:    "mod revision matches",
+			initial: map[string]string{"a": "0"},
+			cmps: func(current map[string]kvstore.RevisionedKeyValue) []kvstore.Compare {
+				return []kvstore.Compare{kvstore.CompareModRevision("a", current["a"].ModRevision)}
+			},
+			ops:       []kvstore.Op{kvstore.OpPut("a", "1")},
+			succeeded: true,
+			want:      map[string]string{"a": "1"},
+		},
+		{
+			name:    "mod revision does not match",
+			initial: map[string]string{"a": "0"},
+			cmps: func(current map[string]kvstore.RevisionedKeyValue) []kvstore.Compare {
+				return []kvstore.Compare{kvstore.CompareModRevision("a", current["a"].ModRevision+1)}
+			},
+			ops:       []kvstore.Op{kvstore.OpPut("a", "1")},
+			succeeded: false,
+			want:      map[string]string{"a": "0"},
+		},
+		{
+			name:    "one of the conditions is not met",
+			initial: map[string]string{"a": "0", "b": "0"},
+			cmps: func(current map[string]kvstore.RevisionedKeyValue) []kvstore.Compare {
+				return []kvstore.Compare{
+					kvstore.CompareModRevision("a", current["a"].ModRevision),
+					kvstore.CompareNotExist("b"),
+				}
+			},
+			ops:       []kvstore.Op{kvstore.OpPut("a", "1"), kvstore.OpDelete("b")},
+			succeeded: false,
+			want:      map[string]string{"a": "0", "b": "0"},
+		},
+		{
+			name:      "operations are applied in order",
+			initial:   map[string]string{"a": "0"},
+			ops:       []kvstore.Op{kvstore.OpPut("a", "1"), kvstore.OpDelete("a"), kvstore.OpPut("b", "1"), kvstore.OpPut("b", "2")},
+			succeeded: true,
+			want:      map[string]string{"a": "", "b": "2"},
+		},
+		{
+			name:      "delete prefix",
+			initial:   map[string]string{"p/1": "0", "p/2": "0", "q/1": "0"},
+			ops:       []kvstore.Op{kvstore.OpDeletePrefix("p/")},
+			succeeded: true,
+			want:      map[string]string{"p/1": "", "p/2": "", "q/1": "0"},
+		},
+		{
+			name:      "delete a key which does not exist",
+			ops:       []kvstore.Op{kvstore.OpDelete("a")},
+			succeeded: true,
+			want:      map[string]string{"a": ""},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := open(t)
+			putAll(t, store, tc.initial)
+			var cmps []kvstore.Compare
+			if tc.cmps != nil {
+				cmps = tc.cmps(getAll(t, store, "a", "b", "p/1"))
+			}
+
+			resp, err := store.Txn(cmps, tc.ops)
+			require.NoError(t, err)
+			assert.Equal(t, tc.succeeded, resp.Succeeded)
+			assertValues(t, store, tc.want)
+
+			// all operations of a transaction share the revision of the transaction
+			if tc.succeeded {
+				for _, op := range tc.ops {
+					if op.Type != kvstore.OpTypePut || tc.want[op.Key] == "" {
+						continue
+					}
+					rkv, err := store.GetRevisionedKv(op.Key)
+					require.NoError(t, err)
+					assert.Equal(t, resp.Revision, rkv.ModRevision, "revision of %s", op.Key)
+				}
+			}
+		})
+	}
+}
+
+func testTxnLimit(t *testing.T, store kvstore.Store) {
+	ops := func(n int) []kvstore.Op {
+		list := []kvstore.Op{}
+		for i := 0; i < n; i++ {
+			list = append(list, kvstore.OpPut("k/"+strconv.Itoa(i), "v"))
+		}
+		return list
+	}
+	cmps := func(n int) []kvstore.Compare {
+		list := []kvstore.Compare{}
+		for i := 0; i < n; i++ {
+			list = append(list, kvstore.CompareNotExist("c/"+strconv.Itoa(i)))
+		}
+		return list
+	}
+	cases := []struct {
+		name    string
+		cmps    []kvstore.Compare
+		ops     []kvstore.Op
+		wantErr error
+	}{
+		{name: "max operations", ops: ops(kvstore.MaxTxnOps)},
+		{name: "max conditions", cmps: cmps(kvstore.MaxTxnOps), ops: ops(1)},
+		{name: "too many operations", ops: ops(kvstore.MaxTxnOps + 1), wantErr: kvstore.ErrTooManyOps},
+		{name: "too many conditions", cmps: cmps(kvstore.MaxTxnOps + 1), ops: ops(1), wantErr: kvstore.ErrTooManyOps},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := store.Txn(tc.cmps, tc.ops)
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, resp.Succeeded)
+		})
+	}
+}
+
+func testCompareAndSwap(t *testing.T, open NewStoreFunc) {
+	cases := []struct {
+		name    string
+		initial map[string]string
+		// modRevision returns the revision to compare from the current record of the key
+		modRevision func(current kvstore.RevisionedKeyValue) int64
+		swapped     bool
+		want        string
+	}{
+		{
+			name:        "new key",
+			modRevision: func(current kvstore.RevisionedKeyValue) int64 { return 0 },
+			swapped:     true,
+			want:        "new",
+		},
+		{
+			name:        "new key which exists",
+			initial:     map[string]string{"a": "old"},
+			modRevision: func(current kvstore.RevisionedKeyValue) int64 { return 0 },
+			swapped:     false,
+			want:        "old",
+		},
+		{
+			name:        "current revision",
+			initial:     map[string]string{"a": "old"},
+			modRevision: func(current kvstore.RevisionedKeyValue) int64 { return current.ModRevision },
+			swapped:     true,
+			want:        "new",
+		},
+		{
+			name:        "stale revision",
+			initial:     map[string]string{"a": "old"},
+			modRevision: func(current kvstore.RevisionedKeyValue) int64 { return current.ModRevision - 1 },
+			swapped:     false,
+			want:        "old",
+		},
+		{
+			name:        "revision of a key which does not exist",
+			modRevision: func(current kvstore.RevisionedKeyValue) int64 { return 1 },
+			swapped:     false,
+			want:        "",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := open(t)
+			// another key makes the revision of "a" greater than 1
+			putAll(t, store, map[string]string{"other": "0"})
+			putAll(t, store, tc.initial)
+			current := getAll(t, store, "a")["a"]
+
+			swapped, err := store.CompareAndSwap("a", "new", tc.modRevision(current))
+			require.NoError(t, err)
+			assert.Equal(t, tc.swapped, swapped)
+			assertValues(t, store, map[string]string{"a": tc.want})
+		})
+	}
+}
+
+func testReadModifyWrite(t *testing.T, open NewStoreFunc) {
+	errBuild := errors.New("build failed")
+	cases := []struct {
+		name    string
+		initial map[string]string
+		// build is called with the store to simulate concurrent updates and the number of the call
+		build   func(store kvstore.Store, call int, current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error)
+		wantErr error
+		calls   int
+		want    map[string]string
+	}{
+		{
+			name:    "builds from the current values",
+			initial: map[string]string{"a": "1"},
+			build: func(store kvstore.Store, call int, current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+				if current["b"].Exists() {
+					return nil, fmt.Errorf("b must not exist")
+				}
+				return []kvstore.Op{kvstore.OpPut("b", current["a"].Value+"+b")}, nil
+			},
+			calls: 1,
+			want:  map[string]string{"a": "1", "b": "1+b"},
+		},
+		{
+			name:    "build error",
+			initial: map[string]string{"a": "1"},
+			build: func(store kvstore.Store, call int, current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+				return nil, errBuild
+			},
+			wantErr: errBuild,
+			calls:   1,
+			want:    map[string]string{"a": "1", "b": ""},
+		},
+		{
+			name:    "no operations",
+			initial: map[string]string{"a": "1"},
+			build: func(store kvstore.Store, call int, current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+				return nil, nil
+			},
+			calls: 1,
+			want:  map[string]string{"a": "1"},
+		},
+		{
+			name:    "retried on a concurrent update",
+			initial: map[string]string{"a": "1"},
+			build: func(store kvstore.Store, call int, current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+				if call == 1 {
+					// another writer updates the key after it is read
+					if err := store.Put("a", "2"); err != nil {
+						return nil, err
+					}
+				}
+				return []kvstore.Op{kvstore.OpPut("a", current["a"].Value+"+1")}, nil
+			},
+			calls: 2,
+			want:  map[string]string{"a": "2+1"},
+		},
+		{
+			name: "retried on a concurrent creation",
+			build: func(store kvstore.Store, call int, current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+				if call == 1 {
+					if err := store.Put("b", "other"); err != nil {
+						return nil, err
+					}
+				}
+				if current["b"].Exists() {
+					return nil, nil
+				}
+				return []kvstore.Op{kvstore.OpPut("b", "mine")}, nil
+			},
+			calls: 2,
+			want:  map[string]string{"b": "other"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := open(t)
+			putAll(t, store, tc.initial)
+			calls := 0
+			err := kvstore.ReadModifyWriteOn(context.Background(), store, []string{"a", "b"},
+				func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+					calls++
+					return tc.build(store, calls, current)
+				})
+			if tc.wantErr != nil {
+				assert.ErrorIs(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.calls, calls)
+			assertValues(t, store, tc.want)
+		})
+	}
+}
+
+func testReadModifyWriteConcurrent(t *testing.T, store kvstore.Store) {
+	const workers, increments = 8, 5
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*increments)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < increments; i++ {
+				errs <- kvstore.ReadModifyWriteOn(context.Background(), store, []string{"counter"},
+					func(current map[string]kvstore.RevisionedKeyValue) ([]kvstore.Op, error) {
+						n := 0
+						if current["counter"].Exists() {
+							n, _ = strconv.Atoi(current["counter"].Value)
+						}
+						return []kvstore.Op{kvstore.OpPut("counter", strconv.Itoa(n+1))}, nil
+					})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	// no increment is lost
+	assertValues(t, store, map[string]string{"counter": strconv.Itoa(workers * increments)})
+}
@@ -0,0 +1,149 @@
+package kvstoretest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiveEvents receives n events from the watch
+func receiveEvents(t *testing.T, ch kvstore.WatchChan, n int) []kvstore.Event {
+	t.Helper()
+	events := []kvstore.Event{}
+	timeout := time.After(waitTimeout)
+	for len(events) < n {
+		select {
+		case resp, ok := <-ch:
+			require.True(t, ok, "watch is closed after %d events", len(events))
+			require.NoError(t, resp.Err)
+			events = append(events, resp.Events...)
+		case <-timeout:
+			require.FailNow(t, "timed out", "received %d of %d events", len(events), n)
+		}
+	}
+	return events
+}
+
+// assertClosed checks that the watch is closed (pending events are discarded)
+func assertClosed(t *testing.T, ch kvstore.WatchChan) {
+	t.Helper()
+	timeout := time.After(waitTimeout)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			require.FailNow(t, "watch is not closed")
+		}
+	}
+}
+
+func testWatch(t *testing.T, open NewStoreFunc) {
+	type event struct {
+		Type  kvstore.EventType
+		Key   string
+		Value string
+	}
+	cases := []struct {
+		name   string
+		watch  func(store kvstore.Store) kvstore.WatchChan
+		update func(t *testing.T, store kvstore.Store)
+		want   []event
+	}{
+		{
+			name:  "key",
+			watch: func(store kvstore.Store) kvstore.WatchChan { return store.WatchKey("a") },
+			update: func(t *testing.T, store kvstore.Store) {
+				require.NoError(t, store.Put("a", "1"))
+				require.NoError(t, store.Put("ab", "1"))
+				require.NoError(t, store.Put("a", "2"))
+				require.NoError(t, store.Delete("a"))
+			},
+			want: []event{
+				{kvstore.EventTypePut, "a", "1"},
+				{kvstore.EventTypePut, "a", "2"},
+				{kvstore.EventTypeDelete, "a", ""},
+			},
+		},
+		{
+			name:  "prefix",
+			watch: func(store kvstore.Store) kvstore.WatchChan { return store.WatchKeys("p/") },
+			update: func(t *testing.T, store kvstore.Store) {
+				require.NoError(t, store.Put("p/1", "1"))
+				require.NoError(t, store.Put("q/1", "1"))
+				require.NoError(t, store.Put("p/2", "2"))
+			},
+			want: []event{
+				{kvstore.EventTypePut, "p/1", "1"},
+				{kvstore.EventTypePut, "p/2", "2"},
+			},
+		},
+		{
+			name:  "transaction",
+			watch: func(store kvstore.Store) kvstore.WatchChan { return store.WatchKeys("p/") },
+			update: func(t *testing.T, store kvstore.Store) {
+				require.NoError(t, store.Put("p/1", "1"))
+				resp, err := store.Txn(nil, []kvstore.Op{kvstore.OpPut("p/2", "2"), kvstore.OpDeletePrefix("p/1")})
+				require.NoError(t, err)
+				require.True(t, resp.Succeeded)
+			},
+			want: []event{
+				{kvstore.EventTypePut, "p/1", "1"},
+				{kvstore.EventTypePut, "p/2", "2"},
+				{kvstore.EventTypeDelete, "p/1", ""},
+			},
+		},
+		{
+			name:  "failed transaction",
+			watch: func(store kvstore.Store) kvstore.WatchChan { return store.WatchKeys("p/") },
+			update: func(t *testing.T, store kvstore.Store) {
+				resp, err := store.Txn([]kvstore.Compare{kvstore.CompareModRevision("p/0", 1)}, []kvstore.Op{kvstore.OpPut("p/1", "1")})
+				require.NoError(t, err)
+				require.False(t, resp.Succeeded)
+				require.NoError(t, store.Put("p/2", "2"))
+			},
+			want: []event{
+				{kvstore.EventTypePut, "p/2", "2"},
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := open(t)
+			ch := tc.watch(store)
+			tc.update(t, store)
+
+			events := receiveEvents(t, ch, len(tc.want))
+			got := []event{}
+			for _, ev := range events {
+				got = append(got, event{ev.Type, ev.Key, ev.Value})
+				assert.Positive(t, ev.ModRevision)
+			}
+			assert.Equal(t, tc.want, got)
+			for i := 1; i < len(events); i++ {
+				assert.LessOrEqual(t, events[i-1].ModRevision, events[i].ModRevision, "events are in revision order")
+			}
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		store := open(t)
+		ctx, cancel := context.WithCancel(context.Background())
+		ch := store.WatchKeyWith(ctx, "a")
+		cancel()
+		assertClosed(t, ch)
+	})
+
+	t.Run("store closed", func(t *testing.T) {
+		store := open(t)
+		ch := store.WatchKeys("")
+		require.NoError(t, store.Close())
+		assertClosed(t, ch)
+	})
+}
@@ -0,0 +1,368 @@
+// Package memory provides an in-memory implementation of kvstore.Store.
+// It keeps all key-value pairs in a process-local map, so data is lost when the process exits.
+// It is useful to run CB-Tumblebug or tests without an etcd cluster.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvlocal"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+)
+
+// MemoryStore represents an in-memory key-value store.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	data     map[string]kvlocal.Record
+	revision int64
+	closed   bool
+
+	ctx     context.Context
+	locks   *kvlocal.LockManager
+	watches *kvlocal.WatchHub
+}
+
+// NewMemoryStore creates a new instance of MemoryStore.
+func NewMemoryStore(ctx context.Context) (kvstore.Store, error) {
+	return &MemoryStore{
+		data:    make(map[string]kvlocal.Record),
+		ctx:     ctx,
+		locks:   kvlocal.NewLockManager(),
+		watches: kvlocal.NewWatchHub(),
+	}, nil
+}
+
+// checkAvailable returns an error if the ctx is done or the store is closed.
+// The caller must hold s.mu.
+func (s *MemoryStore) checkAvailable(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.closed {
+		return fmt.Errorf("store is closed")
+	}
+	return nil
+}
+
+// NewSession creates a new process-local session.
+// A session is needed for acquiring locks.
+func (s *MemoryStore) NewSession(ctx context.Context) (kvstore.Session, error) {
+	return s.locks.NewSession(ctx)
+}
+
+// NewLock acquires a lock on the given key and returns the lock.
+// It uses the provided session to ensure the lock's lifecycle is tied to the session.
+func (s *MemoryStore) NewLock(ctx context.Context, session kvstore.Session, lockKey string) (kvstore.Lock, error) {
+	return s.locks.NewLock(ctx, session, lockKey)
+}
+
+// Put stores a key-value pair.
+func (s *MemoryStore) Put(key, value string) error {
+	return s.PutWith(s.ctx, key, value)
+}
+
+// PutWith stores a key-value pair using the provided context.
+func (s *MemoryStore) PutWith(ctx context.Context, key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkAvailable(ctx); err != nil {
+		return fmt.Errorf("failed to put key-value: %w", err)
+	}
+
+	s.revision++
+	record, found := s.data[key]
+	if !found {
+		record.CreateRevision = s.revision
+	}
+	record.Value = value
+	record.ModRevision = s.revision
+	record.Version++
+	s.data[key] = record
+
+	s.watches.Notify(kvstore.Event{
+		Type:        kvstore.EventTypePut,
+		KeyValue:    kvstore.KeyValue{Key: key, Value: value},
+		ModRevision: s.revision,
+	})
+	return nil
+}
+
+// Get retrieves the value for a given key.
+func (s *MemoryStore) Get(key string) (string, error) {
+	return s.GetWith(s.ctx, key)
+}
+
+// GetWith retrieves the value for a given key using the provided context.
+// It returns an empty string if the key does not exist.
+func (s *MemoryStore) GetWith(ctx context.Context, key string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.checkAvailable(ctx); err != nil {
+		return "", fmt.Errorf("failed to get key: %w", err)
+	}
+	return s.data[key].Value, nil
+}
+
+// GetList retrieves multiple values for keys with the given keyPrefix.
+func (s *MemoryStore) GetList(keyPrefix string) ([]string, error) {
+	return s.GetListWith(s.ctx, keyPrefix)
+}
+
+// GetListWith retrieves multiple values for keys with the given keyPrefix using the provided context.
+func (s *MemoryStore) GetListWith(ctx context.Context, keyPrefix string) ([]string, error) {
+	entries, err := s.listEntries(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+	if err != nil {
+		return nil, err
+	}
+	values := []string{}
+	for _, e := range entries {
+		values = append(values, e.Value)
+	}
+	return values, nil
+}
+
+// GetKv retrieves a key-value pair.
+func (s *MemoryStore) GetKv(key string) (kvstore.KeyValue, error) {
+	return s.GetKvWith(s.ctx, key)
+}
+
+// GetKvWith retrieves a key-value pair using the provided context.
+// It returns an empty key-value pair if the key does not exist.
+func (s *MemoryStore) GetKvWith(ctx context.Context, key string) (kvstore.KeyValue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.checkAvailable(ctx); err != nil {
+		return kvstore.KeyValue{}, fmt.Errorf("failed to get key: %w", err)
+	}
+	record, found := s.data[key]
+	if !found {
+		return kvstore.KeyValue{}, nil
+	}
+	return kvstore.KeyValue{Key: key, Value: record.Value}, nil
+}
+
+// GetKvList retrieves multiple key-value pairs with the given keyPrefix.
+func (s *MemoryStore) GetKvList(keyPrefix string) ([]kvstore.KeyValue, error) {
+	return s.GetKvListWith(s.ctx, keyPrefix)
+}
+
+// GetKvListWith retrieves multiple key-value pairs with the given keyPrefix using the provided context.
+func (s *MemoryStore) GetKvListWith(ctx context.Context, keyPrefix string) ([]kvstore.KeyValue, error) {
+	return s.GetSortedKvListWith(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+}
+
+// GetSortedKvList retrieves multiple key-value pairs with the given keyPrefix, sortBy, and order.
+func (s *MemoryStore) GetSortedKvList(keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	return s.GetSortedKvListWith(s.ctx, keyPrefix, sortBy, order)
+}
+
+// GetSortedKvListWith retrieves multiple key-value pairs with the given keyPrefix, sortBy, and order using the provided context.
+func (s *MemoryStore) GetSortedKvListWith(ctx context.Context, keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvstore.KeyValue, error) {
+	entries, err := s.listEntries(ctx, keyPrefix, sortBy, order)
+	if err != nil {
+		return nil, err
+	}
+	return kvlocal.ToKeyValues(entries), nil
+}
+
+// GetKvRange retrieves key-value pairs of keys in [startKey, endKey) sorted by key (at most limit pairs; 0 for no limit).
+func (s *MemoryStore) GetKvRange(startKey, endKey string, order kvstore.SortOrder, limit int64) ([]kvstore.KeyValue, error) {
+	return s.GetKvRangeWith(s.ctx, startKey, endKey, order, limit)
+}
+
+// GetKvRangeWith retrieves key-value pairs of keys in [startKey, endKey) sorted by key using the provided context.
+func (s *MemoryStore) GetKvRangeWith(ctx context.Context, startKey, endKey string, order kvstore.SortOrder, limit int64) ([]kvstore.KeyValue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.checkAvailable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get range of keys: %w", err)
+	}
+	entries := []kvlocal.Entry{}
+	for key, record := range s.data {
+		if kvlocal.InRange(key, startKey, endKey) {
+			entries = append(entries, kvlocal.Entry{Key: key, Record: record})
+		}
+	}
+	kvlocal.SortEntries(entries, kvstore.SortByKey, order)
+	if limit > 0 && int64(len(entries)) > limit {
+		entries = entries[:limit]
+	}
+	return kvlocal.ToKeyValues(entries), nil
+}
+
+// GetKvMap retrieves multiple key-value pairs with the given keyPrefix.
+func (s *MemoryStore) GetKvMap(keyPrefix string) (kvstore.KeyValueMap, error) {
+	return s.GetKvMapWith(s.ctx, keyPrefix)
+}
+
+// GetKvMapWith retrieves multiple key-value pairs with the given keyPrefix using the provided context.
+func (s *MemoryStore) GetKvMapWith(ctx context.Context, keyPrefix string) (kvstore.KeyValueMap, error) {
+	entries, err := s.listEntries(ctx, keyPrefix, kvstore.SortByKey, kvstore.SortAscend)
+	if err != nil {
+		return nil, err
+	}
+	kvs := kvstore.KeyValueMap{}
+	for _, e := range entries {
+		kvs[e.Key] = e.Value
+	}
+	return kvs, nil
+}
+
+// listEntries returns the sorted entries of keys with the given keyPrefix.
+func (s *MemoryStore) listEntries(ctx context.Context, keyPrefix string, sortBy kvstore.SortTarget, order kvstore.SortOrder) ([]kvlocal.Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.checkAvailable(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get list with keyPrefix: %w", err)
+	}
+	entries := []kvlocal.Entry{}
+	for key, record := range s.data {
+		if kvlocal.HasKey(key, keyPrefix, true) {
+			entries = append(entries, kvlocal.Entry{Key: key, Record: record})
+		}
+	}
+	kvlocal.SortEntries(entries, sortBy, order)
+	return entries, nil
+}
+
+// Delete removes a key-value pair.
+func (s *MemoryStore) Delete(key string) error {
+	return s.DeleteWith(s.ctx, key)
+}
+
+// DeleteWith removes a key-value pair using the provided context.
+func (s *MemoryStore) DeleteWith(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkAvailable(ctx); err != nil {
+		return fmt.Errorf("failed to delete key: %w", err)
+	}
+	if _, found := s.data[key]; !found {
+		return nil
+	}
+
+	s.revision++
+	delete(s.data, key)
+
+	s.watches.Notify(kvstore.Event{
+		Type:        kvstore.EventTypeDelete,
+		KeyValue:    kvstore.KeyValue{Key: key},
+		ModRevision: s.revision,
+	})
+	return nil
+}
+
+// GetRevisionedKv retrieves a key-value pair with its revision metadata.
+func (s *MemoryStore) GetRevisionedKv(key string) (kvstore.RevisionedKeyValue, error) {
+	return s.GetRevisionedKvWith(s.ctx, key)
+}
+
+// GetRevisionedKvWith retrieves a key-value pair with its revision metadata using the provided context.
+// It returns an empty value with ModRevision 0 if the key does not exist.
+func (s *MemoryStore) GetRevisionedKvWith(ctx context.Context, key string) (kvstore.RevisionedKeyValue, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.checkAvailable(ctx); err != nil {
+		return kvstore.RevisionedKeyValue{}, fmt.Errorf("failed to get key: %w", err)
+	}
+	record, found := s.data[key]
+	if !found {
+		return kvstore.RevisionedKeyValue{KeyValue: kvstore.KeyValue{Key: key}}, nil
+	}
+	return kvlocal.ToRevisionedKeyValue(key, record), nil
+}
+
+// Txn applies the operations atomically if all conditions are met.
+func (s *MemoryStore) Txn(cmps []kvstore.Compare, ops []kvstore.Op) (kvstore.TxnResponse, error) {
+	return s.TxnWith(s.ctx, cmps, ops)
+}
+
+// TxnWith applies the operations atomically if all conditions are met using the provided context.
+func (s *MemoryStore) TxnWith(ctx context.Context, cmps []kvstore.Compare, ops []kvstore.Op) (kvstore.TxnResponse, error) {
+	if len(ops) > kvstore.MaxTxnOps || len(cmps) > kvstore.MaxTxnOps {
+		return kvstore.TxnResponse{}, kvstore.ErrTooManyOps
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.checkAvailable(ctx); err != nil {
+		return kvstore.TxnResponse{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	for _, cmp := range cmps {
+		if s.data[cmp.Key].ModRevision != cmp.ModRevision {
+			return kvstore.TxnResponse{Succeeded: false, Revision: s.revision}, nil
+		}
+	}
+
+	// All operations of a transaction share one revision, as in etcd.
+	revision := s.revision + 1
+	events := kvlocal.ApplyOps(ops, revision, func(keyPrefix string) []string {
+		keys := []string{}
+		for key := range s.data {
+			if kvlocal.HasKey(key, keyPrefix, true) {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}, func(key string) (kvlocal.Record, bool) {
+		record, found := s.data[key]
+		return record, found
+	}, func(key string, record kvlocal.Record, deleted bool) {
+		if deleted {
+			delete(s.data, key)
+		} else {
+			s.data[key] = record
+		}
+	})
+	if len(events) > 0 {
+		s.revision = revision
+		s.watches.Notify(events...)
+	}
+	return kvstore.TxnResponse{Succeeded: true, Revision: s.revision}, nil
+}
+
+// CompareAndSwap puts a key-value pair if the key was last modified at the given revision (0 for a new key).
+func (s *MemoryStore) CompareAndSwap(key, value string, modRevision int64) (bool, error) {
+	return s.CompareAndSwapWith(s.ctx, key, value, modRevision)
+}
+
+// CompareAndSwapWith puts a key-value pair if the key was last modified at the given revision (0 for a new key)
+// using the provided context.
+func (s *MemoryStore) CompareAndSwapWith(ctx context.Context, key, value string, modRevision int64) (bool, error) {
+	resp, err := s.TxnWith(ctx, []kvstore.Compare{kvstore.CompareModRevision(key, modRevision)}, []kvstore.Op{kvstore.OpPut(key, value)})
+	if err != nil {
+		return false, err
+	}
+	return resp.Succeeded, nil
+}
+
+// WatchKey watches for changes on the given key.
+func (s *MemoryStore) WatchKey(key string) kvstore.WatchChan {
+	return s.WatchKeyWith(s.ctx, key)
+}
+
+// WatchKeyWith watches for changes on the given key using the provided context.
+func (s *MemoryStore) WatchKeyWith(ctx context.Context, key string) kvstore.WatchChan {
+	return s.watches.Watch(ctx, key, false)
+}
+
+// WatchKeys watches for changes on keys with the given keyPrefix.
+func (s *MemoryStore) WatchKeys(keyPrefix string) kvstore.WatchChan {
+	return s.WatchKeysWith(s.ctx, keyPrefix)
+}
+
+// WatchKeysWith watches for changes on keys with the given keyPrefix using the provided context.
+func (s *MemoryStore) WatchKeysWith(ctx context.Context, keyPrefix string) kvstore.WatchChan {
+	return s.watches.Watch(ctx, keyPrefix, true)
+}
+
+// Close closes the store and stops all watches.
+func (s *MemoryStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.watches.Close()
+	return nil
+}
@@ -0,0 +1,18 @@
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstoretest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	kvstoretest.Run(t, func(t *testing.T) kvstore.Store {
+		store, err := NewMemoryStore(context.Background())
+		require.NoError(t, err)
+		return store
+	})
+}
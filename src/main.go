@@ -28,8 +28,10 @@ import (
 
 	"github.com/cloud-barista/cb-tumblebug/src/core/common/logger"
 	"github.com/cloud-barista/cb-tumblebug/src/core/model"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/bolt"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/etcd"
 	"github.com/cloud-barista/cb-tumblebug/src/kvstore/kvstore"
+	"github.com/cloud-barista/cb-tumblebug/src/kvstore/memory"
 	"github.com/rs/zerolog/log"
 
 	//_ "github.com/go-sql-driver/mysql"
@@ -59,12 +61,33 @@ func init() {
 	model.DBUser = common.NVL(os.Getenv("TB_SQLITE_USER"), "cb_tumblebug")
 	model.DBPassword = common.NVL(os.Getenv("TB_SQLITE_PASSWORD"), "cb_tumblebug")
 	model.AutocontrolDurationMs = common.NVL(os.Getenv("TB_AUTOCONTROL_DURATION_MS"), "10000")
+	model.ReconcileDurationMs = common.NVL(os.Getenv("TB_RECONCILE_DURATION_MS"), "60000")
+	model.JobRetentionHours = common.NVL(os.Getenv("TB_JOB_RETENTION_HOURS"), "72")
+	model.ShutdownTimeoutSec = common.NVL(os.Getenv("TB_SHUTDOWN_TIMEOUT_SEC"), "8")
+	model.OutboundTimeoutSec = common.NVL(os.Getenv("TB_OUTBOUND_TIMEOUT_SEC"), "600")
+	model.OutboundRetryMax = common.NVL(os.Getenv("TB_OUTBOUND_RETRY_MAX"), "3")
+	model.OutboundRetryWaitMs = common.NVL(os.Getenv("TB_OUTBOUND_RETRY_WAIT_MS"), "500")
+	model.OutboundRetryMaxWaitMs = common.NVL(os.Getenv("TB_OUTBOUND_RETRY_MAX_WAIT_MS"), "10000")
+	model.CircuitBreakerThreshold = common.NVL(os.Getenv("TB_CIRCUIT_BREAKER_THRESHOLD"), "5")
+	model.CircuitBreakerOpenSec = common.NVL(os.Getenv("TB_CIRCUIT_BREAKER_OPEN_SEC"), "30")
+	model.OtlpEndpoint = os.Getenv("TB_OTLP_ENDPOINT")
+	model.OtlpSamplingRatio = common.NVL(os.Getenv("TB_OTLP_SAMPLING_RATIO"), "1")
+	model.AuditEnabled = common.NVL(os.Getenv("TB_AUDIT_ENABLED"), "true")
+	model.AuditRetentionDays = common.NVL(os.Getenv("TB_AUDIT_RETENTION_DAYS"), "90")
 	model.DefaultNamespace = common.NVL(os.Getenv("TB_DEFAULT_NAMESPACE"), "default")
 	model.DefaultCredentialHolder = common.NVL(os.Getenv("TB_DEFAULT_CREDENTIALHOLDER"), "admin")
 
 	// Etcd
 	model.EtcdEndpoints = common.NVL(os.Getenv("TB_ETCD_ENDPOINTS"), "localhost:2379")
 
+	// kvstore backend (etcd, memory, or bolt)
+	model.KvStoreType = common.NVL(os.Getenv("TB_KVSTORE_TYPE"), "etcd")
+	model.KvStorePath = common.NVL(os.Getenv("TB_KVSTORE_PATH"), "../meta_db/dat/tumblebug.db")
+	model.SecretMasterKey = os.Getenv("TB_SECRET_MASTER_KEY")
+	model.SecretMasterKeyFile = os.Getenv("TB_SECRET_MASTER_KEY_FILE")
+	model.SecretMasterKeyPrevious = os.Getenv("TB_SECRET_MASTER_KEY_PREVIOUS")
+	model.SecretKmsPath = common.NVL(os.Getenv("TB_SECRET_KMS_PATH"), "../meta_db/kms/keyring.json")
+
 	// load the latest configuration from DB (if exist)
 
 	log.Info().Msg("[Update system environment]")
@@ -99,6 +122,9 @@ func init() {
 	// Set the global logger
 	log.Logger = *logger
 
+	// Initialize the tracer provider (OpenTelemetry)
+	common.InitTracing()
+
 	// load config
 	//masterConfigInfos = confighandler.GetMasterConfigInfos()
 
@@ -256,53 +282,31 @@ func setConfig() {
 		panic("Failed to confirm CB-Spider readiness within the allowed time. \nCheck the connection to CB-Spider.")
 	}
 
-	// Setup etcd and kvstore
-	var etcdAuthEnabled bool
-	var etcdUsername string
-	var etcdPassword string
-	etcdAuthEnabled = os.Getenv("TB_ETCD_AUTH_ENABLED") == "true"
-	if etcdAuthEnabled {
-		etcdUsername = os.Getenv("TB_ETCD_USERNAME")
-		etcdPassword = os.Getenv("TB_ETCD_PASSWORD")
-	}
-
-	etcdEndpoints := strings.Split(model.EtcdEndpoints, ",")
-
-	ctx := context.Background()
-	config := etcd.Config{
-		Endpoints:   etcdEndpoints,
-		DialTimeout: 5 * time.Second,
-	}
-	if etcdAuthEnabled && etcdUsername != "" && etcdPassword != "" {
-		config.Username = etcdUsername
-		config.Password = etcdPassword
-	}
-
-	// Wait until etcd is ready
-	var etcdStore kvstore.Store
-	var err2 error
-	etcdMaxAttempts := 10 // (50 sec)
-	etcdAttempt := 1
-	for ; etcdAttempt <= etcdMaxAttempts; etcdAttempt++ {
-		etcdStore, err2 = etcd.NewEtcdStore(ctx, config)
-		if err2 == nil {
-			log.Info().Msg("etcd is now available.")
-			break
-		}
-		log.Warn().Err(err2).Msgf("etcd at %s is not ready. Attempt %d/%d", model.EtcdEndpoints, etcdAttempt, maxAttempts)
-		time.Sleep(5 * time.Second)
-	}
-
+	// Setup kvstore
+	store, err2 := newKvStore()
 	if err2 != nil {
-		log.Fatal().Err(err2).Msg("failed to initialize etcd")
+		log.Fatal().Err(err2).Msgf("failed to initialize kvstore (%s)", model.KvStoreType)
 	}
 
-	err2 = kvstore.InitializeStore(etcdStore)
+	// Latency of kvstore operations is exported as metrics
+	err2 = kvstore.InitializeStore(kvstore.NewObservedStore(store, common.ObserveKvStoreOp))
 	if err2 != nil {
 		log.Fatal().Err(err2).Msg("")
 	}
 	log.Info().Msg("kvstore is initialized successfully. Initializing CB-Tumblebug...")
 
+	// Sensitive fields cannot be stored or read without the master key
+	// (with a shared kvstore, the instances cannot decrypt the values encrypted by the others)
+	if err := common.CheckSecretKeyring(); err != nil {
+		if common.IsSharedKvStore() {
+			log.Fatal().Err(err).Msg("shared master key for the sensitive fields is not available")
+		}
+		log.Error().Err(err).Msg("master key for the sensitive fields is not available")
+	}
+
+	// Jobs left unfinished by the previous process cannot be resumed
+	common.InterruptOrphanJobs()
+
 	// Register all cloud info
 	err = common.RegisterAllCloudInfo()
 	if err != nil {
@@ -369,6 +373,63 @@ func setConfig() {
 
 }
 
+// newKvStore creates the kvstore backend selected by TB_KVSTORE_TYPE
+func newKvStore() (kvstore.Store, error) {
+	ctx := context.Background()
+
+	switch model.KvStoreType {
+	case "memory":
+		log.Warn().Msg("kvstore is in-memory. All objects will be lost when CB-Tumblebug stops.")
+		return memory.NewMemoryStore(ctx)
+	case "bolt":
+		log.Info().Msgf("kvstore is an embedded database (%s)", model.KvStorePath)
+		return bolt.NewBoltStore(ctx, bolt.Config{
+			Path:    model.KvStorePath,
+			Timeout: 5 * time.Second,
+		})
+	case "etcd":
+		// continue to set up etcd below
+	default:
+		return nil, fmt.Errorf("unknown TB_KVSTORE_TYPE: %s (use etcd, memory, or bolt)", model.KvStoreType)
+	}
+
+	// Setup etcd
+	var etcdAuthEnabled bool
+	var etcdUsername string
+	var etcdPassword string
+	etcdAuthEnabled = os.Getenv("TB_ETCD_AUTH_ENABLED") == "true"
+	if etcdAuthEnabled {
+		etcdUsername = os.Getenv("TB_ETCD_USERNAME")
+		etcdPassword = os.Getenv("TB_ETCD_PASSWORD")
+	}
+
+	etcdEndpoints := strings.Split(model.EtcdEndpoints, ",")
+
+	config := etcd.Config{
+		Endpoints:   etcdEndpoints,
+		DialTimeout: 5 * time.Second,
+	}
+	if etcdAuthEnabled && etcdUsername != "" && etcdPassword != "" {
+		config.Username = etcdUsername
+		config.Password = etcdPassword
+	}
+
+	// Wait until etcd is ready
+	var etcdStore kvstore.Store
+	var err error
+	etcdMaxAttempts := 10 // (50 sec)
+	for etcdAttempt := 1; etcdAttempt <= etcdMaxAttempts; etcdAttempt++ {
+		etcdStore, err = etcd.NewEtcdStore(ctx, config)
+		if err == nil {
+			log.Info().Msg("etcd is now available.")
+			return etcdStore, nil
+		}
+		log.Warn().Err(err).Msgf("etcd at %s is not ready. Attempt %d/%d", model.EtcdEndpoints, etcdAttempt, etcdMaxAttempts)
+		time.Sleep(5 * time.Second)
+	}
+	return nil, err
+}
+
 // addIndexes adds indexes to the tables for faster search
 func addIndexes() error {
 
@@ -423,6 +484,12 @@ func addIndexes() error {
 // @description Type "Bearer" followed by a space and JWT token ([TBD] Get token in http://xxx.xxx.xxx.xxx:xxx/auth)
 func main() {
 
+	// Elect the leader among the Tumblebug instances sharing the kvstore.
+	// Only the leader runs the singleton background controllers below (e.g., to avoid double scale-outs by MCI policies).
+	leaderCtx, stopLeaderElection := context.WithCancel(context.Background())
+	go common.RunLeaderElection(leaderCtx)
+	defer stopLeaderElection()
+
 	//Ticker for MCI Orchestration Policy
 	log.Info().Msg("[Initiate Multi-Cloud Orchestration]")
 	autoControlDuration, _ := strconv.Atoi(model.AutocontrolDurationMs) //ms
@@ -432,11 +499,59 @@ func main() {
 			//display ticker if you need (remove '_ = t')
 			_ = t
 			//fmt.Println("- Orchestration Controller ", t.Format("2006-01-02 15:04:05"))
+			if !common.IsLeader() {
+				continue
+			}
+			// the shutdown waits for the scale-outs and scale-ins being done by the controller
+			done, ok := common.TrackBackgroundOperation()
+			if !ok {
+				continue
+			}
 			infra.OrchestrationController()
+			done()
 		}
 	}()
 	defer ticker.Stop()
 
+	// Ticker for reconciliation of MCIs to their desired status (disabled if the duration is 0)
+	reconcileDuration, _ := strconv.Atoi(model.ReconcileDurationMs) //ms
+	if reconcileDuration > 0 {
+		log.Info().Msg("[Initiate MCI Reconciliation]")
+		reconcileTicker := time.NewTicker(time.Millisecond * time.Duration(reconcileDuration))
+		go func() {
+			for range reconcileTicker.C {
+				if !common.IsLeader() {
+					continue
+				}
+				done, ok := common.TrackBackgroundOperation()
+				if !ok {
+					continue
+				}
+				infra.ReconcileController()
+				done()
+			}
+		}()
+		defer reconcileTicker.Stop()
+	}
+
+	// Ticker to clean up expired jobs, the jobs of stopped instances, and expired audit records
+	// (not drained at shutdown: the cleanup is idempotent and is done again by the next leader)
+	jobCleanupTicker := time.NewTicker(10 * time.Minute)
+	go func() {
+		for range jobCleanupTicker.C {
+			if !common.IsLeader() {
+				continue
+			}
+			common.CleanupJobs()
+			common.CleanupAudit()
+		}
+	}()
+	defer jobCleanupTicker.Stop()
+
+	// Start tracking the cost of existing VMs (VMs created before cost tracking are tracked from now)
+	go infra.InitVmCostTracking()
+
+	// the config file is local to each instance, so every instance watches it (regardless of the leadership)
 	go func() {
 		viper.WatchConfig()
 		viper.OnConfigChange(func(e fsnotify.Event) {
@@ -465,4 +580,9 @@ func main() {
 	}()
 
 	wg.Wait()
+
+	// Flush the remaining spans
+	if err := common.ShutdownTracing(context.Background()); err != nil {
+		log.Error().Err(err).Msg("failed to shut down the tracer provider")
+	}
 }